@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestAPI is the whole API on a fresh in-memory store with the catalog
+// the tests share: product p1 with variance 1, a 50kg bag with 10 on hand.
+func newTestAPI(t *testing.T) http.Handler {
+	t.Helper()
+	cfg := testConfig(t, map[string]string{})
+	r := setupRouter(cfg, newMemoryStore(cfg.Pricing).stores())
+
+	for _, step := range []struct{ path, body string }{
+		{"/brand/upsert", `{"name":"Holcim"}`},
+		{"/supplier/upsert", `{"name":"Acme Traders","status":"active"}`},
+		{"/products/insert", testProduct},
+		{"/variance/upsert", testVariance},
+	} {
+		if w, _ := serveJSON(t, r, http.MethodPost, step.path, step.body); w.Code != http.StatusOK {
+			t.Fatalf("POST %s = %d %s", step.path, w.Code, w.Body.String())
+		}
+	}
+	return r
+}
+
+const testProduct = `{"id":"p1","title":"Portland Cement","description":"Ordinary grey cement",
+	"department":"mainBuilding","main_catogory":"cement","sub_catogory":"ordinary portland"}`
+
+const testVariance = `{"productName":"Portland Cement","product_id":"p1","variance":"50kg bag","brand":"Holcim",
+	"supplier":"Acme Traders","original_price":1500,"wholesale_price":1600,"retail_price":1800,"quantity":10}`
+
+func TestAPI(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		code   string
+	}{
+		{name: "get product", method: http.MethodGet, path: "/products/get-product/p1", status: http.StatusOK},
+		{name: "unknown product", method: http.MethodGet, path: "/products/get-product/nope", status: http.StatusNotFound, code: CodeNotFound},
+		{name: "duplicate product", method: http.MethodPost, path: "/products/insert", body: testProduct, status: http.StatusConflict},
+		{name: "invalid product", method: http.MethodPost, path: "/products/insert", body: `{"id":"p2","department":"nowhere"}`,
+			status: http.StatusUnprocessableEntity, code: CodeValidation},
+		{name: "malformed json", method: http.MethodPost, path: "/products/insert", body: `{"id":`, status: http.StatusBadRequest},
+		{name: "list products", method: http.MethodGet, path: "/products", status: http.StatusOK},
+		{name: "last product", method: http.MethodGet, path: "/products/last-product", status: http.StatusOK},
+		{name: "update unknown product", method: http.MethodPut, path: "/products/update",
+			body: `{"id":"p9","title":"x","department":"mainBuilding","main_catogory":"sand"}`, status: http.StatusNotFound, code: CodeNotFound},
+		{name: "variances by product", method: http.MethodGet, path: "/variance/by-product/p1", status: http.StatusOK},
+		{name: "last variance", method: http.MethodGet, path: "/variance/last", status: http.StatusOK},
+		{name: "retail below wholesale", method: http.MethodPost, path: "/variance/upsert",
+			body:   `{"productName":"Portland Cement","product_id":"p1","variance":"25kg bag","brand":"Holcim","wholesale_price":900,"retail_price":800}`,
+			status: http.StatusUnprocessableEntity, code: CodeValidation},
+		{name: "receipt", method: http.MethodPost, path: "/inventory/movements", body: `{"variance_id":1,"kind":"receipt","quantity":5}`, status: http.StatusOK},
+		{name: "sale", method: http.MethodPost, path: "/inventory/movements", body: `{"variance_id":1,"kind":"sale","quantity":-4}`, status: http.StatusOK},
+		{name: "oversell", method: http.MethodPost, path: "/inventory/movements", body: `{"variance_id":1,"kind":"sale","quantity":-12}`,
+			status: http.StatusConflict, code: CodeInsufficientStock},
+		{name: "sale with the wrong sign", method: http.MethodPost, path: "/inventory/movements", body: `{"variance_id":1,"kind":"sale","quantity":4}`,
+			status: http.StatusUnprocessableEntity, code: CodeValidation},
+		{name: "movement of unknown variance", method: http.MethodPost, path: "/inventory/movements", body: `{"variance_id":99,"kind":"receipt","quantity":1}`,
+			status: http.StatusNotFound, code: CodeNotFound},
+		{name: "stock level", method: http.MethodGet, path: "/inventory/variance/1", status: http.StatusOK},
+		{name: "stock by product", method: http.MethodGet, path: "/inventory/by-product/p1", status: http.StatusOK},
+		{name: "list movements", method: http.MethodGet, path: "/inventory/movements?kind=sale", status: http.StatusOK},
+		{name: "unknown route", method: http.MethodGet, path: "/nowhere", status: http.StatusNotFound, code: CodeRouteNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestAPI(t)
+			// Every case runs against 11 on hand, after a receipt and a sale
+			serveJSON(t, r, http.MethodPost, "/inventory/movements", `{"variance_id":1,"kind":"receipt","quantity":5}`)
+			serveJSON(t, r, http.MethodPost, "/inventory/movements", `{"variance_id":1,"kind":"sale","quantity":-4}`)
+
+			var body any
+			if tt.body != "" {
+				body = tt.body
+			}
+			w, env := serveJSON(t, r, tt.method, tt.path, body)
+			if w.Code != tt.status {
+				t.Fatalf("%s %s = %d, want %d: %s", tt.method, tt.path, w.Code, tt.status, w.Body.String())
+			}
+			if env.Success != (tt.status == http.StatusOK) {
+				t.Errorf("success = %v for status %d", env.Success, w.Code)
+			}
+			if tt.code != "" && (env.Error == nil || env.Error.Code != tt.code) {
+				t.Errorf("error = %+v, want code %s", env.Error, tt.code)
+			}
+		})
+	}
+}
+
+func TestStockFollowsTheLedger(t *testing.T) {
+	r := newTestAPI(t)
+	movements := []struct {
+		body    string
+		balance float64
+	}{
+		{`{"variance_id":1,"kind":"receipt","quantity":5}`, 15},
+		{`{"variance_id":1,"kind":"sale","quantity":-3}`, 12},
+		{`{"variance_id":1,"kind":"adjustment","reason":"damage","quantity":-2}`, 10},
+		{`{"variance_id":1,"kind":"return","quantity":1}`, 11},
+	}
+	for _, m := range movements {
+		w, env := serveJSON(t, r, http.MethodPost, "/inventory/movements", m.body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("POST %s = %d %s", m.body, w.Code, w.Body.String())
+		}
+		var mv StockMovement
+		decodeData(t, env, &mv)
+		if mv.BalanceAfter != m.balance {
+			t.Errorf("%s: balance_after = %v, want %v", m.body, mv.BalanceAfter, m.balance)
+		}
+	}
+
+	_, env := serveJSON(t, r, http.MethodGet, "/inventory/variance/1", nil)
+	var level StockLevel
+	decodeData(t, env, &level)
+	if level.OnHand != 11 || level.Available != 11 {
+		t.Errorf("stock = %+v, want 11 on hand and available", level)
+	}
+
+	// A count on upsert records the difference, and upserting matches the
+	// existing variance rather than adding one
+	w, env := serveJSON(t, r, http.MethodPost, "/variance/upsert", testVariance)
+	if w.Code != http.StatusOK {
+		t.Fatalf("upsert = %d %s", w.Code, w.Body.String())
+	}
+	var v Variance
+	decodeData(t, env, &v)
+	if v.ID != 1 {
+		t.Errorf("upsert id = %d, want 1", v.ID)
+	}
+	_, env = serveJSON(t, r, http.MethodGet, "/inventory/movements?variance_id=1&kind=adjustment", nil)
+	var counts []StockMovement
+	decodeData(t, env, &counts)
+	if len(counts) != 3 || counts[0].Quantity != -1 || counts[0].Reason != reasonCount {
+		t.Errorf("adjustments = %+v, want the count of -1 newest first", counts)
+	}
+}
+
+func TestVariancesByProductPaginates(t *testing.T) {
+	r := newTestAPI(t)
+	for i := range 4 {
+		body := fmt.Sprintf(`{"productName":"Portland Cement","product_id":"p1","variance":"%dkg bag","brand":"Holcim","retail_price":100}`, i+1)
+		if w, _ := serveJSON(t, r, http.MethodPost, "/variance/upsert", body); w.Code != http.StatusOK {
+			t.Fatalf("upsert = %d %s", w.Code, w.Body.String())
+		}
+	}
+
+	_, env := serveJSON(t, r, http.MethodGet, "/variance/by-product/p1?limit=2", nil)
+	var page []Variance
+	decodeData(t, env, &page)
+	if env.Meta.Total != 5 || len(page) != 2 || page[0].ID != 5 {
+		t.Errorf("first page = %d of %d starting at %+v, want 2 of 5 from id 5", len(page), env.Meta.Total, page)
+	}
+}
+
+func TestActor(t *testing.T) {
+	tests := []struct {
+		name   string
+		auth   string
+		header string
+		want   string
+	}{
+		{name: "basic auth", auth: "foo", header: "mallory", want: "foo"},
+		{name: "X-User only", header: "mallory", want: "unauthenticated (mallory)"},
+		{name: "nobody", want: "unauthenticated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/variance/upsert", nil)
+			if tt.header != "" {
+				c.Request.Header.Set("X-User", tt.header)
+			}
+			if tt.auth != "" {
+				c.Set(gin.AuthUserKey, tt.auth)
+			}
+			if got := actor(c); got != tt.want {
+				t.Errorf("actor = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Without basic auth, the ledger and the price history mark the name X-User
+// claims as unauthenticated.
+func TestChangesDoNotTrustXUser(t *testing.T) {
+	r := newTestAPI(t)
+	post := func(path, body string) testEnvelope {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User", "admin")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("POST %s = %d %s", path, w.Code, w.Body.String())
+		}
+		var env testEnvelope
+		if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+			t.Fatal(err)
+		}
+		return env
+	}
+
+	var mv StockMovement
+	decodeData(t, post("/inventory/movements", `{"variance_id":1,"kind":"receipt","quantity":5}`), &mv)
+	if mv.CreatedBy != "unauthenticated (admin)" {
+		t.Errorf("movement created_by = %q, want unauthenticated (admin)", mv.CreatedBy)
+	}
+
+	post("/variance/upsert", strings.Replace(testVariance, `"retail_price":1800`, `"retail_price":1900`, 1))
+	_, env := serveJSON(t, r, http.MethodGet, "/variance/price-history/1", nil)
+	var history []PriceHistory
+	decodeData(t, env, &history)
+	if len(history) != 1 || history[0].ChangedBy != "unauthenticated (admin)" {
+		t.Errorf("history = %+v, want one change by unauthenticated (admin)", history)
+	}
+}
+
+// With accounts configured, changing a price needs basic auth, and the
+// history names the account that made the change.
+func TestPriceChangesNeedAuth(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"BASIC_AUTH_ACCOUNTS": "foo:bar"})
+	r := setupRouter(cfg, newMemoryStore(cfg.Pricing).stores())
+	serve := func(method, path, body string, auth bool) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User", "mallory")
+		if auth {
+			req.SetBasicAuth("foo", "bar")
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	for _, step := range []struct{ path, body string }{
+		{"/brand/upsert", `{"name":"Holcim"}`},
+		{"/products/insert", testProduct},
+	} {
+		if w := serve(http.MethodPost, step.path, step.body, false); w.Code != http.StatusOK {
+			t.Fatalf("POST %s = %d %s", step.path, w.Code, w.Body.String())
+		}
+	}
+
+	priceChanges := []struct{ method, path, body string }{
+		{http.MethodPost, "/variance/upsert", testVariance},
+		{http.MethodPost, "/variance/scheduled-prices", `{"variance_id":1,"retail_price":"1950","effective_at":"2099-01-01T00:00:00Z"}`},
+		{http.MethodPost, "/variance/scheduled-prices/1/cancel", ""},
+		{http.MethodPost, "/purchase-orders/1/receive", `{"lines":[{"variance_id":1,"quantity":1}]}`},
+		{http.MethodPut, "/price-lists/retail/prices/1", `{"tiers":[{"min_quantity":1,"price":"1700"}]}`},
+	}
+	for _, route := range priceChanges {
+		if w := serve(route.method, route.path, route.body, false); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s without auth = %d, want 401", route.method, route.path, w.Code)
+		}
+	}
+
+	if w := serve(http.MethodPost, "/variance/upsert", testVariance, true); w.Code != http.StatusOK {
+		t.Fatalf("upsert as foo = %d %s", w.Code, w.Body.String())
+	}
+	body := strings.Replace(testVariance, `"retail_price":1800`, `"retail_price":1900`, 1)
+	if w := serve(http.MethodPost, "/variance/upsert", body, true); w.Code != http.StatusOK {
+		t.Fatalf("upsert as foo = %d %s", w.Code, w.Body.String())
+	}
+	_, env := serveJSON(t, r, http.MethodGet, "/variance/price-history/1", nil)
+	var history []PriceHistory
+	decodeData(t, env, &history)
+	if len(history) != 1 || history[0].ChangedBy != "foo" {
+		t.Errorf("history = %+v, want one change by foo", history)
+	}
+}
+
+// Prices are stored as given, so a variance or scheduled price in any
+// currency other than the base one is turned away rather than relabelled.
+func TestPricesMustBeInBaseCurrency(t *testing.T) {
+	r := newTestAPI(t)
+	tests := []struct {
+		name, path, body string
+		want             int
+	}{
+		{"variance in base", "/variance/upsert", strings.Replace(testVariance, `"quantity":10`, `"currency":"LKR"`, 1), http.StatusOK},
+		{"variance in USD", "/variance/upsert", strings.Replace(testVariance, `"quantity":10`, `"currency":"USD"`, 1), http.StatusBadRequest},
+		{"scheduled in USD", "/variance/scheduled-prices",
+			`{"variance_id":1,"retail_price":"6","currency":"USD","effective_at":"2099-01-01T00:00:00Z"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, env := serveJSON(t, r, http.MethodPost, tt.path, tt.body)
+			if w.Code != tt.want {
+				t.Fatalf("POST %s = %d %s, want %d", tt.path, w.Code, w.Body.String(), tt.want)
+			}
+			if tt.want == http.StatusBadRequest && env.Error.Code != CodeBadRequest {
+				t.Errorf("error code = %s, want %s", env.Error.Code, CodeBadRequest)
+			}
+		})
+	}
+
+	_, env := serveJSON(t, r, http.MethodGet, "/variance/price-history/1", nil)
+	var history []PriceHistory
+	decodeData(t, env, &history)
+	if len(history) != 0 {
+		t.Errorf("rejected prices left history %+v", history)
+	}
+
+	snapshot := catalogSnapshot{Variances: []Variance{{ProductName: "Cement", VarianceTitle: "50kg", Currency: "USD"}}}
+	if err := snapshot.checkCurrency("LKR"); err == nil {
+		t.Error("importing a snapshot priced in USD into LKR: no error")
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+//! ============================================================================ //
+//? ============================ 🏷️ BARCODES 🏷️ ================================ //
+//! ============================================================================ //
+
+// gtinCheckDigit computes the GS1 check digit for the digits of an EAN-8,
+// UPC-A, EAN-13 or GTIN-14 code without its final digit.
+func gtinCheckDigit(body string) int {
+	sum := 0
+	// Weights alternate 3,1,3,... starting from the rightmost digit.
+	for i := len(body) - 1; i >= 0; i-- {
+		d := int(body[i] - '0')
+		if (len(body)-1-i)%2 == 0 {
+			d *= 3
+		}
+		sum += d
+	}
+	return (10 - sum%10) % 10
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//! ============================================================================ //
+//? ======================== 🛠️ SUBCOMMANDS 🛠️ ================================= //
+//! ============================================================================ //
+
+// command is one subcommand of the binary, e.g. "app seed --products 500".
+type command struct {
+	name  string
+	usage string
+	run   func(cfg *Config, args []string) error
+}
+
+func commands() []command {
+	return []command{
+		{"serve", "serve                         run the HTTP API (default)", runServe},
+		{"migrate", "migrate up|down|status [n]    apply or roll back schema migrations", runMigrate},
+		{"seed", "seed [--products N --seed S]  fill the catalog with reproducible fake data", runSeed},
+		{"export", "export [--out FILE]           write the catalog as JSON (stdout by default)", runExport},
+		{"import", "import [--in FILE]            upsert a catalog written by export (stdin by default)", runImport},
+		{"import-rates", "import-rates [--in FILE]      upsert exchange rates from a JSON file (stdin by default)", runImportRates},
+	}
+}
+
+// runCLI dispatches args (os.Args[1:]) to a subcommand. With no arguments
+// the server starts, which keeps "./app" working as Render's start command.
+func runCLI(args []string) error {
+	name := "serve"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage(os.Stdout)
+		return nil
+	}
+
+	for _, cmd := range commands() {
+		if cmd.name != name {
+			continue
+		}
+		cfg, err := loadConfig(os.LookupEnv)
+		if err != nil {
+			return fmt.Errorf("invalid configuration: %w", err)
+		}
+		if err := cmd.run(cfg, args); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return nil
+	}
+
+	printUsage(os.Stderr)
+	return fmt.Errorf("unknown command %q", name)
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: app <command> [flags]")
+	fmt.Fprintln(w)
+	for _, cmd := range commands() {
+		fmt.Fprintln(w, "  "+cmd.usage)
+	}
+}
+
+// newFlagSet returns a flag set that reports errors instead of exiting.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
+
+// persistentStores opens the configured stores for commands whose work would
+// be pointless against the in-memory store.
+func persistentStores(cfg *Config) (Stores, func(), error) {
+	if cfg.Store == storeMemory {
+		return Stores{}, nil, errors.New("needs STORE=postgres, the in-memory store is discarded on exit")
+	}
+	return openStores(cfg)
+}
+
+func runServe(cfg *Config, args []string) error {
+	if err := newFlagSet("serve").Parse(args); err != nil {
+		return err
+	}
+
+	message := Hello("Models imported 🐳")
+	fmt.Println(message)
+
+	stores, closeStores, err := openStores(cfg)
+	if err != nil {
+		return fmt.Errorf("database unavailable: %w", err)
+	}
+	defer closeStores()
+
+	// Both are process wide, so they are set once here rather than in
+	// setupRouter, which tests call for every router they build
+	gin.SetMode(cfg.GinMode)
+	registerValidators()
+	return serve(cfg, setupRouter(cfg, stores), backgroundJobs(cfg, stores))
+}
+
+func runSeed(cfg *Config, args []string) error {
+	fs := newFlagSet("seed")
+	var opts seedOptions
+	fs.IntVar(&opts.Products, "products", 50, "number of products to create")
+	fs.IntVar(&opts.Brands, "brands", 12, "number of brands to create")
+	fs.IntVar(&opts.Suppliers, "suppliers", 6, "number of suppliers to create")
+	fs.IntVar(&opts.MaxVariances, "variances", 3, "maximum variances per product")
+	fs.Int64Var(&opts.Seed, "seed", 0, "random seed; the same seed reproduces the same catalog (0 = random)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if opts.Products < 1 || opts.Brands < 1 || opts.Suppliers < 1 || opts.MaxVariances < 1 {
+		return errors.New("--products, --brands, --suppliers and --variances must be at least 1")
+	}
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+
+	stores, closeStores, err := persistentStores(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStores()
+
+	return seedCatalog(context.Background(), stores, opts)
+}
+
+func runExport(cfg *Config, args []string) error {
+	fs := newFlagSet("export")
+	out := fs.String("out", "", "file to write (default stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	stores, closeStores, err := persistentStores(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStores()
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	snapshot, err := exportCatalog(context.Background(), stores)
+	if err != nil {
+		return err
+	}
+	if err := snapshot.write(w); err != nil {
+		return err
+	}
+	log.Printf("📦 exported %d brands, %d suppliers, %d products, %d variances",
+		len(snapshot.Brands), len(snapshot.Suppliers), len(snapshot.Products), len(snapshot.Variances))
+	return nil
+}
+
+func runImport(cfg *Config, args []string) error {
+	fs := newFlagSet("import")
+	in := fs.String("in", "", "file to read (default stdin)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	r := io.Reader(os.Stdin)
+	if *in != "" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	snapshot, err := readCatalogSnapshot(r)
+	if err != nil {
+		return err
+	}
+	if err := snapshot.checkCurrency(cfg.Pricing.Currency); err != nil {
+		return err
+	}
+
+	stores, closeStores, err := persistentStores(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStores()
+
+	alerts := newAlerter(cfg, stores)
+	defer alerts.wait()
+	if err := importCatalog(context.Background(), stores, snapshot, alerts); err != nil {
+		return err
+	}
+	log.Printf("📦 imported %d brands, %d suppliers, %d products, %d variances",
+		len(snapshot.Brands), len(snapshot.Suppliers), len(snapshot.Products), len(snapshot.Variances))
+	return nil
+}
+
+func runImportRates(cfg *Config, args []string) error {
+	fs := newFlagSet("import-rates")
+	in := fs.String("in", "", "file to read (default stdin)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	r := io.Reader(os.Stdin)
+	if *in != "" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	imp, err := readExchangeRates(r)
+	if err != nil {
+		return err
+	}
+	if err := imp.prepare(cfg.Pricing.Currency, "import", time.Now()); err != nil {
+		return err
+	}
+
+	stores, closeStores, err := persistentStores(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStores()
+
+	if _, err := stores.ExchangeRates.UpsertExchangeRates(context.Background(), imp.Rates); err != nil {
+		return err
+	}
+	log.Printf("💱 imported %d exchange rates", len(imp.Rates))
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunCLIRejectsUnknownCommands(t *testing.T) {
+	err := runCLI([]string{"frobnicate"})
+	if err == nil || !strings.Contains(err.Error(), `unknown command "frobnicate"`) {
+		t.Errorf("err = %v, want unknown command", err)
+	}
+	if err := runCLI([]string{"help"}); err != nil {
+		t.Errorf("help: %v", err)
+	}
+}
+
+// The in-memory store is thrown away on exit, so commands that only change
+// or read stored data refuse it instead of quietly doing nothing.
+func TestCommandsNeedPostgres(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, body string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	catalog := write("catalog.json", `{"brands":[],"suppliers":[],"products":[],"variances":[]}`)
+	rates := write("rates.json", `{"rates":[{"currency":"USD","rate":"0.0033"}]}`)
+
+	cfg := testConfig(t, map[string]string{})
+	tests := map[string][]string{
+		"migrate":      {"up"},
+		"seed":         {"--products", "1"},
+		"export":       {"--out", filepath.Join(dir, "out.json")},
+		"import":       {"--in", catalog},
+		"import-rates": {"--in", rates},
+	}
+	for _, cmd := range commands() {
+		args, ok := tests[cmd.name]
+		if !ok {
+			continue
+		}
+		t.Run(cmd.name, func(t *testing.T) {
+			err := cmd.run(cfg, args)
+			if err == nil || !strings.Contains(err.Error(), "STORE=postgres") {
+				t.Errorf("err = %v, want a refusal of the memory store", err)
+			}
+		})
+	}
+}
+
+func TestSeedFlags(t *testing.T) {
+	cfg := testConfig(t, map[string]string{})
+	for _, args := range [][]string{{"--products", "0"}, {"--variances", "-1"}, {"--colour", "red"}} {
+		if err := runSeed(cfg, args); err == nil {
+			t.Errorf("seed %v: no error", args)
+		}
+	}
+}
+
+// What export writes, import reads back into an empty store unchanged.
+func TestExportImportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	pricing := defaultConfig().Pricing
+	from := newMemoryStore(pricing).stores()
+	if err := seedCatalog(ctx, from, seedOptions{Seed: 7, Products: 8, Brands: 4, Suppliers: 3, MaxVariances: 3}); err != nil {
+		t.Fatal(err)
+	}
+	exported, err := exportCatalog(ctx, from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file bytes.Buffer
+	if err := exported.write(&file); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := readCatalogSnapshot(&file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := read.checkCurrency(pricing.Currency); err != nil {
+		t.Fatal(err)
+	}
+	to := newMemoryStore(pricing).stores()
+	if err := importCatalog(ctx, to, read, nil); err != nil {
+		t.Fatal(err)
+	}
+	again, err := exportCatalog(ctx, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(again.Brands) != len(exported.Brands) || len(again.Suppliers) != len(exported.Suppliers) ||
+		len(again.Products) != len(exported.Products) || len(again.Variances) != len(exported.Variances) {
+		t.Fatalf("re-exported %d/%d/%d/%d brands/suppliers/products/variances, want %d/%d/%d/%d",
+			len(again.Brands), len(again.Suppliers), len(again.Products), len(again.Variances),
+			len(exported.Brands), len(exported.Suppliers), len(exported.Products), len(exported.Variances))
+	}
+	type key struct{ product, variance, brand string }
+	want := map[key]Variance{}
+	for _, v := range exported.Variances {
+		want[key{v.ProductName, v.VarianceTitle, v.Brand}] = v
+	}
+	for _, v := range again.Variances {
+		w, ok := want[key{v.ProductName, v.VarianceTitle, v.Brand}]
+		if !ok {
+			t.Errorf("variance %q/%q was not exported", v.ProductName, v.VarianceTitle)
+			continue
+		}
+		if v.RetailPrice.Amount.Cmp(w.RetailPrice.Amount) != 0 || v.Quantity != w.Quantity || v.ProductID != w.ProductID {
+			t.Errorf("variance %q/%q came back as %s x%v of %s, want %s x%v of %s", v.ProductName, v.VarianceTitle,
+				v.RetailPrice, v.Quantity, v.ProductID, w.RetailPrice, w.Quantity, w.ProductID)
+		}
+	}
+}
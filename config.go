@@ -0,0 +1,367 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+//! ============================================================================ //
+//? ======================== ⚙️ CONFIGURATION ⚙️ ============================== //
+//! ============================================================================ //
+
+// Config holds everything the server needs to start. It is built from
+// defaults, then an optional YAML/TOML file (CONFIG_FILE), then environment
+// variables, so the same binary runs locally, on staging and on Render.
+type Config struct {
+	Store       string            `yaml:"store" toml:"store"`
+	DatabaseURL string            `yaml:"database_url" toml:"database_url"`
+	Port        string            `yaml:"port" toml:"port"`
+	GinMode     string            `yaml:"gin_mode" toml:"gin_mode"`
+	DB          DBConfig          `yaml:"db" toml:"db"`
+	HTTP        HTTPConfig        `yaml:"http" toml:"http"`
+	Inventory   InventoryConfig   `yaml:"inventory" toml:"inventory"`
+	Alerts      AlertsConfig      `yaml:"alerts" toml:"alerts"`
+	Pricing     PricingConfig     `yaml:"pricing" toml:"pricing"`
+	Accounts    map[string]string `yaml:"basic_auth_accounts" toml:"basic_auth_accounts"`
+}
+
+type DBConfig struct {
+	MaxOpenConns    int      `yaml:"max_open_conns" toml:"max_open_conns"`
+	MaxIdleConns    int      `yaml:"max_idle_conns" toml:"max_idle_conns"`
+	ConnMaxLifetime Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime"`
+	ConnMaxIdleTime Duration `yaml:"conn_max_idle_time" toml:"conn_max_idle_time"`
+}
+
+type HTTPConfig struct {
+	ReadTimeout     Duration `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout    Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout     Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+}
+
+type InventoryConfig struct {
+	// ReservationTTL is how long a reservation holds stock when the request
+	// does not say.
+	ReservationTTL Duration `yaml:"reservation_ttl" toml:"reservation_ttl"`
+	// ReservationSweepInterval is how often expired reservations are
+	// released.
+	ReservationSweepInterval Duration `yaml:"reservation_sweep_interval" toml:"reservation_sweep_interval"`
+}
+
+// AlertsConfig is where low stock alerts go; see notify.go.
+type AlertsConfig struct {
+	// Notifiers names the channels alerts are sent through.
+	Notifiers  []string `yaml:"notifiers" toml:"notifiers"`
+	WebhookURL string   `yaml:"webhook_url" toml:"webhook_url"`
+	MailDir    string   `yaml:"mail_dir" toml:"mail_dir"`
+	MailFrom   string   `yaml:"mail_from" toml:"mail_from"`
+	MailTo     string   `yaml:"mail_to" toml:"mail_to"`
+	// Cooldown is the least time between two alerts for the same rule.
+	Cooldown Duration `yaml:"cooldown" toml:"cooldown"`
+}
+
+// PricingConfig is how prices are kept; see money.go.
+type PricingConfig struct {
+	// Currency is the ISO 4217 code catalog prices are in.
+	Currency string `yaml:"currency" toml:"currency"`
+	// Rounding is how prices converted into other currencies are rounded to
+	// the cent; see exchange_rates.go.
+	Rounding RoundingMode `yaml:"rounding" toml:"rounding"`
+	// ScheduleInterval is how often scheduled price changes that are due
+	// are applied; see price_history.go.
+	ScheduleInterval Duration `yaml:"schedule_interval" toml:"schedule_interval"`
+}
+
+// Store backends selectable through STORE.
+const (
+	storePostgres = "postgres"
+	storeMemory   = "memory"
+)
+
+// Duration lets config files use strings like "30s" or "5m".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d Duration) Std() time.Duration { return time.Duration(d) }
+
+func defaultConfig() Config {
+	return Config{
+		Store:   storePostgres,
+		Port:    "8080",
+		GinMode: gin.DebugMode,
+		DB: DBConfig{
+			MaxOpenConns:    10,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: Duration(30 * time.Minute),
+			ConnMaxIdleTime: Duration(5 * time.Minute),
+		},
+		HTTP: HTTPConfig{
+			ReadTimeout:     Duration(15 * time.Second),
+			WriteTimeout:    Duration(30 * time.Second),
+			IdleTimeout:     Duration(60 * time.Second),
+			ShutdownTimeout: Duration(10 * time.Second),
+		},
+		Inventory: InventoryConfig{
+			ReservationTTL:           Duration(15 * time.Minute),
+			ReservationSweepInterval: Duration(time.Minute),
+		},
+		Alerts: AlertsConfig{
+			Notifiers: []string{notifierLog},
+			MailFrom:  "inventory@localhost",
+			Cooldown:  Duration(time.Hour),
+		},
+		Pricing: PricingConfig{
+			Currency:         "LKR",
+			Rounding:         RoundHalfUp,
+			ScheduleInterval: Duration(time.Minute),
+		},
+		Accounts: map[string]string{},
+	}
+}
+
+// loadConfig builds the Config from defaults, the file named by CONFIG_FILE
+// (if any) and the environment, then validates it. lookup is normally
+// os.LookupEnv; tests can pass their own.
+func loadConfig(lookup func(string) (string, bool)) (*Config, error) {
+	cfg := defaultConfig()
+
+	if path, ok := lookup("CONFIG_FILE"); ok && path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.applyEnv(lookup); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (cfg *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: reading %s: %w", path, err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("config: %s: unsupported file type (use .yaml, .yml or .toml)", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config: parsing %s: %w", path, err)
+	}
+	return nil
+}
+
+func (cfg *Config) applyEnv(lookup func(string) (string, bool)) error {
+	var errs []error
+
+	str := func(key string, dst *string) {
+		if v, ok := lookup(key); ok && v != "" {
+			*dst = v
+		}
+	}
+	num := func(key string, dst *int) {
+		if v, ok := lookup(key); ok && v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not an integer", key, v))
+				return
+			}
+			*dst = n
+		}
+	}
+	dur := func(key string, dst *Duration) {
+		if v, ok := lookup(key); ok && v != "" {
+			if err := dst.UnmarshalText([]byte(v)); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a duration (e.g. 30s, 5m)", key, v))
+			}
+		}
+	}
+
+	str("STORE", &cfg.Store)
+	str("DATABASE_URL", &cfg.DatabaseURL)
+	str("PORT", &cfg.Port)
+	str("GIN_MODE", &cfg.GinMode)
+	num("DB_MAX_OPEN_CONNS", &cfg.DB.MaxOpenConns)
+	num("DB_MAX_IDLE_CONNS", &cfg.DB.MaxIdleConns)
+	dur("DB_CONN_MAX_LIFETIME", &cfg.DB.ConnMaxLifetime)
+	dur("DB_CONN_MAX_IDLE_TIME", &cfg.DB.ConnMaxIdleTime)
+	dur("HTTP_READ_TIMEOUT", &cfg.HTTP.ReadTimeout)
+	dur("HTTP_WRITE_TIMEOUT", &cfg.HTTP.WriteTimeout)
+	dur("HTTP_IDLE_TIMEOUT", &cfg.HTTP.IdleTimeout)
+	dur("HTTP_SHUTDOWN_TIMEOUT", &cfg.HTTP.ShutdownTimeout)
+	dur("RESERVATION_TTL", &cfg.Inventory.ReservationTTL)
+	dur("RESERVATION_SWEEP_INTERVAL", &cfg.Inventory.ReservationSweepInterval)
+	str("ALERT_WEBHOOK_URL", &cfg.Alerts.WebhookURL)
+	str("ALERT_MAIL_DIR", &cfg.Alerts.MailDir)
+	str("ALERT_MAIL_FROM", &cfg.Alerts.MailFrom)
+	str("ALERT_MAIL_TO", &cfg.Alerts.MailTo)
+	dur("ALERT_COOLDOWN", &cfg.Alerts.Cooldown)
+	str("CURRENCY", &cfg.Pricing.Currency)
+	if v, ok := lookup("PRICE_ROUNDING"); ok && v != "" {
+		if err := cfg.Pricing.Rounding.UnmarshalText([]byte(v)); err != nil {
+			errs = append(errs, fmt.Errorf("PRICE_ROUNDING: %w", err))
+		}
+	}
+	dur("PRICE_SCHEDULE_INTERVAL", &cfg.Pricing.ScheduleInterval)
+
+	// ALERT_NOTIFIERS="log,webhook"; "none" turns alerts off.
+	if v, ok := lookup("ALERT_NOTIFIERS"); ok && v != "" {
+		cfg.Alerts.Notifiers = nil
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" && name != "none" {
+				cfg.Alerts.Notifiers = append(cfg.Alerts.Notifiers, name)
+			}
+		}
+	}
+
+	// BASIC_AUTH_ACCOUNTS="foo:bar,manu:123" replaces any accounts from the file.
+	if v, ok := lookup("BASIC_AUTH_ACCOUNTS"); ok && v != "" {
+		accounts, err := parseAccounts(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("BASIC_AUTH_ACCOUNTS: %w", err))
+		} else {
+			cfg.Accounts = accounts
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func parseAccounts(raw string) (map[string]string, error) {
+	accounts := map[string]string{}
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		user, pass, ok := strings.Cut(pair, ":")
+		if !ok || user == "" || pass == "" {
+			return nil, fmt.Errorf("%q must look like user:password", pair)
+		}
+		accounts[user] = pass
+	}
+	return accounts, nil
+}
+
+func (cfg *Config) validate() error {
+	var errs []error
+
+	switch cfg.Store {
+	case storePostgres:
+		if cfg.DatabaseURL == "" {
+			errs = append(errs, errors.New("DATABASE_URL is required"))
+		}
+	case storeMemory:
+	default:
+		errs = append(errs, fmt.Errorf("STORE %q must be one of postgres, memory", cfg.Store))
+	}
+	if port, err := strconv.Atoi(cfg.Port); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("PORT %q must be a number between 1 and 65535", cfg.Port))
+	}
+	switch cfg.GinMode {
+	case gin.DebugMode, gin.ReleaseMode, gin.TestMode:
+	default:
+		errs = append(errs, fmt.Errorf("GIN_MODE %q must be one of debug, release, test", cfg.GinMode))
+	}
+	if cfg.DB.MaxOpenConns < 0 {
+		errs = append(errs, errors.New("DB_MAX_OPEN_CONNS must not be negative"))
+	}
+	if cfg.DB.MaxIdleConns < 0 {
+		errs = append(errs, errors.New("DB_MAX_IDLE_CONNS must not be negative"))
+	}
+	if cfg.DB.MaxOpenConns > 0 && cfg.DB.MaxIdleConns > cfg.DB.MaxOpenConns {
+		errs = append(errs, fmt.Errorf("DB_MAX_IDLE_CONNS (%d) must not exceed DB_MAX_OPEN_CONNS (%d)", cfg.DB.MaxIdleConns, cfg.DB.MaxOpenConns))
+	}
+	for _, d := range []struct {
+		name  string
+		value Duration
+	}{
+		{"DB_CONN_MAX_LIFETIME", cfg.DB.ConnMaxLifetime},
+		{"DB_CONN_MAX_IDLE_TIME", cfg.DB.ConnMaxIdleTime},
+		{"HTTP_READ_TIMEOUT", cfg.HTTP.ReadTimeout},
+		{"HTTP_WRITE_TIMEOUT", cfg.HTTP.WriteTimeout},
+		{"HTTP_IDLE_TIMEOUT", cfg.HTTP.IdleTimeout},
+		{"HTTP_SHUTDOWN_TIMEOUT", cfg.HTTP.ShutdownTimeout},
+	} {
+		if d.value < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative", d.name))
+		}
+	}
+	if cfg.Inventory.ReservationTTL <= 0 || cfg.Inventory.ReservationTTL.Std() > maxReservationTTL {
+		errs = append(errs, fmt.Errorf("RESERVATION_TTL must be between 0 and %s", maxReservationTTL))
+	}
+	if cfg.Inventory.ReservationSweepInterval <= 0 {
+		errs = append(errs, errors.New("RESERVATION_SWEEP_INTERVAL must be positive"))
+	}
+	for _, name := range cfg.Alerts.Notifiers {
+		switch name {
+		case notifierLog:
+		case notifierWebhook:
+			if !validHTTPURL(cfg.Alerts.WebhookURL) {
+				errs = append(errs, errors.New("ALERT_WEBHOOK_URL must be an http(s) URL for the webhook notifier"))
+			}
+		case notifierMail:
+			if cfg.Alerts.MailDir == "" || cfg.Alerts.MailTo == "" {
+				errs = append(errs, errors.New("ALERT_MAIL_DIR and ALERT_MAIL_TO are required for the mail notifier"))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("ALERT_NOTIFIERS: %q must be one of %s", name, strings.Join(notifierNames, ", ")))
+		}
+	}
+	if cfg.Alerts.Cooldown < 0 {
+		errs = append(errs, errors.New("ALERT_COOLDOWN must not be negative"))
+	}
+	if !validCurrency(cfg.Pricing.Currency) {
+		errs = append(errs, fmt.Errorf("CURRENCY %q must be a three letter ISO 4217 code such as LKR", cfg.Pricing.Currency))
+	}
+	if cfg.Pricing.ScheduleInterval <= 0 {
+		errs = append(errs, errors.New("PRICE_SCHEDULE_INTERVAL must be positive"))
+	}
+	if cfg.GinMode == gin.ReleaseMode && len(cfg.Accounts) == 0 {
+		errs = append(errs, errors.New("BASIC_AUTH_ACCOUNTS is required in release mode"))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// addr is the listen address for http.Server.
+func (cfg *Config) addr() string {
+	return ":" + cfg.Port
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+//! ============================================================================ //
+//? ========================== 🚨 API ERRORS 🚨 ================================ //
+//! ============================================================================ //
+
+// Stable error codes clients can switch on.
+const (
+	CodeInvalidJSON      = "INVALID_JSON"
+	CodeValidation       = "VALIDATION_FAILED"
+	CodeBadRequest       = "BAD_REQUEST"
+	CodeNotFound         = "NOT_FOUND"
+	CodeRouteNotFound    = "ROUTE_NOT_FOUND"
+	CodeUniqueViolation  = "UNIQUE_VIOLATION"
+	CodeForeignKey       = "FOREIGN_KEY_VIOLATION"
+	CodeConstraint       = "CONSTRAINT_VIOLATION"
+	CodeDatabase         = "DATABASE_ERROR"
+	CodeInternal         = "INTERNAL_ERROR"
+	CodeMethodNotAllowed = "METHOD_NOT_ALLOWED"
+)
+
+// APIError is the one error shape every handler returns. It renders as
+//
+//	{"success": false, "error": {"code": ..., "message": ..., "details": ...}}
+type APIError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details any    `json:"details,omitempty"`
+	// Err is the underlying cause; it is logged, and only shown to clients
+	// outside release mode.
+	Err error `json:"-"`
+}
+
+func (e *APIError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Message, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func (e *APIError) Unwrap() error { return e.Err }
+
+func newAPIError(status int, code, message string) *APIError {
+	return &APIError{Status: status, Code: code, Message: message}
+}
+
+func errBadRequest(message string) *APIError {
+	return newAPIError(http.StatusBadRequest, CodeBadRequest, message)
+}
+
+func errNotFoundf(format string, args ...any) *APIError {
+	return &APIError{Status: http.StatusNotFound, Code: CodeNotFound, Message: fmt.Sprintf(format, args...), Err: errNotFound}
+}
+
+// errBinding classifies a ShouldBindJSON failure: malformed JSON is a 400,
+// JSON that fails its binding rules is a 422.
+func errBinding(err error) *APIError {
+	if details, ok := fieldErrors(err); ok {
+		return &APIError{Status: http.StatusUnprocessableEntity, Code: CodeValidation, Message: "Request failed validation", Details: details, Err: err}
+	}
+	return &APIError{Status: http.StatusBadRequest, Code: CodeInvalidJSON, Message: "Invalid JSON input", Details: err.Error(), Err: err}
+}
+
+// storeError turns an error from a store into an APIError. message describes
+// what the handler was doing, e.g. "Failed to fetch products"; it is only used
+// when the error has no more specific meaning.
+func storeError(err error, message string) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	if errors.Is(err, errNotFound) {
+		return &APIError{Status: http.StatusNotFound, Code: CodeNotFound, Message: "No rows found", Err: err}
+	}
+	if errors.Is(err, errConflict) {
+		return &APIError{Status: http.StatusConflict, Code: CodeUniqueViolation, Message: "A record with the same key already exists", Err: err}
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Name() {
+		case "unique_violation":
+			return &APIError{Status: http.StatusConflict, Code: CodeUniqueViolation,
+				Message: "A record with the same key already exists", Details: constraintDetails(pqErr), Err: err}
+		case "foreign_key_violation":
+			return &APIError{Status: http.StatusUnprocessableEntity, Code: CodeForeignKey,
+				Message: "A referenced record does not exist", Details: constraintDetails(pqErr), Err: err}
+		case "not_null_violation", "check_violation", "string_data_right_truncation", "numeric_value_out_of_range":
+			return &APIError{Status: http.StatusUnprocessableEntity, Code: CodeConstraint,
+				Message: "The record breaks a database constraint", Details: constraintDetails(pqErr), Err: err}
+		case "invalid_text_representation", "invalid_datetime_format":
+			return &APIError{Status: http.StatusBadRequest, Code: CodeBadRequest,
+				Message: "A value has the wrong format", Details: pqErr.Message, Err: err}
+		}
+	}
+
+	return &APIError{Status: http.StatusInternalServerError, Code: CodeDatabase, Message: message, Err: err}
+}
+
+func constraintDetails(e *pq.Error) gin.H {
+	details := gin.H{"constraint": e.Constraint}
+	if e.Detail != "" {
+		details["detail"] = e.Detail
+	}
+	return details
+}
+
+// respondError records err for errorHandler and stops the handler chain.
+// Handlers call it and return.
+func respondError(c *gin.Context, err error) {
+	_ = c.Error(err)
+	c.Abort()
+}
+
+// errorHandler renders the last error a handler recorded with respondError.
+// It is the only place error responses are written.
+func errorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		err := c.Errors.Last().Err
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			apiErr = &APIError{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "Unexpected error", Err: err}
+		}
+
+		if apiErr.Status >= http.StatusInternalServerError {
+			log.Printf("🔴 %s %s: %v", c.Request.Method, c.Request.URL.Path, apiErr)
+		}
+
+		body := *apiErr
+		if body.Details == nil && body.Err != nil && gin.Mode() != gin.ReleaseMode {
+			body.Details = body.Err.Error()
+		}
+		c.JSON(apiErr.Status, gin.H{"success": false, "error": body})
+	}
+}
+
+func noRoute(c *gin.Context) {
+	respondError(c, newAPIError(http.StatusNotFound, CodeRouteNotFound, fmt.Sprintf("No route for %s %s", c.Request.Method, c.Request.URL.Path)))
+}
+
+func noMethod(c *gin.Context) {
+	respondError(c, newAPIError(http.StatusMethodNotAllowed, CodeMethodNotAllowed, fmt.Sprintf("%s is not allowed on %s", c.Request.Method, c.Request.URL.Path)))
+}
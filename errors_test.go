@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+func TestStoreError(t *testing.T) {
+	own := errUnknownVariance(7)
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"api error passes through", fmt.Errorf("wrapped: %w", own), own.Status, own.Code},
+		{"not found", fmt.Errorf("variance 7: %w", errNotFound), http.StatusNotFound, CodeNotFound},
+		{"conflict", errConflict, http.StatusConflict, CodeUniqueViolation},
+		{"unique", &pq.Error{Code: "23505", Constraint: "brand_name_key"}, http.StatusConflict, CodeUniqueViolation},
+		{"foreign key", &pq.Error{Code: "23503", Constraint: "variances_product_fkey"}, http.StatusUnprocessableEntity, CodeForeignKey},
+		{"check", &pq.Error{Code: "23514"}, http.StatusUnprocessableEntity, CodeConstraint},
+		{"not null", &pq.Error{Code: "23502"}, http.StatusUnprocessableEntity, CodeConstraint},
+		{"bad text", &pq.Error{Code: "22P02"}, http.StatusBadRequest, CodeBadRequest},
+		{"anything else", errors.New("connection reset"), http.StatusInternalServerError, CodeDatabase},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := storeError(tt.err, "Failed to do the thing")
+			if got.Status != tt.status || got.Code != tt.code {
+				t.Errorf("storeError = %d %s, want %d %s", got.Status, got.Code, tt.status, tt.code)
+			}
+			if got.Code == CodeDatabase && got.Message != "Failed to do the thing" {
+				t.Errorf("message = %q, want the handler's", got.Message)
+			}
+		})
+	}
+
+	fk := storeError(&pq.Error{Code: "23503", Constraint: "variances_product_fkey", Detail: "Key (product_id)=(x) is not present"}, "")
+	details, _ := fk.Details.(gin.H)
+	if details["constraint"] != "variances_product_fkey" || details["detail"] == nil {
+		t.Errorf("details = %v, want the constraint and its detail", fk.Details)
+	}
+}
+
+// Every failure reaches the client in the same envelope, whichever way it
+// happened.
+func TestErrorEnvelope(t *testing.T) {
+	r := newTestAPI(t)
+	tests := []struct {
+		name, method, path, body string
+		status                   int
+		code                     string
+	}{
+		{"unknown route", http.MethodGet, "/nowhere", "", http.StatusNotFound, CodeRouteNotFound},
+		{"wrong method", http.MethodDelete, "/products", "", http.StatusMethodNotAllowed, CodeMethodNotAllowed},
+		{"malformed json", http.MethodPost, "/brand/upsert", `{"name":`, http.StatusBadRequest, CodeInvalidJSON},
+		{"failed validation", http.MethodPost, "/brand/upsert", `{}`, http.StatusUnprocessableEntity, CodeValidation},
+		{"missing row", http.MethodGet, "/products/get-product/nope", "", http.StatusNotFound, CodeNotFound},
+		{"bad path id", http.MethodGet, "/variance/price-history/one", "", http.StatusBadRequest, CodeBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, env := serveJSON(t, r, tt.method, tt.path, tt.body)
+			if w.Code != tt.status {
+				t.Fatalf("%s %s = %d %s, want %d", tt.method, tt.path, w.Code, w.Body.String(), tt.status)
+			}
+			if env.Success || env.Error == nil || env.Error.Code != tt.code || env.Error.Message == "" {
+				t.Errorf("envelope = %s, want success false and a %s error with a message", w.Body.String(), tt.code)
+			}
+		})
+	}
+}
+
+// An error that is not an APIError is still rendered, as a 500.
+func TestErrorHandlerWrapsPlainErrors(t *testing.T) {
+	r := gin.New()
+	r.Use(errorHandler())
+	r.GET("/boom", func(c *gin.Context) { respondError(c, errors.New("boom")) })
+
+	w, env := serveJSON(t, r, http.MethodGet, "/boom", nil)
+	if w.Code != http.StatusInternalServerError || env.Error == nil || env.Error.Code != CodeInternal {
+		t.Errorf("GET /boom = %d %s, want 500 %s", w.Code, w.Body.String(), CodeInternal)
+	}
+}
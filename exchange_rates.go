@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+//! ============================================================================ //
+//? ========================== 💱 EXCHANGE RATES 💱 ============================ //
+//! ============================================================================ //
+
+// Variances are priced in the base currency, CURRENCY. An exchange rate says
+// how many units of another currency one unit of the base buys; rates are
+// kept in the exchange_rates table and maintained through
+// PUT /admin/exchange-rates or "app import-rates".
+//
+// currency= on the product and variance reads converts prices as they are
+// read: each price times the rate, rounded to the cent with PRICE_ROUNDING.
+// Search filters and facets stay in the base currency.
+//
+// An order may name a currency of its own. Its lines are priced at the rate
+// of the moment, and the order keeps that rate, so later rate changes never
+// alter it.
+
+// rateScale is how many decimals rates keep, as NUMERIC(20, 10) does.
+const rateScale = 10
+
+type ExchangeRate struct {
+	Currency string `json:"currency" binding:"required,currency"`
+	// Rate is how many units of Currency one unit of the base currency buys.
+	Rate      Decimal    `json:"rate" binding:"gt=0"`
+	UpdatedBy string     `json:"updated_by"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// ExchangeRateImport is the body of PUT /admin/exchange-rates and the file
+// "app import-rates" reads.
+type ExchangeRateImport struct {
+	Rates []ExchangeRate `json:"rates" binding:"required,min=1,unique=Currency,dive"`
+}
+
+// baseRate is the rate of the base currency into itself.
+func baseRate(currency string) ExchangeRate {
+	return ExchangeRate{Currency: currency, Rate: newDecimal(1, 0).Round(rateScale, RoundHalfUp)}
+}
+
+// price is m, a base currency amount, in r's currency to the cent.
+func (r ExchangeRate) price(m Money, mode RoundingMode) Money {
+	return Money{Amount: m.Amount.Mul(r.Rate).Round(priceScale, mode), Currency: r.Currency}
+}
+
+// base is m, an amount in r's currency, in the base currency to the cent,
+// rounded half up as catalog prices are.
+func (r ExchangeRate) base(m Money, base string) Money {
+	return Money{Amount: m.Amount.Quo(r.Rate, priceScale, RoundHalfUp), Currency: base}
+}
+
+// convert puts the prices of variances into r's currency. A nil r leaves
+// them in the base currency.
+func (r *ExchangeRate) convert(variances []Variance, mode RoundingMode) {
+	if r == nil {
+		return
+	}
+	for i := range variances {
+		v := &variances[i]
+		v.OriginalPrice = r.price(v.OriginalPrice, mode)
+		v.RetailPrice = r.price(v.RetailPrice, mode)
+		v.WholesalePrice = r.price(v.WholesalePrice, mode)
+		v.Currency = r.Currency
+	}
+}
+
+// convertRelated converts the variances an include= expansion nests.
+func (r *ExchangeRate) convertRelated(related map[string]Related, mode RoundingMode) {
+	for _, rel := range related {
+		if rel.Variances != nil {
+			r.convert(*rel.Variances, mode)
+		}
+	}
+}
+
+// prepare checks rates against the base currency and stamps them with who
+// set them and when. Rates keep rateScale decimals.
+func (imp *ExchangeRateImport) prepare(base, by string, now time.Time) *APIError {
+	for i := range imp.Rates {
+		r := &imp.Rates[i]
+		if r.Currency == base {
+			return &APIError{Status: http.StatusUnprocessableEntity, Code: CodeValidation,
+				Message: fmt.Sprintf("%s is the base currency, its rate is always 1", base),
+				Details: gin.H{"currency": base}}
+		}
+		r.Rate = r.Rate.Round(rateScale, RoundHalfUp)
+		if r.Rate.Sign() <= 0 {
+			return &APIError{Status: http.StatusUnprocessableEntity, Code: CodeValidation,
+				Message: fmt.Sprintf("The rate of %s must be at least 0.0000000001", r.Currency),
+				Details: gin.H{"currency": r.Currency}}
+		}
+		r.UpdatedBy, r.UpdatedAt = by, &now
+	}
+	return nil
+}
+
+// readExchangeRates reads a rates file, validated like a request body.
+func readExchangeRates(r io.Reader) (ExchangeRateImport, error) {
+	var imp ExchangeRateImport
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&imp); err != nil {
+		return imp, fmt.Errorf("reading rates: %w", err)
+	}
+	registerValidators()
+	if err := binding.Validator.ValidateStruct(&imp); err != nil {
+		if fields, ok := fieldErrors(err); ok {
+			messages := make([]string, len(fields))
+			for i, f := range fields {
+				messages[i] = f.Message
+			}
+			err = errors.New(strings.Join(messages, "; "))
+		}
+		return imp, fmt.Errorf("reading rates: %w", err)
+	}
+	return imp, nil
+}
+
+// errUnknownCurrency is returned for an order in a currency without a rate.
+func errUnknownCurrency(code string) *APIError {
+	return &APIError{Status: http.StatusUnprocessableEntity, Code: CodeForeignKey,
+		Message: fmt.Sprintf("There is no exchange rate for %s", code), Details: gin.H{"currency": code}}
+}
+
+//? ---------------------------- http handlers ------------------------------ //
+
+// rateParam reads currency= on the catalog reads. It returns nil when prices
+// stay in the base currency.
+func (s *server) rateParam(c *gin.Context) (*ExchangeRate, error) {
+	code := c.Query("currency")
+	if code == "" || code == s.cfg.Pricing.Currency {
+		return nil, nil
+	}
+	if !validCurrency(code) {
+		return nil, &APIError{Status: http.StatusBadRequest, Code: CodeBadRequest,
+			Message: "currency must be a three letter ISO 4217 code such as USD", Details: gin.H{"param": "currency"}}
+	}
+
+	rate, err := s.store.ExchangeRates.ExchangeRate(c.Request.Context(), code)
+	if errors.Is(err, errNotFound) {
+		return nil, &APIError{Status: http.StatusBadRequest, Code: CodeBadRequest,
+			Message: fmt.Sprintf("There is no exchange rate for %s", code), Details: gin.H{"param": "currency"}}
+	}
+	if err != nil {
+		return nil, storeError(err, "Failed to fetch exchange rate")
+	}
+	return &rate, nil
+}
+
+func (s *server) listExchangeRates(c *gin.Context) {
+	rates, err := s.store.ExchangeRates.ListExchangeRates(c.Request.Context())
+	if err != nil {
+		respondError(c, storeError(err, "Failed to fetch exchange rates"))
+		return
+	}
+	respondAll(c, rates)
+}
+
+func (s *server) upsertExchangeRates(c *gin.Context) {
+	var imp ExchangeRateImport
+	if err := c.ShouldBindJSON(&imp); err != nil {
+		respondError(c, errBinding(err))
+		return
+	}
+	if err := imp.prepare(s.cfg.Pricing.Currency, actor(c), time.Now()); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	rates, err := s.store.ExchangeRates.UpsertExchangeRates(c.Request.Context(), imp.Rates)
+	if err != nil {
+		respondError(c, storeError(err, "Failed to save exchange rates"))
+		return
+	}
+	respondAll(c, rates)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExchangeRatePrice(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount Decimal
+		rate   Decimal
+		mode   RoundingMode
+		want   Decimal
+	}{
+		{"exact", newDecimal(1800, 0), newDecimal(33, 4), RoundHalfUp, newDecimal(594, 2)},
+		{"half up", newDecimal(1, 0), newDecimal(125, 3), RoundHalfUp, newDecimal(13, 2)},
+		{"half even", newDecimal(1, 0), newDecimal(125, 3), RoundHalfEven, newDecimal(12, 2)},
+		{"up", newDecimal(1, 0), newDecimal(121, 3), RoundUp, newDecimal(13, 2)},
+		{"down", newDecimal(1, 0), newDecimal(129, 3), RoundDown, newDecimal(12, 2)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := ExchangeRate{Currency: "USD", Rate: tt.rate}
+			got := r.price(Money{Amount: tt.amount, Currency: "LKR"}, tt.mode)
+			if got.Amount.Cmp(tt.want) != 0 || got.Currency != "USD" {
+				t.Errorf("%s at %s = %s, want %s USD", tt.amount, tt.rate, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExchangeRateBase(t *testing.T) {
+	tests := []struct {
+		amount Decimal
+		rate   Decimal
+		want   Decimal
+	}{
+		{newDecimal(594, 2), newDecimal(33, 4), newDecimal(1800, 0)},
+		{newDecimal(1, 0), newDecimal(33, 4), newDecimal(30303, 2)},
+		{newDecimal(2, 0), newDecimal(3, 3), newDecimal(66667, 2)},
+	}
+	for _, tt := range tests {
+		r := ExchangeRate{Currency: "USD", Rate: tt.rate}
+		got := r.base(Money{Amount: tt.amount, Currency: "USD"}, "LKR")
+		if got.Amount.Cmp(tt.want) != 0 || got.Currency != "LKR" {
+			t.Errorf("%s USD at %s = %s, want %s LKR", tt.amount, tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestExchangeRatesAPI(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"BASIC_AUTH_ACCOUNTS": "foo:bar"})
+	stores := newMemoryStore(cfg.Pricing).stores()
+	r := setupRouter(cfg, stores)
+	v := testVarianceWithStock(t, stores, 10)
+
+	putRates := func(body string, auth bool) (*httptest.ResponseRecorder, testEnvelope) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPut, "/admin/exchange-rates", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		if auth {
+			req.SetBasicAuth("foo", "bar")
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var env testEnvelope
+		if w.Body.Len() > 0 {
+			if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+				t.Fatalf("PUT rates: decoding %q: %v", w.Body.String(), err)
+			}
+		}
+		return w, env
+	}
+
+	if w, _ := putRates(`{"rates":[{"currency":"USD","rate":0.0033}]}`, false); w.Code != http.StatusUnauthorized {
+		t.Errorf("PUT rates without credentials = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w, env := putRates(`{"rates":[{"currency":"LKR","rate":2}]}`, true); w.Code != http.StatusUnprocessableEntity || env.Error == nil || env.Error.Code != CodeValidation {
+		t.Errorf("PUT a rate for the base currency = %d %s", w.Code, w.Body.String())
+	}
+	if w, _ := putRates(`{"rates":[{"currency":"USD","rate":0.0033}]}`, true); w.Code != http.StatusOK {
+		t.Fatalf("PUT rates = %d %s", w.Code, w.Body.String())
+	}
+
+	_, env := serveJSON(t, r, http.MethodGet, "/exchange-rates", nil)
+	var rates []ExchangeRate
+	decodeData(t, env, &rates)
+	if len(rates) != 1 || rates[0].Currency != "USD" || rates[0].Rate.Cmp(newDecimal(33, 4)) != 0 || rates[0].UpdatedBy != "foo" {
+		t.Errorf("rates = %+v, want USD at 0.0033 set by foo", rates)
+	}
+
+	// currency= converts the prices read
+	w, env := serveJSON(t, r, http.MethodGet, "/variance/by-product/"+v.ProductID+"?currency=USD", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET variances in USD = %d %s", w.Code, w.Body.String())
+	}
+	var variances []Variance
+	decodeData(t, env, &variances)
+	if len(variances) != 1 || variances[0].Currency != "USD" || variances[0].RetailPrice.Amount.Cmp(newDecimal(231, 2)) != 0 {
+		t.Errorf("variances in USD = %+v, want retail 2.31 USD", variances)
+	}
+	for _, code := range []string{"EUR", "usd", "DOLLAR"} {
+		w, env := serveJSON(t, r, http.MethodGet, "/variance/by-product/"+v.ProductID+"?currency="+code, nil)
+		if w.Code != http.StatusBadRequest || env.Error == nil || env.Error.Code != CodeBadRequest {
+			t.Errorf("currency=%s: %d %s, want %d", code, w.Code, w.Body.String(), http.StatusBadRequest)
+		}
+	}
+
+	// An order in a currency keeps the rate that priced it
+	w, env = serveJSON(t, r, http.MethodPost, "/orders", map[string]any{"currency": "USD",
+		"lines": []map[string]any{{"variance_id": v.ID, "quantity": 2}}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST order in USD = %d %s", w.Code, w.Body.String())
+	}
+	var o Order
+	decodeData(t, env, &o)
+	if o.Currency != "USD" || o.ExchangeRate.Cmp(newDecimal(33, 4)) != 0 || o.Total.Amount.Cmp(newDecimal(462, 2)) != 0 {
+		t.Errorf("order = %+v, want 4.62 USD at 0.0033", o)
+	}
+	w, env = serveJSON(t, r, http.MethodPost, "/orders", map[string]any{"currency": "EUR",
+		"lines": []map[string]any{{"variance_id": v.ID, "quantity": 1}}})
+	if w.Code != http.StatusUnprocessableEntity || env.Error == nil || env.Error.Code != CodeForeignKey {
+		t.Errorf("POST order in EUR = %d %s, want %d %s", w.Code, w.Body.String(), http.StatusUnprocessableEntity, CodeForeignKey)
+	}
+}
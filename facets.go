@@ -0,0 +1,113 @@
+package main
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+)
+
+//! ============================================================================ //
+//? ============================ 🧮 FACETS 🧮 =================================== //
+//! ============================================================================ //
+
+// facets=true on /products/search adds meta.facets: for each filter
+// dimension, how many products each value would yield. A dimension's counts
+// apply every active filter except its own, so picking a second department
+// shows what it would add rather than zero. The price histogram counts the
+// retail prices of the matching products' variances.
+
+// Facet dimensions, also the names ProductSearch filters are skipped by.
+const (
+	facetDepartment   = "department"
+	facetMainCategory = "main_catogory"
+	facetSubCategory  = "sub_catogory"
+	facetBrand        = "brand"
+	facetPrice        = "price"
+)
+
+// priceBuckets is the most buckets the price histogram is split into.
+const priceBuckets = 10
+
+type Facets struct {
+	Department   []FacetBucket `json:"department"`
+	MainCategory []FacetBucket `json:"main_catogory"`
+	SubCategory  []FacetBucket `json:"sub_catogory"`
+	Brand        []FacetBucket `json:"brand"`
+	Price        []PriceBucket `json:"price"`
+}
+
+type FacetBucket struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// PriceBucket counts variances with Min <= retail_price < Max.
+type PriceBucket struct {
+	Min   Decimal `json:"min"`
+	Max   Decimal `json:"max"`
+	Count int     `json:"count"`
+}
+
+// facetBuckets orders counts by count, most first, then by value.
+func facetBuckets(counts map[string]int) []FacetBucket {
+	buckets := make([]FacetBucket, 0, len(counts))
+	for value, n := range counts {
+		buckets = append(buckets, FacetBucket{Value: value, Count: n})
+	}
+	slices.SortFunc(buckets, func(a, b FacetBucket) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Value, b.Value)
+	})
+	return buckets
+}
+
+// priceBucketWidth picks the narrowest round width (1, 2, 2.5 or 5 times a
+// power of ten, no finer than a cent) that puts every price from lo to hi
+// into at most priceBuckets buckets. Buckets are aligned to the width, so
+// the count is from priceBucket(lo) to priceBucket(hi), not span / width.
+func priceBucketWidth(lo, hi Decimal) Decimal {
+	steps := []Decimal{newDecimal(1, 0), newDecimal(2, 0), newDecimal(25, 1), newDecimal(5, 0)}
+	for magnitude := newDecimal(1, priceScale); ; magnitude = magnitude.Mul(newDecimal(10, 0)) {
+		for _, step := range steps {
+			exact := step.Mul(magnitude)
+			width := exact.Round(priceScale, RoundDown)
+			if width.Cmp(exact) != 0 {
+				continue // 2.5 cents
+			}
+			if priceBucket(hi, width)-priceBucket(lo, width) < priceBuckets {
+				return width
+			}
+		}
+	}
+}
+
+// priceBucket is the number of the bucket price falls in, floor(price /
+// width). Prices are never negative, so rounding down is the floor.
+func priceBucket(price, width Decimal) int {
+	return int(price.Quo(width, 0, RoundDown).int().Int64())
+}
+
+// priceHistogram turns counts per bucket number into contiguous buckets from
+// the lowest to the highest, empty ones included.
+func priceHistogram(counts map[int]int, width Decimal) []PriceBucket {
+	if len(counts) == 0 {
+		return []PriceBucket{}
+	}
+	lo, hi := math.MaxInt, math.MinInt
+	for b := range counts {
+		lo, hi = min(lo, b), max(hi, b)
+	}
+
+	buckets := make([]PriceBucket, 0, hi-lo+1)
+	for b := lo; b <= hi; b++ {
+		buckets = append(buckets, PriceBucket{
+			Min:   width.Mul(newDecimal(int64(b), 0)),
+			Max:   width.Mul(newDecimal(int64(b+1), 0)),
+			Count: counts[b],
+		})
+	}
+	return buckets
+}
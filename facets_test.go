@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestPriceBucketWidth(t *testing.T) {
+	tests := []struct {
+		lo, hi Decimal
+		want   string
+	}{
+		{newDecimal(5, 0), newDecimal(5, 0), "0.01"},
+		{newDecimal(5, 0), newDecimal(15, 0), "2.00"},
+		{newDecimal(5, 0), newDecimal(1499, 2), "1.00"},
+		{newDecimal(0, 0), newDecimal(100, 0), "20.00"},
+		{newDecimal(95, 0), newDecimal(205, 0), "20.00"},
+		{newDecimal(1, 2), newDecimal(9, 2), "0.01"},
+		{newDecimal(1, 2), newDecimal(30, 2), "0.05"},
+		{newDecimal(1250, 0), newDecimal(1850, 0), "100.00"},
+		{newDecimal(0, 0), newDecimal(999999999999, 2), "1000000000.00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lo.String()+".."+tt.hi.String(), func(t *testing.T) {
+			width := priceBucketWidth(tt.lo, tt.hi)
+			if width.String() != tt.want {
+				t.Errorf("width = %s, want %s", width, tt.want)
+			}
+			if n := priceBucket(tt.hi, width) - priceBucket(tt.lo, width) + 1; n > priceBuckets {
+				t.Errorf("width %s gives %d buckets, want at most %d", width, n, priceBuckets)
+			}
+		})
+	}
+}
+
+// Buckets are bounded in exact cents, so a price on a boundary starts the
+// bucket above it.
+func TestPriceHistogram(t *testing.T) {
+	width := newDecimal(25, 2)
+	counts := map[int]int{}
+	for _, price := range []Decimal{newDecimal(10, 2), newDecimal(25, 2), newDecimal(74, 2), newDecimal(75, 2)} {
+		counts[priceBucket(price, width)]++
+	}
+	buckets := priceHistogram(counts, width)
+	want := []struct {
+		min, max string
+		count    int
+	}{{"0.00", "0.25", 1}, {"0.25", "0.50", 1}, {"0.50", "0.75", 1}, {"0.75", "1.00", 1}}
+	if len(buckets) != len(want) {
+		t.Fatalf("got %d buckets %+v, want %d", len(buckets), buckets, len(want))
+	}
+	for i, b := range buckets {
+		if b.Min.String() != want[i].min || b.Max.String() != want[i].max || b.Count != want[i].count {
+			t.Errorf("bucket %d = %s..%s (%d), want %s..%s (%d)", i, b.Min, b.Max, b.Count, want[i].min, want[i].max, want[i].count)
+		}
+	}
+}
+
+func facetValues(buckets []FacetBucket) []string {
+	values := make([]string, len(buckets))
+	for i, b := range buckets {
+		values[i] = fmt.Sprintf("%s:%d", b.Value, b.Count)
+	}
+	return values
+}
+
+func TestSearchFacets(t *testing.T) {
+	r := newSearchAPI(t)
+
+	_, env := search(t, r, "facets=true")
+	f := env.Meta.Facets
+	if f == nil {
+		t.Fatal("facets=true returned no meta.facets")
+	}
+	if got, want := facetValues(f.Department), []string{"mainBuilding:2", "paintStore:1", "yard:1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("department = %v, want %v", got, want)
+	}
+	if got, want := facetValues(f.Brand), []string{"Holcim:2", "Dulux:1", "Sanstha:1", "Tokyo:1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("brand = %v, want %v", got, want)
+	}
+	var prices []string
+	for _, b := range f.Price {
+		prices = append(prices, fmt.Sprintf("%s-%s:%d", b.Min, b.Max, b.Count))
+	}
+	want := []string{"500.00-1000.00:1", "1000.00-1500.00:0", "1500.00-2000.00:2", "2000.00-2500.00:1", "2500.00-3000.00:0", "3000.00-3500.00:1"}
+	if !reflect.DeepEqual(prices, want) {
+		t.Errorf("price = %v, want %v", prices, want)
+	}
+
+	// A dimension ignores its own filter, so the other departments still
+	// show what picking them would add; the rest narrow down.
+	_, env = search(t, r, "facets=true&department=yard")
+	f = env.Meta.Facets
+	if got, want := facetValues(f.Department), []string{"mainBuilding:2", "paintStore:1", "yard:1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("department with department=yard = %v, want %v", got, want)
+	}
+	if got, want := facetValues(f.MainCategory), []string{"sand:1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("main_catogory with department=yard = %v, want %v", got, want)
+	}
+	if len(f.Price) != 1 || f.Price[0].Count != 1 {
+		t.Errorf("price with department=yard = %+v, want the one sand price", f.Price)
+	}
+
+	if _, env := search(t, r, "department=yard"); env.Meta.Facets != nil {
+		t.Error("facets were counted without facets=true")
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+//! ============================================================================ //
+//? ========================== 🧩 FUZZY SEARCH 🧩 ============================== //
+//! ============================================================================ //
+
+// mode=fuzzy on /products/search matches q against product titles and the
+// brand and supplier names of their variances while tolerating typos
+// ("cemnt" finds "Portland Cement"). Postgres scores with pg_trgm's
+// word_similarity (migration 0003); the in-memory store scores words by
+// Levenshtein distance instead. Both report the score as similarity, 0..1.
+//
+// A search with q that finds nothing, fuzzy or not, returns "did you mean"
+// suggestions in meta.suggestions.
+
+const (
+	searchModeFullText = "fulltext"
+	searchModeFuzzy    = "fuzzy"
+
+	// fuzzyThreshold is the lowest similarity that counts as a hit. It is
+	// pg_trgm.word_similarity_threshold's default, which the <% operator uses.
+	fuzzyThreshold = 0.6
+	// suggestThreshold is the lowest similarity offered as a suggestion.
+	suggestThreshold = 0.3
+	maxSuggestions   = 5
+)
+
+// Suggestion is a catalog name close to a query that found nothing.
+type Suggestion struct {
+	Text string `json:"text"`
+	// Kind is product, brand or supplier.
+	Kind       string  `json:"kind"`
+	Similarity float64 `json:"similarity"`
+}
+
+func bestSuggestions(suggestions []Suggestion, limit int) []Suggestion {
+	slices.SortStableFunc(suggestions, func(a, b Suggestion) int {
+		if c := cmp.Compare(b.Similarity, a.Similarity); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Text, b.Text)
+	})
+	return suggestions[:min(limit, len(suggestions))]
+}
+
+//? ------------------------- in-memory similarity --------------------------- //
+
+// wordSimilarity is the in-memory stand-in for pg_trgm's word_similarity: each
+// word of q is scored against its closest word in text, and the scores are
+// averaged. Two words score 1 - distance/longer length.
+func wordSimilarity(q, text string) float64 {
+	terms := searchTerms(q)
+	words := searchTerms(text)
+	if len(terms) == 0 || len(words) == 0 {
+		return 0
+	}
+
+	total := 0.0
+	for _, term := range terms {
+		best := 0.0
+		for _, w := range words {
+			best = max(best, levenshteinSimilarity(term, w))
+		}
+		total += best
+	}
+	return total / float64(len(terms))
+}
+
+func levenshteinSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+// levenshtein counts the single-rune edits turning a into b.
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+//! ============================================================================ //
+//? ========================= 🧷 INCLUDE EXPANSION 🧷 ========================== //
+//! ============================================================================ //
+
+// include= on /products/get-product/:id and /products/search nests related
+// rows into each product, so a product page is one request instead of four:
+//
+//	GET /products/get-product/p1?include=variances,brand,supplier
+//
+// brand and supplier list the distinct brands and suppliers named by the
+// product's variances. However many products a page has, the expansion costs
+// at most three queries: one per related table.
+//
+// /variance/by-product/:id takes include=availability, which adds each
+// variance's stock level, per location and in total.
+
+const (
+	includeVariances = "variances"
+	includeBrand     = "brand"
+	includeSupplier  = "supplier"
+)
+
+var includeNames = []string{includeBrand, includeSupplier, includeVariances}
+
+// Includes is which related rows a request asked for.
+type Includes struct {
+	Variances bool
+	Brands    bool
+	Suppliers bool
+}
+
+func (inc Includes) any() bool {
+	return inc.Variances || inc.Brands || inc.Suppliers
+}
+
+// includeParam reads include, a comma separated list of includeNames.
+func includeParam(c *gin.Context) (Includes, error) {
+	var inc Includes
+	for _, name := range splitCSV(c.Query("include")) {
+		switch name {
+		case includeVariances:
+			inc.Variances = true
+		case includeBrand:
+			inc.Brands = true
+		case includeSupplier:
+			inc.Suppliers = true
+		default:
+			return inc, errInclude(name, includeNames)
+		}
+	}
+	return inc, nil
+}
+
+const includeAvailability = "availability"
+
+// availabilityParam reads include on the variance lists, where availability
+// is the only expansion.
+func availabilityParam(c *gin.Context) (bool, error) {
+	availability := false
+	for _, name := range splitCSV(c.Query("include")) {
+		if name != includeAvailability {
+			return false, errInclude(name, []string{includeAvailability})
+		}
+		availability = true
+	}
+	return availability, nil
+}
+
+func errInclude(name string, allowed []string) *APIError {
+	return &APIError{Status: http.StatusBadRequest, Code: CodeBadRequest,
+		Message: fmt.Sprintf("Cannot include %q", name),
+		Details: gin.H{"param": "include", "allowed": allowed}}
+}
+
+// Related holds the expanded rows of one product. A field is nil when it was
+// not asked for and an empty list when there is nothing to include, so the
+// key is present exactly when requested.
+type Related struct {
+	Variances *[]Variance `json:"variances,omitempty"`
+	Brands    *[]Brand    `json:"brands,omitempty"`
+	Suppliers *[]Supplier `json:"suppliers,omitempty"`
+}
+
+// ProductDetail is a product with its include= expansion.
+type ProductDetail struct {
+	Product
+	Related
+}
+
+// HitDetail is a search hit with its include= expansion.
+type HitDetail struct {
+	ProductHit
+	Related
+}
+
+// VarianceDetail is a variance with include=availability.
+type VarianceDetail struct {
+	Variance
+	Availability *StockLevel `json:"availability,omitempty"`
+}
+
+// related loads what inc asks for for every product in productIDs, keyed by
+// product id.
+func (s *server) related(ctx context.Context, productIDs []string, inc Includes) (map[string]Related, error) {
+	byProduct, err := s.store.Variances.VariancesByProducts(ctx, productIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var brandNames, supplierNames []string
+	for _, variances := range byProduct {
+		for _, v := range variances {
+			brandNames = append(brandNames, v.Brand)
+			supplierNames = append(supplierNames, v.Supplier)
+		}
+	}
+
+	brands := map[string]Brand{}
+	if inc.Brands {
+		found, err := s.store.Brands.BrandsByName(ctx, distinctNames(brandNames))
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range found {
+			brands[b.Name] = b
+		}
+	}
+	suppliers := map[string]Supplier{}
+	if inc.Suppliers {
+		found, err := s.store.Suppliers.SuppliersByName(ctx, distinctNames(supplierNames))
+		if err != nil {
+			return nil, err
+		}
+		for _, supplier := range found {
+			suppliers[supplier.Name] = supplier
+		}
+	}
+
+	related := make(map[string]Related, len(productIDs))
+	for _, id := range productIDs {
+		variances := byProduct[id]
+		var r Related
+		if inc.Variances {
+			list := append([]Variance{}, variances...)
+			r.Variances = &list
+		}
+		if inc.Brands {
+			list := relatedByName(variances, brands, func(v Variance) string { return v.Brand })
+			r.Brands = &list
+		}
+		if inc.Suppliers {
+			list := relatedByName(variances, suppliers, func(v Variance) string { return v.Supplier })
+			r.Suppliers = &list
+		}
+		related[id] = r
+	}
+	return related, nil
+}
+
+// relatedByName picks the rows named by variances, each once, in the order
+// the variances name them.
+func relatedByName[T any](variances []Variance, byName map[string]T, name func(Variance) string) []T {
+	list := []T{}
+	seen := map[string]bool{}
+	for _, v := range variances {
+		n := name(v)
+		row, ok := byName[n]
+		if !ok || seen[n] {
+			continue
+		}
+		seen[n] = true
+		list = append(list, row)
+	}
+	return list
+}
+
+// distinctNames drops blanks and duplicates.
+func distinctNames(names []string) []string {
+	var distinct []string
+	seen := map[string]bool{}
+	for _, n := range names {
+		if strings.TrimSpace(n) != "" && !seen[n] {
+			seen[n] = true
+			distinct = append(distinct, n)
+		}
+	}
+	return distinct
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestIncludeOnProduct(t *testing.T) {
+	r := newSearchAPI(t)
+	get := func(path string) map[string]json.RawMessage {
+		t.Helper()
+		_, env := serveJSON(t, r, http.MethodGet, path, nil)
+		var product map[string]json.RawMessage
+		decodeData(t, env, &product)
+		return product
+	}
+
+	p := get("/products/get-product/p1?include=variances,brand,supplier")
+	var variances []Variance
+	var brands []Brand
+	var suppliers []Supplier
+	for key, v := range map[string]any{"variances": &variances, "brands": &brands, "suppliers": &suppliers} {
+		if err := json.Unmarshal(p[key], v); err != nil {
+			t.Fatalf("%s: %v in %s", key, err, p[key])
+		}
+	}
+	if len(variances) != 2 || len(brands) != 2 || len(suppliers) != 1 {
+		t.Errorf("p1 included %d variances, %d brands, %d suppliers, want 2, 2 and 1", len(variances), len(brands), len(suppliers))
+	}
+	if len(brands) == 2 && (brands[0].Name != "Holcim" || brands[1].Name != "Tokyo") {
+		t.Errorf("brands = %s, %s, want Holcim and Tokyo", brands[0].Name, brands[1].Name)
+	}
+
+	p = get("/products/get-product/p1")
+	for _, key := range []string{"variances", "brands", "suppliers"} {
+		if _, ok := p[key]; ok {
+			t.Errorf("%s present without include", key)
+		}
+	}
+
+	post := `{"id":"p5","title":"Bare Plank","department":"yard","main_catogory":"timber"}`
+	if w, _ := serveJSON(t, r, http.MethodPost, "/products/insert", post); w.Code != http.StatusOK {
+		t.Fatalf("insert p5 = %d %s", w.Code, w.Body.String())
+	}
+	p = get("/products/get-product/p5?include=brand")
+	if string(p["brands"]) != "[]" {
+		t.Errorf("brands of a product without variances = %s, want []", p["brands"])
+	}
+}
+
+func TestIncludeOnSearchAndVariances(t *testing.T) {
+	r := newSearchAPI(t)
+
+	_, env := serveJSON(t, r, http.MethodGet, "/products/search?brand=Holcim&include=variances", nil)
+	var hits []HitDetail
+	decodeData(t, env, &hits)
+	if len(hits) != 2 {
+		t.Fatalf("found %d products, want 2", len(hits))
+	}
+	for _, h := range hits {
+		if h.Variances == nil || len(*h.Variances) == 0 {
+			t.Errorf("%s came without its variances", h.ID)
+		}
+	}
+
+	_, env = serveJSON(t, r, http.MethodGet, "/variance/by-product/p1?include=availability", nil)
+	var details []VarianceDetail
+	decodeData(t, env, &details)
+	for _, d := range details {
+		if d.Availability == nil {
+			t.Errorf("variance %d came without availability", d.ID)
+		}
+	}
+
+	for _, path := range []string{
+		"/products/get-product/p1?include=price",
+		"/products/search?include=variances,everything",
+		"/variance/by-product/p1?include=brand",
+	} {
+		if w, env := serveJSON(t, r, http.MethodGet, path, nil); w.Code != http.StatusBadRequest || env.Error.Code != CodeBadRequest {
+			t.Errorf("GET %s = %d %s, want 400", path, w.Code, w.Body.String())
+		}
+	}
+}
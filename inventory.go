@@ -0,0 +1,307 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+//! ============================================================================ //
+//? ========================== 📒 STOCK LEDGER 📒 ============================== //
+//! ============================================================================ //
+
+// Stock is never overwritten. Every change is a StockMovement appended to the
+// ledger at a location (see locations.go), and a variance's on-hand quantity
+// is the sum of its movements, per location and in total. Variance.Quantity
+// is kept equal to the total as a cache for search and sorting.
+//
+// A movement's quantity is the signed change to on-hand:
+//
+//	receipt     > 0  goods received, e.g. from a supplier
+//	sale        < 0  goods sold
+//	adjustment  ±    stock counts, damage, shrinkage and other corrections
+//	transfer    ±    one side of a move between locations
+//	return      > 0  goods a customer brought back
+//
+// Transfers are only made through /inventory/transfers, which records both
+// sides at once. A movement that would take a location below zero is refused,
+// and sales and transfers out cannot take stock that is reserved (see
+// reservations.go).
+
+const (
+	movementReceipt    = "receipt"
+	movementSale       = "sale"
+	movementAdjustment = "adjustment"
+	movementTransfer   = "transfer"
+	movementReturn     = "return"
+)
+
+// movementReasons are the reason codes allowed for each kind; the first is
+// the default when a movement gives none.
+var movementReasons = map[string][]string{
+	movementReceipt:    {"purchase", "found"},
+	movementSale:       {"sale"},
+	movementAdjustment: {"count", "damage", "shrinkage", "expiry", "found", "correction"},
+	movementTransfer:   {"relocation"},
+	movementReturn:     {"customer_return"},
+}
+
+// reasonCount is the adjustment recorded when stock is set to a counted
+// quantity, e.g. by /variance/upsert.
+const reasonCount = "count"
+
+// StockCount is a stock count taken with a variance upsert: the variance's
+// on-hand quantity at Movement.LocationID is Quantity, and Movement gives the
+// adjustment its reason, reference and author.
+type StockCount struct {
+	Quantity float64
+	Movement StockMovement
+}
+
+type StockMovement struct {
+	ID         int    `json:"id"`
+	VarianceID int    `json:"variance_id" binding:"required"`
+	Kind       string `json:"kind" binding:"required,oneof=receipt sale adjustment transfer return"`
+	// LocationID is where the movement happens; 0 means the main building.
+	LocationID int     `json:"location_id"`
+	Quantity   float64 `json:"quantity"`
+	// BalanceAfter is the variance's on-hand quantity at the location right
+	// after this movement.
+	BalanceAfter float64    `json:"balance_after"`
+	Reason       string     `json:"reason"`
+	Reference    string     `json:"reference" binding:"max=200"`
+	CreatedBy    string     `json:"created_by"`
+	CreatedAt    *time.Time `json:"created_at"`
+}
+
+// StockLevel is a variance's on-hand quantity as summed from the ledger, in
+// total and per location, with what active reservations leave available.
+type StockLevel struct {
+	VarianceID     int        `json:"variance_id"`
+	ProductID      string     `json:"product_id"`
+	OnHand         float64    `json:"on_hand"`
+	Reserved       float64    `json:"reserved"`
+	Available      float64    `json:"available"`
+	LastMovementAt *time.Time `json:"last_movement_at"`
+	// Locations lists every location the variance has had movements at, by
+	// location id.
+	Locations []LocationStock `json:"locations"`
+}
+
+// StockTransfer moves stock of one variance between two locations.
+type StockTransfer struct {
+	VarianceID     int     `json:"variance_id" binding:"required"`
+	FromLocationID int     `json:"from_location_id" binding:"required"`
+	ToLocationID   int     `json:"to_location_id" binding:"required"`
+	Quantity       float64 `json:"quantity" binding:"gt=0"`
+	Reference      string  `json:"reference" binding:"max=200"`
+}
+
+// Transfer is the pair of movements a StockTransfer records.
+type Transfer struct {
+	Out StockMovement `json:"out"`
+	In  StockMovement `json:"in"`
+}
+
+// MovementFilter narrows /inventory/movements; zero fields match everything.
+type MovementFilter struct {
+	VarianceID int
+	LocationID int
+	Kind       string
+	Reference  string
+}
+
+var movementSortFields = sortFields{
+	"id":         "id",
+	"quantity":   "quantity",
+	"created_at": "created_at",
+}
+
+func movementSortKey(m StockMovement, field string) any {
+	switch field {
+	case "quantity":
+		return m.Quantity
+	case "created_at":
+		return timeValue(m.CreatedAt)
+	}
+	return m.ID
+}
+
+// CodeInsufficientStock is returned when a movement or reservation would take
+// more than a location has: more than on-hand, or for sales, transfers out and
+// reservations, more than is available.
+const CodeInsufficientStock = "INSUFFICIENT_STOCK"
+
+func errInsufficientStock(varianceID int, available, change float64) *APIError {
+	return &APIError{Status: http.StatusConflict, Code: CodeInsufficientStock,
+		Message: fmt.Sprintf("Variance %d has %g available, %g cannot be taken", varianceID, available, -change),
+		Details: gin.H{"variance_id": varianceID, "available": available, "quantity": change}}
+}
+
+// validateMovement checks the quantity's sign and the reason code against the
+// movement kind. Unknown kinds are left to the oneof rule.
+func validateMovement(sl validator.StructLevel) {
+	m := sl.Current().Interface().(StockMovement)
+	reasons, ok := movementReasons[m.Kind]
+	if !ok {
+		return
+	}
+
+	switch {
+	case m.Quantity == 0:
+		sl.ReportError(m.Quantity, "quantity", "Quantity", "ne", "0")
+	case m.Quantity < 0 && (m.Kind == movementReceipt || m.Kind == movementReturn):
+		sl.ReportError(m.Quantity, "quantity", "Quantity", "gt", "0")
+	case m.Quantity > 0 && m.Kind == movementSale:
+		sl.ReportError(m.Quantity, "quantity", "Quantity", "lt", "0")
+	}
+	if m.Reason != "" && !contains(reasons, m.Reason) {
+		sl.ReportError(m.Reason, "reason", "Reason", "oneof", strings.Join(reasons, " "))
+	}
+}
+
+// validateTransfer checks that stock moves between two different locations.
+func validateTransfer(sl validator.StructLevel) {
+	t := sl.Current().Interface().(StockTransfer)
+	if t.FromLocationID != 0 && t.FromLocationID == t.ToLocationID {
+		sl.ReportError(t.ToLocationID, "to_location_id", "ToLocationID", "nefield", "from_location_id")
+	}
+}
+
+// unauthenticated is who a change made without basic auth is recorded as.
+const unauthenticated = "unauthenticated"
+
+// actor names who is making a change. Only the basic auth user is taken at
+// their word; anyone else is recorded as unauthenticated, with the name
+// X-User claims for them in brackets.
+func actor(c *gin.Context) string {
+	if user := c.GetString(gin.AuthUserKey); user != "" {
+		return user
+	}
+	if claimed := c.GetHeader("X-User"); claimed != "" {
+		return fmt.Sprintf("%s (%s)", unauthenticated, claimed)
+	}
+	return unauthenticated
+}
+
+//? ---------------------------- http handlers ------------------------------ //
+
+func (s *server) recordMovement(c *gin.Context) {
+	var m StockMovement
+	if err := c.ShouldBindJSON(&m); err != nil {
+		respondError(c, errBinding(err))
+		return
+	}
+	if m.Kind == movementTransfer {
+		respondError(c, errBadRequest("Transfers are recorded through /inventory/transfers"))
+		return
+	}
+	if m.Reason == "" {
+		m.Reason = movementReasons[m.Kind][0]
+	}
+	now := time.Now()
+	m.ID, m.BalanceAfter, m.CreatedAt, m.CreatedBy = 0, 0, &now, actor(c)
+
+	result, err := s.store.Inventory.RecordMovement(c.Request.Context(), m)
+	if errors.Is(err, errNotFound) {
+		respondError(c, errNotFoundf("Variance %d does not exist", m.VarianceID))
+		return
+	}
+	if err != nil {
+		respondError(c, storeError(err, "Failed to record stock movement"))
+		return
+	}
+	s.alerts.stockChanged(c.Request.Context(), result.VarianceID, result.LocationID)
+	respondOK(c, result)
+}
+
+func (s *server) listMovements(c *gin.Context) {
+	opts, err := listParams(c, movementSortFields)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	f := MovementFilter{Kind: c.Query("kind"), Reference: c.Query("reference")}
+	if _, ok := movementReasons[f.Kind]; f.Kind != "" && !ok {
+		respondError(c, errBadRequest(fmt.Sprintf("kind must be one of: %s, %s, %s, %s, %s",
+			movementReceipt, movementSale, movementAdjustment, movementTransfer, movementReturn)))
+		return
+	}
+	for param, id := range map[string]*int{"variance_id": &f.VarianceID, "location_id": &f.LocationID} {
+		if raw := c.Query(param); raw != "" {
+			if *id, err = strconv.Atoi(raw); err != nil {
+				respondError(c, errBadRequest(param+" must be a number"))
+				return
+			}
+		}
+	}
+
+	page, err := s.store.Inventory.ListMovements(c.Request.Context(), f, opts)
+	if err != nil {
+		respondError(c, storeError(err, "Failed to fetch stock movements"))
+		return
+	}
+	respondPage(c, page)
+}
+
+func (s *server) transferStock(c *gin.Context) {
+	var t StockTransfer
+	if err := c.ShouldBindJSON(&t); err != nil {
+		respondError(c, errBinding(err))
+		return
+	}
+
+	now := time.Now()
+	side := StockMovement{VarianceID: t.VarianceID, Kind: movementTransfer, Reason: movementReasons[movementTransfer][0],
+		Reference: t.Reference, CreatedBy: actor(c), CreatedAt: &now}
+	out, in := side, side
+	out.LocationID, out.Quantity = t.FromLocationID, -t.Quantity
+	in.LocationID, in.Quantity = t.ToLocationID, t.Quantity
+
+	result, err := s.store.Inventory.Transfer(c.Request.Context(), out, in)
+	if errors.Is(err, errNotFound) {
+		respondError(c, errNotFoundf("Variance %d does not exist", t.VarianceID))
+		return
+	}
+	if err != nil {
+		respondError(c, storeError(err, "Failed to transfer stock"))
+		return
+	}
+	s.alerts.stockChanged(c.Request.Context(), t.VarianceID, result.Out.LocationID, result.In.LocationID)
+	respondOK(c, result)
+}
+
+func (s *server) getStockLevel(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, errBadRequest("Variance id must be a number"))
+		return
+	}
+
+	level, err := s.store.Inventory.StockLevel(c.Request.Context(), id)
+	if errors.Is(err, errNotFound) {
+		respondError(c, errNotFoundf("Variance %d does not exist", id))
+		return
+	}
+	if err != nil {
+		respondError(c, storeError(err, "Failed to fetch stock level"))
+		return
+	}
+	respondOK(c, level)
+}
+
+func (s *server) getStockLevelsByProduct(c *gin.Context) {
+	levels, err := s.store.Inventory.StockLevels(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondError(c, storeError(err, "Failed to fetch stock levels"))
+		return
+	}
+	respondAll(c, levels)
+}
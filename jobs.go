@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+//! ============================================================================ //
+//? ======================== ⏰ BACKGROUND JOBS ⏰ ============================= //
+//! ============================================================================ //
+
+// serve runs a few jobs on a timer next to the HTTP server. They stop with
+// the server; a failing run is logged and retried at the next tick.
+
+// job is work serve repeats every interval.
+type job struct {
+	name     string
+	interval time.Duration
+	run      func(context.Context) error
+}
+
+// backgroundJobs lists the jobs runServe starts.
+func backgroundJobs(cfg *Config, stores Stores) []job {
+	return []job{
+		{name: "reservation sweeper", interval: cfg.Inventory.ReservationSweepInterval.Std(), run: sweepReservations(stores.Reservations)},
+		{name: "price scheduler", interval: cfg.Pricing.ScheduleInterval.Std(), run: applyScheduledPrices(stores.PriceHistory)},
+	}
+}
+
+// startJobs runs each job until ctx is done. Wait on the result for the runs
+// in progress to finish.
+func startJobs(ctx context.Context, jobs []job) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	for _, j := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(j.interval)
+			defer ticker.Stop()
+
+			log.Printf("⏰ %s runs every %s", j.name, j.interval)
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+				if err := j.run(ctx); err != nil && ctx.Err() == nil {
+					log.Printf("🔴 %s failed: %v", j.name, err)
+				}
+			}
+		}()
+	}
+	return &wg
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//! ============================================================================ //
+//? ============================ 🏬 LOCATIONS 🏬 ================================ //
+//! ============================================================================ //
+
+// Stock is held at locations: the main building, stores and yards. Every
+// movement happens at one location, and transfers move stock between two.
+// The main building (defaultLocationCode) always exists and takes movements
+// that name no location, including stock counts from /variance/upsert.
+
+// defaultLocationCode matches the department the queries default to.
+const defaultLocationCode = "mainBuilding"
+
+type Location struct {
+	ID        int        `json:"id"`
+	Code      string     `json:"code" binding:"required,max=40"`
+	Name      string     `json:"name" binding:"required,max=120"`
+	Kind      string     `json:"kind" binding:"omitempty,oneof=store warehouse yard"`
+	Address   string     `json:"address"`
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+// LocationStock is a variance's stock at one location.
+type LocationStock struct {
+	LocationID int     `json:"location_id"`
+	Code       string  `json:"code"`
+	Name       string  `json:"name"`
+	OnHand     float64 `json:"on_hand"`
+	Reserved   float64 `json:"reserved"`
+	Available  float64 `json:"available"`
+}
+
+var locationSortFields = sortFields{
+	"id":         "id",
+	"code":       "code",
+	"name":       "name",
+	"kind":       "kind",
+	"created_at": "created_at",
+}
+
+func locationSortKey(l Location, field string) any {
+	switch field {
+	case "code":
+		return l.Code
+	case "name":
+		return l.Name
+	case "kind":
+		return l.Kind
+	case "created_at":
+		return timeValue(l.CreatedAt)
+	}
+	return l.ID
+}
+
+// errUnknownLocation is returned by the inventory stores for a movement or
+// transfer at a location that does not exist.
+func errUnknownLocation(id int) *APIError {
+	return &APIError{Status: http.StatusUnprocessableEntity, Code: CodeForeignKey,
+		Message: fmt.Sprintf("Location %d does not exist", id), Details: gin.H{"location_id": id}}
+}
+
+// matchesLocation reports whether l is named by ref, an id or a code.
+func matchesLocation(l Location, ref string) bool {
+	return l.Code == ref || strconv.Itoa(l.ID) == ref
+}
+
+//? ---------------------------- http handlers ------------------------------ //
+
+func (s *server) insertOrUpdateLocation(c *gin.Context) {
+	var l Location
+	if err := c.ShouldBindJSON(&l); err != nil {
+		log.Println("📢 upserting location to json parsing got error", err)
+		respondError(c, errBinding(err))
+		return
+	}
+	if l.Kind == "" {
+		l.Kind = "store"
+	}
+
+	now := time.Now()
+	l.CreatedAt = &now
+
+	result, err := s.store.Locations.UpsertLocation(c.Request.Context(), l)
+	if err != nil {
+		respondError(c, storeError(err, "Failed to upsert location"))
+		return
+	}
+
+	respondOK(c, result)
+}
+
+func (s *server) getLocations(c *gin.Context) {
+	opts, err := listParams(c, locationSortFields)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	locations, err := s.store.Locations.ListLocations(c.Request.Context(), opts)
+	if err != nil {
+		respondError(c, storeError(err, "Failed to fetch locations"))
+		return
+	}
+
+	respondPage(c, locations)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// testLocation adds a yard with a code of its own.
+func testLocation(t *testing.T, stores Stores) Location {
+	t.Helper()
+	now := time.Now()
+	code := fmt.Sprintf("yard-%d", now.UnixNano())
+	l, err := stores.Locations.UpsertLocation(context.Background(), Location{Code: code, Name: "Test yard", Kind: "yard", CreatedAt: &now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func testTransfer(stores Stores, varianceID, from, to int, quantity float64) (Transfer, error) {
+	now := time.Now()
+	side := StockMovement{VarianceID: varianceID, Kind: movementTransfer, Reason: movementReasons[movementTransfer][0],
+		Reference: "test", CreatedBy: "test", CreatedAt: &now}
+	out, in := side, side
+	out.LocationID, out.Quantity = from, -quantity
+	in.LocationID, in.Quantity = to, quantity
+	return stores.Inventory.Transfer(context.Background(), out, in)
+}
+
+// onHandAt is the variance's on-hand quantity at each location, by id.
+func onHandAt(t *testing.T, stores Stores, varianceID int) (float64, map[int]float64) {
+	t.Helper()
+	level, err := stores.Inventory.StockLevel(context.Background(), varianceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := map[int]float64{}
+	for _, l := range level.Locations {
+		at[l.LocationID] = l.OnHand
+	}
+	return level.OnHand, at
+}
+
+func TestTransferMovesStockBetweenLocations(t *testing.T) {
+	for name, stores := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			v := testVarianceWithStock(t, stores, 10)
+			yard := testLocation(t, stores)
+			_, before := onHandAt(t, stores, v.ID)
+			var main int
+			for id := range before {
+				main = id
+			}
+
+			tr, err := testTransfer(stores, v.ID, main, yard.ID, 4)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tr.Out.BalanceAfter != 6 || tr.In.BalanceAfter != 4 {
+				t.Errorf("balances after = %v out, %v in, want 6 and 4", tr.Out.BalanceAfter, tr.In.BalanceAfter)
+			}
+			total, at := onHandAt(t, stores, v.ID)
+			if total != 10 || at[main] != 6 || at[yard.ID] != 4 {
+				t.Errorf("on hand %v, %v at main and %v at the yard, want 10, 6 and 4", total, at[main], at[yard.ID])
+			}
+
+			// Neither side is recorded when one fails.
+			if _, err := testTransfer(stores, v.ID, yard.ID, main, 5); errCode(err) != CodeInsufficientStock {
+				t.Errorf("moving 5 out of 4: err = %v, want %s", err, CodeInsufficientStock)
+			}
+			if _, err := testTransfer(stores, v.ID, main, -1, 1); errCode(err) != CodeForeignKey {
+				t.Errorf("moving into an unknown location: err = %v, want %s", err, CodeForeignKey)
+			}
+			total, at = onHandAt(t, stores, v.ID)
+			if total != 10 || at[main] != 6 || at[yard.ID] != 4 {
+				t.Errorf("after failed transfers: %v, %v at main and %v at the yard, want 10, 6 and 4", total, at[main], at[yard.ID])
+			}
+		})
+	}
+}
+
+// Reserved stock at a location cannot be moved away from it.
+func TestTransferLeavesReservedStock(t *testing.T) {
+	for name, stores := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			v := testVarianceWithStock(t, stores, 5)
+			yard := testLocation(t, stores)
+			res, err := stores.Reservations.Reserve(context.Background(), testReservation(v.ID, 3, time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := testTransfer(stores, v.ID, res.LocationID, yard.ID, 3); errCode(err) != CodeInsufficientStock {
+				t.Errorf("moving 3 with 2 available: err = %v, want %s", err, CodeInsufficientStock)
+			}
+			if _, err := testTransfer(stores, v.ID, res.LocationID, yard.ID, 2); err != nil {
+				t.Errorf("moving the 2 available: %v", err)
+			}
+		})
+	}
+}
+
+func TestUpsertLocationKeepsItsID(t *testing.T) {
+	for name, stores := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			l := testLocation(t, stores)
+			l.Name = "Renamed yard"
+			again, err := stores.Locations.UpsertLocation(context.Background(), l)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again.ID != l.ID || again.Name != "Renamed yard" {
+				t.Errorf("upsert on code %s gave %+v, want id %d renamed", l.Code, again, l.ID)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+	log.SetOutput(io.Discard)
+	registerValidators()
+	os.Exit(m.Run())
+}
+
+// testConfig loads a Config from env alone, on the in-memory store.
+func testConfig(t *testing.T, env map[string]string) *Config {
+	t.Helper()
+	lookup := func(key string) (string, bool) {
+		if key == "STORE" {
+			return storeMemory, true
+		}
+		v, ok := env[key]
+		return v, ok
+	}
+	cfg, err := loadConfig(lookup)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	return cfg
+}
+
+// testEnvelope is the body of every response.
+type testEnvelope struct {
+	Success bool            `json:"success"`
+	Data    json.RawMessage `json:"data"`
+	Meta    struct {
+		Total       int          `json:"total"`
+		Count       int          `json:"count"`
+		NextCursor  string       `json:"next_cursor"`
+		Suggestions []Suggestion `json:"suggestions"`
+		Facets      *Facets      `json:"facets"`
+	} `json:"meta"`
+	Error *struct {
+		Code    string          `json:"code"`
+		Message string          `json:"message"`
+		Details json.RawMessage `json:"details"`
+	} `json:"error"`
+}
+
+// serveJSON sends a request with body, a raw JSON string or a value to
+// encode, and decodes the envelope of the response.
+func serveJSON(t *testing.T, r http.Handler, method, path string, body any) (*httptest.ResponseRecorder, testEnvelope) {
+	t.Helper()
+	var raw []byte
+	switch b := body.(type) {
+	case nil:
+	case string:
+		raw = []byte(b)
+	default:
+		var err error
+		if raw, err = json.Marshal(b); err != nil {
+			t.Fatalf("encoding body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(raw))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var env testEnvelope
+	if w.Body.Len() > 0 && w.Header().Get("Content-Type") != "text/plain; charset=utf-8" {
+		if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+			t.Fatalf("%s %s: decoding %q: %v", method, path, w.Body.String(), err)
+		}
+	}
+	return w, env
+}
+
+// decodeData decodes the data of env into v.
+func decodeData(t *testing.T, env testEnvelope, v any) {
+	t.Helper()
+	if err := json.Unmarshal(env.Data, v); err != nil {
+		t.Fatalf("decoding data %s: %v", env.Data, err)
+	}
+}
+
+func TestSetupRouterFromConfig(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   map[string]string
+		admin int
+	}{
+		{name: "without accounts", env: map[string]string{}, admin: http.StatusNotFound},
+		{name: "with accounts", env: map[string]string{"BASIC_AUTH_ACCOUNTS": "foo:bar"}, admin: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, tt.env)
+			// Routers are built again and again, as every test does
+			for range 2 {
+				r := setupRouter(cfg, newMemoryStore(cfg.Pricing).stores())
+
+				w, _ := serveJSON(t, r, http.MethodGet, "/ping", nil)
+				if w.Code != http.StatusOK || w.Body.String() != "pong" {
+					t.Fatalf("GET /ping = %d %q", w.Code, w.Body.String())
+				}
+				if w, _ := serveJSON(t, r, http.MethodPost, "/admin", `{"value":"x"}`); w.Code != tt.admin {
+					t.Errorf("POST /admin = %d, want %d", w.Code, tt.admin)
+				}
+			}
+		})
+	}
+}
+
+func TestSetupRouterAdminAuthenticated(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"BASIC_AUTH_ACCOUNTS": "foo:bar"})
+	r := setupRouter(cfg, newMemoryStore(cfg.Pricing).stores())
+
+	req := httptest.NewRequest(http.MethodPost, "/admin", bytes.NewReader([]byte(`{"value":"x"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth("foo", "bar")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /admin as foo = %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//! ============================================================================ //
+//? ======================= 🧱 SCHEMA MIGRATIONS 🧱 ============================ //
+//! ============================================================================ //
+
+// Migrations live in migrations/ as NNNN_name.up.sql / NNNN_name.down.sql and
+// are compiled into the binary. Applied versions are recorded in
+// schema_migrations. A migration that needs configuration, such as the base
+// currency to backfill with, reads it with current_setting('migrate.<name>');
+// see migrator.settings.
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// migrationLockID is the pg_advisory_lock key that keeps two deploys from
+// migrating at once.
+const migrationLockID = 727274
+
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+func loadMigrations(fsys fs.FS) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*migration{}
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migrations/%s: name must look like 0001_name.up.sql", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		body, err := fs.ReadFile(fsys, path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: match[2]}
+			byVersion[version] = m
+		} else if m.name != match[2] {
+			return nil, fmt.Errorf("migration %04d has two names: %s and %s", version, m.name, match[2])
+		}
+		if match[3] == "up" {
+			m.up = string(body)
+		} else {
+			m.down = string(body)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", m.version, m.name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+type migrator struct {
+	db         *sql.DB
+	migrations []migration
+	// settings are set for the length of each migration's transaction,
+	// under the migrate. prefix.
+	settings map[string]string
+}
+
+// newMigrator migrates db for a catalog kept in currency, CURRENCY, which
+// migrations backfill existing rows with.
+func newMigrator(db *sql.DB, currency string) (*migrator, error) {
+	if !validCurrency(currency) {
+		return nil, fmt.Errorf("migrating needs the base currency, not %q", currency)
+	}
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return nil, err
+	}
+	return &migrator{db: db, migrations: migrations, settings: map[string]string{"currency": currency}}, nil
+}
+
+// withLock runs fn on a single connection holding the migration advisory lock.
+func (m *migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("acquiring migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)
+	`); err != nil {
+		return fmt.Errorf("creating schema_migrations: %w", err)
+	}
+	return fn(conn)
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// up applies pending migrations in order; steps <= 0 applies all of them.
+func (m *migrator) up(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		done := 0
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.version]; ok {
+				continue
+			}
+			if steps > 0 && done == steps {
+				break
+			}
+			log.Printf("⬆️  applying %04d_%s", mig.version, mig.name)
+			if err := runMigration(ctx, conn, m.settings, mig.up,
+				`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, mig.version, mig.name); err != nil {
+				return fmt.Errorf("%04d_%s up: %w", mig.version, mig.name, err)
+			}
+			done++
+		}
+		if done == 0 {
+			log.Println("📢 schema is up to date")
+		}
+		return nil
+	})
+}
+
+// down rolls back the most recently applied migrations; steps <= 0 means one.
+func (m *migrator) down(ctx context.Context, steps int) error {
+	if steps <= 0 {
+		steps = 1
+	}
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		done := 0
+		for i := len(m.migrations) - 1; i >= 0 && done < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.version]; !ok {
+				continue
+			}
+			log.Printf("⬇️  reverting %04d_%s", mig.version, mig.name)
+			if err := runMigration(ctx, conn, m.settings, mig.down,
+				`DELETE FROM schema_migrations WHERE version = $1`, mig.version); err != nil {
+				return fmt.Errorf("%04d_%s down: %w", mig.version, mig.name, err)
+			}
+			done++
+		}
+		if done == 0 {
+			log.Println("📢 nothing to roll back")
+		}
+		return nil
+	})
+}
+
+// runMigration executes a migration body and its bookkeeping statement in one
+// transaction so a failed migration leaves no trace. settings are visible to
+// the body as migrate.<name> until the transaction ends.
+func runMigration(ctx context.Context, conn *sql.Conn, settings map[string]string, body, record string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for name, value := range settings {
+		if _, err := tx.ExecContext(ctx, `SELECT set_config($1, $2, true)`, "migrate."+name, value); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, body); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m *migrator) status(ctx context.Context, w io.Writer) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			state := "pending"
+			if at, ok := applied[mig.version]; ok {
+				state = "applied " + at.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d_%-30s %s\n", mig.version, mig.name, state)
+		}
+		return nil
+	})
+}
+
+// runMigrate implements "app migrate up|down|status [steps]".
+func runMigrate(cfg *Config, args []string) error {
+	if cfg.Store != storePostgres {
+		return fmt.Errorf("migrate needs STORE=%s", storePostgres)
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up|down|status [steps]")
+	}
+
+	steps := 0
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return fmt.Errorf("steps %q must be a positive number", args[1])
+		}
+		steps = n
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	m, err := newMigrator(db, cfg.Pricing.Currency)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		return m.up(ctx, steps)
+	case "down":
+		return m.down(ctx, steps)
+	case "status":
+		return m.status(ctx, os.Stdout)
+	}
+	return fmt.Errorf("unknown migrate action %q (want up, down or status)", args[0])
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Errorf("migration %d is %04d_%s, want version %d: versions must not skip", i, m.version, m.name, i+1)
+		}
+		if strings.TrimSpace(m.up) == "" || strings.TrimSpace(m.down) == "" {
+			t.Errorf("%04d_%s has an empty up or down", m.version, m.name)
+		}
+	}
+}
+
+func TestLoadMigrationsRejects(t *testing.T) {
+	file := func(body string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(body)} }
+	tests := map[string]fstest.MapFS{
+		"badly named": {
+			"migrations/0001_init.up.sql":   file("CREATE TABLE a ()"),
+			"migrations/0001_init.down.sql": file("DROP TABLE a"),
+			"migrations/init.sql":           file("CREATE TABLE b ()"),
+		},
+		"without a down": {
+			"migrations/0001_init.up.sql": file("CREATE TABLE a ()"),
+		},
+		"with two names": {
+			"migrations/0001_init.up.sql":     file("CREATE TABLE a ()"),
+			"migrations/0001_create.down.sql": file("DROP TABLE a"),
+		},
+	}
+	for name, fsys := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := loadMigrations(fsys); err == nil {
+				t.Error("loaded without an error")
+			}
+		})
+	}
+}
+
+func TestLoadMigrationsOrdersByVersion(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for _, name := range []string{"0010_ten", "0002_two", "0001_one"} {
+		fsys["migrations/"+name+".up.sql"] = &fstest.MapFile{Data: []byte("-- up " + name)}
+		fsys["migrations/"+name+".down.sql"] = &fstest.MapFile{Data: []byte("-- down " + name)}
+	}
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, m := range migrations {
+		names = append(names, m.name)
+	}
+	if got := strings.Join(names, ","); got != "one,two,ten" {
+		t.Errorf("order = %s, want one,two,ten", got)
+	}
+	if migrations[2].up != "-- up 0010_ten" || migrations[2].down != "-- down 0010_ten" {
+		t.Errorf("0010 = %+v, want its own up and down", migrations[2])
+	}
+}
+
+func TestNewMigratorNeedsACurrency(t *testing.T) {
+	for _, currency := range []string{"", "lkr", "RUPEE"} {
+		if _, err := newMigrator(nil, currency); err == nil {
+			t.Errorf("newMigrator(%q): no error", currency)
+		}
+	}
+}
+
+// Against Postgres, migrating up leaves nothing pending and a second run is
+// a no-op.
+func TestMigrateUpIsIdempotent(t *testing.T) {
+	url := os.Getenv("DATABASE_URL")
+	if url == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := newMigrator(db, defaultConfig().Pricing.Currency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for range 2 {
+		if err := m.up(ctx, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var status bytes.Buffer
+	if err := m.status(ctx, &status); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(status.String(), "pending") {
+		t.Errorf("status after up:\n%s", status.String())
+	}
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS products_variances;
+DROP TABLE IF EXISTS supplier_tb;
+DROP TABLE IF EXISTS brand;
+DROP TABLE IF EXISTS products;
@@ -0,0 +1,85 @@
+-- Catalog tables the handlers have always assumed. IF NOT EXISTS lets this
+-- migration adopt a database that was created by hand before migrations
+-- existed; the unique constraints back the ON CONFLICT clauses in the upserts.
+
+CREATE TABLE IF NOT EXISTS products (
+    id               TEXT PRIMARY KEY,
+    title            TEXT NOT NULL DEFAULT '',
+    description      TEXT,
+    tag_one          TEXT,
+    tag_two          TEXT,
+    imageurl         TEXT,
+    department       TEXT DEFAULT 'mainBuilding',
+    main_catogory    TEXT,
+    sub_catogory     TEXT,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_modified_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS products_last_modified_at_idx ON products (last_modified_at DESC);
+CREATE INDEX IF NOT EXISTS products_department_idx ON products (department);
+CREATE INDEX IF NOT EXISTS products_main_catogory_idx ON products (main_catogory);
+CREATE INDEX IF NOT EXISTS products_sub_catogory_idx ON products (sub_catogory);
+
+CREATE TABLE IF NOT EXISTS brand (
+    id                 SERIAL PRIMARY KEY,
+    name               TEXT NOT NULL,
+    description        TEXT,
+    logourl            TEXT,
+    coutry_of_origin   TEXT,
+    social_media_links TEXT,
+    contact_email      TEXT,
+    phone_number       TEXT,
+    banner_url         TEXT,
+    website            TEXT,
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT brand_name_key UNIQUE (name)
+);
+
+CREATE TABLE IF NOT EXISTS supplier_tb (
+    id                 SERIAL PRIMARY KEY,
+    name               TEXT NOT NULL,
+    description        TEXT,
+    logourl            TEXT,
+    website            TEXT,
+    coutry_of_origin   TEXT,
+    social_media_links TEXT,
+    contact_email      TEXT,
+    phone_number       TEXT,
+    banner_url         TEXT,
+    city               TEXT,
+    country            TEXT,
+    bank_details       TEXT,
+    status             TEXT,
+    extra_data         TEXT,
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT supplier_tb_name_key UNIQUE (name)
+);
+
+CREATE TABLE IF NOT EXISTS products_variances (
+    id                     SERIAL PRIMARY KEY,
+    product_id             TEXT NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+    product                TEXT NOT NULL,
+    variance               TEXT NOT NULL,
+    brand_name             TEXT NOT NULL DEFAULT '',
+    variance_display_title TEXT,
+    about_this_variance    TEXT,
+    images                 JSONB NOT NULL DEFAULT '[]'::jsonb,
+    supplier               TEXT,
+    original_price         NUMERIC(12, 2),
+    retail_price           NUMERIC(12, 2),
+    wholesale_price        NUMERIC(12, 2),
+    quantity               DOUBLE PRECISION,
+    unit_measure           TEXT,
+    least_sub_unit_measure DOUBLE PRECISION,
+    barcode                TEXT,
+    created_at             TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_modified_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT products_variances_product_variance_brand_name_key UNIQUE (product, variance, brand_name)
+);
+
+CREATE INDEX IF NOT EXISTS products_variances_product_id_idx ON products_variances (product_id);
+CREATE INDEX IF NOT EXISTS products_variances_last_modified_at_idx ON products_variances (last_modified_at DESC);
+CREATE INDEX IF NOT EXISTS products_variances_brand_name_idx ON products_variances (brand_name);
+CREATE INDEX IF NOT EXISTS products_variances_supplier_idx ON products_variances (supplier);
+CREATE INDEX IF NOT EXISTS products_variances_barcode_idx ON products_variances (barcode);
@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS products_variances_search_vector ON products_variances;
+DROP TRIGGER IF EXISTS products_search_vector ON products;
+DROP FUNCTION IF EXISTS products_variances_search_vector_trigger();
+DROP FUNCTION IF EXISTS products_search_vector_trigger();
+DROP FUNCTION IF EXISTS product_search_vector(TEXT, TEXT, TEXT, TEXT, TEXT);
+DROP INDEX IF EXISTS products_search_vector_idx;
+ALTER TABLE products DROP COLUMN IF EXISTS search_vector;
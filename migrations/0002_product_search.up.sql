@@ -0,0 +1,59 @@
+-- Full-text search over the catalog. Each product carries a weighted
+-- search_vector:
+--
+--   A  title
+--   B  tags and the brands of its variances
+--   C  variance display titles
+--   D  description
+--
+-- The 'simple' configuration keeps product words unstemmed, so prefix
+-- queries like 'cem:*' behave predictably on names and codes.
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector tsvector;
+
+CREATE OR REPLACE FUNCTION product_search_vector(
+    p_id TEXT, p_title TEXT, p_description TEXT, p_tag_one TEXT, p_tag_two TEXT
+) RETURNS tsvector LANGUAGE sql STABLE AS $$
+    SELECT setweight(to_tsvector('simple', coalesce(p_title, '')), 'A')
+        || setweight(to_tsvector('simple', coalesce(p_tag_one, '') || ' ' || coalesce(p_tag_two, '')), 'B')
+        || setweight(to_tsvector('simple', coalesce(
+               (SELECT string_agg(DISTINCT brand_name, ' ') FROM products_variances WHERE product_id = p_id), '')), 'B')
+        || setweight(to_tsvector('simple', coalesce(
+               (SELECT string_agg(variance_display_title, ' ') FROM products_variances WHERE product_id = p_id), '')), 'C')
+        || setweight(to_tsvector('simple', coalesce(p_description, '')), 'D')
+$$;
+
+CREATE OR REPLACE FUNCTION products_search_vector_trigger() RETURNS trigger LANGUAGE plpgsql AS $$
+BEGIN
+    NEW.search_vector := product_search_vector(NEW.id, NEW.title, NEW.description, NEW.tag_one, NEW.tag_two);
+    RETURN NEW;
+END
+$$;
+
+-- A variance change re-indexes the product(s) it belongs to.
+CREATE OR REPLACE FUNCTION products_variances_search_vector_trigger() RETURNS trigger LANGUAGE plpgsql AS $$
+BEGIN
+    UPDATE products p
+    SET search_vector = product_search_vector(p.id, p.title, p.description, p.tag_one, p.tag_two)
+    WHERE p.id IN (
+        CASE WHEN TG_OP <> 'DELETE' THEN NEW.product_id END,
+        CASE WHEN TG_OP <> 'INSERT' THEN OLD.product_id END
+    );
+    RETURN NULL;
+END
+$$;
+
+DROP TRIGGER IF EXISTS products_search_vector ON products;
+CREATE TRIGGER products_search_vector
+    BEFORE INSERT OR UPDATE OF title, description, tag_one, tag_two ON products
+    FOR EACH ROW EXECUTE FUNCTION products_search_vector_trigger();
+
+DROP TRIGGER IF EXISTS products_variances_search_vector ON products_variances;
+CREATE TRIGGER products_variances_search_vector
+    AFTER INSERT OR UPDATE OF product_id, brand_name, variance_display_title OR DELETE ON products_variances
+    FOR EACH ROW EXECUTE FUNCTION products_variances_search_vector_trigger();
+
+UPDATE products
+SET search_vector = product_search_vector(id, title, description, tag_one, tag_two);
+
+CREATE INDEX IF NOT EXISTS products_search_vector_idx ON products USING GIN (search_vector);
@@ -0,0 +1,6 @@
+-- The extension is left installed; other schemas in the database may use it.
+DROP INDEX IF EXISTS supplier_tb_name_trgm_idx;
+DROP INDEX IF EXISTS brand_name_trgm_idx;
+DROP INDEX IF EXISTS products_variances_supplier_trgm_idx;
+DROP INDEX IF EXISTS products_variances_brand_name_trgm_idx;
+DROP INDEX IF EXISTS products_title_trgm_idx;
@@ -0,0 +1,12 @@
+-- Typo-tolerant search (mode=fuzzy) with pg_trgm. The GIN trigram indexes let
+-- the <% (word similarity) operator find candidates without a sequential
+-- scan; brand and supplier names are matched through the variances that
+-- carry them, and looked up directly for suggestions.
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS products_title_trgm_idx ON products USING GIN (title gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS products_variances_brand_name_trgm_idx ON products_variances USING GIN (brand_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS products_variances_supplier_trgm_idx ON products_variances USING GIN (supplier gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS brand_name_trgm_idx ON brand USING GIN (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS supplier_tb_name_trgm_idx ON supplier_tb USING GIN (name gin_trgm_ops);
@@ -0,0 +1,2 @@
+-- products_variances.quantity already holds the current on-hand quantities.
+DROP TABLE IF EXISTS stock_movements;
@@ -0,0 +1,35 @@
+-- Stock ledger. Every change to a variance's stock is an append-only row in
+-- stock_movements; on-hand is the sum of a variance's movements.
+-- products_variances.quantity stays as a cache of that sum, written in the
+-- same transaction as each movement, so search filters and sorts on quantity
+-- keep working without aggregating the ledger.
+--
+-- quantity is the signed change: receipts and returns add stock, sales take
+-- it away, adjustments and transfers go either way. balance_after is the
+-- on-hand quantity right after the movement.
+
+CREATE TABLE IF NOT EXISTS stock_movements (
+    id            SERIAL PRIMARY KEY,
+    variance_id   INTEGER NOT NULL REFERENCES products_variances (id) ON DELETE CASCADE,
+    kind          TEXT NOT NULL,
+    quantity      DOUBLE PRECISION NOT NULL,
+    balance_after DOUBLE PRECISION NOT NULL,
+    reason        TEXT NOT NULL,
+    reference     TEXT NOT NULL DEFAULT '',
+    created_by    TEXT NOT NULL DEFAULT '',
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT stock_movements_kind_check CHECK (kind IN ('receipt', 'sale', 'adjustment', 'transfer', 'return')),
+    CONSTRAINT stock_movements_quantity_check CHECK (quantity <> 0),
+    CONSTRAINT stock_movements_balance_after_check CHECK (balance_after >= 0)
+);
+
+CREATE INDEX IF NOT EXISTS stock_movements_variance_id_idx ON stock_movements (variance_id, id);
+CREATE INDEX IF NOT EXISTS stock_movements_reference_idx ON stock_movements (reference) WHERE reference <> '';
+
+-- Open the ledger with the quantities the variances have today.
+UPDATE products_variances SET quantity = 0 WHERE quantity IS NULL OR quantity < 0;
+
+INSERT INTO stock_movements (variance_id, kind, quantity, balance_after, reason, reference, created_by)
+SELECT id, 'adjustment', quantity, quantity, 'count', 'opening balance', 'migration'
+FROM products_variances
+WHERE quantity > 0;
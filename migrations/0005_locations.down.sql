@@ -0,0 +1,6 @@
+-- Stock at other locations folds back into the single quantity per variance,
+-- which products_variances.quantity already holds.
+DROP TABLE IF EXISTS stock_levels;
+DROP INDEX IF EXISTS stock_movements_location_id_idx;
+ALTER TABLE stock_movements DROP COLUMN IF EXISTS location_id;
+DROP TABLE IF EXISTS locations;
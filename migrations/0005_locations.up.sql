@@ -0,0 +1,45 @@
+-- Stock locations: the main building, stores and yards. Movements now happen
+-- at a location, and stock_levels caches each variance's on-hand quantity
+-- per location the way products_variances.quantity caches the total. Both
+-- caches are written in the same transaction as the movement.
+--
+-- Everything recorded so far happened at the main building, which is also
+-- where movements go when they name no location.
+
+CREATE TABLE IF NOT EXISTS locations (
+    id         SERIAL PRIMARY KEY,
+    code       TEXT NOT NULL,
+    name       TEXT NOT NULL,
+    kind       TEXT NOT NULL DEFAULT 'store',
+    address    TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT locations_code_key UNIQUE (code),
+    CONSTRAINT locations_kind_check CHECK (kind IN ('store', 'warehouse', 'yard'))
+);
+
+INSERT INTO locations (code, name, kind) VALUES ('mainBuilding', 'Main building', 'store')
+ON CONFLICT (code) DO NOTHING;
+
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS location_id INTEGER REFERENCES locations (id);
+UPDATE stock_movements SET location_id = (SELECT id FROM locations WHERE code = 'mainBuilding')
+WHERE location_id IS NULL;
+ALTER TABLE stock_movements ALTER COLUMN location_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS stock_movements_location_id_idx ON stock_movements (location_id);
+
+CREATE TABLE IF NOT EXISTS stock_levels (
+    variance_id INTEGER NOT NULL REFERENCES products_variances (id) ON DELETE CASCADE,
+    location_id INTEGER NOT NULL REFERENCES locations (id),
+    quantity    DOUBLE PRECISION NOT NULL DEFAULT 0,
+    PRIMARY KEY (variance_id, location_id),
+    CONSTRAINT stock_levels_quantity_check CHECK (quantity >= 0)
+);
+
+-- Finds what is available at a location for the search filter.
+CREATE INDEX IF NOT EXISTS stock_levels_location_id_idx ON stock_levels (location_id, variance_id) WHERE quantity > 0;
+
+INSERT INTO stock_levels (variance_id, location_id, quantity)
+SELECT variance_id, location_id, SUM(quantity)
+FROM stock_movements
+GROUP BY variance_id, location_id
+ON CONFLICT (variance_id, location_id) DO UPDATE SET quantity = EXCLUDED.quantity;
@@ -0,0 +1,24 @@
+-- Stock reservations hold a variance's stock at a location until they are
+-- confirmed into a sale, released, or expire. Available stock is on-hand less
+-- the active reservations whose expires_at is still ahead; the partial index
+-- serves that sum, which runs with the variance row locked.
+
+CREATE TABLE IF NOT EXISTS stock_reservations (
+    id          SERIAL PRIMARY KEY,
+    variance_id INTEGER NOT NULL REFERENCES products_variances (id) ON DELETE CASCADE,
+    location_id INTEGER NOT NULL REFERENCES locations (id),
+    quantity    DOUBLE PRECISION NOT NULL,
+    status      TEXT NOT NULL DEFAULT 'active',
+    reference   TEXT NOT NULL DEFAULT '',
+    expires_at  TIMESTAMPTZ NOT NULL,
+    movement_id INTEGER REFERENCES stock_movements (id),
+    created_by  TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT stock_reservations_quantity_check CHECK (quantity > 0),
+    CONSTRAINT stock_reservations_status_check CHECK (status IN ('active', 'confirmed', 'released', 'expired'))
+);
+
+CREATE INDEX IF NOT EXISTS stock_reservations_active_idx
+    ON stock_reservations (variance_id, location_id, expires_at) WHERE status = 'active';
+CREATE INDEX IF NOT EXISTS stock_reservations_reference_idx ON stock_reservations (reference);
@@ -0,0 +1,21 @@
+-- Reorder rules: a reorder point and quantity per variance, either at one
+-- location or, with a NULL location_id, for the variance's total stock. low
+-- and alerted_at remember the last check so an alert is raised once per
+-- drop below the point.
+
+CREATE TABLE IF NOT EXISTS reorder_rules (
+    id               SERIAL PRIMARY KEY,
+    variance_id      INTEGER NOT NULL REFERENCES products_variances (id) ON DELETE CASCADE,
+    location_id      INTEGER REFERENCES locations (id) ON DELETE CASCADE,
+    reorder_point    DOUBLE PRECISION NOT NULL DEFAULT 0,
+    reorder_quantity DOUBLE PRECISION NOT NULL DEFAULT 0,
+    low              BOOLEAN NOT NULL DEFAULT false,
+    alerted_at       TIMESTAMPTZ,
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT reorder_rules_reorder_point_check CHECK (reorder_point >= 0),
+    CONSTRAINT reorder_rules_reorder_quantity_check CHECK (reorder_quantity >= 0)
+);
+
+-- One rule per variance and location, the total counting as location 0
+CREATE UNIQUE INDEX IF NOT EXISTS reorder_rules_variance_location_key
+    ON reorder_rules (variance_id, (COALESCE(location_id, 0)));
@@ -0,0 +1,36 @@
+-- Purchase orders to suppliers. Lines reference variances, with the expected
+-- unit cost (the variance's wholesale_price unless the buyer gave one) and
+-- how much has been received so far. Receiving also writes receipt rows to
+-- stock_movements, referencing the order.
+
+CREATE TABLE IF NOT EXISTS purchase_orders (
+    id          SERIAL PRIMARY KEY,
+    supplier_id INTEGER NOT NULL REFERENCES supplier_tb (id),
+    location_id INTEGER NOT NULL REFERENCES locations (id),
+    status      TEXT NOT NULL DEFAULT 'draft',
+    reference   TEXT NOT NULL DEFAULT '',
+    notes       TEXT NOT NULL DEFAULT '',
+    created_by  TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT purchase_orders_status_check
+        CHECK (status IN ('draft', 'sent', 'partially_received', 'received', 'cancelled'))
+);
+
+CREATE INDEX IF NOT EXISTS purchase_orders_supplier_id_idx ON purchase_orders (supplier_id, id);
+CREATE INDEX IF NOT EXISTS purchase_orders_status_idx ON purchase_orders (status, id);
+
+CREATE TABLE IF NOT EXISTS purchase_order_lines (
+    id                SERIAL PRIMARY KEY,
+    purchase_order_id INTEGER NOT NULL REFERENCES purchase_orders (id) ON DELETE CASCADE,
+    variance_id       INTEGER NOT NULL REFERENCES products_variances (id),
+    quantity          DOUBLE PRECISION NOT NULL,
+    unit_cost         NUMERIC(12, 2) NOT NULL,
+    quantity_received DOUBLE PRECISION NOT NULL DEFAULT 0,
+    CONSTRAINT purchase_order_lines_variance_key UNIQUE (purchase_order_id, variance_id),
+    CONSTRAINT purchase_order_lines_quantity_check CHECK (quantity > 0),
+    CONSTRAINT purchase_order_lines_unit_cost_check CHECK (unit_cost >= 0),
+    CONSTRAINT purchase_order_lines_received_check CHECK (quantity_received >= 0 AND quantity_received <= quantity)
+);
+
+CREATE INDEX IF NOT EXISTS purchase_order_lines_variance_id_idx ON purchase_order_lines (variance_id);
@@ -0,0 +1,36 @@
+-- Customer orders. Lines capture the variance's retail price when the order
+-- is placed; totals are exact NUMERIC sums of the line totals. Fulfilling an
+-- order writes one sale row to stock_movements per line.
+
+CREATE TABLE IF NOT EXISTS orders (
+    id          SERIAL PRIMARY KEY,
+    status      TEXT NOT NULL DEFAULT 'pending',
+    location_id INTEGER NOT NULL REFERENCES locations (id),
+    customer    TEXT NOT NULL DEFAULT '',
+    reference   TEXT NOT NULL DEFAULT '',
+    notes       TEXT NOT NULL DEFAULT '',
+    total       NUMERIC(14, 2) NOT NULL DEFAULT 0,
+    created_by  TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT orders_status_check
+        CHECK (status IN ('pending', 'paid', 'fulfilled', 'cancelled', 'refunded'))
+);
+
+CREATE INDEX IF NOT EXISTS orders_status_idx ON orders (status, id);
+CREATE INDEX IF NOT EXISTS orders_customer_idx ON orders (customer, id);
+
+CREATE TABLE IF NOT EXISTS order_lines (
+    id          SERIAL PRIMARY KEY,
+    order_id    INTEGER NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    variance_id INTEGER NOT NULL REFERENCES products_variances (id),
+    quantity    DOUBLE PRECISION NOT NULL,
+    unit_price  NUMERIC(12, 2) NOT NULL,
+    line_total  NUMERIC(14, 2) NOT NULL,
+    movement_id INTEGER REFERENCES stock_movements (id),
+    CONSTRAINT order_lines_variance_key UNIQUE (order_id, variance_id),
+    CONSTRAINT order_lines_quantity_check CHECK (quantity > 0),
+    CONSTRAINT order_lines_unit_price_check CHECK (unit_price >= 0)
+);
+
+CREATE INDEX IF NOT EXISTS order_lines_variance_id_idx ON order_lines (variance_id);
@@ -0,0 +1,2 @@
+ALTER TABLE orders DROP COLUMN IF EXISTS currency;
+ALTER TABLE purchase_orders DROP COLUMN IF EXISTS currency;
@@ -0,0 +1,12 @@
+-- Purchase orders and customer orders record the currency of their amounts.
+-- Rows written before had no other choice than the catalog currency, so they
+-- are backfilled with CURRENCY, which the migrator hands over as
+-- migrate.currency; new rows always name theirs.
+
+ALTER TABLE purchase_orders ADD COLUMN IF NOT EXISTS currency TEXT;
+UPDATE purchase_orders SET currency = current_setting('migrate.currency') WHERE currency IS NULL;
+ALTER TABLE purchase_orders ALTER COLUMN currency SET NOT NULL;
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS currency TEXT;
+UPDATE orders SET currency = current_setting('migrate.currency') WHERE currency IS NULL;
+ALTER TABLE orders ALTER COLUMN currency SET NOT NULL;
@@ -0,0 +1,16 @@
+-- Exchange rates from the base currency (CURRENCY) into the others prices
+-- can be shown or sold in: one unit of the base currency buys rate units of
+-- currency. Orders keep the rate they were priced at, which is 1 for orders
+-- in the base currency and for every order placed before rates existed.
+
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    currency   TEXT PRIMARY KEY,
+    rate       NUMERIC(20, 10) NOT NULL,
+    updated_by TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT exchange_rates_currency_check CHECK (currency ~ '^[A-Z]{3}$'),
+    CONSTRAINT exchange_rates_rate_check CHECK (rate > 0)
+);
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS exchange_rate NUMERIC(20, 10) NOT NULL DEFAULT 1;
+ALTER TABLE orders ALTER COLUMN exchange_rate DROP DEFAULT;
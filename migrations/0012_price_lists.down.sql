@@ -0,0 +1,4 @@
+ALTER TABLE orders DROP COLUMN IF EXISTS price_list;
+DROP TABLE IF EXISTS customer_price_lists;
+DROP TABLE IF EXISTS list_prices;
+DROP TABLE IF EXISTS price_lists;
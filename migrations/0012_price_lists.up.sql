@@ -0,0 +1,49 @@
+-- Named price lists. A list prices a variance with tiers, each from a
+-- minimum quantity up and optionally only between two moments; customers,
+-- as orders name them, are assigned to one list. Orders record the list
+-- that priced them, which was retail for every order placed before.
+
+CREATE TABLE IF NOT EXISTS price_lists (
+    id          SERIAL PRIMARY KEY,
+    code        TEXT NOT NULL,
+    name        TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    base_price  TEXT NOT NULL DEFAULT 'retail',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT price_lists_code_key UNIQUE (code),
+    CONSTRAINT price_lists_base_price_check CHECK (base_price IN ('retail', 'wholesale'))
+);
+
+INSERT INTO price_lists (code, name, base_price) VALUES
+    ('retail', 'Retail', 'retail'),
+    ('wholesale', 'Wholesale', 'wholesale'),
+    ('contractor', 'Contractor', 'retail'),
+    ('staff', 'Staff', 'retail')
+ON CONFLICT (code) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS list_prices (
+    id            SERIAL PRIMARY KEY,
+    price_list_id INTEGER NOT NULL REFERENCES price_lists (id) ON DELETE CASCADE,
+    variance_id   INTEGER NOT NULL REFERENCES products_variances (id) ON DELETE CASCADE,
+    min_quantity  DOUBLE PRECISION NOT NULL DEFAULT 0,
+    price         NUMERIC(12, 2) NOT NULL,
+    valid_from    TIMESTAMPTZ,
+    valid_to      TIMESTAMPTZ,
+    updated_by    TEXT NOT NULL DEFAULT '',
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT list_prices_min_quantity_check CHECK (min_quantity >= 0),
+    CONSTRAINT list_prices_price_check CHECK (price >= 0),
+    CONSTRAINT list_prices_valid_check CHECK (valid_to > valid_from)
+);
+
+CREATE INDEX IF NOT EXISTS list_prices_variance_idx ON list_prices (price_list_id, variance_id, min_quantity);
+
+CREATE TABLE IF NOT EXISTS customer_price_lists (
+    customer      TEXT PRIMARY KEY,
+    price_list_id INTEGER NOT NULL REFERENCES price_lists (id) ON DELETE CASCADE,
+    updated_by    TEXT NOT NULL DEFAULT '',
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS price_list TEXT NOT NULL DEFAULT 'retail';
+ALTER TABLE orders ALTER COLUMN price_list DROP DEFAULT;
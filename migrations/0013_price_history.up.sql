@@ -0,0 +1,43 @@
+-- Variance prices keep their history: every change of original_price,
+-- retail_price or wholesale_price adds a row with the old and new price,
+-- what made it and who, in the transaction making it. Price changes can also
+-- be scheduled; the price scheduler applies pending ones once effective_at
+-- passes, and a NULL price is one the change leaves alone.
+
+CREATE TABLE IF NOT EXISTS price_history (
+    id          SERIAL PRIMARY KEY,
+    variance_id INTEGER NOT NULL REFERENCES products_variances (id) ON DELETE CASCADE,
+    field       TEXT NOT NULL,
+    old_price   NUMERIC(12, 2) NOT NULL,
+    new_price   NUMERIC(12, 2) NOT NULL,
+    source      TEXT NOT NULL,
+    reference   TEXT NOT NULL DEFAULT '',
+    changed_by  TEXT NOT NULL DEFAULT '',
+    changed_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT price_history_field_check CHECK (field IN ('original_price', 'retail_price', 'wholesale_price')),
+    CONSTRAINT price_history_source_check CHECK (source IN ('upsert', 'import', 'purchase_order', 'schedule'))
+);
+
+CREATE INDEX IF NOT EXISTS price_history_variance_idx ON price_history (variance_id, changed_at);
+
+CREATE TABLE IF NOT EXISTS scheduled_prices (
+    id              SERIAL PRIMARY KEY,
+    variance_id     INTEGER NOT NULL REFERENCES products_variances (id) ON DELETE CASCADE,
+    original_price  NUMERIC(12, 2),
+    retail_price    NUMERIC(12, 2),
+    wholesale_price NUMERIC(12, 2),
+    effective_at    TIMESTAMPTZ NOT NULL,
+    reference       TEXT NOT NULL DEFAULT '',
+    status          TEXT NOT NULL DEFAULT 'pending',
+    failure         TEXT NOT NULL DEFAULT '',
+    created_by      TEXT NOT NULL DEFAULT '',
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT scheduled_prices_prices_check CHECK (
+        COALESCE(original_price, retail_price, wholesale_price) IS NOT NULL),
+    CONSTRAINT scheduled_prices_status_check CHECK (status IN ('pending', 'applied', 'cancelled', 'failed'))
+);
+
+CREATE INDEX IF NOT EXISTS scheduled_prices_pending_idx
+    ON scheduled_prices (effective_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS scheduled_prices_variance_idx ON scheduled_prices (variance_id);
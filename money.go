@@ -0,0 +1,392 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+//! ============================================================================ //
+//? ============================== 💰 MONEY 💰 ================================= //
+//! ============================================================================ //
+
+// Prices are Money: a Decimal amount and the currency it is in. A Decimal
+// keeps exactly the digits NUMERIC does, an integer coefficient and a scale
+// (how many of those digits follow the point), so nothing is lost between
+// Postgres, Go and JSON, and sums do not drift the way float64 ones do.
+//
+// Arithmetic is exact. Rounding only happens where code asks for it, to a
+// scale and with a RoundingMode. Catalog prices and order amounts are kept
+// to the cent (priceScale), as their NUMERIC(12, 2) columns store them.
+//
+// JSON carries amounts as strings such as "1800.00", so no client reads them
+// into a float by accident; numbers are still accepted on input. A record's
+// currency is a field of its own next to its prices. Amounts in two
+// currencies do not add or compare: one is converted with its ExchangeRate
+// first.
+
+// priceScale is how many decimals prices and order amounts keep.
+const priceScale = 2
+
+// Decimal is an exact decimal number. The zero value is 0.
+type Decimal struct {
+	coef  *big.Int // nil is zero; never changed once the Decimal is made
+	scale int
+}
+
+// RoundingMode says which way a Decimal rounds when digits are dropped.
+type RoundingMode int
+
+const (
+	// RoundHalfUp rounds to the nearest, ties away from zero: 0.125 is 0.13.
+	RoundHalfUp RoundingMode = iota
+	// RoundHalfEven rounds to the nearest, ties to even: 0.125 is 0.12.
+	RoundHalfEven
+	// RoundUp rounds away from zero: 0.121 is 0.13.
+	RoundUp
+	// RoundDown truncates towards zero: 0.129 is 0.12.
+	RoundDown
+)
+
+// roundingModeNames are the names PRICE_ROUNDING takes.
+var roundingModeNames = []string{"half_up", "half_even", "up", "down"}
+
+func (r RoundingMode) String() string {
+	if int(r) < len(roundingModeNames) {
+		return roundingModeNames[r]
+	}
+	return fmt.Sprintf("RoundingMode(%d)", int(r))
+}
+
+func (r *RoundingMode) UnmarshalText(text []byte) error {
+	for i, name := range roundingModeNames {
+		if string(text) == name {
+			*r = RoundingMode(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("%q must be one of %s", text, strings.Join(roundingModeNames, ", "))
+}
+
+func (r RoundingMode) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// maxExponent bounds the exponent parseDecimal accepts, so "1e999999999"
+// cannot make it allocate a number with a billion digits.
+const maxExponent = 100
+
+// maxAmount bounds the amounts JSON may carry. Prices are NUMERIC(12, 2)
+// and rates NUMERIC(20, 10), and neither holds 10^10, so larger input is
+// turned away rather than overflowing a column.
+var maxAmount = newDecimal(10_000_000_000, 0)
+
+var bigTen = big.NewInt(10)
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+// newDecimal is units * 10^-scale: newDecimal(1999, 2) is 19.99.
+func newDecimal(units int64, scale int) Decimal {
+	return Decimal{coef: big.NewInt(units), scale: scale}
+}
+
+// parseDecimal reads a decimal such as "1800", "-3.05" or "1.5e3" exactly.
+func parseDecimal(s string) (Decimal, error) {
+	mantissa, exp := s, 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.Atoi(s[i+1:])
+		if err != nil || e > maxExponent || e < -maxExponent {
+			return Decimal{}, fmt.Errorf("%q is not a decimal number", s)
+		}
+		mantissa, exp = s[:i], e
+	}
+	digits := strings.TrimLeft(mantissa, "+-")
+	whole, frac, _ := strings.Cut(digits, ".")
+	if len(mantissa)-len(digits) > 1 || whole+frac == "" || strings.Trim(whole+frac, "0123456789") != "" {
+		return Decimal{}, fmt.Errorf("%q is not a decimal number", s)
+	}
+
+	coef, _ := new(big.Int).SetString(whole+frac, 10)
+	if strings.HasPrefix(mantissa, "-") {
+		coef.Neg(coef)
+	}
+	d := Decimal{coef: coef, scale: len(frac) - exp}
+	if d.scale < 0 {
+		d.coef.Mul(d.coef, pow10(-d.scale))
+		d.scale = 0
+	}
+	return d, nil
+}
+
+// decimalFromFloat is the shortest decimal that reads back as f, so 0.1 is
+// 0.1 rather than the binary fraction nearest it. f must be finite.
+func decimalFromFloat(f float64) Decimal {
+	d, _ := parseDecimal(strconv.FormatFloat(f, 'f', -1, 64))
+	return d
+}
+
+func (d Decimal) int() *big.Int {
+	if d.coef == nil {
+		return new(big.Int)
+	}
+	return d.coef
+}
+
+// at returns d's coefficient at scale, which must not be below d's.
+func (d Decimal) at(scale int) *big.Int {
+	return new(big.Int).Mul(d.int(), pow10(scale-d.scale))
+}
+
+// align returns the coefficients of d and e at the larger of their scales.
+func align(d, e Decimal) (*big.Int, *big.Int, int) {
+	scale := max(d.scale, e.scale)
+	return d.at(scale), e.at(scale), scale
+}
+
+func (d Decimal) Add(e Decimal) Decimal {
+	a, b, scale := align(d, e)
+	return Decimal{coef: a.Add(a, b), scale: scale}
+}
+
+func (d Decimal) Sub(e Decimal) Decimal {
+	a, b, scale := align(d, e)
+	return Decimal{coef: a.Sub(a, b), scale: scale}
+}
+
+func (d Decimal) Neg() Decimal {
+	return Decimal{coef: new(big.Int).Neg(d.int()), scale: d.scale}
+}
+
+// Mul is exact: its scale is the sum of d's and e's.
+func (d Decimal) Mul(e Decimal) Decimal {
+	return Decimal{coef: new(big.Int).Mul(d.int(), e.int()), scale: d.scale + e.scale}
+}
+
+// Quo divides d by e, rounded to scale decimals with mode. e must not be
+// zero.
+func (d Decimal) Quo(e Decimal, scale int, mode RoundingMode) Decimal {
+	num, den := new(big.Int).Set(d.int()), new(big.Int).Set(e.int())
+	if shift := scale - d.scale + e.scale; shift >= 0 {
+		num.Mul(num, pow10(shift))
+	} else {
+		den.Mul(den, pow10(-shift))
+	}
+	return Decimal{coef: roundQuo(num, den, mode), scale: scale}
+}
+
+// Round is d with scale decimals, rounded with mode when that drops digits.
+func (d Decimal) Round(scale int, mode RoundingMode) Decimal {
+	if scale >= d.scale {
+		return Decimal{coef: d.at(scale), scale: scale}
+	}
+	return Decimal{coef: roundQuo(d.int(), pow10(d.scale-scale), mode), scale: scale}
+}
+
+// roundQuo divides num by den, rounding the quotient with mode.
+func roundQuo(num, den *big.Int, mode RoundingMode) *big.Int {
+	if den.Sign() < 0 {
+		num, den = new(big.Int).Neg(num), new(big.Int).Neg(den)
+	}
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Sign() == 0 {
+		return quo
+	}
+	// quo was truncated towards zero; away is one step further from it
+	away := big.NewInt(int64(num.Sign()))
+	half := rem.Abs(rem).Lsh(rem, 1).Cmp(den)
+	switch {
+	case mode == RoundUp,
+		mode == RoundHalfUp && half >= 0,
+		mode == RoundHalfEven && (half > 0 || half == 0 && quo.Bit(0) == 1):
+		quo.Add(quo, away)
+	}
+	return quo
+}
+
+func (d Decimal) Cmp(e Decimal) int {
+	a, b, _ := align(d, e)
+	return a.Cmp(b)
+}
+
+func (d Decimal) Sign() int { return d.int().Sign() }
+
+func (d Decimal) IsZero() bool { return d.Sign() == 0 }
+
+// Float64 is the float nearest d, for things like histograms that do not
+// need to be exact.
+func (d Decimal) Float64() float64 {
+	f, _ := new(big.Rat).SetFrac(d.int(), pow10(d.scale)).Float64()
+	return f
+}
+
+// String writes d with all of its scale's decimals: 1800.00 stays "1800.00".
+func (d Decimal) String() string {
+	digits := new(big.Int).Abs(d.int()).String()
+	if d.scale > 0 {
+		if len(digits) <= d.scale {
+			digits = strings.Repeat("0", d.scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-d.scale] + "." + digits[len(digits)-d.scale:]
+	}
+	if d.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(d.String())), nil
+}
+
+// UnmarshalJSON reads a JSON string or number without going through float64.
+// It refuses amounts that would not fit the columns they are kept in; see
+// checkAmount.
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var raw string
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+	} else {
+		var n json.Number
+		if err := json.Unmarshal(data, &n); err != nil {
+			return err
+		}
+		raw = n.String()
+	}
+	parsed, err := parseDecimal(raw)
+	if err == nil {
+		err = checkAmount(parsed)
+	}
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// checkAmount reports an error when d, rounded to the cent, is not below
+// maxAmount either way.
+func checkAmount(d Decimal) error {
+	if r := d.Round(priceScale, RoundHalfUp); r.Cmp(maxAmount) >= 0 || r.Cmp(maxAmount.Neg()) <= 0 {
+		return fmt.Errorf("%s is out of range: amounts must be below %s", d, maxAmount)
+	}
+	return nil
+}
+
+// Scan reads a NUMERIC column, which lib/pq hands over as text.
+func (d *Decimal) Scan(src any) error {
+	var err error
+	switch v := src.(type) {
+	case []byte:
+		*d, err = parseDecimal(string(v))
+	case string:
+		*d, err = parseDecimal(v)
+	case int64:
+		*d = newDecimal(v, 0)
+	case float64:
+		*d = decimalFromFloat(v)
+	case nil:
+		*d = Decimal{}
+	default:
+		err = fmt.Errorf("cannot scan %T into a Decimal", src)
+	}
+	return err
+}
+
+// Value writes d as NUMERIC text.
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+//? -------------------------------- money ---------------------------------- //
+
+// Money is an amount in a currency, an ISO 4217 code such as "LKR".
+type Money struct {
+	Amount   Decimal
+	Currency string
+}
+
+// validCurrency reports whether code looks like an ISO 4217 code.
+func validCurrency(code string) bool {
+	return len(code) == 3 && strings.Trim(code, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") == ""
+}
+
+// currencyOf is the currency m and n share, an empty one taking the other's.
+// It returns an error when they are in two currencies.
+func currencyOf(m, n Money) (string, error) {
+	switch {
+	case m.Currency == "":
+		return n.Currency, nil
+	case n.Currency == "" || n.Currency == m.Currency:
+		return m.Currency, nil
+	}
+	return "", fmt.Errorf("money: cannot mix %s and %s; convert one first", m.Currency, n.Currency)
+}
+
+func (m Money) Add(n Money) (Money, error) {
+	currency, err := currencyOf(m, n)
+	return Money{Amount: m.Amount.Add(n.Amount), Currency: currency}, err
+}
+
+func (m Money) Sub(n Money) (Money, error) {
+	currency, err := currencyOf(m, n)
+	return Money{Amount: m.Amount.Sub(n.Amount), Currency: currency}, err
+}
+
+func (m Money) Mul(d Decimal) Money {
+	return Money{Amount: m.Amount.Mul(d), Currency: m.Currency}
+}
+
+// Times is the exact price of quantity units at m each.
+func (m Money) Times(quantity float64) Money {
+	return m.Mul(decimalFromFloat(quantity))
+}
+
+func (m Money) Round(scale int, mode RoundingMode) Money {
+	return Money{Amount: m.Amount.Round(scale, mode), Currency: m.Currency}
+}
+
+func (m Money) Cmp(n Money) (int, error) {
+	_, err := currencyOf(m, n)
+	return m.Amount.Cmp(n.Amount), err
+}
+
+func (m Money) Sign() int { return m.Amount.Sign() }
+
+// price is m in currency to the cent, the way a catalog price is kept.
+// Extra decimals round half up, as NUMERIC(12, 2) rounds them.
+func (m Money) price(currency string) Money {
+	return Money{Amount: m.Amount.Round(priceScale, RoundHalfUp), Currency: currency}
+}
+
+func (m Money) String() string {
+	return strings.TrimSpace(m.Amount.String() + " " + m.Currency)
+}
+
+// MarshalJSON writes only the amount; records carry their currency
+// alongside.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return m.Amount.MarshalJSON()
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	return m.Amount.UnmarshalJSON(data)
+}
+
+// Scan reads the amount from a NUMERIC column; the caller sets the currency.
+func (m *Money) Scan(src any) error {
+	return m.Amount.Scan(src)
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return m.Amount.Value()
+}
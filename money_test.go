@@ -0,0 +1,357 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func mustDecimal(t *testing.T, s string) Decimal {
+	t.Helper()
+	d, err := parseDecimal(s)
+	if err != nil {
+		t.Fatalf("parseDecimal(%q): %v", s, err)
+	}
+	return d
+}
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		in    string
+		want  string
+		scale int
+		err   bool
+	}{
+		{in: "1800", want: "1800", scale: 0},
+		{in: "1800.00", want: "1800.00", scale: 2},
+		{in: "-3.05", want: "-3.05", scale: 2},
+		{in: "+0.5", want: "0.5", scale: 1},
+		{in: ".25", want: "0.25", scale: 2},
+		{in: "7.", want: "7", scale: 0},
+		{in: "1.5e3", want: "1500", scale: 0},
+		{in: "15e-3", want: "0.015", scale: 3},
+		{in: "0.000", want: "0.000", scale: 3},
+		{in: "", err: true},
+		{in: "-", err: true},
+		{in: ".", err: true},
+		{in: "+-1", err: true},
+		{in: "1.2.3", err: true},
+		{in: "12a", err: true},
+		{in: "1e", err: true},
+		{in: "1e101", err: true},
+		{in: "1e999999999", err: true},
+		{in: " 1", err: true},
+	}
+	for _, tt := range tests {
+		d, err := parseDecimal(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseDecimal(%q) = %s, want an error", tt.in, d)
+			}
+			continue
+		}
+		if err != nil || d.String() != tt.want || d.scale != tt.scale {
+			t.Errorf("parseDecimal(%q) = %s at scale %d, %v; want %s at scale %d", tt.in, d, d.scale, err, tt.want, tt.scale)
+		}
+	}
+}
+
+func TestDecimalRound(t *testing.T) {
+	tests := []struct {
+		in                   string
+		halfUp, halfEven, up string
+		down                 string
+	}{
+		{in: "0.125", halfUp: "0.13", halfEven: "0.12", up: "0.13", down: "0.12"},
+		{in: "0.135", halfUp: "0.14", halfEven: "0.14", up: "0.14", down: "0.13"},
+		{in: "0.121", halfUp: "0.12", halfEven: "0.12", up: "0.13", down: "0.12"},
+		{in: "0.129", halfUp: "0.13", halfEven: "0.13", up: "0.13", down: "0.12"},
+		{in: "0.1250001", halfUp: "0.13", halfEven: "0.13", up: "0.13", down: "0.12"},
+		{in: "-0.125", halfUp: "-0.13", halfEven: "-0.12", up: "-0.13", down: "-0.12"},
+		{in: "-0.135", halfUp: "-0.14", halfEven: "-0.14", up: "-0.14", down: "-0.13"},
+		{in: "-0.121", halfUp: "-0.12", halfEven: "-0.12", up: "-0.13", down: "-0.12"},
+		{in: "2.5", halfUp: "2.50", halfEven: "2.50", up: "2.50", down: "2.50"},
+		{in: "0.005", halfUp: "0.01", halfEven: "0.00", up: "0.01", down: "0.00"},
+		{in: "-0.005", halfUp: "-0.01", halfEven: "0.00", up: "-0.01", down: "0.00"},
+		{in: "1999.995", halfUp: "2000.00", halfEven: "2000.00", up: "2000.00", down: "1999.99"},
+	}
+	for _, tt := range tests {
+		d := mustDecimal(t, tt.in)
+		for mode, want := range map[RoundingMode]string{RoundHalfUp: tt.halfUp, RoundHalfEven: tt.halfEven, RoundUp: tt.up, RoundDown: tt.down} {
+			if got := d.Round(priceScale, mode).String(); got != want {
+				t.Errorf("%s rounded %s = %s, want %s", tt.in, mode, got, want)
+			}
+		}
+	}
+
+	// Whole numbers at .5 show the ties most plainly
+	for _, tt := range []struct {
+		in               string
+		halfUp, halfEven string
+	}{
+		{"0.5", "1", "0"}, {"1.5", "2", "2"}, {"2.5", "3", "2"}, {"-0.5", "-1", "0"}, {"-1.5", "-2", "-2"}, {"-2.5", "-3", "-2"},
+	} {
+		d := mustDecimal(t, tt.in)
+		if got := d.Round(0, RoundHalfUp).String(); got != tt.halfUp {
+			t.Errorf("%s half up = %s, want %s", tt.in, got, tt.halfUp)
+		}
+		if got := d.Round(0, RoundHalfEven).String(); got != tt.halfEven {
+			t.Errorf("%s half even = %s, want %s", tt.in, got, tt.halfEven)
+		}
+	}
+}
+
+func TestDecimalQuo(t *testing.T) {
+	tests := []struct {
+		num, den string
+		scale    int
+		mode     RoundingMode
+		want     string
+	}{
+		{"1", "3", 2, RoundHalfUp, "0.33"},
+		{"2", "3", 2, RoundHalfUp, "0.67"},
+		{"2", "3", 2, RoundDown, "0.66"},
+		{"-2", "3", 2, RoundHalfUp, "-0.67"},
+		{"1", "-8", 2, RoundHalfEven, "-0.12"},
+		{"1", "8", 2, RoundHalfUp, "0.13"},
+		{"1500", "0.0034", 0, RoundHalfUp, "441176"},
+		{"10", "4", 0, RoundHalfEven, "2"},
+	}
+	for _, tt := range tests {
+		if got := mustDecimal(t, tt.num).Quo(mustDecimal(t, tt.den), tt.scale, tt.mode).String(); got != tt.want {
+			t.Errorf("%s / %s to %d %s = %s, want %s", tt.num, tt.den, tt.scale, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyTimes(t *testing.T) {
+	tests := []struct {
+		price    string
+		quantity float64
+		exact    string
+		cents    string
+	}{
+		{"1800.00", 3, "5400.00", "5400.00"},
+		{"19.99", 0.5, "9.995", "10.00"},
+		{"0.10", 0.1, "0.010", "0.01"},
+		{"1.15", 0.3, "0.345", "0.35"},
+		{"1800.00", -2, "-3600.00", "-3600.00"},
+		{"333.33", 1.5, "499.995", "500.00"},
+		{"0.01", 0.25, "0.0025", "0.00"},
+	}
+	for _, tt := range tests {
+		m := Money{Amount: mustDecimal(t, tt.price), Currency: "LKR"}
+		got := m.Times(tt.quantity)
+		if got.Amount.String() != tt.exact || got.Currency != "LKR" {
+			t.Errorf("%s × %v = %s, want %s LKR", tt.price, tt.quantity, got, tt.exact)
+		}
+		if cents := got.Round(priceScale, RoundHalfUp).Amount.String(); cents != tt.cents {
+			t.Errorf("%s × %v to the cent = %s, want %s", tt.price, tt.quantity, cents, tt.cents)
+		}
+	}
+}
+
+func TestMoneyMixingCurrencies(t *testing.T) {
+	lkr := Money{Amount: newDecimal(100, 0), Currency: "LKR"}
+	usd := Money{Amount: newDecimal(100, 0), Currency: "USD"}
+	if _, err := lkr.Add(usd); err == nil {
+		t.Error("adding USD to LKR succeeded")
+	}
+	if _, err := lkr.Sub(usd); err == nil {
+		t.Error("subtracting USD from LKR succeeded")
+	}
+	if _, err := lkr.Cmp(usd); err == nil {
+		t.Error("comparing LKR with USD succeeded")
+	}
+
+	// An amount with no currency takes the other's
+	sum, err := (Money{Amount: newDecimal(5, 1)}).Add(lkr)
+	if err != nil || sum.String() != "100.5 LKR" {
+		t.Errorf("0.5 + 100 LKR = %s, %v", sum, err)
+	}
+	if cmp, err := lkr.Cmp(Money{Amount: newDecimal(10000, 2)}); err != nil || cmp != 0 {
+		t.Errorf("100 LKR against 100.00 = %d, %v", cmp, err)
+	}
+}
+
+// Totals are exact sums of line totals that were each rounded to the cent,
+// so they never drift from what the lines add up to.
+func TestTotalsSumLineTotals(t *testing.T) {
+	tests := []struct {
+		name   string
+		prices []string
+		qty    []float64
+		total  string
+	}{
+		{"tenths", []string{"0.10", "0.10", "0.10", "0.10", "0.10", "0.10", "0.10", "0.10", "0.10", "0.10"},
+			[]float64{1, 1, 1, 1, 1, 1, 1, 1, 1, 1}, "1.00"},
+		{"fractional quantities", []string{"19.99", "1.15", "333.33"}, []float64{0.5, 0.3, 1.5}, "510.35"},
+		{"a return", []string{"1800.00", "1800.00"}, []float64{3, -1}, "3600.00"},
+		{"half cents each way", []string{"0.01", "0.03"}, []float64{0.5, 0.5}, "0.03"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := Order{Currency: "LKR"}
+			for i, price := range tt.prices {
+				l := OrderLine{Quantity: tt.qty[i]}
+				l.price(Money{Amount: mustDecimal(t, price), Currency: "LKR"})
+				if want := l.UnitPrice.Times(l.Quantity).Round(priceScale, RoundHalfUp); l.LineTotal.Amount.Cmp(want.Amount) != 0 {
+					t.Errorf("line total of %v at %s = %s, want %s", l.Quantity, price, l.LineTotal, want)
+				}
+				if l.LineTotal.Amount.scale != priceScale {
+					t.Errorf("line total %s is not to the cent", l.LineTotal)
+				}
+				o.Lines = append(o.Lines, l)
+			}
+			total, err := o.total()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total.String() != tt.total+" LKR" {
+				t.Errorf("total = %s, want %s LKR", total, tt.total)
+			}
+
+			po := PurchaseOrder{Currency: "LKR"}
+			for i, price := range tt.prices {
+				cost := Money{Amount: mustDecimal(t, price), Currency: "LKR"}
+				po.Lines = append(po.Lines, PurchaseOrderLine{Quantity: tt.qty[i], UnitCost: &cost})
+			}
+			cost, err := po.totalCost()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cost.Amount.scale != priceScale {
+				t.Errorf("total cost %s is not to the cent", cost)
+			}
+		})
+	}
+
+	o := Order{Currency: "LKR", Lines: []OrderLine{{LineTotal: Money{Amount: newDecimal(1, 0), Currency: "USD"}}}}
+	if _, err := o.total(); err == nil {
+		t.Error("an order in LKR summed a line in USD")
+	}
+}
+
+func TestDecimalJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{in: `"1800.00"`, want: "1800.00"},
+		{in: `1800`, want: "1800"},
+		{in: `1800.50`, want: "1800.50"},
+		{in: `-3.05`, want: "-3.05"},
+		{in: `1.5e3`, want: "1500"},
+		{in: `"9999999999.99"`, want: "9999999999.99"},
+		{in: `"-9999999999.99"`, want: "-9999999999.99"},
+		{in: `"12`, err: true},
+		{in: `12"`, err: true},
+		{in: `"1"2"`, err: true},
+		{in: `""`, err: true},
+		{in: `"abc"`, err: true},
+		{in: `true`, err: true},
+		{in: `{}`, err: true},
+		{in: `[1]`, err: true},
+		{in: `01`, err: true},
+		{in: `.5`, err: true},
+		{in: `1e100`, err: true},
+		{in: `"1e100"`, err: true},
+		{in: `10000000000`, err: true},
+		{in: `"-10000000000"`, err: true},
+		{in: `"9999999999.995"`, err: true},
+	}
+	for _, tt := range tests {
+		var d Decimal
+		err := d.UnmarshalJSON([]byte(tt.in))
+		if tt.err {
+			if err == nil {
+				t.Errorf("unmarshaling %s = %s, want an error", tt.in, d)
+			}
+			continue
+		}
+		if err != nil || d.String() != tt.want {
+			t.Errorf("unmarshaling %s = %s, %v; want %s", tt.in, d, err, tt.want)
+			continue
+		}
+
+		// What is written reads back the same, scale and all
+		data, err := json.Marshal(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var back Decimal
+		if err := json.Unmarshal(data, &back); err != nil || back.String() != d.String() {
+			t.Errorf("%s read back from %s as %s, %v", d, data, back, err)
+		}
+	}
+
+	// null leaves the value alone
+	d := newDecimal(5, 0)
+	if err := json.Unmarshal([]byte(`null`), &d); err != nil || d.String() != "5" {
+		t.Errorf("null unmarshaled into 5 = %s, %v", d, err)
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	var v struct {
+		Price Money  `json:"price"`
+		Cost  *Money `json:"cost"`
+	}
+	if err := json.Unmarshal([]byte(`{"price":"1800.5","cost":12}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"price":"1800.5","cost":"12"}` {
+		t.Errorf("marshaled %s", data)
+	}
+	if err := json.Unmarshal([]byte(`{"price":1e12}`), &v); err == nil {
+		t.Error("a price of 1e12 was accepted")
+	}
+}
+
+func TestDecimalScan(t *testing.T) {
+	tests := []struct {
+		src  any
+		want string
+	}{
+		{[]byte("1800.00"), "1800.00"},
+		{"-3.05", "-3.05"},
+		{"0.0034000000", "0.0034000000"},
+		{int64(42), "42"},
+		{float64(0.1), "0.1"},
+		{nil, "0"},
+	}
+	for _, tt := range tests {
+		var d Decimal
+		if err := d.Scan(tt.src); err != nil || d.String() != tt.want {
+			t.Errorf("Scan(%#v) = %s, %v; want %s", tt.src, d, err, tt.want)
+			continue
+		}
+
+		// Value writes what Scan reads, as lib/pq round trips NUMERIC
+		value, err := d.Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var back Decimal
+		if err := back.Scan([]byte(value.(string))); err != nil || back.String() != d.String() {
+			t.Errorf("%s scanned back as %s, %v", d, back, err)
+		}
+	}
+
+	var d Decimal
+	if err := d.Scan(true); err == nil {
+		t.Error("scanned a bool into a Decimal")
+	}
+	if err := d.Scan("12abc"); err == nil {
+		t.Error("scanned 12abc into a Decimal")
+	}
+
+	m := Money{Currency: "LKR"}
+	if err := m.Scan([]byte("1800.50")); err != nil || m.String() != "1800.50 LKR" {
+		t.Errorf("Money.Scan = %s, %v", m, err)
+	}
+}
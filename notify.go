@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//! ============================================================================ //
+//? ============================ 📣 NOTIFIERS 📣 =============================== //
+//! ============================================================================ //
+
+// Alerts go out through the notifiers named in ALERT_NOTIFIERS:
+//
+//	log      one log line per alert
+//	webhook  POSTs the alert as JSON to ALERT_WEBHOOK_URL
+//	mail     writes an .eml message per alert to ALERT_MAIL_DIR, standing in
+//	         for an SMTP relay until we have one
+//
+// Adding a channel is implementing Notifier and naming it in newNotifier.
+
+const (
+	notifierLog     = "log"
+	notifierWebhook = "webhook"
+	notifierMail    = "mail"
+)
+
+var notifierNames = []string{notifierLog, notifierWebhook, notifierMail}
+
+type Notifier interface {
+	Notify(ctx context.Context, alert StockAlert) error
+}
+
+// newNotifier builds the notifiers cfg names; validate has checked the names
+// and the settings they need.
+func newNotifier(cfg AlertsConfig) Notifier {
+	var all multiNotifier
+	for _, name := range cfg.Notifiers {
+		switch name {
+		case notifierLog:
+			all = append(all, logNotifier{})
+		case notifierWebhook:
+			all = append(all, webhookNotifier{url: cfg.WebhookURL, client: &http.Client{Timeout: alertTimeout}})
+		case notifierMail:
+			all = append(all, mailNotifier{dir: cfg.MailDir, from: cfg.MailFrom, to: cfg.MailTo})
+		}
+	}
+	return all
+}
+
+// multiNotifier sends every alert to all of its notifiers.
+type multiNotifier []Notifier
+
+func (m multiNotifier) Notify(ctx context.Context, alert StockAlert) error {
+	var errs []error
+	for _, n := range m {
+		if err := n.Notify(ctx, alert); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// alertSummary is the one line description of alert every channel uses.
+func alertSummary(alert StockAlert) string {
+	where := "in total"
+	if alert.LocationCode != "" {
+		where = "at " + alert.LocationCode
+	}
+	return fmt.Sprintf("Variance %d of product %s is low %s: %g on hand, reorder point %g",
+		alert.VarianceID, alert.ProductID, where, alert.OnHand, alert.ReorderPoint)
+}
+
+//? --------------------------------- log ----------------------------------- //
+
+type logNotifier struct{}
+
+func (logNotifier) Notify(ctx context.Context, alert StockAlert) error {
+	log.Printf("📉 %s", alertSummary(alert))
+	return nil
+}
+
+//? ------------------------------- webhook --------------------------------- //
+
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (w webhookNotifier) Notify(ctx context.Context, alert StockAlert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook: %s answered %s", w.url, resp.Status)
+	}
+	return nil
+}
+
+//? --------------------------------- mail ---------------------------------- //
+
+type mailNotifier struct {
+	dir  string
+	from string
+	to   string
+}
+
+func (m mailNotifier) Notify(ctx context.Context, alert StockAlert) error {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", m.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", m.to)
+	fmt.Fprintf(&msg, "Date: %s\r\n", alert.RaisedAt.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Subject: Low stock: variance %d\r\n", alert.VarianceID)
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "%s.\r\n\r\nSuggested order: %g.\r\n", alertSummary(alert), alert.ReorderQuantity)
+
+	name := fmt.Sprintf("%d-variance-%d.eml", alert.RaisedAt.UnixNano(), alert.VarianceID)
+	if err := os.WriteFile(filepath.Join(m.dir, name), []byte(msg.String()), 0o644); err != nil {
+		return fmt.Errorf("mail: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//! ============================================================================ //
+//? ============================= 🛒 ORDERS 🛒 ================================= //
+//! ============================================================================ //
+
+// A customer order sells variances from one location. Each line captures the
+// variance's price for the customer and quantity when the order is placed
+// (see price_lists.go), so later price changes never alter an order. An
+// order moves through
+//
+//	pending -> paid -> fulfilled
+//
+// A pending order can be cancelled; a paid or fulfilled one refunded.
+// Fulfilling records a sale movement per line (see inventory.go), all or
+// nothing, and like any sale can only take available stock. A refund moves
+// no stock: goods that come back are a return movement.
+//
+// A line total is its unit price times its quantity, rounded half away from
+// zero to the cent (see money.go), and the order total is the sum of those.
+// An order in another currency than CURRENCY converts its prices at the
+// rate of the moment and keeps it.
+
+const (
+	orderPending   = "pending"
+	orderPaid      = "paid"
+	orderFulfilled = "fulfilled"
+	orderCancelled = "cancelled"
+	orderRefunded  = "refunded"
+)
+
+var orderStatuses = []string{orderPending, orderPaid, orderFulfilled, orderCancelled, orderRefunded}
+
+// orderTransitions are the statuses each status can move to.
+var orderTransitions = map[string][]string{
+	orderPending:   {orderPaid, orderCancelled},
+	orderPaid:      {orderFulfilled, orderRefunded},
+	orderFulfilled: {orderRefunded},
+}
+
+type Order struct {
+	ID     int    `json:"id"`
+	Status string `json:"status"`
+	// LocationID is where the order is fulfilled from; 0 means the main
+	// building.
+	LocationID int         `json:"location_id"`
+	Customer   string      `json:"customer" binding:"max=200"`
+	Reference  string      `json:"reference" binding:"max=200"`
+	Notes      string      `json:"notes"`
+	Lines      []OrderLine `json:"lines" binding:"required,min=1,unique=VarianceID,dive"`
+	Total      Money       `json:"total"`
+	// Currency is what the order is priced in, CURRENCY when left out.
+	Currency string `json:"currency" binding:"omitempty,currency"`
+	// ExchangeRate is the rate from CURRENCY that priced the order; see
+	// exchange_rates.go.
+	ExchangeRate Decimal `json:"exchange_rate"`
+	// PriceList is the customer's price list, which priced the lines; see
+	// price_lists.go.
+	PriceList string     `json:"price_list"`
+	CreatedBy string     `json:"created_by"`
+	CreatedAt *time.Time `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+type OrderLine struct {
+	ID         int     `json:"id"`
+	VarianceID int     `json:"variance_id" binding:"required"`
+	Quantity   float64 `json:"quantity" binding:"gt=0"`
+	// UnitPrice is the variance's price when the order was placed, in the
+	// order's currency.
+	UnitPrice Money `json:"unit_price"`
+	LineTotal Money `json:"line_total"`
+	// MovementID is the sale movement that fulfilled the line.
+	MovementID *int `json:"movement_id"`
+}
+
+// price sets l's unit price and line total from a retail price.
+func (l *OrderLine) price(retail Money) {
+	l.UnitPrice, l.LineTotal = retail, retail.Times(l.Quantity).Round(priceScale, RoundHalfUp)
+}
+
+// total sums o's line totals.
+func (o Order) total() (Money, error) {
+	total := Money{Currency: o.Currency}
+	for _, l := range o.Lines {
+		var err error
+		if total, err = total.Add(l.LineTotal); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// OrderFilter narrows /orders; zero fields match everything.
+type OrderFilter struct {
+	Status   string
+	Customer string
+}
+
+var orderSortFields = sortFields{
+	"id":         "id",
+	"status":     "status",
+	"total":      "total",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
+func orderSortKey(o Order, field string) any {
+	switch field {
+	case "status":
+		return o.Status
+	case "total":
+		return o.Total.Amount
+	case "created_at":
+		return timeValue(o.CreatedAt)
+	case "updated_at":
+		return timeValue(o.UpdatedAt)
+	}
+	return o.ID
+}
+
+// OrderFulfilment is a fulfilled order and the sales it recorded.
+type OrderFulfilment struct {
+	Order     Order           `json:"order"`
+	Movements []StockMovement `json:"movements"`
+}
+
+// saleMovement is the sale fulfilling l, from the template sale.
+func (o Order) saleMovement(l OrderLine, sale StockMovement) StockMovement {
+	sale.VarianceID, sale.LocationID, sale.Quantity = l.VarianceID, o.LocationID, -l.Quantity
+	sale.Reference = o.Reference
+	if sale.Reference == "" {
+		sale.Reference = fmt.Sprintf("ORDER-%d", o.ID)
+	}
+	return sale
+}
+
+// checkOrderTransition fails unless o may move to status.
+func checkOrderTransition(o Order, status string) error {
+	if !contains(orderTransitions[o.Status], status) {
+		return errTransition("Order", o.ID, o.Status, status)
+	}
+	return nil
+}
+
+//? ---------------------------- http handlers ------------------------------ //
+
+// orderID reads the :id path parameter.
+func orderID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, errBadRequest("Order id must be a number"))
+		return 0, false
+	}
+	return id, true
+}
+
+func (s *server) createOrder(c *gin.Context) {
+	var o Order
+	if err := c.ShouldBindJSON(&o); err != nil {
+		respondError(c, errBinding(err))
+		return
+	}
+	now := time.Now()
+	o.ID, o.Status, o.CreatedBy, o.CreatedAt, o.UpdatedAt = 0, orderPending, actor(c), &now, &now
+	// Prices are captured by the store, never taken from the client
+	for i := range o.Lines {
+		o.Lines[i] = OrderLine{VarianceID: o.Lines[i].VarianceID, Quantity: o.Lines[i].Quantity}
+	}
+
+	result, err := s.store.Orders.CreateOrder(c.Request.Context(), o)
+	if err != nil {
+		respondError(c, storeError(err, "Failed to create order"))
+		return
+	}
+	respondOK(c, result)
+}
+
+func (s *server) getOrder(c *gin.Context) {
+	id, ok := orderID(c)
+	if !ok {
+		return
+	}
+
+	o, err := s.store.Orders.GetOrder(c.Request.Context(), id)
+	if errors.Is(err, errNotFound) {
+		respondError(c, errNotFoundf("Order %d does not exist", id))
+		return
+	}
+	if err != nil {
+		respondError(c, storeError(err, "Failed to fetch order"))
+		return
+	}
+	respondOK(c, o)
+}
+
+func (s *server) listOrders(c *gin.Context) {
+	opts, err := listParams(c, orderSortFields)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	f := OrderFilter{Status: c.Query("status"), Customer: c.Query("customer")}
+	if f.Status != "" && !contains(orderStatuses, f.Status) {
+		respondError(c, errBadRequest("status must be one of: "+strings.Join(orderStatuses, ", ")))
+		return
+	}
+
+	page, err := s.store.Orders.ListOrders(c.Request.Context(), f, opts)
+	if err != nil {
+		respondError(c, storeError(err, "Failed to fetch orders"))
+		return
+	}
+	respondPage(c, page)
+}
+
+// setOrderStatus handles the transitions that move no stock: pay, cancel
+// and refund.
+func (s *server) setOrderStatus(status string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := orderID(c)
+		if !ok {
+			return
+		}
+
+		o, err := s.store.Orders.SetOrderStatus(c.Request.Context(), id, status, time.Now())
+		if errors.Is(err, errNotFound) {
+			respondError(c, errNotFoundf("Order %d does not exist", id))
+			return
+		}
+		if err != nil {
+			respondError(c, storeError(err, "Failed to update order"))
+			return
+		}
+		respondOK(c, o)
+	}
+}
+
+func (s *server) fulfilOrder(c *gin.Context) {
+	id, ok := orderID(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	sale := StockMovement{Kind: movementSale, Reason: movementReasons[movementSale][0], CreatedBy: actor(c), CreatedAt: &now}
+	result, err := s.store.Orders.FulfilOrder(c.Request.Context(), id, sale)
+	if errors.Is(err, errNotFound) {
+		respondError(c, errNotFoundf("Order %d does not exist", id))
+		return
+	}
+	if err != nil {
+		respondError(c, storeError(err, "Failed to fulfil order"))
+		return
+	}
+	for _, m := range result.Movements {
+		s.alerts.stockChanged(c.Request.Context(), m.VarianceID, m.LocationID)
+	}
+	respondOK(c, result)
+}
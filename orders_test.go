@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Orders and rate updates racing each other: every order's lines must be
+// priced at the rate the order records, whichever one that turns out to be.
+func TestOrderPricedAtTheRateItRecords(t *testing.T) {
+	for name, stores := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			pricing := defaultConfig().Pricing
+			v := testVarianceWithStock(t, stores, 100)
+			rates := []Decimal{newDecimal(3, 3), newDecimal(4, 3)}
+			setRate := func(rate Decimal) {
+				now := time.Now()
+				if _, err := stores.ExchangeRates.UpsertExchangeRates(ctx, []ExchangeRate{{Currency: "XTS", Rate: rate, UpdatedAt: &now}}); err != nil {
+					t.Error(err)
+				}
+			}
+			setRate(rates[0])
+
+			done := make(chan struct{})
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; ; i++ {
+					select {
+					case <-done:
+						return
+					default:
+						setRate(rates[i%2])
+					}
+				}
+			}()
+
+			var orders []Order
+			for range 20 {
+				now := time.Now()
+				o, err := stores.Orders.CreateOrder(ctx, Order{Status: orderPending, Currency: "XTS", CreatedAt: &now, UpdatedAt: &now,
+					Lines: []OrderLine{{VarianceID: v.ID, Quantity: 1}}})
+				if err != nil {
+					t.Fatal(err)
+				}
+				orders = append(orders, o)
+			}
+			close(done)
+			wg.Wait()
+
+			for _, o := range orders {
+				rate := ExchangeRate{Currency: "XTS", Rate: o.ExchangeRate}
+				want := rate.price(v.RetailPrice, pricing.Rounding)
+				if got := o.Lines[0].UnitPrice; got.Amount.Cmp(want.Amount) != 0 || got.Currency != "XTS" {
+					t.Errorf("order %d at rate %s has unit price %s, want %s", o.ID, o.ExchangeRate, got, want)
+				}
+			}
+		})
+	}
+}
+
+// testOrder places a pending order for quantity of each variance.
+func testOrder(t *testing.T, stores Stores, quantity float64, variances ...Variance) Order {
+	t.Helper()
+	now := time.Now()
+	o := Order{Status: orderPending, CreatedBy: "test", CreatedAt: &now, UpdatedAt: &now}
+	for _, v := range variances {
+		o.Lines = append(o.Lines, OrderLine{VarianceID: v.ID, Quantity: quantity})
+	}
+	o, err := stores.Orders.CreateOrder(context.Background(), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func TestOrderTransitions(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []string
+		want  []string // status after each step; "" when the step is refused
+	}{
+		{"pay", []string{orderPaid}, []string{orderPaid}},
+		{"cancel a pending order", []string{orderCancelled}, []string{orderCancelled}},
+		{"refund once paid", []string{orderPaid, orderRefunded}, []string{orderPaid, orderRefunded}},
+		{"cancel once paid", []string{orderPaid, orderCancelled}, []string{orderPaid, ""}},
+		{"refund a pending order", []string{orderRefunded}, []string{""}},
+		{"pay twice", []string{orderPaid, orderPaid}, []string{orderPaid, ""}},
+		{"pay a cancelled order", []string{orderCancelled, orderPaid}, []string{orderCancelled, ""}},
+	}
+	for name, stores := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			v := testVarianceWithStock(t, stores, 10)
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					o := testOrder(t, stores, 1, v)
+					for i, status := range tt.steps {
+						got, err := stores.Orders.SetOrderStatus(context.Background(), o.ID, status, time.Now())
+						if tt.want[i] == "" {
+							if errCode(err) != CodeInvalidTransition {
+								t.Fatalf("step %d to %s: err = %v, want %s", i, status, err, CodeInvalidTransition)
+							}
+							continue
+						}
+						if err != nil {
+							t.Fatalf("step %d to %s: %v", i, status, err)
+						}
+						if got.Status != tt.want[i] {
+							t.Fatalf("step %d: status = %s, want %s", i, got.Status, tt.want[i])
+						}
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestOrderTotals(t *testing.T) {
+	for name, stores := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			a, b := testVarianceWithStock(t, stores, 10), testVarianceWithStock(t, stores, 10)
+			now := time.Now()
+			o, err := stores.Orders.CreateOrder(context.Background(), Order{Status: orderPending, CreatedAt: &now, UpdatedAt: &now,
+				Lines: []OrderLine{{VarianceID: a.ID, Quantity: 2}, {VarianceID: b.ID, Quantity: 0.00125}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// 700 x 0.00125 is 0.875, which rounds half away from zero
+			wants := []Decimal{newDecimal(1400, 0), newDecimal(88, 2)}
+			for i, want := range wants {
+				l := o.Lines[i]
+				if l.UnitPrice.Amount.Cmp(newDecimal(700, 0)) != 0 || l.LineTotal.Amount.Cmp(want) != 0 {
+					t.Errorf("line %d: %s x %g = %s, want 700 x %g = %s", i, l.UnitPrice, l.Quantity, l.LineTotal, l.Quantity, want)
+				}
+			}
+			if o.Total.Amount.Cmp(newDecimal(140088, 2)) != 0 || o.Currency != defaultConfig().Pricing.Currency {
+				t.Errorf("total = %s %s, want 1400.88 in the base currency", o.Total, o.Currency)
+			}
+		})
+	}
+}
+
+func TestFulfilOrder(t *testing.T) {
+	for name, stores := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			v := testVarianceWithStock(t, stores, 5)
+			first, second := testOrder(t, stores, 3, v), testOrder(t, stores, 4, v)
+
+			if _, err := stores.Orders.FulfilOrder(ctx, first.ID, testSale()); errCode(err) != CodeInvalidTransition {
+				t.Errorf("fulfilling a pending order: err = %v, want %s", err, CodeInvalidTransition)
+			}
+			for _, o := range []Order{first, second} {
+				if _, err := stores.Orders.SetOrderStatus(ctx, o.ID, orderPaid, time.Now()); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			result, err := stores.Orders.FulfilOrder(ctx, first.ID, testSale())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Order.Status != orderFulfilled || len(result.Movements) != 1 {
+				t.Fatalf("fulfilment = %+v", result)
+			}
+			mv := result.Movements[0]
+			if mv.Kind != movementSale || mv.Quantity != -3 || mv.BalanceAfter != 2 || mv.Reference != fmt.Sprintf("ORDER-%d", first.ID) {
+				t.Errorf("movement = %+v", mv)
+			}
+			if id := result.Order.Lines[0].MovementID; id == nil || *id != mv.ID {
+				t.Errorf("line movement = %v, want %d", id, mv.ID)
+			}
+
+			if _, err := stores.Orders.FulfilOrder(ctx, second.ID, testSale()); errCode(err) != CodeInsufficientStock {
+				t.Errorf("fulfilling 4 of 2: err = %v, want %s", err, CodeInsufficientStock)
+			}
+			if o, _ := stores.Orders.GetOrder(ctx, second.ID); o.Status != orderPaid {
+				t.Errorf("short order is %s, want %s", o.Status, orderPaid)
+			}
+
+			// A refund moves no stock
+			if _, err := stores.Orders.SetOrderStatus(ctx, first.ID, orderRefunded, time.Now()); err != nil {
+				t.Fatal(err)
+			}
+			if onHand, _ := onHandAt(t, stores, v.ID); onHand != 2 {
+				t.Errorf("on hand = %g, want 2", onHand)
+			}
+		})
+	}
+}
+
+func TestOrderAPI(t *testing.T) {
+	r := newTestAPI(t)
+
+	// The client's prices are ignored; the variance's retail price is used
+	w, env := serveJSON(t, r, http.MethodPost, "/orders",
+		`{"customer":"Nimal","lines":[{"variance_id":1,"quantity":1.5,"unit_price":1}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /orders = %d %s", w.Code, w.Body.String())
+	}
+	var o Order
+	decodeData(t, env, &o)
+	if o.Status != orderPending || o.Lines[0].UnitPrice.Amount.Cmp(newDecimal(1800, 0)) != 0 || o.Total.Amount.Cmp(newDecimal(2700, 0)) != 0 {
+		t.Errorf("order = %+v, want pending at 1800 totalling 2700", o)
+	}
+
+	steps := []struct {
+		path   string
+		status int
+		code   string
+	}{
+		{"fulfil", http.StatusConflict, CodeInvalidTransition},
+		{"pay", http.StatusOK, ""},
+		{"fulfil", http.StatusOK, ""},
+		{"cancel", http.StatusConflict, CodeInvalidTransition},
+		{"refund", http.StatusOK, ""},
+	}
+	for _, step := range steps {
+		path := fmt.Sprintf("/orders/%d/%s", o.ID, step.path)
+		w, env := serveJSON(t, r, http.MethodPost, path, nil)
+		if w.Code != step.status {
+			t.Fatalf("POST %s = %d %s, want %d", path, w.Code, w.Body.String(), step.status)
+		}
+		if step.code != "" && (env.Error == nil || env.Error.Code != step.code) {
+			t.Errorf("POST %s: error %+v, want %s", path, env.Error, step.code)
+		}
+	}
+
+	w, env = serveJSON(t, r, http.MethodGet, fmt.Sprintf("/orders/%d", o.ID), nil)
+	decodeData(t, env, &o)
+	if w.Code != http.StatusOK || o.Status != orderRefunded || o.Lines[0].MovementID == nil {
+		t.Errorf("GET order = %d, %+v", w.Code, o)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//! ============================================================================ //
+//? =========================== 📑 PAGINATION 📑 ================================ //
+//! ============================================================================ //
+
+// Lists can be paged two ways:
+//
+//   - offset: page/pagesize on /products/search, which reports meta.total
+//   - keyset: limit and cursor on every list endpoint. A page that has more
+//     rows after it carries meta.next_cursor; passing it back as cursor=
+//     continues right after the last row, so edits made in between do not
+//     shift rows across pages.
+//
+// A cursor is opaque to clients. It holds the sort it was issued for and the
+// sort key values of the last row, ending with its id.
+
+const (
+	defaultCursorLimit = 50
+	maxPageSize        = 500
+)
+
+// ListOptions orders and pages the plain list endpoints.
+type ListOptions struct {
+	Sort SortSpec
+	// After continues a keyset page; nil starts from the first row.
+	After *Cursor
+	// Limit caps the rows returned; 0 returns every row.
+	Limit int
+}
+
+type Cursor struct {
+	Sort   string
+	Values []any
+}
+
+// cursorToken is the wire form of a Cursor. Each value is prefixed with its
+// type so it decodes back to what the sort key returned.
+type cursorToken struct {
+	Sort   string   `json:"s"`
+	Values []string `json:"v"`
+}
+
+func errInvalidCursor(reason string) *APIError {
+	return &APIError{Status: http.StatusBadRequest, Code: CodeBadRequest, Message: "Invalid cursor",
+		Details: gin.H{"param": "cursor", "reason": reason}}
+}
+
+// encodeCursor issues the cursor for the row whose sort key values are values.
+func encodeCursor(spec SortSpec, values []any) string {
+	token := cursorToken{Sort: spec.String(), Values: make([]string, len(values))}
+	for i, v := range values {
+		switch v := v.(type) {
+		case string:
+			token.Values[i] = "s:" + v
+		case int:
+			token.Values[i] = "i:" + strconv.Itoa(v)
+		case float64:
+			token.Values[i] = "f:" + strconv.FormatFloat(v, 'g', -1, 64)
+		case Decimal:
+			token.Values[i] = "d:" + v.String()
+		case time.Time:
+			token.Values[i] = "t:" + v.UTC().Format(time.RFC3339Nano)
+		default:
+			panic(fmt.Sprintf("cursor value of unsupported type %T", v))
+		}
+	}
+	raw, _ := json.Marshal(token)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidCursor("not a cursor issued by this API")
+	}
+	var token cursorToken
+	if err := json.Unmarshal(raw, &token); err != nil || len(token.Values) == 0 {
+		return nil, errInvalidCursor("not a cursor issued by this API")
+	}
+
+	c := &Cursor{Sort: token.Sort, Values: make([]any, len(token.Values))}
+	for i, v := range token.Values {
+		kind, value, _ := strings.Cut(v, ":")
+		switch kind {
+		case "s":
+			c.Values[i] = value
+		case "i":
+			c.Values[i], err = strconv.Atoi(value)
+		case "f":
+			c.Values[i], err = strconv.ParseFloat(value, 64)
+		case "d":
+			c.Values[i], err = parseDecimal(value)
+		case "t":
+			c.Values[i], err = time.Parse(time.RFC3339Nano, value)
+		default:
+			err = fmt.Errorf("unknown value kind %q", kind)
+		}
+		if err != nil {
+			return nil, errInvalidCursor("not a cursor issued by this API")
+		}
+	}
+	return c, nil
+}
+
+// valuesFor returns the cursor's values if it was issued for spec.
+func (c *Cursor) valuesFor(spec SortSpec) ([]any, error) {
+	if c.Sort != spec.String() || len(c.Values) != len(spec) {
+		return nil, errInvalidCursor(fmt.Sprintf("issued for sort %q, not %q", c.Sort, spec.String()))
+	}
+	return c.Values, nil
+}
+
+// keyset renders the condition selecting rows that come after cursor in spec
+// order, e.g. for sort=-title:
+//
+//	(title < $1) OR (title = $1 AND id > $2)
+//
+// Placeholders are numbered from argID. A nil cursor yields no condition.
+func keyset(cursor *Cursor, spec SortSpec, allowed sortFields, argID int) (string, []any, error) {
+	if cursor == nil {
+		return "", nil, nil
+	}
+	values, err := cursor.valuesFor(spec)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var alternatives []string
+	for i, f := range spec {
+		var terms []string
+		for j := range i {
+			terms = append(terms, fmt.Sprintf("%s = $%d", allowed[spec[j].Field], argID+j))
+		}
+		op := ">"
+		if f.Desc {
+			op = "<"
+		}
+		terms = append(terms, fmt.Sprintf("%s %s $%d", allowed[f.Field], op, argID+i))
+		alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")", values, nil
+}
+
+// limitClause fetches one row more than limit so pageOf can tell whether
+// another page follows.
+func limitClause(limit int) string {
+	if limit <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" LIMIT %d", limit+1)
+}
+
+// pageOf trims items fetched with limitClause back to limit and issues the
+// cursor for the row after the last one kept.
+func pageOf[T any](items []T, total, limit int, spec SortSpec, key func(T, string) any) Page[T] {
+	page := Page[T]{Items: items, Total: total}
+	if limit <= 0 || len(items) <= limit {
+		return page
+	}
+	page.Items = items[:limit]
+	page.NextCursor = encodeCursor(spec, sortValues(page.Items[limit-1], spec, key))
+	return page
+}
+
+func sortValues[T any](item T, spec SortSpec, key func(T, string) any) []any {
+	values := make([]any, len(spec))
+	for i, f := range spec {
+		values[i] = key(item, f.Field)
+	}
+	return values
+}
+
+// listParams reads sort, cursor and limit for a list endpoint. Without limit
+// or cursor the whole list is returned, as it always was.
+func listParams(c *gin.Context, allowed sortFields) (ListOptions, error) {
+	var opts ListOptions
+	var err error
+	if opts.Sort, err = sortParam(c, allowed, ""); err != nil {
+		return opts, err
+	}
+	if opts.After, err = cursorParam(c); err != nil {
+		return opts, err
+	}
+
+	if raw := c.Query("limit"); raw != "" {
+		opts.Limit, err = strconv.Atoi(raw)
+		if err != nil || opts.Limit < 1 || opts.Limit > maxPageSize {
+			return opts, errBadRequest(fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+		}
+	} else if opts.After != nil {
+		opts.Limit = defaultCursorLimit
+	}
+	return opts, nil
+}
+
+func cursorParam(c *gin.Context) (*Cursor, error) {
+	raw := c.Query("cursor")
+	if raw == "" {
+		return nil, nil
+	}
+	return decodeCursor(raw)
+}
+
+// cursorLinks builds self/next links for a keyset page.
+func cursorLinks(c *gin.Context, nextCursor string) Links {
+	links := Links{Self: c.Request.URL.RequestURI()}
+	if nextCursor != "" {
+		next := *c.Request.URL
+		q := next.Query()
+		q.Del("page")
+		q.Set("cursor", nextCursor)
+		next.RawQuery = q.Encode()
+		links.Next = next.RequestURI()
+	}
+	return links
+}
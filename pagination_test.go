@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	spec := SortSpec{{Field: "title", Desc: true}, {Field: "quantity"}, {Field: "retail_price"}, {Field: "created_at"}, {Field: "id"}}
+	values := []any{"Cement: 50kg, \"grey\"", 12.5, newDecimal(180050, 2),
+		time.Date(2026, 3, 1, 9, 30, 0, 123456789, time.UTC), 42}
+
+	c, err := decodeCursor(encodeCursor(spec, values))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.valuesFor(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range values {
+		if d, ok := values[i].(Decimal); ok {
+			if g, _ := got[i].(Decimal); g.Cmp(d) != 0 {
+				t.Errorf("value %d = %v, want %v", i, got[i], d)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got[i], values[i]) {
+			t.Errorf("value %d = %#v, want %#v", i, got[i], values[i])
+		}
+	}
+
+	if _, err := c.valuesFor(SortSpec{{Field: "title"}, {Field: "id"}}); err == nil {
+		t.Error("cursor issued for one sort was accepted for another")
+	}
+}
+
+func TestDecodeCursorRejectsTampering(t *testing.T) {
+	token := func(json string) string { return base64.RawURLEncoding.EncodeToString([]byte(json)) }
+	valid := encodeCursor(SortSpec{{Field: "id"}}, []any{7})
+	tests := map[string]string{
+		"not base64":         "%%%",
+		"padded base64":      valid + "==",
+		"not json":           token("id=7"),
+		"no values":          token(`{"s":"id","v":[]}`),
+		"unknown kind":       token(`{"s":"id","v":["x:7"]}`),
+		"bad int":            token(`{"s":"id","v":["i:seven"]}`),
+		"bad time":           token(`{"s":"created_at","v":["t:yesterday"]}`),
+		"bad decimal":        token(`{"s":"retail_price","v":["d:1e"]}`),
+		"value without kind": token(`{"s":"id","v":["7"]}`),
+	}
+	for name, raw := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := decodeCursor(raw)
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadRequest {
+				t.Errorf("decodeCursor(%q) err = %v, want a 400", raw, err)
+			}
+		})
+	}
+}
+
+func TestKeyset(t *testing.T) {
+	spec := SortSpec{{Field: "title", Desc: true}, {Field: "id"}}
+	cursor := &Cursor{Sort: "-title,id", Values: []any{"Sand", 3}}
+	where, args, err := keyset(cursor, spec, productSortFields, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "((title < $4) OR (title = $4 AND id > $5))"; where != want {
+		t.Errorf("keyset = %q, want %q", where, want)
+	}
+	if !reflect.DeepEqual(args, cursor.Values) {
+		t.Errorf("args = %v, want %v", args, cursor.Values)
+	}
+}
+
+// Following next_cursor visits every row once, even when a row is added
+// before the cursor between pages, and a cursor that was edited is a 400.
+func TestCursorPagesOverHTTP(t *testing.T) {
+	r := newTestAPI(t)
+	upsert := func(title string) {
+		t.Helper()
+		body := fmt.Sprintf(`{"productName":"Portland Cement","product_id":"p1","variance":%q,"brand":"Holcim","retail_price":100}`, title)
+		if w, _ := serveJSON(t, r, http.MethodPost, "/variance/upsert", body); w.Code != http.StatusOK {
+			t.Fatalf("upsert = %d %s", w.Code, w.Body.String())
+		}
+	}
+	for _, title := range []string{"10kg bag", "20kg bag", "30kg bag", "40kg bag"} {
+		upsert(title)
+	}
+
+	var seen []string
+	path := "/variance/by-product/p1?sort=variance&limit=2"
+	for page := 0; ; page++ {
+		w, env := serveJSON(t, r, http.MethodGet, path, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d %s", path, w.Code, w.Body.String())
+		}
+		var items []Variance
+		decodeData(t, env, &items)
+		for _, v := range items {
+			seen = append(seen, v.VarianceTitle)
+		}
+		if page == 0 {
+			upsert("05kg bag") // sorts before the cursor, so no page shifts
+		}
+		if env.Meta.NextCursor == "" {
+			break
+		}
+		path = "/variance/by-product/p1?sort=variance&limit=2&cursor=" + env.Meta.NextCursor
+	}
+	want := []string{"10kg bag", "20kg bag", "30kg bag", "40kg bag", "50kg bag"}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("pages held %v, want %v", seen, want)
+	}
+
+	_, env := serveJSON(t, r, http.MethodGet, "/variance/by-product/p1?sort=variance&limit=2", nil)
+	cursor := env.Meta.NextCursor
+	for name, path := range map[string]string{
+		"edited":     "/variance/by-product/p1?sort=variance&cursor=" + strings.ToUpper(cursor),
+		"other sort": "/variance/by-product/p1?sort=-variance&cursor=" + cursor,
+	} {
+		if w, env := serveJSON(t, r, http.MethodGet, path, nil); w.Code != http.StatusBadRequest || env.Error.Code != CodeBadRequest {
+			t.Errorf("%s cursor = %d %s, want 400", name, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//! ============================================================================ //
+//? ========================== 🏷️ PRICE HISTORY 🏷️ ============================= //
+//! ============================================================================ //
+
+// Every change to a variance's original_price, retail_price or
+// wholesale_price is recorded in price_history with the old and new price,
+// what made it (a variance upsert, a catalog import, a purchase order
+// receipt or a scheduled change), who and when, in the same transaction as
+// the change itself. A variance's first prices are not history; its history
+// starts with the first change.
+//
+// That answers "what was the price last month": a price at a moment is the
+// from of the first change after it, or the current price when nothing has
+// changed it since.
+//
+// A price change can also be scheduled for later. Scheduled changes are
+// pending until the price scheduler (see startJobs) applies them at or soon
+// after their effective_at, or they are cancelled. A change that would put
+// retail_price below wholesale_price or original_price by then fails and
+// leaves the prices alone.
+
+// Sources of price changes.
+const (
+	priceSourceUpsert        = "upsert"
+	priceSourceImport        = "import"
+	priceSourcePurchaseOrder = "purchase_order"
+	priceSourceSchedule      = "schedule"
+)
+
+var priceSources = []string{priceSourceUpsert, priceSourceImport, priceSourcePurchaseOrder, priceSourceSchedule}
+
+const (
+	schedulePending   = "pending"
+	scheduleApplied   = "applied"
+	scheduleCancelled = "cancelled"
+	scheduleFailed    = "failed"
+)
+
+var scheduleStatuses = []string{schedulePending, scheduleApplied, scheduleCancelled, scheduleFailed}
+
+// PriceHistory is one recorded change of one variance price.
+type PriceHistory struct {
+	ID int `json:"id"`
+	PriceChange
+	Currency  string     `json:"currency"`
+	Source    string     `json:"source"`
+	Reference string     `json:"reference"`
+	ChangedBy string     `json:"changed_by"`
+	ChangedAt *time.Time `json:"changed_at"`
+}
+
+// PriceHistoryFilter narrows /variance/price-history/:id; zero fields match
+// everything.
+type PriceHistoryFilter struct {
+	VarianceID int
+	Field      string
+	Source     string
+	// Since and Until bound changed_at, Since inclusive, Until exclusive.
+	Since *time.Time
+	Until *time.Time
+}
+
+var priceHistorySortFields = sortFields{
+	"id":         "id",
+	"changed_at": "changed_at",
+}
+
+func priceHistorySortKey(h PriceHistory, field string) any {
+	if field == "changed_at" {
+		return timeValue(h.ChangedAt)
+	}
+	return h.ID
+}
+
+// VariancePrices are a variance's prices at a moment.
+type VariancePrices struct {
+	VarianceID     int       `json:"variance_id"`
+	At             time.Time `json:"at"`
+	OriginalPrice  Money     `json:"original_price"`
+	RetailPrice    Money     `json:"retail_price"`
+	WholesalePrice Money     `json:"wholesale_price"`
+	Currency       string    `json:"currency"`
+}
+
+// priceFields are the variance prices history keeps, by column name.
+var priceFields = []struct {
+	name string
+	of   func(*Variance) *Money
+}{
+	{"original_price", func(v *Variance) *Money { return &v.OriginalPrice }},
+	{"retail_price", func(v *Variance) *Money { return &v.RetailPrice }},
+	{"wholesale_price", func(v *Variance) *Money { return &v.WholesalePrice }},
+}
+
+func priceFieldNames() []string {
+	names := make([]string, len(priceFields))
+	for i, f := range priceFields {
+		names[i] = f.name
+	}
+	return names
+}
+
+// changes returns a history row, filled in from h, for each price v has
+// that old did not. A variance's prices are all in the base currency.
+func (h PriceHistory) changes(old, v Variance) []PriceHistory {
+	var rows []PriceHistory
+	for _, f := range priceFields {
+		from, to := *f.of(&old), *f.of(&v)
+		if from.Amount.Cmp(to.Amount) != 0 {
+			row := h
+			row.PriceChange = PriceChange{VarianceID: old.ID, Field: f.name, From: from, To: to}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// pricesAt rolls v's current prices back to at, given the changes made
+// after it in the order they were made.
+func pricesAt(v Variance, at time.Time, later []PriceHistory) VariancePrices {
+	seen := map[string]bool{}
+	for _, h := range later {
+		if seen[h.Field] {
+			continue
+		}
+		seen[h.Field] = true
+		for _, f := range priceFields {
+			if f.name == h.Field {
+				*f.of(&v) = h.From
+			}
+		}
+	}
+	return VariancePrices{VarianceID: v.ID, At: at, OriginalPrice: v.OriginalPrice,
+		RetailPrice: v.RetailPrice, WholesalePrice: v.WholesalePrice, Currency: v.Currency}
+}
+
+// ScheduledPrice is a price change set to apply at EffectiveAt. It is also
+// the body of POST /variance/scheduled-prices.
+type ScheduledPrice struct {
+	ID         int `json:"id"`
+	VarianceID int `json:"variance_id" binding:"required"`
+	// The prices to set; a price left out stays whatever it is by then.
+	OriginalPrice  *Money     `json:"original_price" binding:"omitempty,gte=0"`
+	RetailPrice    *Money     `json:"retail_price" binding:"omitempty,gte=0"`
+	WholesalePrice *Money     `json:"wholesale_price" binding:"omitempty,gte=0"`
+	Currency       string     `json:"currency"`
+	EffectiveAt    *time.Time `json:"effective_at" binding:"required"`
+	Reference      string     `json:"reference" binding:"max=200"`
+	Status         string     `json:"status"`
+	// Failure says why a failed change was not applied.
+	Failure   string     `json:"failure,omitempty"`
+	CreatedBy string     `json:"created_by"`
+	CreatedAt *time.Time `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// ScheduledPriceFilter narrows /variance/scheduled-prices; zero fields
+// match everything.
+type ScheduledPriceFilter struct {
+	VarianceID int
+	Status     string
+}
+
+var scheduledPriceSortFields = sortFields{
+	"id":           "id",
+	"effective_at": "effective_at",
+	"created_at":   "created_at",
+}
+
+func scheduledPriceSortKey(sp ScheduledPrice, field string) any {
+	switch field {
+	case "effective_at":
+		return timeValue(sp.EffectiveAt)
+	case "created_at":
+		return timeValue(sp.CreatedAt)
+	}
+	return sp.ID
+}
+
+// prices lists the prices sp sets, by priceFields order, nil for the ones
+// it leaves alone.
+func (sp ScheduledPrice) prices() []*Money {
+	return []*Money{sp.OriginalPrice, sp.RetailPrice, sp.WholesalePrice}
+}
+
+// applyTo returns v with the prices sp sets, or why it cannot have them.
+func (sp ScheduledPrice) applyTo(v Variance) (Variance, error) {
+	for i, p := range sp.prices() {
+		if p != nil {
+			*priceFields[i].of(&v) = *p
+		}
+	}
+	if conflicts := v.priceConflicts(); len(conflicts) > 0 {
+		return v, fmt.Errorf("retail_price %s would be below %s", v.RetailPrice.Amount, strings.Join(conflicts, " and "))
+	}
+	return v, nil
+}
+
+// history is the template of the history rows applying sp at now writes.
+func (sp ScheduledPrice) history(now time.Time) PriceHistory {
+	reference := sp.Reference
+	if reference == "" {
+		reference = fmt.Sprintf("scheduled price %d", sp.ID)
+	}
+	return PriceHistory{Source: priceSourceSchedule, Reference: reference, ChangedBy: sp.CreatedBy, ChangedAt: &now}
+}
+
+// priced rounds the prices sp sets to the cent in currency.
+func (sp *ScheduledPrice) priced(currency string) {
+	for _, p := range sp.prices() {
+		if p != nil {
+			*p = p.price(currency)
+		}
+	}
+	sp.Currency = currency
+}
+
+//? ---------------------------- http handlers ------------------------------ //
+
+// varianceID reads the :id path parameter.
+func varianceID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, errBadRequest("Variance id must be a number"))
+		return 0, false
+	}
+	return id, true
+}
+
+func (s *server) getPriceHistory(c *gin.Context) {
+	id, ok := varianceID(c)
+	if !ok {
+		return
+	}
+	opts, err := listParams(c, priceHistorySortFields)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	f := PriceHistoryFilter{VarianceID: id, Field: c.Query("field"), Source: c.Query("source")}
+	if f.Field != "" && !contains(priceFieldNames(), f.Field) {
+		respondError(c, errBadRequest("field must be one of: "+strings.Join(priceFieldNames(), ", ")))
+		return
+	}
+	if f.Source != "" && !contains(priceSources, f.Source) {
+		respondError(c, errBadRequest("source must be one of: "+strings.Join(priceSources, ", ")))
+		return
+	}
+	for param, bound := range map[string]**time.Time{"since": &f.Since, "until": &f.Until} {
+		if raw := c.Query(param); raw != "" {
+			t, err := parseDate(raw)
+			if err != nil {
+				respondError(c, errBadRequest(param+" must be RFC 3339 or YYYY-MM-DD"))
+				return
+			}
+			*bound = &t
+		}
+	}
+
+	page, err := s.store.PriceHistory.ListPriceHistory(c.Request.Context(), f, opts)
+	if err != nil {
+		respondError(c, storeError(err, "Failed to fetch price history"))
+		return
+	}
+	respondPage(c, page)
+}
+
+func (s *server) getVariancePrices(c *gin.Context) {
+	id, ok := varianceID(c)
+	if !ok {
+		return
+	}
+	at := time.Now()
+	if raw := c.Query("date"); raw != "" {
+		var err error
+		if at, err = parseDate(raw); err != nil {
+			respondError(c, errBadRequest("date must be RFC 3339 or YYYY-MM-DD"))
+			return
+		}
+	}
+
+	prices, err := s.store.PriceHistory.PricesAt(c.Request.Context(), id, at)
+	if errors.Is(err, errNotFound) {
+		respondError(c, errNotFoundf("Variance %d does not exist", id))
+		return
+	}
+	if err != nil {
+		respondError(c, storeError(err, "Failed to fetch prices"))
+		return
+	}
+	respondOK(c, prices)
+}
+
+func (s *server) schedulePrice(c *gin.Context) {
+	var sp ScheduledPrice
+	if err := c.ShouldBindJSON(&sp); err != nil {
+		respondError(c, errBinding(err))
+		return
+	}
+	now := time.Now()
+	if sp.OriginalPrice == nil && sp.RetailPrice == nil && sp.WholesalePrice == nil {
+		respondError(c, errBadRequest("Give at least one of original_price, retail_price or wholesale_price"))
+		return
+	}
+	if !sp.EffectiveAt.After(now) {
+		respondError(c, errBadRequest("effective_at must be in the future"))
+		return
+	}
+	if err := checkCurrency(sp.Currency, s.cfg.Pricing.Currency); err != nil {
+		respondError(c, err)
+		return
+	}
+	sp.priced(s.cfg.Pricing.Currency)
+	sp.ID, sp.Status, sp.Failure = 0, schedulePending, ""
+	sp.CreatedBy, sp.CreatedAt, sp.UpdatedAt = actor(c), &now, &now
+
+	result, err := s.store.PriceHistory.SchedulePrice(c.Request.Context(), sp)
+	if err != nil {
+		respondError(c, storeError(err, "Failed to schedule price change"))
+		return
+	}
+	respondOK(c, result)
+}
+
+func (s *server) listScheduledPrices(c *gin.Context) {
+	opts, err := listParams(c, scheduledPriceSortFields)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	f := ScheduledPriceFilter{Status: c.Query("status")}
+	if f.Status != "" && !contains(scheduleStatuses, f.Status) {
+		respondError(c, errBadRequest("status must be one of: "+strings.Join(scheduleStatuses, ", ")))
+		return
+	}
+	if raw := c.Query("variance_id"); raw != "" {
+		if f.VarianceID, err = strconv.Atoi(raw); err != nil {
+			respondError(c, errBadRequest("variance_id must be a number"))
+			return
+		}
+	}
+
+	page, err := s.store.PriceHistory.ListScheduledPrices(c.Request.Context(), f, opts)
+	if err != nil {
+		respondError(c, storeError(err, "Failed to fetch scheduled price changes"))
+		return
+	}
+	respondPage(c, page)
+}
+
+func (s *server) cancelScheduledPrice(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, errBadRequest("Scheduled price change id must be a number"))
+		return
+	}
+
+	sp, err := s.store.PriceHistory.CancelScheduledPrice(c.Request.Context(), id, time.Now())
+	if errors.Is(err, errNotFound) {
+		respondError(c, errNotFoundf("Scheduled price change %d does not exist", id))
+		return
+	}
+	if err != nil {
+		respondError(c, storeError(err, "Failed to cancel scheduled price change"))
+		return
+	}
+	respondOK(c, sp)
+}
+
+// errScheduleTransition is returned for cancelling a change that is no
+// longer pending.
+func errScheduleTransition(sp ScheduledPrice) *APIError {
+	return errTransition("Scheduled price change", sp.ID, sp.Status, scheduleCancelled)
+}
+
+//? ------------------------------ scheduler -------------------------------- //
+
+// applyScheduledPrices applies the scheduled price changes that are due.
+func applyScheduledPrices(store PriceHistoryStore) func(context.Context) error {
+	return func(ctx context.Context) error {
+		n, err := store.ApplyScheduledPrices(ctx, time.Now())
+		if n > 0 {
+			log.Printf("🏷️ applied %d scheduled price change(s)", n)
+		}
+		return err
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// A change the price rules reject is marked failed, and the changes due
+// after it are still applied.
+func TestApplyScheduledPricesGoesPastFailures(t *testing.T) {
+	for name, stores := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			v := testVarianceWithStock(t, stores, 0)
+			effective := time.Now().Add(time.Minute)
+			due := effective.Add(time.Second)
+			// Clear whatever else is due by then, so Postgres counts only ours.
+			stores.PriceHistory.ApplyScheduledPrices(ctx, due)
+			schedule := func(retail, wholesale int64) ScheduledPrice {
+				t.Helper()
+				now := time.Now()
+				sp := ScheduledPrice{VarianceID: v.ID, RetailPrice: &Money{Amount: newDecimal(retail, 0)}, EffectiveAt: &effective,
+					Status: schedulePending, CreatedBy: unauthenticated, CreatedAt: &now, UpdatedAt: &now}
+				if wholesale > 0 {
+					sp.WholesalePrice = &Money{Amount: newDecimal(wholesale, 0)}
+				}
+				sp.priced(defaultConfig().Pricing.Currency)
+				sp, err := stores.PriceHistory.SchedulePrice(ctx, sp)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return sp
+			}
+			first := schedule(800, 0)
+			broken := schedule(500, 600)
+			last := schedule(900, 0)
+
+			n, err := stores.PriceHistory.ApplyScheduledPrices(ctx, due)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 2 {
+				t.Errorf("applied %d change(s), want 2", n)
+			}
+			page, err := stores.PriceHistory.ListScheduledPrices(ctx, ScheduledPriceFilter{VarianceID: v.ID}, ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := map[int]string{first.ID: scheduleApplied, broken.ID: scheduleFailed, last.ID: scheduleApplied}
+			for _, sp := range page.Items {
+				if sp.Status != want[sp.ID] {
+					t.Errorf("scheduled price %d is %s, want %s", sp.ID, sp.Status, want[sp.ID])
+				}
+			}
+			if len(page.Items) != len(want) {
+				t.Errorf("listed %d scheduled prices, want %d", len(page.Items), len(want))
+			}
+		})
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//! ============================================================================ //
+//? ============================ 🏷️ PRICE LISTS 🏷️ ============================== //
+//! ============================================================================ //
+
+// A price list is a named set of prices: retail, wholesale, contractor,
+// staff, or any list added later. A list prices a variance with tiers, each
+// applying from a min_quantity up and, optionally, only between valid_from
+// and valid_to. Customers are assigned to one list; everyone else buys from
+// retail (defaultPriceListCode).
+//
+// The price of a variance for a customer, quantity and date is the tier of
+// the customer's list that is valid then and has the highest min_quantity
+// not above the quantity. A list without such a tier falls back to the
+// variance's own retail_price, or wholesale_price for a list whose
+// base_price is wholesale. Orders price their lines the same way.
+
+// defaultPriceListCode is the list of customers without one, which
+// migration 0012 creates along with wholesale, contractor and staff.
+const defaultPriceListCode = "retail"
+
+// Where a resolved price came from: a tier of the list, or the variance
+// price the list falls back to.
+const (
+	priceSourceList      = "price_list"
+	priceSourceRetail    = "retail_price"
+	priceSourceWholesale = "wholesale_price"
+)
+
+type PriceList struct {
+	ID          int    `json:"id"`
+	Code        string `json:"code" binding:"required,max=40"`
+	Name        string `json:"name" binding:"required,max=120"`
+	Description string `json:"description"`
+	// BasePrice is the variance price used where the list has no tier:
+	// retail (the default) or wholesale.
+	BasePrice string     `json:"base_price" binding:"omitempty,oneof=retail wholesale"`
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+// ListPrice is one tier of a price list for a variance.
+type ListPrice struct {
+	ID          int `json:"id"`
+	PriceListID int `json:"price_list_id"`
+	VarianceID  int `json:"variance_id"`
+	// MinQuantity is the least quantity the tier applies to.
+	MinQuantity float64 `json:"min_quantity" binding:"gte=0"`
+	Price       Money   `json:"price" binding:"gte=0"`
+	Currency    string  `json:"currency"`
+	// ValidFrom and ValidTo bound when the tier applies, ValidTo exclusive;
+	// nil is open-ended.
+	ValidFrom *time.Time `json:"valid_from"`
+	ValidTo   *time.Time `json:"valid_to"`
+	UpdatedBy string     `json:"updated_by"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// ListPriceSet is the body of PUT /price-lists/:code/prices/:variance_id:
+// every tier of the list for the variance.
+type ListPriceSet struct {
+	Tiers []ListPrice `json:"tiers" binding:"dive"`
+}
+
+// CustomerPriceList assigns a customer, as orders name them, to a list.
+type CustomerPriceList struct {
+	Customer  string     `json:"customer"`
+	PriceList string     `json:"price_list" binding:"required"`
+	UpdatedBy string     `json:"updated_by"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// PriceQuery asks for the price of a variance; see ResolvePrice.
+type PriceQuery struct {
+	VarianceID int
+	Customer   string
+	// PriceList names a list to use instead of the customer's.
+	PriceList string
+	Quantity  float64
+	At        time.Time
+}
+
+// PriceResolution is the effective price of a variance for a PriceQuery.
+type PriceResolution struct {
+	VarianceID int       `json:"variance_id"`
+	Customer   string    `json:"customer"`
+	Quantity   float64   `json:"quantity"`
+	At         time.Time `json:"at"`
+	PriceList  string    `json:"price_list"`
+	// Source is priceSourceList when Tier applies, or the variance price the
+	// list fell back to.
+	Source    string     `json:"source"`
+	Tier      *ListPrice `json:"tier"`
+	UnitPrice Money      `json:"unit_price"`
+	LineTotal Money      `json:"line_total"`
+	Currency  string     `json:"currency"`
+}
+
+// validAt reports whether p applies at t.
+func (p ListPrice) validAt(t time.Time) bool {
+	return (p.ValidFrom == nil || !t.Before(*p.ValidFrom)) && (p.ValidTo == nil || t.Before(*p.ValidTo))
+}
+
+// overlaps reports whether p and q apply at some moment in common.
+func (p ListPrice) overlaps(q ListPrice) bool {
+	before := func(end, start *time.Time) bool { return end != nil && start != nil && !end.After(*start) }
+	return !before(p.ValidTo, q.ValidFrom) && !before(q.ValidTo, p.ValidFrom)
+}
+
+// checkTiers fails when a tier ends before it starts, or when two tiers for
+// the same min_quantity apply at the same time, which would leave the price
+// ambiguous.
+func checkTiers(tiers []ListPrice) *APIError {
+	for i, p := range tiers {
+		if p.ValidFrom != nil && p.ValidTo != nil && !p.ValidTo.After(*p.ValidFrom) {
+			return &APIError{Status: http.StatusUnprocessableEntity, Code: CodeValidation,
+				Message: "valid_to must be after valid_from", Details: gin.H{"tier": i}}
+		}
+		for j, q := range tiers[:i] {
+			if p.MinQuantity == q.MinQuantity && p.overlaps(q) {
+				return &APIError{Status: http.StatusUnprocessableEntity, Code: CodeValidation,
+					Message: fmt.Sprintf("Tiers %d and %d both price %g or more at the same time", j, i, p.MinQuantity),
+					Details: gin.H{"tiers": []int{j, i}, "min_quantity": p.MinQuantity}}
+			}
+		}
+	}
+	return nil
+}
+
+// sortTiers orders tiers by variance and min_quantity, then by when they
+// start.
+func sortTiers(tiers []ListPrice) {
+	slices.SortStableFunc(tiers, func(a, b ListPrice) int {
+		return cmp.Or(cmp.Compare(a.VarianceID, b.VarianceID), cmp.Compare(a.MinQuantity, b.MinQuantity),
+			timeValue(a.ValidFrom).Compare(timeValue(b.ValidFrom)))
+	})
+}
+
+// resolvePrice prices q from v, the list and the list's tiers for v.
+func resolvePrice(q PriceQuery, v Variance, list PriceList, tiers []ListPrice) PriceResolution {
+	res := PriceResolution{VarianceID: v.ID, Customer: q.Customer, Quantity: q.Quantity, At: q.At,
+		PriceList: list.Code, Source: priceSourceRetail, UnitPrice: v.RetailPrice}
+	if list.BasePrice == "wholesale" {
+		res.Source, res.UnitPrice = priceSourceWholesale, v.WholesalePrice
+	}
+	for _, p := range tiers {
+		if p.MinQuantity <= q.Quantity && p.validAt(q.At) && (res.Tier == nil || p.MinQuantity > res.Tier.MinQuantity) {
+			res.Source, res.Tier, res.UnitPrice = priceSourceList, &p, p.Price
+		}
+	}
+	res.Currency = res.UnitPrice.Currency
+	res.LineTotal = res.UnitPrice.Times(q.Quantity).Round(priceScale, RoundHalfUp)
+	return res
+}
+
+// errUnknownPriceList is returned for a price list code that does not
+// exist.
+func errUnknownPriceList(code string) *APIError {
+	return &APIError{Status: http.StatusUnprocessableEntity, Code: CodeForeignKey,
+		Message: fmt.Sprintf("Price list %s does not exist", code), Details: gin.H{"price_list": code}}
+}
+
+//? ---------------------------- http handlers ------------------------------ //
+
+func (s *server) upsertPriceList(c *gin.Context) {
+	var l PriceList
+	if err := c.ShouldBindJSON(&l); err != nil {
+		respondError(c, errBinding(err))
+		return
+	}
+	now := time.Now()
+	l.ID, l.CreatedAt = 0, &now
+	if l.BasePrice == "" {
+		l.BasePrice = "retail"
+	}
+
+	result, err := s.store.PriceLists.UpsertPriceList(c.Request.Context(), l)
+	if err != nil {
+		respondError(c, storeError(err, "Failed to save price list"))
+		return
+	}
+	respondOK(c, result)
+}
+
+func (s *server) getPriceLists(c *gin.Context) {
+	lists, err := s.store.PriceLists.ListPriceLists(c.Request.Context())
+	if err != nil {
+		respondError(c, storeError(err, "Failed to fetch price lists"))
+		return
+	}
+	respondAll(c, lists)
+}
+
+func (s *server) getListPrices(c *gin.Context) {
+	code := c.Param("code")
+	varianceID := 0
+	if raw := c.Query("variance_id"); raw != "" {
+		var err error
+		if varianceID, err = strconv.Atoi(raw); err != nil {
+			respondError(c, errBadRequest("variance_id must be a number"))
+			return
+		}
+	}
+
+	prices, err := s.store.PriceLists.ListPrices(c.Request.Context(), code, varianceID)
+	if errors.Is(err, errNotFound) {
+		respondError(c, errNotFoundf("Price list %s does not exist", code))
+		return
+	}
+	if err != nil {
+		respondError(c, storeError(err, "Failed to fetch list prices"))
+		return
+	}
+	respondAll(c, prices)
+}
+
+func (s *server) setListPrices(c *gin.Context) {
+	code := c.Param("code")
+	varianceID, err := strconv.Atoi(c.Param("variance_id"))
+	if err != nil {
+		respondError(c, errBadRequest("Variance id must be a number"))
+		return
+	}
+	var set ListPriceSet
+	if err := c.ShouldBindJSON(&set); err != nil {
+		respondError(c, errBinding(err))
+		return
+	}
+	if err := checkTiers(set.Tiers); err != nil {
+		respondError(c, err)
+		return
+	}
+	now := time.Now()
+	for i := range set.Tiers {
+		set.Tiers[i].UpdatedBy, set.Tiers[i].UpdatedAt = actor(c), &now
+	}
+
+	prices, err := s.store.PriceLists.SetListPrices(c.Request.Context(), code, varianceID, set.Tiers)
+	if errors.Is(err, errNotFound) {
+		respondError(c, errNotFoundf("Price list %s does not exist", code))
+		return
+	}
+	if err != nil {
+		respondError(c, storeError(err, "Failed to save list prices"))
+		return
+	}
+	respondAll(c, prices)
+}
+
+func (s *server) assignPriceList(c *gin.Context) {
+	var a CustomerPriceList
+	if err := c.ShouldBindJSON(&a); err != nil {
+		respondError(c, errBinding(err))
+		return
+	}
+	now := time.Now()
+	a.Customer, a.UpdatedBy, a.UpdatedAt = c.Param("customer"), actor(c), &now
+
+	result, err := s.store.PriceLists.AssignPriceList(c.Request.Context(), a)
+	if err != nil {
+		respondError(c, storeError(err, "Failed to assign price list"))
+		return
+	}
+	respondOK(c, result)
+}
+
+func (s *server) getCustomerPriceList(c *gin.Context) {
+	customer := c.Param("customer")
+	a, err := s.store.PriceLists.CustomerPriceList(c.Request.Context(), customer)
+	if errors.Is(err, errNotFound) {
+		respondError(c, errNotFoundf("Customer %s has no price list", customer))
+		return
+	}
+	if err != nil {
+		respondError(c, storeError(err, "Failed to fetch price list"))
+		return
+	}
+	respondOK(c, a)
+}
+
+func (s *server) unassignPriceList(c *gin.Context) {
+	customer := c.Param("customer")
+	err := s.store.PriceLists.UnassignPriceList(c.Request.Context(), customer)
+	if errors.Is(err, errNotFound) {
+		respondError(c, errNotFoundf("Customer %s has no price list", customer))
+		return
+	}
+	if err != nil {
+		respondError(c, storeError(err, "Failed to unassign price list"))
+		return
+	}
+	respondOK(c, gin.H{"customer": customer, "price_list": defaultPriceListCode})
+}
+
+func (s *server) getResolvedPrice(c *gin.Context) {
+	q := PriceQuery{Customer: c.Query("customer"), PriceList: c.Query("price_list"), Quantity: 1, At: time.Now()}
+	var err error
+	if q.VarianceID, err = strconv.Atoi(c.Query("variance_id")); err != nil {
+		respondError(c, errBadRequest("variance_id is required and must be a number"))
+		return
+	}
+	if raw := c.Query("quantity"); raw != "" {
+		if q.Quantity, err = strconv.ParseFloat(raw, 64); err != nil || q.Quantity <= 0 {
+			respondError(c, errBadRequest("quantity must be a number greater than 0"))
+			return
+		}
+	}
+	if raw := c.Query("date"); raw != "" {
+		if q.At, err = parseDate(raw); err != nil {
+			respondError(c, errBadRequest("date must be RFC 3339 or YYYY-MM-DD"))
+			return
+		}
+	}
+	rate, err := s.rateParam(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	res, err := s.store.PriceLists.ResolvePrice(c.Request.Context(), q)
+	if errors.Is(err, errNotFound) {
+		respondError(c, errNotFoundf("Variance %d does not exist", q.VarianceID))
+		return
+	}
+	if err != nil {
+		respondError(c, storeError(err, "Failed to resolve price"))
+		return
+	}
+	if rate != nil {
+		res.UnitPrice = rate.price(res.UnitPrice, s.cfg.Pricing.Rounding)
+		res.LineTotal = res.UnitPrice.Times(res.Quantity).Round(priceScale, RoundHalfUp)
+		res.Currency = rate.Currency
+	}
+	respondOK(c, res)
+}
+
+// parseDate reads an RFC 3339 time or a YYYY-MM-DD date, the start of that
+// day in UTC.
+func parseDate(raw string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, raw)
+}
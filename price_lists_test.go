@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The Postgres resolvePrice once took its query as pq, hiding lib/pq; this
+// runs it, and the memory store's, through every way a list is picked.
+func TestResolvePrice(t *testing.T) {
+	for name, stores := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			v := testVarianceWithStock(t, stores, 0)
+			code := fmt.Sprintf("trade-%d", time.Now().UnixNano())
+			customer := "customer-" + code
+			now := time.Now()
+			if _, err := stores.PriceLists.UpsertPriceList(ctx, PriceList{Code: code, Name: "Trade", BasePrice: "retail", CreatedAt: &now}); err != nil {
+				t.Fatal(err)
+			}
+			_, err := stores.PriceLists.SetListPrices(ctx, code, v.ID, []ListPrice{
+				{MinQuantity: 1, Price: Money{Amount: newDecimal(650, 0)}, UpdatedAt: &now},
+				{MinQuantity: 10, Price: Money{Amount: newDecimal(600, 0)}, UpdatedAt: &now},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := stores.PriceLists.AssignPriceList(ctx, CustomerPriceList{Customer: customer, PriceList: code, UpdatedAt: &now}); err != nil {
+				t.Fatal(err)
+			}
+
+			tests := []struct {
+				name       string
+				query      PriceQuery
+				list       string
+				source     string
+				unit, line int64
+			}{
+				{"no customer", PriceQuery{Quantity: 2}, defaultPriceListCode, priceSourceRetail, 700, 1400},
+				{"customer's list", PriceQuery{Customer: customer, Quantity: 2}, code, priceSourceList, 650, 1300},
+				{"higher tier", PriceQuery{Customer: customer, Quantity: 12}, code, priceSourceList, 600, 7200},
+				{"below every tier", PriceQuery{Customer: customer, Quantity: 0.5}, code, priceSourceRetail, 700, 350},
+				{"named list wins", PriceQuery{Customer: customer, PriceList: defaultPriceListCode, Quantity: 12}, defaultPriceListCode, priceSourceRetail, 700, 8400},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					q := tt.query
+					q.VarianceID, q.At = v.ID, now
+					res, err := stores.PriceLists.ResolvePrice(ctx, q)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if res.PriceList != tt.list || res.Source != tt.source ||
+						res.UnitPrice.Amount.Cmp(newDecimal(tt.unit, 0)) != 0 || res.LineTotal.Amount.Cmp(newDecimal(tt.line, 0)) != 0 {
+						t.Errorf("resolved %s/%s at %s for %s, want %s/%s at %d for %d",
+							res.PriceList, res.Source, res.UnitPrice, res.LineTotal, tt.list, tt.source, tt.unit, tt.line)
+					}
+				})
+			}
+
+			if _, err := stores.PriceLists.ResolvePrice(ctx, PriceQuery{VarianceID: v.ID, PriceList: "no-such-list", Quantity: 1}); errCode(err) != CodeForeignKey {
+				t.Errorf("unknown list: err = %v, want %s", err, CodeForeignKey)
+			}
+			if _, err := stores.PriceLists.ResolvePrice(ctx, PriceQuery{VarianceID: -1, Quantity: 1}); !errors.Is(err, errNotFound) {
+				t.Errorf("unknown variance: err = %v, want errNotFound", err)
+			}
+		})
+	}
+}
+
+func TestResolvePriceTiersAndWindows(t *testing.T) {
+	now := time.Date(2026, 6, 15, 12, 0, 0, 0, time.UTC)
+	june, july := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+	price := func(amount int64) Money { return Money{Amount: newDecimal(amount, 0)} }
+	v := Variance{ID: 1, RetailPrice: price(700), WholesalePrice: price(620)}
+	tiers := []ListPrice{
+		{MinQuantity: 1, Price: price(680)},
+		{MinQuantity: 10, Price: price(640), ValidTo: &june},
+		{MinQuantity: 10, Price: price(600), ValidFrom: &june, ValidTo: &july},
+		{MinQuantity: 10, Price: price(630), ValidFrom: &july},
+		{MinQuantity: 50, Price: price(590), ValidTo: &june},
+	}
+	if err := checkTiers(tiers); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		list   PriceList
+		tiers  []ListPrice
+		qty    float64
+		at     time.Time
+		source string
+		unit   int64
+	}{
+		{"no tiers", PriceList{Code: "retail"}, nil, 1, now, priceSourceRetail, 700},
+		{"wholesale base", PriceList{Code: "trade", BasePrice: "wholesale"}, nil, 1, now, priceSourceWholesale, 620},
+		{"first tier", PriceList{Code: "trade"}, tiers, 3, now, priceSourceList, 680},
+		{"sale tier in its window", PriceList{Code: "trade"}, tiers, 12, now, priceSourceList, 600},
+		{"before the sale", PriceList{Code: "trade"}, tiers, 12, june.Add(-time.Hour), priceSourceList, 640},
+		{"after the sale", PriceList{Code: "trade"}, tiers, 12, july, priceSourceList, 630},
+		{"expired tier", PriceList{Code: "trade"}, tiers, 60, now, priceSourceList, 600},
+		{"expired tier before its end", PriceList{Code: "trade"}, tiers, 60, june.Add(-time.Hour), priceSourceList, 590},
+		{"below the first tier", PriceList{Code: "trade", BasePrice: "wholesale"}, tiers, 0.5, now, priceSourceWholesale, 620},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := resolvePrice(PriceQuery{VarianceID: v.ID, Quantity: tt.qty, At: tt.at}, v, tt.list, tt.tiers)
+			if res.Source != tt.source || res.UnitPrice.Amount.Cmp(newDecimal(tt.unit, 0)) != 0 {
+				t.Errorf("resolved %s at %s, want %s at %d", res.Source, res.UnitPrice, tt.source, tt.unit)
+			}
+			if (res.Tier != nil) != (tt.source == priceSourceList) {
+				t.Errorf("tier = %+v for source %s", res.Tier, res.Source)
+			}
+		})
+	}
+}
+
+func TestCheckTiers(t *testing.T) {
+	june, july := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		tiers []ListPrice
+		ok    bool
+	}{
+		{"distinct quantities", []ListPrice{{MinQuantity: 1}, {MinQuantity: 10}}, true},
+		{"same quantity, back to back", []ListPrice{{MinQuantity: 1, ValidTo: &june}, {MinQuantity: 1, ValidFrom: &june}}, true},
+		{"same quantity, always", []ListPrice{{MinQuantity: 1}, {MinQuantity: 1}}, false},
+		{"same quantity, overlapping", []ListPrice{{MinQuantity: 1, ValidTo: &july}, {MinQuantity: 1, ValidFrom: &june}}, false},
+		{"ends before it starts", []ListPrice{{MinQuantity: 1, ValidFrom: &july, ValidTo: &june}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkTiers(tt.tiers); (err == nil) != tt.ok {
+				t.Errorf("checkTiers = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestPriceListAPI(t *testing.T) {
+	r := newTestAPI(t)
+	steps := []struct {
+		method, path, body string
+		status             int
+	}{
+		{http.MethodPost, "/price-lists", `{"code":"trade","name":"Trade","base_price":"wholesale"}`, http.StatusOK},
+		{http.MethodPut, "/price-lists/trade/prices/1", `{"tiers":[{"min_quantity":1,"price":1700},{"min_quantity":1,"price":1650}]}`, http.StatusUnprocessableEntity},
+		{http.MethodPut, "/price-lists/trade/prices/1", `{"tiers":[{"min_quantity":10,"price":1550},{"min_quantity":20,"price":1500}]}`, http.StatusOK},
+		{http.MethodPut, "/price-lists/none/prices/1", `{"tiers":[]}`, http.StatusNotFound},
+		{http.MethodPut, "/customers/Nimal/price-list", `{"price_list":"trade"}`, http.StatusOK},
+		{http.MethodPut, "/customers/Kamal/price-list", `{"price_list":"none"}`, http.StatusUnprocessableEntity},
+	}
+	for _, step := range steps {
+		if w, _ := serveJSON(t, r, step.method, step.path, step.body); w.Code != step.status {
+			t.Fatalf("%s %s = %d %s, want %d", step.method, step.path, w.Code, w.Body.String(), step.status)
+		}
+	}
+
+	resolve := func(query string) PriceResolution {
+		t.Helper()
+		w, env := serveJSON(t, r, http.MethodGet, "/prices/resolve?variance_id=1&"+query, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("resolve %s = %d %s", query, w.Code, w.Body.String())
+		}
+		var res PriceResolution
+		decodeData(t, env, &res)
+		return res
+	}
+	tests := []struct {
+		query string
+		list  string
+		unit  int64
+	}{
+		{"quantity=2", defaultPriceListCode, 1800},
+		{"customer=Nimal&quantity=2", "trade", 1600},
+		{"customer=Nimal&quantity=12", "trade", 1550},
+		{"customer=Nimal&quantity=25", "trade", 1500},
+		{"customer=Nimal&quantity=25&price_list=retail", defaultPriceListCode, 1800},
+	}
+	for _, tt := range tests {
+		if res := resolve(tt.query); res.PriceList != tt.list || res.UnitPrice.Amount.Cmp(newDecimal(tt.unit, 0)) != 0 {
+			t.Errorf("resolve %s = %s at %s, want %s at %d", tt.query, res.PriceList, res.UnitPrice, tt.list, tt.unit)
+		}
+	}
+
+	// Orders are priced from the customer's list
+	w, env := serveJSON(t, r, http.MethodPost, "/orders", `{"customer":"Nimal","lines":[{"variance_id":1,"quantity":3}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /orders = %d %s", w.Code, w.Body.String())
+	}
+	var o Order
+	decodeData(t, env, &o)
+	if o.PriceList != "trade" || o.Total.Amount.Cmp(newDecimal(4800, 0)) != 0 {
+		t.Errorf("order from %s totalling %s, want trade totalling 4800", o.PriceList, o.Total)
+	}
+
+	if w, _ := serveJSON(t, r, http.MethodDelete, "/customers/Nimal/price-list", nil); w.Code != http.StatusOK {
+		t.Fatalf("DELETE price list = %d %s", w.Code, w.Body.String())
+	}
+	if res := resolve("customer=Nimal&quantity=25"); res.PriceList != defaultPriceListCode {
+		t.Errorf("unassigned customer resolved from %s, want %s", res.PriceList, defaultPriceListCode)
+	}
+}
+
+// A parameter or local named like an import hides the package for the rest
+// of the function, as pq once did in resolvePrice.
+func TestNoIdentifierShadowsAnImport(t *testing.T) {
+	const resolvePriceWithPq = `package main
+
+import "github.com/lib/pq"
+
+func resolvePrice(pq PriceQuery) { var _ *pq.Error }`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "resolve.go", resolvePriceWithPq, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := shadowedImports(fset, f); len(got) != 1 || !strings.Contains(got[0], "pq hides") {
+		t.Fatalf("the old resolvePrice gives %q, want pq reported", got)
+	}
+
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range files {
+		f, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, problem := range shadowedImports(fset, f) {
+			t.Error(problem)
+		}
+	}
+}
+
+// shadowedImports lists the receivers, parameters, results and locals in f
+// named like one of its imports.
+func shadowedImports(fset *token.FileSet, f *ast.File) []string {
+	imports := map[string]bool{}
+	for _, spec := range f.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := importName(path)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if name != "_" && name != "." {
+			imports[name] = true
+		}
+	}
+
+	var problems []string
+	check := func(id *ast.Ident) {
+		if id != nil && imports[id.Name] {
+			problems = append(problems, fmt.Sprintf("%s: %s hides the %s package", fset.Position(id.Pos()), id.Name, id.Name))
+		}
+	}
+	checkFields := func(fields *ast.FieldList) {
+		if fields == nil {
+			return
+		}
+		for _, field := range fields.List {
+			for _, id := range field.Names {
+				check(id)
+			}
+		}
+	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncType:
+			checkFields(n.Params)
+			checkFields(n.Results)
+		case *ast.FuncDecl:
+			checkFields(n.Recv)
+		case *ast.AssignStmt:
+			if n.Tok == token.DEFINE {
+				for _, lhs := range n.Lhs {
+					id, _ := lhs.(*ast.Ident)
+					check(id)
+				}
+			}
+		case *ast.RangeStmt:
+			if n.Tok == token.DEFINE {
+				key, _ := n.Key.(*ast.Ident)
+				value, _ := n.Value.(*ast.Ident)
+				check(key)
+				check(value)
+			}
+		case *ast.ValueSpec:
+			for _, id := range n.Names {
+				check(id)
+			}
+		}
+		return true
+	})
+	return problems
+}
+
+// importName is the package name an import path conventionally declares:
+// gopkg.in/yaml.v3 is yaml, github.com/pelletier/go-toml/v2 is toml.
+func importName(path string) string {
+	dir, base := filepath.Split(path)
+	if len(base) > 1 && base[0] == 'v' && strings.Trim(base[1:], "0123456789") == "" {
+		base = filepath.Base(dir)
+	}
+	base, _, _ = strings.Cut(base, ".")
+	return strings.TrimPrefix(base, "go-")
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//! ============================================================================ //
+//? ========================= 🧾 PURCHASE ORDERS 🧾 ============================ //
+//! ============================================================================ //
+
+// A purchase order asks a supplier (supplier_tb) for variances, delivered to
+// a location. Each line has an expected unit cost, the variance's
+// wholesale_price unless the buyer gives one. An order moves through
+//
+//	draft -> sent -> partially_received -> received
+//
+// and can be cancelled until it is fully received. Only drafts can be edited.
+// Receiving records a receipt movement per line (see inventory.go) at the
+// order's location, and when the cost on the delivery differs from the
+// variance's original_price, original_price is updated to it and the change
+// kept in the price history (see price_history.go).
+
+const (
+	poDraft             = "draft"
+	poSent              = "sent"
+	poPartiallyReceived = "partially_received"
+	poReceived          = "received"
+	poCancelled         = "cancelled"
+)
+
+var poStatuses = []string{poDraft, poSent, poPartiallyReceived, poReceived, poCancelled}
+
+// poTransitions are the statuses each status can move to.
+var poTransitions = map[string][]string{
+	poDraft:             {poSent, poCancelled},
+	poSent:              {poPartiallyReceived, poReceived, poCancelled},
+	poPartiallyReceived: {poPartiallyReceived, poReceived, poCancelled},
+}
+
+type PurchaseOrder struct {
+	ID           int    `json:"id"`
+	SupplierID   int    `json:"supplier_id" binding:"required"`
+	SupplierName string `json:"supplier_name"`
+	Status       string `json:"status"`
+	// LocationID is where the goods are delivered; 0 means the main building.
+	LocationID int                 `json:"location_id"`
+	Reference  string              `json:"reference" binding:"max=200"`
+	Notes      string              `json:"notes"`
+	Lines      []PurchaseOrderLine `json:"lines" binding:"required,min=1,unique=VarianceID,dive"`
+	// Total is the expected cost of every line.
+	Total     Money      `json:"total"`
+	Currency  string     `json:"currency"`
+	CreatedBy string     `json:"created_by"`
+	CreatedAt *time.Time `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+type PurchaseOrderLine struct {
+	ID         int     `json:"id"`
+	VarianceID int     `json:"variance_id" binding:"required"`
+	Quantity   float64 `json:"quantity" binding:"gt=0"`
+	// UnitCost is the expected cost of one unit; the variance's
+	// wholesale_price when not given.
+	UnitCost *Money  `json:"unit_cost" binding:"omitempty,gte=0"`
+	Received float64 `json:"quantity_received"`
+}
+
+// outstanding is how much of l is still to be delivered.
+func (l PurchaseOrderLine) outstanding() float64 {
+	return l.Quantity - l.Received
+}
+
+// totalCost sums the expected cost of po's lines, to the cent.
+func (po PurchaseOrder) totalCost() (Money, error) {
+	total := Money{Currency: po.Currency}
+	for _, l := range po.Lines {
+		if l.UnitCost != nil {
+			var err error
+			if total, err = total.Add(l.UnitCost.Times(l.Quantity)); err != nil {
+				return total, err
+			}
+		}
+	}
+	return total.Round(priceScale, RoundHalfUp), nil
+}
+
+// receivedStatus is po's status once its lines have the quantities received.
+func (po PurchaseOrder) receivedStatus() string {
+	for _, l := range po.Lines {
+		if l.outstanding() > 0 {
+			return poPartiallyReceived
+		}
+	}
+	return poReceived
+}
+
+// PurchaseOrderFilter narrows /purchase-orders; zero fields match everything.
+type PurchaseOrderFilter struct {
+	SupplierID int
+	Status     string
+}
+
+var purchaseOrderSortFields = sortFields{
+	"id":         "po.id",
+	"status":     "po.status",
+	"created_at": "po.created_at",
+	"updated_at": "po.updated_at",
+}
+
+func purchaseOrderSortKey(po PurchaseOrder, field string) any {
+	switch field {
+	case "status":
+		return po.Status
+	case "created_at":
+		return timeValue(po.CreatedAt)
+	case "updated_at":
+		return timeValue(po.UpdatedAt)
+	}
+	return po.ID
+}
+
+// POReceipt is a delivery against a purchase order.
+type POReceipt struct {
+	Lines []POReceiptLine `json:"lines" binding:"required,min=1,unique=VarianceID,dive"`
+	// Reference is recorded on the receipt movements, e.g. the delivery note
+	// number; "PO-<id>" when not given.
+	Reference string     `json:"reference" binding:"max=200"`
+	CreatedBy string     `json:"-"`
+	CreatedAt *time.Time `json:"-"`
+}
+
+type POReceiptLine struct {
+	VarianceID int     `json:"variance_id" binding:"required"`
+	Quantity   float64 `json:"quantity" binding:"gt=0"`
+	// UnitCost is what the delivery cost per unit; the line's expected cost
+	// when not given.
+	UnitCost *Money `json:"unit_cost" binding:"omitempty,gte=0"`
+}
+
+// PriceChange records a variance price a store changed as a side effect.
+type PriceChange struct {
+	VarianceID int    `json:"variance_id"`
+	Field      string `json:"field"`
+	From       Money  `json:"from"`
+	To         Money  `json:"to"`
+}
+
+// POReceiptResult is what receiving recorded.
+type POReceiptResult struct {
+	Order        PurchaseOrder   `json:"order"`
+	Movements    []StockMovement `json:"movements"`
+	PriceChanges []PriceChange   `json:"price_changes"`
+}
+
+// reference is what a delivery is recorded under: its own reference, or the
+// order's number when it has none.
+func (r POReceipt) reference(po PurchaseOrder) string {
+	if r.Reference != "" {
+		return r.Reference
+	}
+	return fmt.Sprintf("PO-%d", po.ID)
+}
+
+// receiptMovement is the receipt recording line of a delivery.
+func (r POReceipt) receiptMovement(po PurchaseOrder, line POReceiptLine) StockMovement {
+	return StockMovement{VarianceID: line.VarianceID, Kind: movementReceipt, LocationID: po.LocationID,
+		Quantity: line.Quantity, Reason: movementReasons[movementReceipt][0], Reference: r.reference(po),
+		CreatedBy: r.CreatedBy, CreatedAt: r.CreatedAt}
+}
+
+// priceHistory records a change of original_price a delivery made.
+func (r POReceipt) priceHistory(po PurchaseOrder, change PriceChange) PriceHistory {
+	return PriceHistory{PriceChange: change, Source: priceSourcePurchaseOrder, Reference: r.reference(po),
+		ChangedBy: r.CreatedBy, ChangedAt: r.CreatedAt}
+}
+
+// CodeInvalidTransition is returned when a document cannot move to the
+// status asked for from the one it is in.
+const CodeInvalidTransition = "INVALID_TRANSITION"
+
+func errTransition(kind string, id int, from, to string) *APIError {
+	return &APIError{Status: http.StatusConflict, Code: CodeInvalidTransition,
+		Message: fmt.Sprintf("%s %d is %s and cannot become %s", kind, id, from, to),
+		Details: gin.H{"id": id, "status": from, "to": to}}
+}
+
+// checkTransition fails unless po may move to status.
+func checkTransition(po PurchaseOrder, status string) error {
+	if !contains(poTransitions[po.Status], status) {
+		return errTransition("Purchase order", po.ID, po.Status, status)
+	}
+	return nil
+}
+
+// errNotDraft is returned for edits to an order that has been sent.
+func errNotDraft(po PurchaseOrder) *APIError {
+	return &APIError{Status: http.StatusConflict, Code: CodeInvalidTransition,
+		Message: fmt.Sprintf("Purchase order %d is %s; only drafts can be edited", po.ID, po.Status),
+		Details: gin.H{"id": po.ID, "status": po.Status}}
+}
+
+// CodeOverReceipt is returned when a delivery is for more than is still
+// outstanding on a line, or for a variance the order does not have.
+const CodeOverReceipt = "OVER_RECEIPT"
+
+func errOverReceipt(po PurchaseOrder, line POReceiptLine, outstanding float64) *APIError {
+	return &APIError{Status: http.StatusConflict, Code: CodeOverReceipt,
+		Message: fmt.Sprintf("Purchase order %d has %g of variance %d outstanding, %g cannot be received",
+			po.ID, outstanding, line.VarianceID, line.Quantity),
+		Details: gin.H{"variance_id": line.VarianceID, "outstanding": outstanding, "quantity": line.Quantity}}
+}
+
+// receiptLine finds the order line a delivery line is for and checks it is
+// still outstanding.
+func receiptLine(po PurchaseOrder, line POReceiptLine) (*PurchaseOrderLine, error) {
+	for i := range po.Lines {
+		if l := &po.Lines[i]; l.VarianceID == line.VarianceID {
+			if line.Quantity > l.outstanding() {
+				return nil, errOverReceipt(po, line, l.outstanding())
+			}
+			return l, nil
+		}
+	}
+	return nil, errOverReceipt(po, line, 0)
+}
+
+// errUnknownSupplier is returned for an order naming a supplier that does
+// not exist.
+func errUnknownSupplier(id int) *APIError {
+	return &APIError{Status: http.StatusUnprocessableEntity, Code: CodeForeignKey,
+		Message: fmt.Sprintf("Supplier %d does not exist", id), Details: gin.H{"supplier_id": id}}
+}
+
+// errUnknownVariance is returned for a line naming a variance that does not
+// exist.
+func errUnknownVariance(id int) *APIError {
+	return &APIError{Status: http.StatusUnprocessableEntity, Code: CodeForeignKey,
+		Message: fmt.Sprintf("Variance %d does not exist", id), Details: gin.H{"variance_id": id}}
+}
+
+//? ---------------------------- http handlers ------------------------------ //
+
+// purchaseOrderID reads the :id path parameter.
+func purchaseOrderID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, errBadRequest("Purchase order id must be a number"))
+		return 0, false
+	}
+	return id, true
+}
+
+// bindPurchaseOrder reads a draft from the request body.
+func bindPurchaseOrder(c *gin.Context) (PurchaseOrder, bool) {
+	var po PurchaseOrder
+	if err := c.ShouldBindJSON(&po); err != nil {
+		respondError(c, errBinding(err))
+		return po, false
+	}
+	now := time.Now()
+	po.Status, po.CreatedBy, po.CreatedAt, po.UpdatedAt = poDraft, actor(c), &now, &now
+	for i := range po.Lines {
+		po.Lines[i].ID, po.Lines[i].Received = 0, 0
+	}
+	return po, true
+}
+
+func (s *server) createPurchaseOrder(c *gin.Context) {
+	po, ok := bindPurchaseOrder(c)
+	if !ok {
+		return
+	}
+
+	result, err := s.store.PurchaseOrders.CreatePurchaseOrder(c.Request.Context(), po)
+	if err != nil {
+		respondError(c, storeError(err, "Failed to create purchase order"))
+		return
+	}
+	respondOK(c, result)
+}
+
+func (s *server) updatePurchaseOrder(c *gin.Context) {
+	id, ok := purchaseOrderID(c)
+	if !ok {
+		return
+	}
+	po, ok := bindPurchaseOrder(c)
+	if !ok {
+		return
+	}
+	po.ID = id
+
+	result, err := s.store.PurchaseOrders.UpdatePurchaseOrder(c.Request.Context(), po)
+	if errors.Is(err, errNotFound) {
+		respondError(c, errNotFoundf("Purchase order %d does not exist", id))
+		return
+	}
+	if err != nil {
+		respondError(c, storeError(err, "Failed to update purchase order"))
+		return
+	}
+	respondOK(c, result)
+}
+
+func (s *server) getPurchaseOrder(c *gin.Context) {
+	id, ok := purchaseOrderID(c)
+	if !ok {
+		return
+	}
+
+	po, err := s.store.PurchaseOrders.GetPurchaseOrder(c.Request.Context(), id)
+	if errors.Is(err, errNotFound) {
+		respondError(c, errNotFoundf("Purchase order %d does not exist", id))
+		return
+	}
+	if err != nil {
+		respondError(c, storeError(err, "Failed to fetch purchase order"))
+		return
+	}
+	respondOK(c, po)
+}
+
+func (s *server) listPurchaseOrders(c *gin.Context) {
+	opts, err := listParams(c, purchaseOrderSortFields)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	f := PurchaseOrderFilter{Status: c.Query("status")}
+	if f.Status != "" && !contains(poStatuses, f.Status) {
+		respondError(c, errBadRequest("status must be one of: "+strings.Join(poStatuses, ", ")))
+		return
+	}
+	if raw := c.Query("supplier_id"); raw != "" {
+		if f.SupplierID, err = strconv.Atoi(raw); err != nil {
+			respondError(c, errBadRequest("supplier_id must be a number"))
+			return
+		}
+	}
+
+	page, err := s.store.PurchaseOrders.ListPurchaseOrders(c.Request.Context(), f, opts)
+	if err != nil {
+		respondError(c, storeError(err, "Failed to fetch purchase orders"))
+		return
+	}
+	respondPage(c, page)
+}
+
+// setPurchaseOrderStatus handles the status-only transitions, send and
+// cancel.
+func (s *server) setPurchaseOrderStatus(status string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := purchaseOrderID(c)
+		if !ok {
+			return
+		}
+
+		po, err := s.store.PurchaseOrders.SetPurchaseOrderStatus(c.Request.Context(), id, status, time.Now())
+		if errors.Is(err, errNotFound) {
+			respondError(c, errNotFoundf("Purchase order %d does not exist", id))
+			return
+		}
+		if err != nil {
+			respondError(c, storeError(err, "Failed to update purchase order"))
+			return
+		}
+		respondOK(c, po)
+	}
+}
+
+func (s *server) receivePurchaseOrder(c *gin.Context) {
+	id, ok := purchaseOrderID(c)
+	if !ok {
+		return
+	}
+	var receipt POReceipt
+	if err := c.ShouldBindJSON(&receipt); err != nil {
+		respondError(c, errBinding(err))
+		return
+	}
+	now := time.Now()
+	receipt.CreatedBy, receipt.CreatedAt = actor(c), &now
+
+	result, err := s.store.PurchaseOrders.ReceivePurchaseOrder(c.Request.Context(), id, receipt)
+	if errors.Is(err, errNotFound) {
+		respondError(c, errNotFoundf("Purchase order %d does not exist", id))
+		return
+	}
+	if err != nil {
+		respondError(c, storeError(err, "Failed to receive purchase order"))
+		return
+	}
+	for _, m := range result.Movements {
+		s.alerts.stockChanged(c.Request.Context(), m.VarianceID, m.LocationID)
+	}
+	respondOK(c, result)
+}
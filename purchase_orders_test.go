@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testPurchaseOrder creates a draft for quantity of each variance from a new
+// supplier.
+func testPurchaseOrder(t *testing.T, stores Stores, quantity float64, variances ...Variance) PurchaseOrder {
+	t.Helper()
+	ctx := context.Background()
+	s, err := stores.Suppliers.UpsertSupplier(ctx, Supplier{Name: fmt.Sprintf("Supplier %d", time.Now().UnixNano())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	supplierID, _ := strconv.Atoi(s.ID)
+
+	now := time.Now()
+	po := PurchaseOrder{SupplierID: supplierID, Status: poDraft, CreatedBy: "test", CreatedAt: &now, UpdatedAt: &now}
+	for _, v := range variances {
+		po.Lines = append(po.Lines, PurchaseOrderLine{VarianceID: v.ID, Quantity: quantity})
+	}
+	po, err = stores.PurchaseOrders.CreatePurchaseOrder(ctx, po)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return po
+}
+
+func testReceipt(lines ...POReceiptLine) POReceipt {
+	now := time.Now()
+	return POReceipt{Lines: lines, CreatedBy: "test", CreatedAt: &now}
+}
+
+func TestPurchaseOrderTransitions(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []string
+		want  []string // status after each step; "" when the step is refused
+	}{
+		{"send", []string{poSent}, []string{poSent}},
+		{"cancel a draft", []string{poCancelled}, []string{poCancelled}},
+		{"cancel once sent", []string{poSent, poCancelled}, []string{poSent, poCancelled}},
+		{"send twice", []string{poSent, poSent}, []string{poSent, ""}},
+		{"received straight from draft", []string{poReceived}, []string{""}},
+		{"send a cancelled order", []string{poCancelled, poSent}, []string{poCancelled, ""}},
+		{"back to draft", []string{poSent, poDraft}, []string{poSent, ""}},
+	}
+	for name, stores := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			v := testVarianceWithStock(t, stores, 0)
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					po := testPurchaseOrder(t, stores, 5, v)
+					if po.Status != poDraft {
+						t.Fatalf("created as %s, want %s", po.Status, poDraft)
+					}
+					for i, status := range tt.steps {
+						got, err := stores.PurchaseOrders.SetPurchaseOrderStatus(context.Background(), po.ID, status, time.Now())
+						if tt.want[i] == "" {
+							if errCode(err) != CodeInvalidTransition {
+								t.Fatalf("step %d to %s: err = %v, want %s", i, status, err, CodeInvalidTransition)
+							}
+							continue
+						}
+						if err != nil {
+							t.Fatalf("step %d to %s: %v", i, status, err)
+						}
+						if got.Status != tt.want[i] {
+							t.Fatalf("step %d: status = %s, want %s", i, got.Status, tt.want[i])
+						}
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestPurchaseOrderEditsOnlyDrafts(t *testing.T) {
+	for name, stores := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			v := testVarianceWithStock(t, stores, 0)
+			po := testPurchaseOrder(t, stores, 5, v)
+
+			po.Lines = []PurchaseOrderLine{{VarianceID: v.ID, Quantity: 8, UnitCost: &Money{Amount: newDecimal(250, 0)}}}
+			po, err := stores.PurchaseOrders.UpdatePurchaseOrder(ctx, po)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(po.Lines) != 1 || po.Lines[0].Quantity != 8 || po.Total.Amount.Cmp(newDecimal(2000, 0)) != 0 {
+				t.Fatalf("updated draft = %+v, want 8 at 250 totalling 2000", po)
+			}
+
+			if _, err := stores.PurchaseOrders.SetPurchaseOrderStatus(ctx, po.ID, poSent, time.Now()); err != nil {
+				t.Fatal(err)
+			}
+			po.Lines[0].Quantity = 10
+			if _, err := stores.PurchaseOrders.UpdatePurchaseOrder(ctx, po); errCode(err) != CodeInvalidTransition {
+				t.Errorf("editing a sent order: err = %v, want %s", err, CodeInvalidTransition)
+			}
+		})
+	}
+}
+
+func TestPurchaseOrderReceiving(t *testing.T) {
+	for name, stores := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			v := testVarianceWithStock(t, stores, 2)
+			po := testPurchaseOrder(t, stores, 10, v)
+
+			if _, err := stores.PurchaseOrders.ReceivePurchaseOrder(ctx, po.ID, testReceipt(POReceiptLine{VarianceID: v.ID, Quantity: 4})); errCode(err) != CodeInvalidTransition {
+				t.Errorf("receiving a draft: err = %v, want %s", err, CodeInvalidTransition)
+			}
+			if _, err := stores.PurchaseOrders.SetPurchaseOrderStatus(ctx, po.ID, poSent, time.Now()); err != nil {
+				t.Fatal(err)
+			}
+
+			cost := Money{Amount: newDecimal(640, 0)}
+			result, err := stores.PurchaseOrders.ReceivePurchaseOrder(ctx, po.ID, testReceipt(POReceiptLine{VarianceID: v.ID, Quantity: 4, UnitCost: &cost}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Order.Status != poPartiallyReceived || result.Order.Lines[0].Received != 4 {
+				t.Errorf("after 4 of 10: status %s, received %g", result.Order.Status, result.Order.Lines[0].Received)
+			}
+			if len(result.Movements) != 1 {
+				t.Fatalf("got %d movements, want 1", len(result.Movements))
+			}
+			if mv := result.Movements[0]; mv.Kind != movementReceipt || mv.Quantity != 4 || mv.BalanceAfter != 6 || mv.Reference != fmt.Sprintf("PO-%d", po.ID) {
+				t.Errorf("movement = %+v", mv)
+			}
+			if len(result.PriceChanges) != 1 || result.PriceChanges[0].Field != "original_price" || result.PriceChanges[0].To.Amount.Cmp(cost.Amount) != 0 {
+				t.Errorf("price changes = %+v, want original_price to %s", result.PriceChanges, cost.Amount)
+			}
+
+			// More than the 6 outstanding is refused and records nothing
+			if _, err := stores.PurchaseOrders.ReceivePurchaseOrder(ctx, po.ID, testReceipt(POReceiptLine{VarianceID: v.ID, Quantity: 7})); errCode(err) != CodeOverReceipt {
+				t.Errorf("over receipt: err = %v, want %s", err, CodeOverReceipt)
+			}
+			other := testVarianceWithStock(t, stores, 0)
+			if _, err := stores.PurchaseOrders.ReceivePurchaseOrder(ctx, po.ID, testReceipt(POReceiptLine{VarianceID: other.ID, Quantity: 1})); errCode(err) != CodeOverReceipt {
+				t.Errorf("receiving a variance not ordered: err = %v, want %s", err, CodeOverReceipt)
+			}
+			if onHand, _ := onHandAt(t, stores, v.ID); onHand != 6 {
+				t.Errorf("on hand = %g after refused receipts, want 6", onHand)
+			}
+
+			result, err = stores.PurchaseOrders.ReceivePurchaseOrder(ctx, po.ID, testReceipt(POReceiptLine{VarianceID: v.ID, Quantity: 6, UnitCost: &cost}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Order.Status != poReceived || len(result.PriceChanges) != 0 {
+				t.Errorf("after the rest: status %s, price changes %+v", result.Order.Status, result.PriceChanges)
+			}
+			if _, err := stores.PurchaseOrders.SetPurchaseOrderStatus(ctx, po.ID, poCancelled, time.Now()); errCode(err) != CodeInvalidTransition {
+				t.Errorf("cancelling a received order: err = %v, want %s", err, CodeInvalidTransition)
+			}
+		})
+	}
+}
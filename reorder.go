@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//! ============================================================================ //
+//? ========================= 📉 REORDER ALERTS 📉 ============================= //
+//! ============================================================================ //
+
+// A reorder rule watches a variance's on-hand stock at one location, or in
+// total when it names no location. Stock below reorder_point is low:
+// /inventory/low-stock lists it, with the reorder_quantity to order.
+//
+// Whenever stock changes (movements, transfers, confirmed reservations and
+// stock counts from /variance/upsert or an import) the rules watching it are
+// checked. A rule that goes low raises one StockAlert, sent through the
+// configured notifiers (see notify.go). It raises no more until stock is back
+// at or above the point, and then not again within ALERT_COOLDOWN, so stock
+// hovering around the point does not flood anyone.
+
+type ReorderRule struct {
+	ID         int `json:"id"`
+	VarianceID int `json:"variance_id" binding:"required"`
+	// LocationID is the location watched; 0 watches the variance's total.
+	LocationID      int     `json:"location_id"`
+	ReorderPoint    float64 `json:"reorder_point" binding:"gte=0"`
+	ReorderQuantity float64 `json:"reorder_quantity" binding:"gte=0"`
+	// Low is whether stock was below the point when last checked.
+	Low       bool       `json:"low"`
+	AlertedAt *time.Time `json:"alerted_at"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// LowStockItem is a /inventory/low-stock row: a low rule and the stock it
+// watches.
+type LowStockItem struct {
+	ReorderRule
+	ProductID string `json:"product_id"`
+	// LocationCode is empty for rules watching the total.
+	LocationCode string  `json:"location_code"`
+	OnHand       float64 `json:"on_hand"`
+	// Shortfall is how far on-hand is below the reorder point.
+	Shortfall float64 `json:"shortfall"`
+}
+
+// LowStockFilter narrows /inventory/low-stock; zero fields match everything.
+type LowStockFilter struct {
+	ProductID  string
+	LocationID int
+}
+
+// StockAlert is what notifiers deliver when a rule goes low.
+type StockAlert struct {
+	Event           string    `json:"event"`
+	VarianceID      int       `json:"variance_id"`
+	ProductID       string    `json:"product_id"`
+	LocationID      int       `json:"location_id"`
+	LocationCode    string    `json:"location_code"`
+	OnHand          float64   `json:"on_hand"`
+	ReorderPoint    float64   `json:"reorder_point"`
+	ReorderQuantity float64   `json:"reorder_quantity"`
+	RaisedAt        time.Time `json:"raised_at"`
+}
+
+const eventStockLow = "stock.low"
+
+// observe records on-hand stock against r at now. changed is whether r needs
+// saving; alert is whether r just went low and is out of its cooldown.
+func (r *ReorderRule) observe(onHand float64, now time.Time, cooldown time.Duration) (changed, alert bool) {
+	low := onHand < r.ReorderPoint
+	if low == r.Low {
+		return false, false
+	}
+	r.Low = low
+	if !low || (r.AlertedAt != nil && now.Sub(*r.AlertedAt) < cooldown) {
+		return true, false
+	}
+	r.AlertedAt = &now
+	return true, true
+}
+
+// lowStockItem describes r as a low-stock row.
+func lowStockItem(r ReorderRule, productID, locationCode string, onHand float64) LowStockItem {
+	return LowStockItem{ReorderRule: r, ProductID: productID, LocationCode: locationCode,
+		OnHand: onHand, Shortfall: r.ReorderPoint - onHand}
+}
+
+// alert is the StockAlert for item at now.
+func (item LowStockItem) alert(now time.Time) StockAlert {
+	return StockAlert{Event: eventStockLow, VarianceID: item.VarianceID, ProductID: item.ProductID,
+		LocationID: item.LocationID, LocationCode: item.LocationCode, OnHand: item.OnHand,
+		ReorderPoint: item.ReorderPoint, ReorderQuantity: item.ReorderQuantity, RaisedAt: now}
+}
+
+//? ------------------------------- alerter --------------------------------- //
+
+// alerter checks reorder rules after stock changes and delivers the alerts.
+type alerter struct {
+	rules    ReorderStore
+	notifier Notifier
+	cooldown time.Duration
+	pending  sync.WaitGroup
+}
+
+func newAlerter(cfg *Config, stores Stores) *alerter {
+	return &alerter{rules: stores.Reorder, notifier: newNotifier(cfg.Alerts), cooldown: cfg.Alerts.Cooldown.Std()}
+}
+
+// alertTimeout bounds one delivery to every notifier.
+const alertTimeout = 10 * time.Second
+
+// stockChanged checks the rules watching a variance at locationIDs, and its
+// total, and sends any alerts in the background. Failures are logged rather
+// than returned: the stock change they follow has already been recorded. A
+// nil alerter does nothing.
+func (a *alerter) stockChanged(ctx context.Context, varianceID int, locationIDs ...int) {
+	if a == nil {
+		return
+	}
+	if len(locationIDs) == 0 {
+		locationIDs = []int{0}
+	}
+	for _, locationID := range locationIDs {
+		alerts, err := a.rules.CheckReorderRules(ctx, varianceID, locationID, time.Now(), a.cooldown)
+		if err != nil {
+			log.Printf("🔴 checking reorder rules of variance %d: %v", varianceID, err)
+			continue
+		}
+		for _, alert := range alerts {
+			a.pending.Add(1)
+			go func() {
+				defer a.pending.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), alertTimeout)
+				defer cancel()
+				if err := a.notifier.Notify(ctx, alert); err != nil {
+					log.Printf("🔴 sending low stock alert for variance %d: %v", alert.VarianceID, err)
+				}
+			}()
+		}
+	}
+}
+
+// wait blocks until the alerts sent so far are delivered.
+func (a *alerter) wait() {
+	if a != nil {
+		a.pending.Wait()
+	}
+}
+
+//? ---------------------------- http handlers ------------------------------ //
+
+func (s *server) upsertReorderRule(c *gin.Context) {
+	var r ReorderRule
+	if err := c.ShouldBindJSON(&r); err != nil {
+		respondError(c, errBinding(err))
+		return
+	}
+	now := time.Now()
+	r.ID, r.UpdatedAt = 0, &now
+
+	result, err := s.store.Reorder.UpsertReorderRule(c.Request.Context(), r)
+	if errors.Is(err, errNotFound) {
+		respondError(c, errNotFoundf("Variance %d does not exist", r.VarianceID))
+		return
+	}
+	if err != nil {
+		respondError(c, storeError(err, "Failed to save reorder rule"))
+		return
+	}
+	// A new point can put stock below it as surely as a movement can
+	s.alerts.stockChanged(c.Request.Context(), result.VarianceID, result.LocationID)
+	respondOK(c, result)
+}
+
+func (s *server) getReorderRules(c *gin.Context) {
+	varianceID := 0
+	if raw := c.Query("variance_id"); raw != "" {
+		var err error
+		if varianceID, err = strconv.Atoi(raw); err != nil {
+			respondError(c, errBadRequest("variance_id must be a number"))
+			return
+		}
+	}
+
+	rules, err := s.store.Reorder.ListReorderRules(c.Request.Context(), varianceID)
+	if err != nil {
+		respondError(c, storeError(err, "Failed to fetch reorder rules"))
+		return
+	}
+	respondAll(c, rules)
+}
+
+func (s *server) getLowStock(c *gin.Context) {
+	f := LowStockFilter{ProductID: c.Query("product_id")}
+	if raw := c.Query("location_id"); raw != "" {
+		var err error
+		if f.LocationID, err = strconv.Atoi(raw); err != nil {
+			respondError(c, errBadRequest("location_id must be a number"))
+			return
+		}
+	}
+
+	items, err := s.store.Reorder.LowStock(c.Request.Context(), f)
+	if err != nil {
+		respondError(c, storeError(err, "Failed to fetch low stock"))
+		return
+	}
+	respondAll(c, items)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReorderRuleObserve(t *testing.T) {
+	now := time.Now()
+	recent, long := now.Add(-time.Minute), now.Add(-2*time.Hour)
+
+	tests := []struct {
+		name        string
+		low         bool
+		alertedAt   *time.Time
+		onHand      float64
+		wantChanged bool
+		wantAlert   bool
+	}{
+		{"stays above", false, nil, 10, false, false},
+		{"at the point is not low", false, nil, 5, false, false},
+		{"goes low", false, nil, 4, true, true},
+		{"stays low", true, &recent, 2, false, false},
+		{"recovers", true, &recent, 5, true, false},
+		{"goes low within cooldown", false, &recent, 4, true, false},
+		{"goes low after cooldown", false, &long, 4, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := ReorderRule{ReorderPoint: 5, Low: tt.low, AlertedAt: tt.alertedAt}
+			changed, alert := r.observe(tt.onHand, now, time.Hour)
+			if changed != tt.wantChanged || alert != tt.wantAlert {
+				t.Errorf("observe(%g) = %v, %v, want %v, %v", tt.onHand, changed, alert, tt.wantChanged, tt.wantAlert)
+			}
+			if r.Low != (tt.onHand < 5) {
+				t.Errorf("Low = %v after observing %g", r.Low, tt.onHand)
+			}
+			if tt.wantAlert && (r.AlertedAt == nil || !r.AlertedAt.Equal(now)) {
+				t.Errorf("AlertedAt = %v, want %v", r.AlertedAt, now)
+			}
+		})
+	}
+}
+
+func TestReorderAlertsOncePerDip(t *testing.T) {
+	for name, stores := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			v := testVarianceWithStock(t, stores, 10)
+			if _, err := stores.Reorder.UpsertReorderRule(ctx, ReorderRule{VarianceID: v.ID, ReorderPoint: 5, ReorderQuantity: 20}); err != nil {
+				t.Fatal(err)
+			}
+			move := func(kind string, qty float64) {
+				t.Helper()
+				m := testSale()
+				m.VarianceID, m.Kind, m.Quantity, m.Reason = v.ID, kind, qty, movementReasons[kind][0]
+				if _, err := stores.Inventory.RecordMovement(ctx, m); err != nil {
+					t.Fatal(err)
+				}
+			}
+			check := func(cooldown time.Duration) []StockAlert {
+				t.Helper()
+				alerts, err := stores.Reorder.CheckReorderRules(ctx, v.ID, 0, time.Now(), cooldown)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return alerts
+			}
+
+			move(movementSale, -6)
+			alerts := check(time.Hour)
+			if len(alerts) != 1 {
+				t.Fatalf("got %d alerts after going low, want 1", len(alerts))
+			}
+			if a := alerts[0]; a.Event != eventStockLow || a.OnHand != 4 || a.ReorderQuantity != 20 || a.ProductID != v.ProductID {
+				t.Errorf("alert = %+v", a)
+			}
+			if alerts := check(time.Hour); len(alerts) != 0 {
+				t.Errorf("got %d alerts while staying low, want 0", len(alerts))
+			}
+
+			items, err := stores.Reorder.LowStock(ctx, LowStockFilter{ProductID: v.ProductID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != 1 || items[0].OnHand != 4 || items[0].Shortfall != 1 || !items[0].Low {
+				t.Fatalf("low stock = %+v, want one item 1 short", items)
+			}
+
+			// Recovering and dipping again inside the cooldown stays quiet
+			move(movementReceipt, 6)
+			if alerts := check(time.Hour); len(alerts) != 0 {
+				t.Errorf("got %d alerts on recovering, want 0", len(alerts))
+			}
+			if items, _ := stores.Reorder.LowStock(ctx, LowStockFilter{ProductID: v.ProductID}); len(items) != 0 {
+				t.Errorf("low stock = %+v after recovering, want none", items)
+			}
+			move(movementSale, -6)
+			if alerts := check(time.Hour); len(alerts) != 0 {
+				t.Errorf("got %d alerts within the cooldown, want 0", len(alerts))
+			}
+
+			move(movementReceipt, 6)
+			check(0)
+			move(movementSale, -6)
+			if alerts := check(0); len(alerts) != 1 {
+				t.Errorf("got %d alerts after the cooldown, want 1", len(alerts))
+			}
+		})
+	}
+}
+
+func TestReorderRuleRejectsUnknownVariance(t *testing.T) {
+	for name, stores := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			_, err := stores.Reorder.UpsertReorderRule(context.Background(), ReorderRule{VarianceID: -1, ReorderPoint: 5})
+			if err == nil {
+				t.Fatal("saved a rule for a missing variance")
+			}
+		})
+	}
+}
+
+// recordingNotifier keeps the alerts it is sent.
+type recordingNotifier struct {
+	mu     sync.Mutex
+	alerts []StockAlert
+}
+
+func (r *recordingNotifier) Notify(ctx context.Context, alert StockAlert) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.alerts = append(r.alerts, alert)
+	return nil
+}
+
+func TestAlerterDeliversOnStockChange(t *testing.T) {
+	stores := newMemoryStore(defaultConfig().Pricing).stores()
+	ctx := context.Background()
+	v := testVarianceWithStock(t, stores, 3)
+	if _, err := stores.Reorder.UpsertReorderRule(ctx, ReorderRule{VarianceID: v.ID, ReorderPoint: 5, ReorderQuantity: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	notifier := &recordingNotifier{}
+	a := &alerter{rules: stores.Reorder, notifier: notifier, cooldown: time.Hour}
+	a.stockChanged(ctx, v.ID)
+	a.stockChanged(ctx, v.ID)
+	a.wait()
+
+	if len(notifier.alerts) != 1 || notifier.alerts[0].VarianceID != v.ID {
+		t.Errorf("delivered %+v, want one alert for variance %d", notifier.alerts, v.ID)
+	}
+
+	var none *alerter
+	none.stockChanged(ctx, v.ID)
+	none.wait()
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var got StockAlert
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Content-Type = %q", r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		if got.VarianceID == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	n := webhookNotifier{url: srv.URL, client: srv.Client()}
+	alert := StockAlert{Event: eventStockLow, VarianceID: 7, ProductID: "p7", OnHand: 2, ReorderPoint: 5}
+	if err := n.Notify(context.Background(), alert); err != nil {
+		t.Fatal(err)
+	}
+	if got.VarianceID != 7 || got.Event != eventStockLow || got.OnHand != 2 {
+		t.Errorf("webhook got %+v", got)
+	}
+	if err := n.Notify(context.Background(), StockAlert{}); err == nil {
+		t.Error("no error when the webhook answered 500")
+	}
+}
+
+func TestMailNotifier(t *testing.T) {
+	dir := t.TempDir()
+	n := mailNotifier{dir: dir, from: "inventory@localhost", to: "buyer@example.com"}
+	alert := StockAlert{VarianceID: 7, ProductID: "p7", LocationCode: "yard", OnHand: 2, ReorderPoint: 5, ReorderQuantity: 10, RaisedAt: time.Now()}
+	if err := n.Notify(context.Background(), alert); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("wrote %d messages, want 1", len(files))
+	}
+	msg, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"To: buyer@example.com", "Subject: Low stock: variance 7", "is low at yard", "Suggested order: 10"} {
+		if !strings.Contains(string(msg), want) {
+			t.Errorf("message lacks %q:\n%s", want, msg)
+		}
+	}
+}
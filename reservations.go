@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//! ============================================================================ //
+//? ========================== 🔖 RESERVATIONS 🔖 ============================== //
+//! ============================================================================ //
+
+// A reservation holds stock of a variance at a location for a checkout or a
+// quote without moving it. It lowers what is available to sell but not
+// on-hand:
+//
+//	available = on-hand - active, unexpired reservations
+//
+// Sales and transfers out can only take available stock, so nothing held for
+// one customer is sold to another. Adjustments are still only limited by
+// on-hand: a count records what is on the shelf whatever is reserved.
+//
+// A reservation is active until it is confirmed into a sale movement,
+// released, or it outlives its TTL. Expired reservations stop counting as
+// soon as expires_at passes; the sweeper (see startJobs) only updates their
+// status.
+
+const (
+	reservationActive    = "active"
+	reservationConfirmed = "confirmed"
+	reservationReleased  = "released"
+	reservationExpired   = "expired"
+)
+
+// maxReservationTTL caps both RESERVATION_TTL and a request's ttl_seconds.
+const maxReservationTTL = 24 * time.Hour
+
+type Reservation struct {
+	ID         int `json:"id"`
+	VarianceID int `json:"variance_id"`
+	// LocationID is where the stock is held; 0 means the main building.
+	LocationID int        `json:"location_id"`
+	Quantity   float64    `json:"quantity"`
+	Status     string     `json:"status"`
+	Reference  string     `json:"reference"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	// MovementID is the sale movement a confirmed reservation became.
+	MovementID *int       `json:"movement_id"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  *time.Time `json:"created_at"`
+	UpdatedAt  *time.Time `json:"updated_at"`
+}
+
+// ReservationRequest is the body of POST /inventory/reservations.
+type ReservationRequest struct {
+	VarianceID int     `json:"variance_id" binding:"required"`
+	LocationID int     `json:"location_id"`
+	Quantity   float64 `json:"quantity" binding:"gt=0"`
+	Reference  string  `json:"reference" binding:"max=200"`
+	// TTLSeconds is how long to hold the stock; RESERVATION_TTL when 0.
+	TTLSeconds int `json:"ttl_seconds" binding:"gte=0,lte=86400"`
+}
+
+// ReservationFilter narrows /inventory/reservations; zero fields match
+// everything.
+type ReservationFilter struct {
+	VarianceID int
+	LocationID int
+	Status     string
+	Reference  string
+}
+
+var reservationSortFields = sortFields{
+	"id":         "id",
+	"quantity":   "quantity",
+	"expires_at": "expires_at",
+	"created_at": "created_at",
+}
+
+func reservationSortKey(r Reservation, field string) any {
+	switch field {
+	case "quantity":
+		return r.Quantity
+	case "expires_at":
+		return timeValue(r.ExpiresAt)
+	case "created_at":
+		return timeValue(r.CreatedAt)
+	}
+	return r.ID
+}
+
+// holds reports whether r still counts against available stock at now.
+func (r Reservation) holds(now time.Time) bool {
+	return r.Status == reservationActive && r.ExpiresAt != nil && r.ExpiresAt.After(now)
+}
+
+// takesAvailable reports whether a movement may only take available stock
+// rather than anything on hand.
+func takesAvailable(m StockMovement) bool {
+	return m.Quantity < 0 && (m.Kind == movementSale || m.Kind == movementTransfer)
+}
+
+// CodeReservationClosed is returned when confirming or releasing a
+// reservation that is no longer active.
+const CodeReservationClosed = "RESERVATION_CLOSED"
+
+func errReservationClosed(r Reservation) *APIError {
+	return &APIError{Status: http.StatusConflict, Code: CodeReservationClosed,
+		Message: fmt.Sprintf("Reservation %d is %s", r.ID, r.Status),
+		Details: gin.H{"reservation_id": r.ID, "status": r.Status, "expires_at": r.ExpiresAt}}
+}
+
+// effectiveStatus is the status r reports at now: an active reservation past
+// its expiry is expired even before the sweeper marks it.
+func effectiveStatus(r Reservation, now time.Time) string {
+	if r.Status == reservationActive && !r.holds(now) {
+		return reservationExpired
+	}
+	return r.Status
+}
+
+// saleReference is the reference of the sale confirming r: its own, or the
+// reservation id when it has none.
+func saleReference(r Reservation) string {
+	if r.Reference != "" {
+		return r.Reference
+	}
+	return fmt.Sprintf("reservation %d", r.ID)
+}
+
+//? ---------------------------- http handlers ------------------------------ //
+
+func (s *server) reserveStock(c *gin.Context) {
+	var req ReservationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, errBinding(err))
+		return
+	}
+	ttl := s.cfg.Inventory.ReservationTTL.Std()
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+
+	now := time.Now()
+	expires := now.Add(ttl)
+	r := Reservation{VarianceID: req.VarianceID, LocationID: req.LocationID, Quantity: req.Quantity,
+		Status: reservationActive, Reference: req.Reference, ExpiresAt: &expires,
+		CreatedBy: actor(c), CreatedAt: &now, UpdatedAt: &now}
+
+	result, err := s.store.Reservations.Reserve(c.Request.Context(), r)
+	if errors.Is(err, errNotFound) {
+		respondError(c, errNotFoundf("Variance %d does not exist", r.VarianceID))
+		return
+	}
+	if err != nil {
+		respondError(c, storeError(err, "Failed to reserve stock"))
+		return
+	}
+	respondOK(c, result)
+}
+
+// reservationID reads the :id path parameter.
+func reservationID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, errBadRequest("Reservation id must be a number"))
+		return 0, false
+	}
+	return id, true
+}
+
+func (s *server) getReservation(c *gin.Context) {
+	id, ok := reservationID(c)
+	if !ok {
+		return
+	}
+
+	r, err := s.store.Reservations.GetReservation(c.Request.Context(), id)
+	if errors.Is(err, errNotFound) {
+		respondError(c, errNotFoundf("Reservation %d does not exist", id))
+		return
+	}
+	if err != nil {
+		respondError(c, storeError(err, "Failed to fetch reservation"))
+		return
+	}
+	respondOK(c, r)
+}
+
+func (s *server) listReservations(c *gin.Context) {
+	opts, err := listParams(c, reservationSortFields)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	f := ReservationFilter{Status: c.Query("status"), Reference: c.Query("reference")}
+	switch f.Status {
+	case "", reservationActive, reservationConfirmed, reservationReleased, reservationExpired:
+	default:
+		respondError(c, errBadRequest(fmt.Sprintf("status must be one of: %s, %s, %s, %s",
+			reservationActive, reservationConfirmed, reservationReleased, reservationExpired)))
+		return
+	}
+	for param, id := range map[string]*int{"variance_id": &f.VarianceID, "location_id": &f.LocationID} {
+		if raw := c.Query(param); raw != "" {
+			if *id, err = strconv.Atoi(raw); err != nil {
+				respondError(c, errBadRequest(param+" must be a number"))
+				return
+			}
+		}
+	}
+
+	page, err := s.store.Reservations.ListReservations(c.Request.Context(), f, opts)
+	if err != nil {
+		respondError(c, storeError(err, "Failed to fetch reservations"))
+		return
+	}
+	respondPage(c, page)
+}
+
+// ReservationSale is a confirmed reservation and the sale it recorded.
+type ReservationSale struct {
+	Reservation Reservation   `json:"reservation"`
+	Movement    StockMovement `json:"movement"`
+}
+
+func (s *server) confirmReservation(c *gin.Context) {
+	id, ok := reservationID(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	sale := StockMovement{Kind: movementSale, Reason: movementReasons[movementSale][0], CreatedBy: actor(c), CreatedAt: &now}
+	result, err := s.store.Reservations.ConfirmReservation(c.Request.Context(), id, sale)
+	if errors.Is(err, errNotFound) {
+		respondError(c, errNotFoundf("Reservation %d does not exist", id))
+		return
+	}
+	if err != nil {
+		respondError(c, storeError(err, "Failed to confirm reservation"))
+		return
+	}
+	s.alerts.stockChanged(c.Request.Context(), result.Movement.VarianceID, result.Movement.LocationID)
+	respondOK(c, result)
+}
+
+func (s *server) releaseReservation(c *gin.Context) {
+	id, ok := reservationID(c)
+	if !ok {
+		return
+	}
+
+	r, err := s.store.Reservations.ReleaseReservation(c.Request.Context(), id, time.Now())
+	if errors.Is(err, errNotFound) {
+		respondError(c, errNotFoundf("Reservation %d does not exist", id))
+		return
+	}
+	if err != nil {
+		respondError(c, storeError(err, "Failed to release reservation"))
+		return
+	}
+	respondOK(c, r)
+}
+
+//? ------------------------------- sweeper --------------------------------- //
+
+// sweepReservations marks reservations past their expiry as expired.
+func sweepReservations(store ReservationStore) func(context.Context) error {
+	return func(ctx context.Context) error {
+		n, err := store.ExpireReservations(ctx, time.Now())
+		if n > 0 {
+			log.Printf("🔖 expired %d stock reservation(s)", n)
+		}
+		return err
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testReservation is an active reservation of quantity expiring after ttl.
+func testReservation(varianceID int, quantity float64, ttl time.Duration) Reservation {
+	now := time.Now()
+	expires := now.Add(ttl)
+	return Reservation{VarianceID: varianceID, Quantity: quantity, Status: reservationActive,
+		ExpiresAt: &expires, CreatedBy: "test", CreatedAt: &now, UpdatedAt: &now}
+}
+
+func testSale() StockMovement {
+	now := time.Now()
+	return StockMovement{Kind: movementSale, Reason: movementReasons[movementSale][0], CreatedBy: "test", CreatedAt: &now}
+}
+
+// errCode is the code of err when it is an APIError.
+func errCode(err error) string {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return ""
+}
+
+// activeReserved sums the active reservations of a variance.
+func activeReserved(t *testing.T, stores Stores, varianceID int) float64 {
+	t.Helper()
+	page, err := stores.Reservations.ListReservations(context.Background(),
+		ReservationFilter{VarianceID: varianceID, Status: reservationActive}, ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0.0
+	for _, r := range page.Items {
+		total += r.Quantity
+	}
+	return total
+}
+
+func TestConcurrentReservationsNeverOversell(t *testing.T) {
+	for name, stores := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			const onHand, attempts = 10, 60
+			v := testVarianceWithStock(t, stores, onHand)
+
+			// Reservations of 1 to 3 and sales of 1 race for the same stock
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			reserved, sold := 0.0, 0.0
+			for i := range attempts {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if i%4 == 3 {
+						sale := testSale()
+						sale.VarianceID, sale.Quantity = v.ID, -1
+						_, err := stores.Inventory.RecordMovement(ctx, sale)
+						if err == nil {
+							mu.Lock()
+							sold++
+							mu.Unlock()
+						} else if errCode(err) != CodeInsufficientStock {
+							t.Errorf("sale: %v", err)
+						}
+						return
+					}
+
+					r, err := stores.Reservations.Reserve(ctx, testReservation(v.ID, float64(i%3+1), time.Hour))
+					if err == nil {
+						mu.Lock()
+						reserved += r.Quantity
+						mu.Unlock()
+					} else if errCode(err) != CodeInsufficientStock {
+						t.Errorf("reserve: %v", err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			level, err := stores.Inventory.StockLevel(ctx, v.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			held := activeReserved(t, stores, v.ID)
+			if held != reserved {
+				t.Errorf("active reservations hold %v, the successful calls reserved %v", held, reserved)
+			}
+			if held+sold > onHand {
+				t.Fatalf("oversold: %v reserved and %v sold of %v", held, sold, onHand)
+			}
+			if level.OnHand != onHand-sold || level.Reserved != held || level.Available != level.OnHand-held || level.Available < 0 {
+				t.Errorf("stock = %+v after %v reserved and %v sold of %v", level, held, sold, onHand)
+			}
+		})
+	}
+}
+
+func TestSweeperReleasesExpiredReservations(t *testing.T) {
+	for name, stores := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			v := testVarianceWithStock(t, stores, 5)
+
+			short, err := stores.Reservations.Reserve(ctx, testReservation(v.ID, 3, 50*time.Millisecond))
+			if err != nil {
+				t.Fatal(err)
+			}
+			long, err := stores.Reservations.Reserve(ctx, testReservation(v.ID, 2, time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := stores.Reservations.Reserve(ctx, testReservation(v.ID, 1, time.Hour)); errCode(err) != CodeInsufficientStock {
+				t.Fatalf("reserving past available: err = %v, want %s", err, CodeInsufficientStock)
+			}
+
+			time.Sleep(100 * time.Millisecond)
+			if err := sweepReservations(stores.Reservations)(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, want := range []struct {
+				r      Reservation
+				status string
+			}{{short, reservationExpired}, {long, reservationActive}} {
+				got, err := stores.Reservations.GetReservation(ctx, want.r.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.Status != want.status {
+					t.Errorf("reservation %d is %s, want %s", got.ID, got.Status, want.status)
+				}
+			}
+			level, err := stores.Inventory.StockLevel(ctx, v.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if level.Reserved != 2 || level.Available != 3 {
+				t.Errorf("stock = %+v, want 2 reserved and 3 available", level)
+			}
+			if _, err := stores.Reservations.ConfirmReservation(ctx, short.ID, testSale()); errCode(err) != CodeReservationClosed {
+				t.Errorf("confirming an expired reservation: err = %v, want %s", err, CodeReservationClosed)
+			}
+		})
+	}
+}
+
+func TestConfirmAndReleaseAreIdempotent(t *testing.T) {
+	for name, stores := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			v := testVarianceWithStock(t, stores, 10)
+
+			confirmed, err := stores.Reservations.Reserve(ctx, testReservation(v.ID, 4, time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			first, err := stores.Reservations.ConfirmReservation(ctx, confirmed.ID, testSale())
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, err := stores.Reservations.ConfirmReservation(ctx, confirmed.ID, testSale())
+			if err != nil {
+				t.Fatalf("confirming again: %v", err)
+			}
+			if second.Movement.ID != first.Movement.ID || second.Reservation.Status != reservationConfirmed {
+				t.Errorf("confirming again = %+v, want sale %d again", second, first.Movement.ID)
+			}
+			if _, err := stores.Reservations.ReleaseReservation(ctx, confirmed.ID, time.Now()); errCode(err) != CodeReservationClosed {
+				t.Errorf("releasing a confirmed reservation: err = %v, want %s", err, CodeReservationClosed)
+			}
+
+			released, err := stores.Reservations.Reserve(ctx, testReservation(v.ID, 5, time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for range 2 {
+				r, err := stores.Reservations.ReleaseReservation(ctx, released.ID, time.Now())
+				if err != nil {
+					t.Fatalf("releasing: %v", err)
+				}
+				if r.Status != reservationReleased {
+					t.Errorf("released reservation is %s", r.Status)
+				}
+			}
+			if _, err := stores.Reservations.ConfirmReservation(ctx, released.ID, testSale()); errCode(err) != CodeReservationClosed {
+				t.Errorf("confirming a released reservation: err = %v, want %s", err, CodeReservationClosed)
+			}
+
+			level, err := stores.Inventory.StockLevel(ctx, v.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if level.OnHand != 6 || level.Reserved != 0 || level.Available != 6 {
+				t.Errorf("stock = %+v, want one sale of 4 and nothing held", level)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+//! ============================================================================ //
+//? ======================= 📨 RESPONSE ENVELOPE 📨 ============================ //
+//! ============================================================================ //
+
+// Envelope is the shape of every successful response:
+//
+//	{"success": true, "data": ..., "meta": {...}, "links": {...}}
+//
+// meta and links are only present on list endpoints.
+type Envelope struct {
+	Success bool      `json:"success"`
+	Data    any       `json:"data"`
+	Meta    *ListMeta `json:"meta,omitempty"`
+	Links   *Links    `json:"links,omitempty"`
+}
+
+type ListMeta struct {
+	// Total is the number of rows matching the request across all pages.
+	Total      int    `json:"total"`
+	Count      int    `json:"count"`
+	Page       int    `json:"page,omitempty"`
+	PageSize   int    `json:"page_size,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	// Suggestions are offered when a search finds nothing.
+	Suggestions []Suggestion `json:"suggestions,omitempty"`
+	// Facets are included on request; see facets.go.
+	Facets *Facets `json:"facets,omitempty"`
+}
+
+type Links struct {
+	Self string `json:"self"`
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+// Page is what a store returns for a paged list.
+type Page[T any] struct {
+	Items []T
+	// Total counts every matching row, not only those in Items.
+	Total int
+	// NextCursor continues after the last item; empty on the last page.
+	NextCursor string
+}
+
+func respondOK(c *gin.Context, data any) {
+	c.JSON(http.StatusOK, Envelope{Success: true, Data: data})
+}
+
+// respondList writes items (never null, [] when empty) with meta and links.
+// meta.Count is filled in here.
+func respondList[T any](c *gin.Context, items []T, meta ListMeta, links Links) {
+	if items == nil {
+		items = []T{}
+	}
+	meta.Count = len(items)
+	if links.Self == "" {
+		links.Self = c.Request.URL.RequestURI()
+	}
+	c.JSON(http.StatusOK, Envelope{Success: true, Data: items, Meta: &meta, Links: &links})
+}
+
+// respondAll is respondList for endpoints that return every row at once.
+func respondAll[T any](c *gin.Context, items []T) {
+	respondList(c, items, ListMeta{Total: len(items)}, Links{})
+}
+
+// respondPage is respondList for a keyset page from a store.
+func respondPage[T any](c *gin.Context, page Page[T]) {
+	respondList(c, page.Items, ListMeta{Total: page.Total, NextCursor: page.NextCursor}, cursorLinks(c, page.NextCursor))
+}
+
+// pageLinks builds self/next/prev links for offset pagination by rewriting
+// the page query parameter of the current request.
+func pageLinks(c *gin.Context, page, pageSize, total int) Links {
+	at := func(p int) string {
+		return withQuery(c.Request.URL, "page", strconv.Itoa(p))
+	}
+
+	links := Links{Self: c.Request.URL.RequestURI()}
+	if page*pageSize < total {
+		links.Next = at(page + 1)
+	}
+	if page > 1 {
+		links.Prev = at(page - 1)
+	}
+	return links
+}
+
+// withQuery returns the current request URI with key set to value.
+func withQuery(u *url.URL, key, value string) string {
+	next := *u
+	q := next.Query()
+	q.Set(key, value)
+	next.RawQuery = q.Encode()
+	return next.RequestURI()
+}
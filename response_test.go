@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// rawEnvelope keeps each top-level key of a response as it was sent, so
+// tests can tell a missing key from a null one.
+func rawEnvelope(t *testing.T, r http.Handler, path string) map[string]json.RawMessage {
+	t.Helper()
+	w, _ := serveJSON(t, r, http.MethodGet, path, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s = %d %s", path, w.Code, w.Body.String())
+	}
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestSuccessEnvelope(t *testing.T) {
+	r := newTestAPI(t)
+
+	one := rawEnvelope(t, r, "/products/get-product/p1")
+	if string(one["success"]) != "true" || one["data"] == nil {
+		t.Errorf("single record = %v, want success and data", one)
+	}
+	if _, ok := one["meta"]; ok {
+		t.Error("a single record carries meta")
+	}
+	if _, ok := one["links"]; ok {
+		t.Error("a single record carries links")
+	}
+
+	empty := rawEnvelope(t, r, "/variance/by-product/nothing")
+	if string(empty["data"]) != "[]" {
+		t.Errorf("empty list data = %s, want []", empty["data"])
+	}
+	var meta ListMeta
+	if err := json.Unmarshal(empty["meta"], &meta); err != nil || meta.Total != 0 || meta.Count != 0 {
+		t.Errorf("empty list meta = %s, want zero total and count", empty["meta"])
+	}
+	var links Links
+	if err := json.Unmarshal(empty["links"], &links); err != nil || links.Self != "/variance/by-product/nothing" {
+		t.Errorf("empty list links = %s, want self", empty["links"])
+	}
+}
+
+// Offset pages on search report their position and link to their
+// neighbours with the rest of the query kept.
+func TestSearchPageLinks(t *testing.T) {
+	r := newTestAPI(t)
+	for _, id := range []string{"p2", "p3"} {
+		body := strings.Replace(testProduct, `"id":"p1"`, `"id":"`+id+`"`, 1)
+		body = strings.Replace(body, "Portland Cement", "Portland Cement "+id, 1)
+		if w, _ := serveJSON(t, r, http.MethodPost, "/products/insert", body); w.Code != http.StatusOK {
+			t.Fatalf("insert %s = %d %s", id, w.Code, w.Body.String())
+		}
+	}
+
+	body := rawEnvelope(t, r, "/products/search?department=mainBuilding&page=2&pagesize=1")
+	var meta ListMeta
+	var links Links
+	if err := json.Unmarshal(body["meta"], &meta); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(body["links"], &links); err != nil {
+		t.Fatal(err)
+	}
+	if meta.Total != 3 || meta.Count != 1 || meta.Page != 2 || meta.PageSize != 1 {
+		t.Errorf("meta = %+v, want page 2 of size 1 out of 3", meta)
+	}
+	if !strings.Contains(links.Next, "page=3") || !strings.Contains(links.Prev, "page=1") ||
+		!strings.Contains(links.Next, "department=mainBuilding") {
+		t.Errorf("links = %+v, want next page 3 and prev page 1 keeping department", links)
+	}
+
+	last := rawEnvelope(t, r, "/products/search?page=3&pagesize=1")
+	links = Links{}
+	if err := json.Unmarshal(last["links"], &links); err != nil {
+		t.Fatal(err)
+	}
+	if links.Next != "" {
+		t.Errorf("last page links next to %s", links.Next)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"maps"
+	"strings"
+	"unicode"
+)
+
+//! ============================================================================ //
+//? ========================= 🔎 FULL-TEXT SEARCH 🔎 =========================== //
+//! ============================================================================ //
+
+// q on /products/search matches whole words and word prefixes anywhere in a
+// product's search document, weighted like the search_vector built by
+// migration 0002:
+//
+//	A  title
+//	B  tags and the brands of its variances
+//	C  variance display titles
+//	D  description
+//
+// Every word of q has to match ("cem port" finds "Portland Cement").
+
+// ProductHit is one /products/search result: the product and how it matched.
+type ProductHit struct {
+	Product
+	// Rank is the full-text relevance for q, higher is better.
+	Rank float64 `json:"rank,omitempty"`
+	// Snippet is the title and description with matched words in <mark>.
+	Snippet string `json:"snippet,omitempty"`
+	// Similarity is the fuzzy match score for q in mode=fuzzy, 0..1.
+	Similarity float64 `json:"similarity,omitempty"`
+	// VarianceCount is how many of the product's variances pass the variance
+	// filters (all of them when there are none).
+	VarianceCount int `json:"variance_count"`
+}
+
+// productSearchSortFields adds relevance and similarity to the product sort
+// fields; rank and similarity are columns of the search subquery.
+var productSearchSortFields = func() sortFields {
+	fields := maps.Clone(productSortFields)
+	fields["relevance"] = "rank"
+	fields["similarity"] = "similarity"
+	return fields
+}()
+
+func hitSortKey(h ProductHit, field string) any {
+	switch field {
+	case "relevance":
+		return h.Rank
+	case "similarity":
+		return h.Similarity
+	}
+	return productSortKey(h.Product, field)
+}
+
+// searchTerms splits q into lower case words, dropping punctuation, so user
+// input never reaches to_tsquery's operator syntax.
+func searchTerms(q string) []string {
+	return strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// tsQuery turns terms into a prefix query for to_tsquery: "cem:* & port:*".
+func tsQuery(terms []string) string {
+	parts := make([]string, len(terms))
+	for i, t := range terms {
+		parts[i] = t + ":*"
+	}
+	return strings.Join(parts, " & ")
+}
+
+// headlineOptions are the ts_headline settings; highlight mirrors them.
+const headlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxWords=25, MinWords=10, ShortWord=2"
+
+//? --------------------------- in-memory ranking ---------------------------- //
+
+// searchWeights are ts_rank's default weights for A, B, C and D.
+var searchWeights = [4]float64{1.0, 0.4, 0.2, 0.1}
+
+// searchDocument is a product's text split by weight, A first.
+type searchDocument [4]string
+
+func newSearchDocument(p Product, variances []Variance) searchDocument {
+	var brands, titles []string
+	for _, v := range variances {
+		brands = append(brands, v.Brand)
+		titles = append(titles, v.DisplayTitle)
+	}
+	return searchDocument{
+		p.Title,
+		strings.Join(append([]string{p.TagOne, p.TagTwo}, brands...), " "),
+		strings.Join(titles, " "),
+		p.Description,
+	}
+}
+
+// rank scores the document against terms the way the Postgres query filters
+// and ranks: every term must prefix some word, and each adds the weight of
+// the best field it matched in. ok is false when a term matches nothing.
+func (d searchDocument) rank(terms []string) (rank float64, ok bool) {
+	var words [4][]string
+	for i, field := range d {
+		words[i] = searchTerms(field)
+	}
+
+	for _, term := range terms {
+		best := 0.0
+		for i := range d {
+			if best < searchWeights[i] && hasPrefixWord(words[i], term) {
+				best = searchWeights[i]
+			}
+		}
+		if best == 0 {
+			return 0, false
+		}
+		rank += best
+	}
+	return rank, true
+}
+
+func hasPrefixWord(words []string, prefix string) bool {
+	for _, w := range words {
+		if strings.HasPrefix(w, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// highlight is ts_headline for the in-memory store: it wraps matching words
+// in <mark> and keeps about 25 words around the first match.
+func highlight(text string, terms []string) string {
+	const maxWords, before = 25, 5
+
+	words := strings.Fields(text)
+	first := -1
+	for i, w := range words {
+		if matchesTerm(w, terms) {
+			if first < 0 {
+				first = i
+			}
+			words[i] = "<mark>" + w + "</mark>"
+		}
+	}
+
+	start := 0
+	if first > before {
+		start = first - before
+	}
+	end := min(start+maxWords, len(words))
+	return strings.Join(words[start:end], " ")
+}
+
+func matchesTerm(word string, terms []string) bool {
+	for _, part := range searchTerms(word) {
+		for _, t := range terms {
+			if strings.HasPrefix(part, t) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newSearchAPI serves a small catalog the search tests share:
+//
+//	p1 Portland Cement  Holcim 50kg 1800 (10), Tokyo 50kg 1750 (0)
+//	p2 White Cement     Holcim 25kg 2400 (5)
+//	p3 River Sand       Sanstha 1 cube 650 (20), says cement in its description
+//	p4 Gloss Enamel     Dulux 4L 3200 (3)
+func newSearchAPI(t *testing.T) http.Handler {
+	t.Helper()
+	cfg := testConfig(t, map[string]string{})
+	r := setupRouter(cfg, newMemoryStore(cfg.Pricing).stores())
+
+	post := func(path, body string) {
+		t.Helper()
+		if w, _ := serveJSON(t, r, http.MethodPost, path, body); w.Code != http.StatusOK {
+			t.Fatalf("POST %s = %d %s", path, w.Code, w.Body.String())
+		}
+	}
+	for _, name := range []string{"Holcim", "Tokyo", "Sanstha", "Dulux"} {
+		post("/brand/upsert", fmt.Sprintf(`{"name":%q}`, name))
+	}
+	for _, name := range []string{"Acme Traders", "River Co"} {
+		post("/supplier/upsert", fmt.Sprintf(`{"name":%q,"status":"active"}`, name))
+	}
+	for _, p := range []struct{ id, title, department, category, sub, description string }{
+		{"p1", "Portland Cement", "mainBuilding", "cement", "ordinary portland", "Ordinary grey cement for concrete"},
+		{"p2", "White Cement", "mainBuilding", "cement", "white cement", "Bright white powder for tiling"},
+		{"p3", "River Sand", "yard", "sand", "river sand", "Washed sand to mix with cement for plaster"},
+		{"p4", "Gloss Enamel", "paintStore", "paint", "enamel", "Hard wearing paint for doors"},
+	} {
+		post("/products/insert", fmt.Sprintf(`{"id":%q,"title":%q,"department":%q,"main_catogory":%q,"sub_catogory":%q,"description":%q}`,
+			p.id, p.title, p.department, p.category, p.sub, p.description))
+	}
+	for _, v := range []struct {
+		product, title, variance, brand, supplier string
+		retail, quantity                          int
+	}{
+		{"p1", "Portland Cement", "50kg bag", "Holcim", "Acme Traders", 1800, 10},
+		{"p1", "Portland Cement", "50kg bag", "Tokyo", "Acme Traders", 1750, 0},
+		{"p2", "White Cement", "25kg bag", "Holcim", "Acme Traders", 2400, 5},
+		{"p3", "River Sand", "1 cube", "Sanstha", "River Co", 650, 20},
+		{"p4", "Gloss Enamel", "4L", "Dulux", "Acme Traders", 3200, 3},
+	} {
+		post("/variance/upsert", fmt.Sprintf(`{"productName":%q,"product_id":%q,"variance":%q,"brand":%q,"supplier":%q,"displayTitle":"%s %s","retail_price":%d,"quantity":%d}`,
+			v.title, v.product, v.variance, v.brand, v.supplier, v.brand, v.variance, v.retail, v.quantity))
+	}
+	return r
+}
+
+// search runs /products/search with query and returns the hits in order.
+func search(t *testing.T, r http.Handler, query string) ([]ProductHit, testEnvelope) {
+	t.Helper()
+	w, env := serveJSON(t, r, http.MethodGet, "/products/search?"+query, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /products/search?%s = %d %s", query, w.Code, w.Body.String())
+	}
+	var hits []ProductHit
+	decodeData(t, env, &hits)
+	return hits, env
+}
+
+func hitIDs(hits []ProductHit) []string {
+	ids := make([]string, len(hits))
+	for i, h := range hits {
+		ids[i] = h.ID
+	}
+	return ids
+}
+
+func TestFullTextSearch(t *testing.T) {
+	r := newSearchAPI(t)
+	tests := []struct {
+		q    string
+		want []string
+	}{
+		{"cement", []string{"p1", "p2", "p3"}}, // titles (A) before the description (D)
+		{"cem port", []string{"p1"}},           // prefixes, every word must match
+		{"holcim", []string{"p1", "p2"}},       // brands weigh as B
+		{"concrete", []string{"p1"}},
+		{"cement & sand | !river", []string{"p3"}}, // operators are only punctuation
+		{"granite", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			hits, _ := search(t, r, "q="+url.QueryEscape(tt.q))
+			if got := hitIDs(hits); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("q=%s found %v, want %v", tt.q, got, tt.want)
+			}
+		})
+	}
+
+	hits, _ := search(t, r, "q=cement")
+	if hits[0].Rank <= hits[2].Rank {
+		t.Errorf("title match ranked %v, description match %v", hits[0].Rank, hits[2].Rank)
+	}
+	if !strings.Contains(hits[0].Snippet, "<mark>cement</mark>") {
+		t.Errorf("snippet = %q, want the match marked", hits[0].Snippet)
+	}
+
+	// An explicit sort overrides relevance.
+	hits, _ = search(t, r, "q=cement&sort=-title")
+	if got := hitIDs(hits); !reflect.DeepEqual(got, []string{"p2", "p3", "p1"}) {
+		t.Errorf("q=cement&sort=-title found %v", got)
+	}
+}
+
+func TestSearchTerms(t *testing.T) {
+	tests := map[string][]string{
+		"Portland Cement":       {"portland", "cement"},
+		"  cem:* & port | !x  ": {"cem", "port", "x"},
+		"50kg":                  {"50kg"},
+		"'); DROP":              {"drop"},
+		"":                      {},
+	}
+	for q, want := range tests {
+		if got := searchTerms(q); len(got) != len(want) || (len(got) > 0 && !reflect.DeepEqual(got, want)) {
+			t.Errorf("searchTerms(%q) = %q, want %q", q, got, want)
+		}
+	}
+	if got := tsQuery([]string{"cem", "port"}); got != "cem:* & port:*" {
+		t.Errorf("tsQuery = %q", got)
+	}
+}
+
+func TestFuzzySearch(t *testing.T) {
+	r := newSearchAPI(t)
+	tests := []struct {
+		q    string
+		want []string
+	}{
+		{"cemnt", []string{"p1", "p2"}},      // a typo in the title
+		{"holcm", []string{"p1", "p2"}},      // in a brand
+		{"acme", []string{"p1", "p2", "p4"}}, // in a supplier
+		{"rivr snd", []string{"p3"}},         // every word scored
+		{"xylophone", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			hits, _ := search(t, r, "mode=fuzzy&q="+url.QueryEscape(tt.q))
+			got := hitIDs(hits)
+			slices.Sort(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fuzzy q=%s found %v, want %v", tt.q, got, tt.want)
+			}
+			for i, h := range hits {
+				if h.Similarity < fuzzyThreshold || (i > 0 && h.Similarity > hits[i-1].Similarity) {
+					t.Errorf("hit %s has similarity %v, want at least %v and best first", h.ID, h.Similarity, fuzzyThreshold)
+				}
+			}
+		})
+	}
+
+	if w, env := serveJSON(t, r, http.MethodGet, "/products/search?mode=psychic&q=cement", nil); w.Code != http.StatusBadRequest || env.Error.Code != CodeBadRequest {
+		t.Errorf("mode=psychic = %d %s, want 400", w.Code, w.Body.String())
+	}
+}
+
+// A search that finds nothing offers the closest names instead.
+func TestSearchSuggestions(t *testing.T) {
+	r := newSearchAPI(t)
+	hits, env := search(t, r, "q=cemnet")
+	if len(hits) != 0 {
+		t.Fatalf("q=cemnet found %v", hitIDs(hits))
+	}
+	if len(env.Meta.Suggestions) == 0 || len(env.Meta.Suggestions) > maxSuggestions {
+		t.Fatalf("suggestions = %+v, want 1..%d", env.Meta.Suggestions, maxSuggestions)
+	}
+	if s := env.Meta.Suggestions[0]; !strings.Contains(s.Text, "Cement") || s.Kind != "product" {
+		t.Errorf("best suggestion = %+v, want a cement product", s)
+	}
+
+	if _, env := search(t, r, "q=cement"); len(env.Meta.Suggestions) != 0 {
+		t.Errorf("a search with hits suggested %+v", env.Meta.Suggestions)
+	}
+}
+
+func TestWordSimilarity(t *testing.T) {
+	if d := levenshtein([]rune("kitten"), []rune("sitting")); d != 3 {
+		t.Errorf("levenshtein(kitten, sitting) = %d, want 3", d)
+	}
+	tests := []struct {
+		q, text  string
+		min, max float64
+	}{
+		{"cement", "Portland Cement", 1, 1},
+		{"cemnt", "Portland Cement", 0.8, 0.9},
+		{"cement sand", "Portland Cement", 0.5, 0.7},
+		{"", "Portland Cement", 0, 0},
+		{"zzz", "Portland Cement", 0, 0.2},
+	}
+	for _, tt := range tests {
+		if got := wordSimilarity(tt.q, tt.text); got < tt.min || got > tt.max {
+			t.Errorf("wordSimilarity(%q, %q) = %v, want %v..%v", tt.q, tt.text, got, tt.min, tt.max)
+		}
+	}
+}
+
+// Variance filters match a product when one of its variances passes all of
+// them together.
+func TestSearchFilters(t *testing.T) {
+	r := newSearchAPI(t)
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"brand=Holcim", []string{"p1", "p2"}},
+		{"brand=holcim", []string{"p1", "p2"}},
+		{"brand=2", []string{"p1"}}, // Tokyo's id
+		{"brand=Holcim,Dulux", []string{"p1", "p2", "p4"}},
+		{"supplier=" + url.QueryEscape("River Co"), []string{"p3"}},
+		{"price_min=1760&price_max=2000", []string{"p1"}},
+		{"price_max=700", []string{"p3"}},
+		{"in_stock=true", []string{"p1", "p2", "p3", "p4"}},
+		{"brand=Tokyo&in_stock=true", []string{}},
+		{"brand=Tokyo&price_min=1760", []string{}},
+		{"department=mainBuilding&brand=Holcim&price_max=2000", []string{"p1"}},
+		{"main_catogory=cement,sand", []string{"p1", "p2", "p3"}},
+		{"sub_catogory=" + url.QueryEscape("white cement"), []string{"p2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			hits, env := search(t, r, tt.query)
+			got := hitIDs(hits)
+			slices.Sort(got)
+			if !reflect.DeepEqual(got, tt.want) || env.Meta.Total != len(tt.want) {
+				t.Errorf("%s found %v (total %d), want %v", tt.query, got, env.Meta.Total, tt.want)
+			}
+		})
+	}
+
+	hits, _ := search(t, r, "brand=Holcim&q=portland")
+	if len(hits) != 1 || hits[0].VarianceCount != 1 {
+		t.Errorf("brand=Holcim&q=portland = %+v, want p1 with the one Holcim variance counted", hits)
+	}
+
+	for _, query := range []string{"price_min=abc", "price_min=3000&price_max=100"} {
+		if w, _ := serveJSON(t, r, http.MethodGet, "/products/search?"+query, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("%s = %d, want 400", query, w.Code)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+)
+
+//! ============================================================================ //
+//? ========================= 🌱 FAKE DATA SEEDING 🌱 ========================== //
+//! ============================================================================ //
+
+type seedOptions struct {
+	// Seed makes the catalog reproducible; 0 picks a random seed.
+	Seed         int64
+	Products     int
+	Brands       int
+	Suppliers    int
+	MaxVariances int
+}
+
+// seedEpoch anchors generated timestamps so a given seed always produces the
+// same rows, whenever it is run.
+var seedEpoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// catalogSeeder generates a coherent catalog: products belong to a real
+// department/main/sub category, and their variances share its units and price
+// band, are made by the seeded brands and bought from the seeded suppliers.
+type catalogSeeder struct {
+	f      *gofakeit.Faker
+	opts   seedOptions
+	titles map[string]bool
+}
+
+// generateCatalog builds the catalog in memory without touching any store, so
+// fixtures can use it directly.
+func generateCatalog(opts seedOptions) catalogSnapshot {
+	g := &catalogSeeder{f: gofakeit.New(opts.Seed), opts: opts, titles: map[string]bool{}}
+
+	snapshot := catalogSnapshot{ExportedAt: seedEpoch}
+	snapshot.Brands = g.brands()
+	snapshot.Suppliers = g.suppliers()
+	for i := 0; i < opts.Products; i++ {
+		p := g.product()
+		snapshot.Products = append(snapshot.Products, p)
+		snapshot.Variances = append(snapshot.Variances, g.variances(p, snapshot.Brands, snapshot.Suppliers)...)
+	}
+	return snapshot
+}
+
+// seedCatalog generates a catalog and upserts it through the stores.
+func seedCatalog(ctx context.Context, stores Stores, opts seedOptions) error {
+	snapshot := generateCatalog(opts)
+	if err := importCatalog(ctx, stores, snapshot, nil); err != nil {
+		return err
+	}
+
+	log.Printf("🌱 seeded %d brands, %d suppliers, %d products, %d variances (seed %d)",
+		len(snapshot.Brands), len(snapshot.Suppliers), len(snapshot.Products), len(snapshot.Variances), opts.Seed)
+	return nil
+}
+
+// timestamp returns a moment in the year after seedEpoch.
+func (g *catalogSeeder) timestamp() *time.Time {
+	t := g.f.DateRange(seedEpoch, seedEpoch.AddDate(1, 0, 0)).UTC()
+	return &t
+}
+
+// uniqueNames draws n distinct names, since brand and supplier_tb are unique
+// on name. A name drawn before gets a company suffix, then a number, so any
+// n terminates however few names next can make.
+func (g *catalogSeeder) uniqueNames(n int, next func() string) []string {
+	seen := map[string]bool{}
+	names := make([]string, 0, n)
+	for len(names) < n {
+		name := next()
+		if seen[name] {
+			name = fmt.Sprintf("%s %s", name, g.f.CompanySuffix())
+		}
+		for i := 2; seen[name]; i++ {
+			if candidate := fmt.Sprintf("%s %d", name, i); !seen[candidate] {
+				name = candidate
+			}
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// slug turns "Acme, Inc." into "acmeinc" for domains and handles.
+func slug(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func (g *catalogSeeder) brands() []Brand {
+	names := g.uniqueNames(g.opts.Brands, g.f.Company)
+	brands := make([]Brand, 0, len(names))
+	for _, name := range names {
+		handle := slug(name)
+		brands = append(brands, Brand{
+			Name:             name,
+			Description:      g.f.Sentence(14),
+			Logourl:          fmt.Sprintf("https://cdn.%s.com/logo.png", handle),
+			CountryOfOrigin:  g.f.Country(),
+			SocialMediaLinks: fmt.Sprintf("https://facebook.com/%s,https://instagram.com/%s", handle, handle),
+			ContactEmail:     fmt.Sprintf("info@%s.com", handle),
+			PhoneNumber:      g.f.Phone(),
+			BannerUrl:        fmt.Sprintf("https://cdn.%s.com/banner.jpg", handle),
+			Website:          fmt.Sprintf("https://www.%s.com", handle),
+			CreatedAt:        g.timestamp(),
+		})
+	}
+	return brands
+}
+
+func (g *catalogSeeder) suppliers() []Supplier {
+	names := g.uniqueNames(g.opts.Suppliers, func() string {
+		return g.f.LastName() + " " + g.f.RandomString([]string{"Traders", "Distributors", "Hardware", "Enterprises", "Holdings"})
+	})
+	suppliers := make([]Supplier, 0, len(names))
+	for _, name := range names {
+		handle := slug(name)
+		status, _ := g.f.Weighted([]any{"active", "inactive", "on_hold"}, []float32{8, 1, 1})
+		suppliers = append(suppliers, Supplier{
+			Name:             name,
+			Description:      g.f.Sentence(12),
+			LogoURL:          fmt.Sprintf("https://cdn.%s.lk/logo.png", handle),
+			Website:          fmt.Sprintf("https://www.%s.lk", handle),
+			CountryOfOrigin:  "Sri Lanka",
+			SocialMediaLinks: fmt.Sprintf("https://facebook.com/%s", handle),
+			ContactEmail:     fmt.Sprintf("sales@%s.lk", handle),
+			PhoneNumber:      g.f.Numerify("+94 7# ### ####"),
+			BannerURL:        fmt.Sprintf("https://cdn.%s.lk/banner.jpg", handle),
+			LocatedCity:      g.f.RandomString([]string{"Colombo", "Kandy", "Galle", "Kurunegala", "Negombo", "Jaffna", "Matara"}),
+			LocatedCountry:   "Sri Lanka",
+			BankDetails:      fmt.Sprintf("%s Bank, A/C %s", g.f.LastName(), g.f.AchAccount()),
+			Status:           status.(string),
+			ExtraData:        fmt.Sprintf(`{"payment_terms":"NET%d"}`, g.f.RandomInt([]int{7, 14, 30, 60})),
+			CreatedAt:        g.timestamp(),
+		})
+	}
+	return suppliers
+}
+
+func (g *catalogSeeder) product() Product {
+	category := catalogCategories[g.f.Number(0, len(catalogCategories)-1)]
+	sub := g.f.RandomString(category.Subs)
+	created := g.timestamp()
+	modified := created.Add(time.Duration(g.f.Number(0, 90*24)) * time.Hour)
+
+	// Variances are unique on (product, variance, brand_name), so two
+	// products sharing a title would overwrite each other's variances.
+	title := titleCase(fmt.Sprintf("%s %s", g.f.Adjective(), sub))
+	for g.titles[title] {
+		title = titleCase(fmt.Sprintf("%s %s %s", g.f.Adjective(), sub, g.f.Numerify("M-###")))
+	}
+	g.titles[title] = true
+
+	return Product{
+		ID:             g.f.UUID(),
+		Title:          title,
+		Description:    g.f.Paragraph(1, 3, 12, " "),
+		TagOne:         category.Name,
+		TagTwo:         sub,
+		ImageURL:       fmt.Sprintf("https://picsum.photos/seed/%s/600/600", g.f.Numerify("######")),
+		Department:     category.Department,
+		MainCategory:   category.Name,
+		SubCategory:    sub,
+		CreatedAt:      created,
+		LastModifiedAt: &modified,
+	}
+}
+
+// variances gives each product 1..MaxVariances variants of its category, each
+// priced off one wholesale figure so original <= wholesale <= retail holds.
+func (g *catalogSeeder) variances(p Product, brands []Brand, suppliers []Supplier) []Variance {
+	category, _ := categoryByName(p.MainCategory)
+	variants := append([]string(nil), category.Variants...)
+	g.f.ShuffleStrings(variants)
+	n := min(g.f.Number(1, g.opts.MaxVariances), len(variants))
+
+	brand := brands[g.f.Number(0, len(brands)-1)].Name
+	unit := g.f.RandomString(category.Units)
+	base := g.f.Float64Range(category.MinPrice, category.MaxPrice)
+
+	variances := make([]Variance, 0, n)
+	for i, variant := range variants[:n] {
+		wholesale := roundPrice(base * (1 + 0.6*float64(i)))
+		created := g.timestamp()
+		variances = append(variances, Variance{
+			ProductName:         p.Title,
+			ProductID:           p.ID,
+			Barcode:             g.ean13(),
+			DisplayTitle:        fmt.Sprintf("%s %s - %s", brand, p.Title, variant),
+			VarianceDescription: g.f.Sentence(10),
+			ImageUrl:            fmt.Sprintf("https://picsum.photos/seed/%s/600/600", g.f.Numerify("######")),
+			VarianceTitle:       variant,
+			Brand:               brand,
+			Supplier:            suppliers[g.f.Number(0, len(suppliers)-1)].Name,
+			OriginalPrice:       seedPrice(wholesale * g.f.Float64Range(0.78, 0.92)),
+			WholesalePrice:      seedPrice(wholesale),
+			RetailPrice:         seedPrice(wholesale * g.f.Float64Range(1.12, 1.35)),
+			Quantity:            float64(g.f.Number(0, 250)),
+			UnitMeasure:         unit,
+			LeastSubUnitMeasure: leastSubUnit(unit),
+			CreatedAt:           created,
+			LastModifiedAt:      created,
+		})
+	}
+	return variances
+}
+
+// ean13 returns a valid EAN-13 in the 479 (Sri Lanka) GS1 prefix.
+func (g *catalogSeeder) ean13() string {
+	body := "479" + g.f.Numerify("#########")
+	return fmt.Sprintf("%s%d", body, gtinCheckDigit(body))
+}
+
+// leastSubUnit is the smallest quantity that can be sold of a unit: loose
+// measures can be split, countable ones cannot.
+func leastSubUnit(unit string) float64 {
+	switch unit {
+	case "kg", "l", "m", "ft", "cube":
+		return 0.5
+	}
+	return 1
+}
+
+func roundPrice(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// seedPrice is a generated price to the cent; the store puts it in its
+// currency.
+func seedPrice(v float64) Money {
+	return Money{Amount: decimalFromFloat(roundPrice(v))}
+}
+
+func titleCase(s string) string {
+	words := strings.Fields(s)
+	for i, w := range words {
+		words[i] = strings.ToUpper(w[:1]) + w[1:]
+	}
+	return strings.Join(words, " ")
+}
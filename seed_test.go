@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/gin-gonic/gin/binding"
+)
+
+func TestUniqueNamesTerminates(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		next func() string
+	}{
+		{name: "one name only", n: 200, next: func() string { return "Acme" }},
+		{name: "two names", n: 500, next: func() func() string {
+			i := 0
+			return func() string { i++; return []string{"Acme", "Bolt"}[i%2] }
+		}()},
+		{name: "none", n: 0, next: func() string { return "Acme" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &catalogSeeder{f: gofakeit.New(1)}
+			names := g.uniqueNames(tt.n, tt.next)
+			if len(names) != tt.n {
+				t.Fatalf("got %d names, want %d", len(names), tt.n)
+			}
+			seen := map[string]bool{}
+			for _, name := range names {
+				if seen[name] {
+					t.Fatalf("%q drawn twice", name)
+				}
+				seen[name] = true
+			}
+		})
+	}
+}
+
+func TestGenerateCatalogIsReproducible(t *testing.T) {
+	opts := seedOptions{Seed: 42, Products: 20, Brands: 300, Suppliers: 300, MaxVariances: 3}
+	a, b := generateCatalog(opts), generateCatalog(opts)
+	if !reflect.DeepEqual(a, b) {
+		t.Fatal("the same seed generated two different catalogs")
+	}
+	if len(a.Brands) != opts.Brands || len(a.Suppliers) != opts.Suppliers {
+		t.Errorf("got %d brands and %d suppliers, want %d of each", len(a.Brands), len(a.Suppliers), opts.Brands)
+	}
+}
+
+// Every generated row would pass the API's own validation, and variances
+// only point at the products, brands and suppliers generated with them.
+func TestGeneratedCatalogIsValid(t *testing.T) {
+	snapshot := generateCatalog(seedOptions{Seed: 11, Products: 40, Brands: 8, Suppliers: 5, MaxVariances: 4})
+	valid := func(what string, v any) {
+		t.Helper()
+		if err := binding.Validator.ValidateStruct(v); err != nil {
+			t.Errorf("%s: %v", what, err)
+		}
+	}
+
+	brands, suppliers, products := map[string]bool{}, map[string]bool{}, map[string]bool{}
+	for _, b := range snapshot.Brands {
+		valid("brand "+b.Name, b)
+		brands[b.Name] = true
+	}
+	for _, s := range snapshot.Suppliers {
+		valid("supplier "+s.Name, s)
+		suppliers[s.Name] = true
+	}
+	for _, p := range snapshot.Products {
+		valid("product "+p.Title, p)
+		products[p.ID] = true
+	}
+	perProduct := map[string]int{}
+	for _, v := range snapshot.Variances {
+		name := v.ProductName + "/" + v.VarianceTitle
+		valid("variance "+name, v)
+		if !products[v.ProductID] || !brands[v.Brand] || !suppliers[v.Supplier] {
+			t.Errorf("variance %s points at product %s, brand %q, supplier %q, not all generated", name, v.ProductID, v.Brand, v.Supplier)
+		}
+		if v.OriginalPrice.Amount.Cmp(v.WholesalePrice.Amount) > 0 || v.WholesalePrice.Amount.Cmp(v.RetailPrice.Amount) > 0 {
+			t.Errorf("variance %s prices %s/%s/%s, want original <= wholesale <= retail", name, v.OriginalPrice, v.WholesalePrice, v.RetailPrice)
+		}
+		perProduct[v.ProductID]++
+	}
+	for id := range products {
+		if n := perProduct[id]; n < 1 || n > 4 {
+			t.Errorf("product %s has %d variances, want 1..4", id, n)
+		}
+	}
+}
+
+func TestSeedCatalogFillsTheStores(t *testing.T) {
+	ctx := context.Background()
+	stores := newMemoryStore(defaultConfig().Pricing).stores()
+	opts := seedOptions{Seed: 3, Products: 10, Brands: 4, Suppliers: 3, MaxVariances: 2}
+	if err := seedCatalog(ctx, stores, opts); err != nil {
+		t.Fatal(err)
+	}
+	want := generateCatalog(opts)
+	products, err := stores.Products.ListProducts(ctx, ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	variances, err := stores.Variances.ListVariances(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(products.Items) != len(want.Products) || len(variances) != len(want.Variances) {
+		t.Errorf("stored %d products and %d variances, want %d and %d",
+			len(products.Items), len(variances), len(want.Products), len(want.Variances))
+	}
+
+	// Seeding again with the same seed upserts the same rows.
+	if err := seedCatalog(ctx, stores, opts); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := stores.Variances.ListVariances(ctx); len(again) != len(variances) {
+		t.Errorf("a second seed left %d variances, want %d", len(again), len(variances))
+	}
+}
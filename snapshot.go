@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+//! ============================================================================ //
+//? ===================== 📦 CATALOG EXPORT / IMPORT 📦 ======================== //
+//! ============================================================================ //
+
+// catalogSnapshot is the file format shared by "export" and "import".
+type catalogSnapshot struct {
+	ExportedAt time.Time  `json:"exported_at"`
+	Brands     []Brand    `json:"brands"`
+	Suppliers  []Supplier `json:"suppliers"`
+	Products   []Product  `json:"products"`
+	Variances  []Variance `json:"variances"`
+}
+
+func exportCatalog(ctx context.Context, stores Stores) (catalogSnapshot, error) {
+	var snapshot catalogSnapshot
+	snapshot.ExportedAt = time.Now().UTC()
+	brands, err := stores.Brands.ListBrands(ctx, ListOptions{})
+	if err != nil {
+		return snapshot, fmt.Errorf("brands: %w", err)
+	}
+	suppliers, err := stores.Suppliers.ListSuppliers(ctx, ListOptions{})
+	if err != nil {
+		return snapshot, fmt.Errorf("suppliers: %w", err)
+	}
+	products, err := stores.Products.ListProducts(ctx, ListOptions{})
+	if err != nil {
+		return snapshot, fmt.Errorf("products: %w", err)
+	}
+	snapshot.Brands, snapshot.Suppliers, snapshot.Products = brands.Items, suppliers.Items, products.Items
+	if snapshot.Variances, err = stores.Variances.ListVariances(ctx); err != nil {
+		return snapshot, fmt.Errorf("variances: %w", err)
+	}
+	return snapshot, nil
+}
+
+func (s catalogSnapshot) write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+func readCatalogSnapshot(r io.Reader) (catalogSnapshot, error) {
+	var snapshot catalogSnapshot
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&snapshot); err != nil {
+		return snapshot, fmt.Errorf("reading snapshot: %w", err)
+	}
+	return snapshot, nil
+}
+
+// checkCurrency makes sure every variance is priced in base, since an import
+// stores prices as they are.
+func (s catalogSnapshot) checkCurrency(base string) error {
+	for _, v := range s.Variances {
+		if err := checkCurrency(v.Currency, base); err != nil {
+			return fmt.Errorf("variance %q/%q: %w", v.ProductName, v.VarianceTitle, err)
+		}
+	}
+	return nil
+}
+
+// importCatalog upserts a snapshot in dependency order: brands and suppliers,
+// then products (matched on id), then variances (matched on product,
+// variance, brand_name). Stock counts that change stock are checked against
+// the reorder rules through alerts, which may be nil.
+func importCatalog(ctx context.Context, stores Stores, snapshot catalogSnapshot, alerts *alerter) error {
+	for _, b := range snapshot.Brands {
+		if _, err := stores.Brands.UpsertBrand(ctx, b); err != nil {
+			return fmt.Errorf("brand %q: %w", b.Name, err)
+		}
+	}
+	for _, s := range snapshot.Suppliers {
+		if _, err := stores.Suppliers.UpsertSupplier(ctx, s); err != nil {
+			return fmt.Errorf("supplier %q: %w", s.Name, err)
+		}
+	}
+	for _, p := range snapshot.Products {
+		if err := upsertProduct(ctx, stores.Products, p); err != nil {
+			return fmt.Errorf("product %s: %w", p.ID, err)
+		}
+	}
+	// A variance's quantity is taken as a stock count, so re-importing the
+	// same snapshot records nothing new
+	count := StockMovement{Reason: reasonCount, Reference: "catalog import", CreatedBy: "import"}
+	now := time.Now()
+	change := PriceHistory{Source: priceSourceImport, Reference: "catalog import", ChangedBy: "import", ChangedAt: &now}
+	for _, v := range snapshot.Variances {
+		result, adjustment, err := stores.Variances.UpsertVariance(ctx, v, change, &StockCount{Quantity: v.Quantity, Movement: count})
+		if err != nil {
+			return fmt.Errorf("variance %q/%q: %w", v.ProductName, v.VarianceTitle, err)
+		}
+		if adjustment != nil {
+			alerts.stockChanged(ctx, result.ID, adjustment.LocationID)
+		}
+	}
+	return nil
+}
+
+func upsertProduct(ctx context.Context, products ProductStore, p Product) error {
+	_, err := products.GetProduct(ctx, p.ID)
+	switch {
+	case errors.Is(err, errNotFound):
+		return products.InsertProduct(ctx, p)
+	case err != nil:
+		return err
+	}
+	return products.UpdateProduct(ctx, p)
+}
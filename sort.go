@@ -0,0 +1,361 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//! ============================================================================ //
+//? ============================ 🔀 SORTING 🔀 ================================= //
+//! ============================================================================ //
+
+// List endpoints take a sort specification like
+//
+//	sort=-last_modified_at,title
+//
+// i.e. a comma separated list of fields, each optionally prefixed with "-"
+// (descending) or "+" (ascending, the default). Fields are checked against an
+// allow-list per resource, so only known column names ever reach SQL. Every
+// ordering ends with id to keep pages stable when the other keys tie.
+
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+type SortSpec []SortField
+
+// sortFields maps the API field names a resource can be sorted by to the SQL
+// expression that orders it. Nullable columns are COALESCEd exactly as the
+// scanners read them, so keyset cursors compare the same values the client
+// was shown.
+type sortFields map[string]string
+
+var productSortFields = sortFields{
+	"id":               "id",
+	"title":            "title",
+	"description":      "COALESCE(description, '')",
+	"tag_one":          "COALESCE(tag_one, 'N/A')",
+	"tag_two":          "COALESCE(tag_two, 'N/A')",
+	"department":       "COALESCE(department, 'mainBuilding')",
+	"main_catogory":    "COALESCE(main_catogory, 'sand')",
+	"sub_catogory":     "COALESCE(sub_catogory, 'N/A')",
+	"created_at":       "created_at",
+	"last_modified_at": "last_modified_at",
+}
+
+var varianceSortFields = sortFields{
+	"id":               "id",
+	"productName":      "product",
+	"variance":         "variance",
+	"displayTitle":     "COALESCE(variance_display_title, '')",
+	"brand":            "brand_name",
+	"supplier":         "COALESCE(supplier, '')",
+	"barcode":          "COALESCE(barcode, '')",
+	"original_price":   "COALESCE(original_price, 0)",
+	"retail_price":     "COALESCE(retail_price, 0)",
+	"wholesale_price":  "COALESCE(wholesale_price, 0)",
+	"quantity":         "COALESCE(quantity, 0)",
+	"created_at":       "created_at",
+	"last_modified_at": "last_modified_at",
+}
+
+// supplierColumns and brandColumns alias id::text as id, so the tie-break
+// names the table column to keep it numeric.
+var supplierSortFields = sortFields{
+	"id":         "supplier_tb.id",
+	"name":       "name",
+	"city":       "COALESCE(city, '')",
+	"country":    "COALESCE(country, '')",
+	"status":     "COALESCE(status, '')",
+	"created_at": "created_at",
+}
+
+var brandSortFields = sortFields{
+	"id":                "brand.id",
+	"name":              "name",
+	"country_of_origin": "COALESCE(coutry_of_origin, '')",
+	"created_at":        "created_at",
+}
+
+// Default orders used by the stores when a request does not ask for one.
+var (
+	productsNewestFirst  = SortSpec{{Field: "last_modified_at", Desc: true}}
+	variancesNewestFirst = SortSpec{{Field: "id", Desc: true}}
+	byName               = SortSpec{{Field: "name"}}
+	// newestFirst orders ledgers and documents by serial id, latest first.
+	newestFirst = SortSpec{{Field: "id", Desc: true}}
+)
+
+func (f sortFields) names() []string {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// parseSort parses a sort specification against allowed. An empty raw value
+// yields a nil spec, leaving the store to apply its default order.
+func parseSort(raw string, allowed sortFields) (SortSpec, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+
+	var spec SortSpec
+	seen := map[string]bool{}
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		field := SortField{Field: strings.TrimLeft(part, "+-"), Desc: strings.HasPrefix(part, "-")}
+		if len(part)-len(field.Field) > 1 {
+			return nil, errSort(fmt.Sprintf("Sort field %q has more than one direction prefix", part), allowed)
+		}
+		if field.Field == "" {
+			return nil, errSort("Sort specification has an empty field", allowed)
+		}
+		if _, ok := allowed[field.Field]; !ok {
+			return nil, errSort(fmt.Sprintf("Cannot sort by %q", field.Field), allowed)
+		}
+		if seen[field.Field] {
+			return nil, errSort(fmt.Sprintf("Sort field %q is listed twice", field.Field), allowed)
+		}
+		seen[field.Field] = true
+		spec = append(spec, field)
+	}
+	return spec, nil
+}
+
+func errSort(message string, allowed sortFields) *APIError {
+	return &APIError{Status: http.StatusBadRequest, Code: CodeBadRequest, Message: message,
+		Details: gin.H{"param": "sort", "allowed": allowed.names()}}
+}
+
+// sortParam reads the sort query parameter, falling back to fallback when it
+// is absent. The older order=asc|desc parameter still applies to fields given
+// without a direction prefix.
+func sortParam(c *gin.Context, allowed sortFields, fallback string) (SortSpec, error) {
+	raw := c.DefaultQuery("sort", fallback)
+	spec, err := parseSort(raw, allowed)
+	if err != nil {
+		return nil, err
+	}
+
+	switch order := strings.ToLower(c.Query("order")); order {
+	case "", "asc":
+	case "desc":
+		if spec == nil {
+			break
+		}
+		for i, part := range strings.Split(raw, ",") {
+			if p := strings.TrimSpace(part); !strings.HasPrefix(p, "-") && !strings.HasPrefix(p, "+") {
+				spec[i].Desc = true
+			}
+		}
+	default:
+		return nil, errBadRequest(fmt.Sprintf("order must be asc or desc, not %q", order))
+	}
+	return spec, nil
+}
+
+// String renders spec back in the sort grammar, e.g. "-title,id".
+func (spec SortSpec) String() string {
+	parts := make([]string, len(spec))
+	for i, f := range spec {
+		parts[i] = f.Field
+		if f.Desc {
+			parts[i] = "-" + f.Field
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// or returns spec, or fallback when spec is empty.
+func (spec SortSpec) or(fallback SortSpec) SortSpec {
+	if len(spec) == 0 {
+		return fallback
+	}
+	return spec
+}
+
+// withTieBreak appends id ascending unless the spec already orders by id.
+func (spec SortSpec) withTieBreak() SortSpec {
+	for _, f := range spec {
+		if f.Field == "id" {
+			return spec
+		}
+	}
+	return append(slices.Clip(spec), SortField{Field: "id"})
+}
+
+// orderBy renders spec as an ORDER BY clause using the columns in allowed.
+// Fields missing from allowed are skipped; parseSort has already rejected
+// them for anything coming from a request.
+func (spec SortSpec) orderBy(allowed sortFields) string {
+	var terms []string
+	for _, f := range spec.withTieBreak() {
+		column, ok := allowed[f.Field]
+		if !ok {
+			continue
+		}
+		if f.Desc {
+			terms = append(terms, column+" DESC")
+		} else {
+			terms = append(terms, column+" ASC")
+		}
+	}
+	return " ORDER BY " + strings.Join(terms, ", ")
+}
+
+// sortItems is orderBy for the in-memory store. key returns the value of a
+// field as a string, number or time.Time.
+func sortItems[T any](items []T, spec SortSpec, key func(T, string) any) {
+	spec = spec.withTieBreak()
+	slices.SortStableFunc(items, func(a, b T) int {
+		return compareSortValues(sortValues(a, spec, key), sortValues(b, spec, key), spec)
+	})
+}
+
+// compareSortValues orders two rows given their sort key values in spec.
+func compareSortValues(a, b []any, spec SortSpec) int {
+	for i, f := range spec {
+		c := compareKeys(a[i], b[i])
+		if f.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareKeys(a, b any) int {
+	switch a := a.(type) {
+	case string:
+		b, _ := b.(string)
+		return cmp.Compare(a, b)
+	case int:
+		b, _ := b.(int)
+		return cmp.Compare(a, b)
+	case float64:
+		b, _ := b.(float64)
+		return cmp.Compare(a, b)
+	case Decimal:
+		b, _ := b.(Decimal)
+		return a.Cmp(b)
+	case time.Time:
+		b, _ := b.(time.Time)
+		return a.Compare(b)
+	}
+	return 0
+}
+
+// timeValue dereferences an optional timestamp for sortItems; nil sorts first.
+func timeValue(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
+
+// The sort keys return the Go value of a sort field for one row. sortItems
+// orders the memory store with them, and both stores encode them into
+// cursors.
+
+func productSortKey(p Product, field string) any {
+	switch field {
+	case "title":
+		return p.Title
+	case "description":
+		return p.Description
+	case "tag_one":
+		return p.TagOne
+	case "tag_two":
+		return p.TagTwo
+	case "department":
+		return p.Department
+	case "main_catogory":
+		return p.MainCategory
+	case "sub_catogory":
+		return p.SubCategory
+	case "created_at":
+		return timeValue(p.CreatedAt)
+	case "last_modified_at":
+		return timeValue(p.LastModifiedAt)
+	}
+	return p.ID
+}
+
+func varianceSortKey(v Variance, field string) any {
+	switch field {
+	case "productName":
+		return v.ProductName
+	case "variance":
+		return v.VarianceTitle
+	case "displayTitle":
+		return v.DisplayTitle
+	case "brand":
+		return v.Brand
+	case "supplier":
+		return v.Supplier
+	case "barcode":
+		return v.Barcode
+	case "original_price":
+		return v.OriginalPrice.Amount
+	case "retail_price":
+		return v.RetailPrice.Amount
+	case "wholesale_price":
+		return v.WholesalePrice.Amount
+	case "quantity":
+		return v.Quantity
+	case "created_at":
+		return timeValue(v.CreatedAt)
+	case "last_modified_at":
+		return timeValue(v.LastModifiedAt)
+	}
+	return v.ID
+}
+
+func supplierSortKey(s Supplier, field string) any {
+	switch field {
+	case "name":
+		return s.Name
+	case "city":
+		return s.LocatedCity
+	case "country":
+		return s.LocatedCountry
+	case "status":
+		return s.Status
+	case "created_at":
+		return timeValue(s.CreatedAt)
+	}
+	return numericID(s.ID)
+}
+
+// numericID orders the string ids of suppliers and brands the way Postgres
+// orders their SERIAL columns.
+func numericID(id string) int {
+	n, _ := strconv.Atoi(id)
+	return n
+}
+
+func brandSortKey(b Brand, field string) any {
+	switch field {
+	case "name":
+		return b.Name
+	case "country_of_origin":
+		return b.CountryOfOrigin
+	case "created_at":
+		return timeValue(b.CreatedAt)
+	}
+	return numericID(b.ID)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseSort(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    SortSpec
+		wantErr bool
+	}{
+		{raw: "", want: nil},
+		{raw: "  ", want: nil},
+		{raw: "title", want: SortSpec{{Field: "title"}}},
+		{raw: "-last_modified_at,+title", want: SortSpec{{Field: "last_modified_at", Desc: true}, {Field: "title"}}},
+		{raw: " -title , id ", want: SortSpec{{Field: "title", Desc: true}, {Field: "id"}}},
+		{raw: "price", wantErr: true},
+		{raw: "title;DROP TABLE products", wantErr: true},
+		{raw: "title DESC", wantErr: true},
+		{raw: "COALESCE(description, '')", wantErr: true},
+		{raw: "--title", wantErr: true},
+		{raw: "+-title", wantErr: true},
+		{raw: "title,", wantErr: true},
+		{raw: "-", wantErr: true},
+		{raw: "title,-title", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			spec, err := parseSort(tt.raw, productSortFields)
+			if tt.wantErr {
+				var apiErr *APIError
+				if !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadRequest {
+					t.Fatalf("err = %v, want a 400", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(spec, tt.want) {
+				t.Errorf("spec = %v, want %v", spec, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderBy(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    SortSpec
+		allowed sortFields
+		want    string
+	}{
+		{"empty gets the tie-break", nil, productSortFields, " ORDER BY id ASC"},
+		{"tie-break appended", SortSpec{{Field: "title", Desc: true}}, productSortFields, " ORDER BY title DESC, id ASC"},
+		{"id already there", SortSpec{{Field: "id", Desc: true}, {Field: "title"}}, productSortFields, " ORDER BY id DESC, title ASC"},
+		{"nullable column", SortSpec{{Field: "retail_price"}}, varianceSortFields, " ORDER BY COALESCE(retail_price, 0) ASC, id ASC"},
+		{"table id", SortSpec{{Field: "name"}}, supplierSortFields, " ORDER BY name ASC, supplier_tb.id ASC"},
+		{"unknown field skipped", SortSpec{{Field: "title; DROP TABLE products"}}, productSortFields, " ORDER BY id ASC"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.spec.orderBy(tt.allowed); got != tt.want {
+				t.Errorf("orderBy = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// withTieBreak must not write the id into the caller's spec.
+func TestWithTieBreakCopies(t *testing.T) {
+	spec := make(SortSpec, 1, 4)
+	spec[0] = SortField{Field: "title"}
+	_ = spec.withTieBreak()
+	if extended := spec[:2]; extended[1].Field != "" {
+		t.Errorf("withTieBreak wrote %v into the caller's backing array", extended)
+	}
+}
+
+func TestSortParamOverHTTP(t *testing.T) {
+	r := newTestAPI(t)
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"sort=-last_modified_at", http.StatusOK},
+		{"sort=title&order=desc", http.StatusOK},
+		{"sort=" + url.QueryEscape("title;DROP TABLE products"), http.StatusBadRequest},
+		{"sort=price", http.StatusBadRequest},
+		{"sort=title&order=sideways", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w, env := serveJSON(t, r, http.MethodGet, "/products?"+tt.query, nil)
+			if w.Code != tt.want {
+				t.Fatalf("GET /products?%s = %d %s, want %d", tt.query, w.Code, w.Body.String(), tt.want)
+			}
+			if tt.want == http.StatusBadRequest && env.Error.Code != CodeBadRequest {
+				t.Errorf("error code = %s, want %s", env.Error.Code, CodeBadRequest)
+			}
+		})
+	}
+}
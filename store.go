@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+//! ============================================================================ //
+//? ======================== 🗄️ STORE INTERFACES 🗄️ ============================ //
+//! ============================================================================ //
+
+// errNotFound is returned by every store when the requested row does not
+// exist (the Postgres implementation translates sql.ErrNoRows into it).
+var errNotFound = errors.New("not found")
+
+// errConflict is returned when a row with the same unique key already exists
+// (Postgres reports this as a unique_violation instead).
+var errConflict = errors.New("already exists")
+
+type ProductStore interface {
+	InsertProduct(ctx context.Context, p Product) error
+	// UpdateProduct returns errNotFound when no product has p.ID.
+	UpdateProduct(ctx context.Context, p Product) error
+	GetProduct(ctx context.Context, id string) (Product, error)
+	LastProduct(ctx context.Context) (Product, error)
+	// ListProducts orders by opts.Sort, newest first when it is empty.
+	ListProducts(ctx context.Context, opts ListOptions) (Page[Product], error)
+	SearchProducts(ctx context.Context, q ProductSearch) (Page[ProductHit], error)
+	// ProductFacets counts what each filter value of q would yield; see
+	// facets.go.
+	ProductFacets(ctx context.Context, q ProductSearch) (Facets, error)
+	// Suggest returns up to limit product, brand and supplier names similar
+	// to q, best first.
+	Suggest(ctx context.Context, q string, limit int) ([]Suggestion, error)
+}
+
+type VarianceStore interface {
+	// UpsertVariance inserts or updates on (product, variance, brand_name).
+	// An update records the prices it changes in the price history, filled
+	// in from change. With a count it also records the adjustment
+	// CountStock would, all or nothing; the adjustment is nil when stock
+	// already matched.
+	UpsertVariance(ctx context.Context, v Variance, change PriceHistory, count *StockCount) (Variance, *StockMovement, error)
+	LastVariance(ctx context.Context) (Variance, error)
+	// VariancesByProduct orders by opts.Sort, newest id first when it is empty.
+	VariancesByProduct(ctx context.Context, productID string, opts ListOptions) (Page[Variance], error)
+	ListVariances(ctx context.Context) ([]Variance, error)
+	// VariancesByProducts groups the variances of every product in
+	// productIDs by product id, in id order, with one query.
+	VariancesByProducts(ctx context.Context, productIDs []string) (map[string][]Variance, error)
+}
+
+type SupplierStore interface {
+	// UpsertSupplier inserts or updates on name.
+	UpsertSupplier(ctx context.Context, s Supplier) (Supplier, error)
+	// ListSuppliers orders by opts.Sort, by name when it is empty.
+	ListSuppliers(ctx context.Context, opts ListOptions) (Page[Supplier], error)
+	// SuppliersByName returns the suppliers named in names; unknown names
+	// are skipped.
+	SuppliersByName(ctx context.Context, names []string) ([]Supplier, error)
+}
+
+type BrandStore interface {
+	// UpsertBrand inserts or updates on name.
+	UpsertBrand(ctx context.Context, b Brand) (Brand, error)
+	// ListBrands orders by opts.Sort, by name when it is empty.
+	ListBrands(ctx context.Context, opts ListOptions) (Page[Brand], error)
+	// BrandsByName returns the brands named in names; unknown names are
+	// skipped.
+	BrandsByName(ctx context.Context, names []string) ([]Brand, error)
+}
+
+// InventoryStore is the stock ledger; see inventory.go.
+type InventoryStore interface {
+	// RecordMovement appends m and returns it with its id and balance. A zero
+	// m.LocationID is the main building. It returns errNotFound for an
+	// unknown variance, errUnknownLocation for an unknown location and an
+	// INSUFFICIENT_STOCK APIError when on-hand there would drop below zero.
+	RecordMovement(ctx context.Context, m StockMovement) (StockMovement, error)
+	// Transfer records both sides of a transfer atomically, with the same
+	// errors as RecordMovement.
+	Transfer(ctx context.Context, out, in StockMovement) (Transfer, error)
+	// CountStock records the adjustment that brings a variance's on-hand
+	// quantity at m.LocationID to counted, using m for the reason, reference
+	// and author. It returns nil when on-hand already equals counted.
+	CountStock(ctx context.Context, varianceID int, counted float64, m StockMovement) (*StockMovement, error)
+	// ListMovements orders by opts.Sort, newest first when it is empty.
+	ListMovements(ctx context.Context, f MovementFilter, opts ListOptions) (Page[StockMovement], error)
+	StockLevel(ctx context.Context, varianceID int) (StockLevel, error)
+	// StockLevels returns the stock of every variance of a product, by
+	// variance id.
+	StockLevels(ctx context.Context, productID string) ([]StockLevel, error)
+}
+
+// ReservationStore holds stock against the ledger; see reservations.go.
+type ReservationStore interface {
+	// Reserve inserts r, an active reservation, and returns it with its id.
+	// It returns errNotFound for an unknown variance, errUnknownLocation for
+	// an unknown location and an INSUFFICIENT_STOCK APIError when less than
+	// r.Quantity is available there.
+	Reserve(ctx context.Context, r Reservation) (Reservation, error)
+	GetReservation(ctx context.Context, id int) (Reservation, error)
+	// ListReservations orders by opts.Sort, newest first when it is empty.
+	ListReservations(ctx context.Context, f ReservationFilter, opts ListOptions) (Page[Reservation], error)
+	// ConfirmReservation records sale, filled in with the reservation's
+	// variance, location, quantity and reference, and marks the reservation
+	// confirmed, atomically. Confirming it again returns the same sale. A
+	// reservation released or expired instead is a RESERVATION_CLOSED
+	// APIError.
+	ConfirmReservation(ctx context.Context, id int, sale StockMovement) (ReservationSale, error)
+	// ReleaseReservation gives an active reservation's stock back. Releasing
+	// it again returns it unchanged; a reservation confirmed or expired
+	// instead is a RESERVATION_CLOSED APIError.
+	ReleaseReservation(ctx context.Context, id int, now time.Time) (Reservation, error)
+	// ExpireReservations marks active reservations that expired by now and
+	// returns how many there were.
+	ExpireReservations(ctx context.Context, now time.Time) (int, error)
+}
+
+// ReorderStore keeps the reorder rules; see reorder.go.
+type ReorderStore interface {
+	// UpsertReorderRule inserts or updates on variance and location. It
+	// returns errNotFound for an unknown variance and errUnknownLocation for
+	// an unknown location.
+	UpsertReorderRule(ctx context.Context, r ReorderRule) (ReorderRule, error)
+	// ListReorderRules returns a variance's rules, or every rule for 0.
+	ListReorderRules(ctx context.Context, varianceID int) ([]ReorderRule, error)
+	// LowStock lists the rules with stock below their point, largest
+	// shortfall first.
+	LowStock(ctx context.Context, f LowStockFilter) ([]LowStockItem, error)
+	// CheckReorderRules observes the stock watched by a variance's rules for
+	// locationID and its total, saves what changed and returns the alerts
+	// to send. Concurrent checks never raise the same alert twice.
+	CheckReorderRules(ctx context.Context, varianceID, locationID int, now time.Time, cooldown time.Duration) ([]StockAlert, error)
+}
+
+// PurchaseOrderStore keeps purchase orders and their lines; see
+// purchase_orders.go.
+type PurchaseOrderStore interface {
+	// CreatePurchaseOrder inserts a draft, filling in each line's missing
+	// unit cost with the variance's wholesale_price. It returns
+	// errUnknownSupplier, errUnknownVariance or errUnknownLocation for
+	// references that do not exist.
+	CreatePurchaseOrder(ctx context.Context, po PurchaseOrder) (PurchaseOrder, error)
+	// UpdatePurchaseOrder replaces a draft's supplier, location, notes and
+	// lines, with the errors of CreatePurchaseOrder. Orders past draft are an
+	// INVALID_TRANSITION APIError.
+	UpdatePurchaseOrder(ctx context.Context, po PurchaseOrder) (PurchaseOrder, error)
+	GetPurchaseOrder(ctx context.Context, id int) (PurchaseOrder, error)
+	// ListPurchaseOrders orders by opts.Sort, newest first when it is empty.
+	ListPurchaseOrders(ctx context.Context, f PurchaseOrderFilter, opts ListOptions) (Page[PurchaseOrder], error)
+	// SetPurchaseOrderStatus moves an order to status if poTransitions
+	// allows it, and fails with INVALID_TRANSITION otherwise.
+	SetPurchaseOrderStatus(ctx context.Context, id int, status string, now time.Time) (PurchaseOrder, error)
+	// ReceivePurchaseOrder records a delivery atomically: a receipt movement
+	// per line, the received quantities, the new status and any
+	// original_price changes with their price history. Costs are converted
+	// into the base currency at the current rate of the order's currency
+	// before they become original_price; errUnknownCurrency when it has
+	// none. A line for more than is outstanding fails with OVER_RECEIPT.
+	ReceivePurchaseOrder(ctx context.Context, id int, receipt POReceipt) (POReceiptResult, error)
+}
+
+// OrderStore keeps customer orders and their lines; see orders.go.
+type OrderStore interface {
+	// CreateOrder inserts a pending order, capturing each line's price as
+	// ResolvePrice resolves it for the order's customer, converted into the
+	// order's currency (the base currency when it names none) at the
+	// current rate. It returns
+	// errUnknownVariance, errUnknownLocation or errUnknownCurrency for
+	// references that do not exist.
+	CreateOrder(ctx context.Context, o Order) (Order, error)
+	GetOrder(ctx context.Context, id int) (Order, error)
+	// ListOrders orders by opts.Sort, newest first when it is empty.
+	ListOrders(ctx context.Context, f OrderFilter, opts ListOptions) (Page[Order], error)
+	// SetOrderStatus moves an order to status if orderTransitions allows
+	// it, and fails with INVALID_TRANSITION otherwise. It moves no stock.
+	SetOrderStatus(ctx context.Context, id int, status string, now time.Time) (Order, error)
+	// FulfilOrder atomically records a sale movement per line, filled in
+	// from sale, and marks the order fulfilled. A line short of available
+	// stock fails with INSUFFICIENT_STOCK and records nothing.
+	FulfilOrder(ctx context.Context, id int, sale StockMovement) (OrderFulfilment, error)
+}
+
+// ExchangeRateStore keeps the rates from the base currency; see
+// exchange_rates.go.
+type ExchangeRateStore interface {
+	// UpsertExchangeRates inserts or updates rates on currency, all or none.
+	UpsertExchangeRates(ctx context.Context, rates []ExchangeRate) ([]ExchangeRate, error)
+	// ListExchangeRates orders by currency.
+	ListExchangeRates(ctx context.Context) ([]ExchangeRate, error)
+	// ExchangeRate returns a rate of 1 for the base currency and errNotFound
+	// for a currency without a rate.
+	ExchangeRate(ctx context.Context, currency string) (ExchangeRate, error)
+}
+
+// PriceListStore keeps price lists, their tiers and which customers use
+// them; see price_lists.go.
+type PriceListStore interface {
+	// UpsertPriceList inserts or updates on code.
+	UpsertPriceList(ctx context.Context, l PriceList) (PriceList, error)
+	// ListPriceLists orders by code.
+	ListPriceLists(ctx context.Context) ([]PriceList, error)
+	// ListPrices returns the tiers of the list with code, for one variance
+	// or every one for 0, by variance then tier. It returns errNotFound for
+	// an unknown list.
+	ListPrices(ctx context.Context, code string, varianceID int) ([]ListPrice, error)
+	// SetListPrices replaces every tier of the list for a variance,
+	// atomically. It returns errNotFound for an unknown list and
+	// errUnknownVariance for an unknown variance.
+	SetListPrices(ctx context.Context, code string, varianceID int, tiers []ListPrice) ([]ListPrice, error)
+	// AssignPriceList inserts or updates on customer. It returns
+	// errUnknownPriceList for an unknown list.
+	AssignPriceList(ctx context.Context, a CustomerPriceList) (CustomerPriceList, error)
+	// CustomerPriceList returns errNotFound for a customer without a list.
+	CustomerPriceList(ctx context.Context, customer string) (CustomerPriceList, error)
+	UnassignPriceList(ctx context.Context, customer string) error
+	// ResolvePrice prices q with resolvePrice. It returns errNotFound for an
+	// unknown variance and errUnknownPriceList for an unknown q.PriceList.
+	ResolvePrice(ctx context.Context, q PriceQuery) (PriceResolution, error)
+}
+
+// PriceHistoryStore keeps the history of variance prices and the price
+// changes scheduled for later; see price_history.go.
+type PriceHistoryStore interface {
+	// ListPriceHistory orders by opts.Sort, newest first when it is empty.
+	ListPriceHistory(ctx context.Context, f PriceHistoryFilter, opts ListOptions) (Page[PriceHistory], error)
+	// PricesAt returns a variance's prices as they were at at. It returns
+	// errNotFound for an unknown variance.
+	PricesAt(ctx context.Context, varianceID int, at time.Time) (VariancePrices, error)
+	// SchedulePrice inserts sp, a pending change. It returns
+	// errUnknownVariance for an unknown variance.
+	SchedulePrice(ctx context.Context, sp ScheduledPrice) (ScheduledPrice, error)
+	// ListScheduledPrices orders by opts.Sort, newest first when it is empty.
+	ListScheduledPrices(ctx context.Context, f ScheduledPriceFilter, opts ListOptions) (Page[ScheduledPrice], error)
+	// CancelScheduledPrice cancels a pending change and fails with
+	// INVALID_TRANSITION for any other.
+	CancelScheduledPrice(ctx context.Context, id int, now time.Time) (ScheduledPrice, error)
+	// ApplyScheduledPrices applies the pending changes effective by now,
+	// earliest first, each with its price history, and returns how many it
+	// applied. A change the price rules reject is marked failed instead.
+	// Each change is applied on its own: one that errors is left pending
+	// for the next run, and the rest are still applied.
+	ApplyScheduledPrices(ctx context.Context, now time.Time) (int, error)
+}
+
+type LocationStore interface {
+	// UpsertLocation inserts or updates on code.
+	UpsertLocation(ctx context.Context, l Location) (Location, error)
+	// ListLocations orders by opts.Sort, by name when it is empty.
+	ListLocations(ctx context.Context, opts ListOptions) (Page[Location], error)
+}
+
+// Stores is everything the HTTP handlers need; setupRouter takes it so the
+// API can run against Postgres or the in-memory implementation.
+type Stores struct {
+	Products       ProductStore
+	Variances      VarianceStore
+	Suppliers      SupplierStore
+	Brands         BrandStore
+	Inventory      InventoryStore
+	Locations      LocationStore
+	Reservations   ReservationStore
+	Reorder        ReorderStore
+	PurchaseOrders PurchaseOrderStore
+	Orders         OrderStore
+	ExchangeRates  ExchangeRateStore
+	PriceLists     PriceListStore
+	PriceHistory   PriceHistoryStore
+}
+
+// ProductSearch carries the /products/search filters.
+type ProductSearch struct {
+	// Query is the q parameter, matched full-text (search.go) or, with
+	// Fuzzy, by similarity (fuzzy.go).
+	Query             string
+	Fuzzy             bool
+	Title             string
+	LookInDescription bool
+	Departments       []string
+	MainCategories    []string
+	SubCategories     []string
+
+	// The variance filters: a product matches when at least one of its
+	// variances passes all of them. Brands and Suppliers hold names (matched
+	// case-insensitively) or numeric brand/supplier_tb ids.
+	Brands    []string
+	Suppliers []string
+	PriceMin  *Decimal
+	PriceMax  *Decimal
+	InStock   bool
+	Barcode   string
+	// Location only passes variances in stock at a location, given by id or
+	// code.
+	Location string
+
+	Sort SortSpec
+	// After switches to keyset paging; Page is ignored when it is set.
+	After    *Cursor
+	Page     int
+	PageSize int
+}
+
+// filtersVariances reports whether any variance filter applies once the
+// facet named skip is left out.
+func (q ProductSearch) filtersVariances(skip string) bool {
+	return (len(q.Brands) > 0 && skip != facetBrand) ||
+		((q.PriceMin != nil || q.PriceMax != nil) && skip != facetPrice) ||
+		len(q.Suppliers) > 0 || q.InStock || q.Barcode != "" || q.Location != ""
+}
+
+func (q ProductSearch) offset() int {
+	if q.After != nil {
+		return 0
+	}
+	return (q.Page - 1) * q.PageSize
+}
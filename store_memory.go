@@ -0,0 +1,1705 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//! ============================================================================ //
+//? ======================== 🧠 IN-MEMORY STORE 🧠 ============================= //
+//! ============================================================================ //
+
+// memoryStore implements every store interface with plain maps. It backs
+// offline dev mode (STORE=memory) and lets the HTTP API run without Postgres.
+type memoryStore struct {
+	mu sync.RWMutex
+	// pricing holds the base currency and how conversions round.
+	pricing PricingConfig
+
+	products  map[string]Product
+	variances map[int]Variance
+	suppliers map[string]Supplier // keyed by name, the upsert conflict key
+	brands    map[string]Brand    // keyed by name, the upsert conflict key
+	locations map[string]Location // keyed by code, the upsert conflict key
+	movements []StockMovement     // the stock ledger, oldest first
+	stock     map[stockKey]float64
+	// reservations are kept by id, reservations[i] having id i+1
+	reservations []Reservation
+	// reorderRules are keyed by variance and location, 0 for the total
+	reorderRules map[stockKey]ReorderRule
+	// purchaseOrders are kept by id, purchaseOrders[i] having id i+1
+	purchaseOrders []PurchaseOrder
+	// orders are kept by id, orders[i] having id i+1
+	orders []Order
+	rates  map[string]ExchangeRate // keyed by currency
+	// priceLists are keyed by code, customerLists by customer
+	priceLists    map[string]PriceList
+	listPrices    []ListPrice
+	customerLists map[string]CustomerPriceList
+	// priceHistory[i] has id i+1, scheduledPrices likewise
+	priceHistory    []PriceHistory
+	scheduledPrices []ScheduledPrice
+
+	nextVarianceID  int
+	nextSupplierID  int
+	nextBrandID     int
+	nextLocationID  int
+	nextPOLineID    int
+	nextOrderLineID int
+	nextPriceListID int
+	nextListPriceID int
+}
+
+func newMemoryStore(pricing PricingConfig) *memoryStore {
+	now := time.Now()
+	return &memoryStore{
+		pricing:   pricing,
+		products:  map[string]Product{},
+		variances: map[int]Variance{},
+		suppliers: map[string]Supplier{},
+		brands:    map[string]Brand{},
+		// Like migration 0005, start with the main building
+		locations: map[string]Location{
+			defaultLocationCode: {ID: 1, Code: defaultLocationCode, Name: "Main building", Kind: "store", CreatedAt: &now},
+		},
+		stock:        map[stockKey]float64{},
+		reorderRules: map[stockKey]ReorderRule{},
+		rates:        map[string]ExchangeRate{},
+		// Like migration 0012, start with the four standard lists
+		priceLists: map[string]PriceList{
+			defaultPriceListCode: {ID: 1, Code: defaultPriceListCode, Name: "Retail", BasePrice: "retail", CreatedAt: &now},
+			"wholesale":          {ID: 2, Code: "wholesale", Name: "Wholesale", BasePrice: "wholesale", CreatedAt: &now},
+			"contractor":         {ID: 3, Code: "contractor", Name: "Contractor", BasePrice: "retail", CreatedAt: &now},
+			"staff":              {ID: 4, Code: "staff", Name: "Staff", BasePrice: "retail", CreatedAt: &now},
+		},
+		customerLists:   map[string]CustomerPriceList{},
+		nextVarianceID:  1,
+		nextSupplierID:  1,
+		nextBrandID:     1,
+		nextLocationID:  2,
+		nextPOLineID:    1,
+		nextOrderLineID: 1,
+		nextPriceListID: 5,
+		nextListPriceID: 1,
+	}
+}
+
+func (m *memoryStore) stores() Stores {
+	return Stores{Products: m, Variances: m, Suppliers: m, Brands: m, Inventory: m, Locations: m, Reservations: m, Reorder: m, PurchaseOrders: m, Orders: m, ExchangeRates: m, PriceLists: m, PriceHistory: m}
+}
+
+// newer reports whether a was modified after b, treating nil as oldest.
+func newer(a, b *time.Time) bool {
+	if a == nil {
+		return false
+	}
+	if b == nil {
+		return true
+	}
+	return a.After(*b)
+}
+
+//? ----------------------------- products ---------------------------------- //
+
+func (m *memoryStore) InsertProduct(ctx context.Context, p Product) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.products[p.ID]; exists {
+		return fmt.Errorf("product %s: %w", p.ID, errConflict)
+	}
+	m.products[p.ID] = p
+	return nil
+}
+
+func (m *memoryStore) UpdateProduct(ctx context.Context, p Product) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.products[p.ID]
+	if !ok {
+		return errNotFound
+	}
+	p.CreatedAt = existing.CreatedAt
+	m.products[p.ID] = p
+	return nil
+}
+
+func (m *memoryStore) GetProduct(ctx context.Context, id string) (Product, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	p, ok := m.products[id]
+	if !ok {
+		return Product{}, errNotFound
+	}
+	return p, nil
+}
+
+func (m *memoryStore) LastProduct(ctx context.Context) (Product, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var last *Product
+	for _, p := range m.products {
+		if last == nil || newer(p.LastModifiedAt, last.LastModifiedAt) {
+			p := p
+			last = &p
+		}
+	}
+	if last == nil {
+		return Product{}, errNotFound
+	}
+	return *last, nil
+}
+
+func (m *memoryStore) ListProducts(ctx context.Context, opts ListOptions) (Page[Product], error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	products := make([]Product, 0, len(m.products))
+	for _, p := range m.products {
+		products = append(products, p)
+	}
+	return paginate(products, opts, productsNewestFirst, productSortKey)
+}
+
+func (m *memoryStore) SearchProducts(ctx context.Context, q ProductSearch) (Page[ProductHit], error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	byProduct := m.variancesByProduct()
+	match := m.varianceFilter(q, "")
+	var hits []ProductHit
+	for _, p := range m.products {
+		if h, ok := searchHit(p, byProduct[p.ID], q, match, ""); ok {
+			hits = append(hits, h)
+		}
+	}
+
+	total := len(hits)
+	spec := q.Sort.or(productsNewestFirst).withTieBreak()
+	hits, err := after(hits, q.After, spec, hitSortKey)
+	if err != nil {
+		return Page[ProductHit]{}, err
+	}
+	hits = hits[min(q.offset(), len(hits)):]
+	return pageOf(hits, total, q.PageSize, spec, hitSortKey), nil
+}
+
+// searchHit matches p against q, leaving out the filter of the facet named
+// skip like buildSearch does, and scores the match. match is the variance
+// filter from varianceFilter for the same skip.
+func searchHit(p Product, variances []Variance, q ProductSearch, match func(Variance) bool, skip string) (ProductHit, bool) {
+	if title := strings.ToLower(q.Title); title != "" {
+		hit := strings.Contains(strings.ToLower(p.Title), title)
+		if q.LookInDescription {
+			hit = hit || strings.Contains(strings.ToLower(p.Description), title)
+		}
+		if !hit {
+			return ProductHit{}, false
+		}
+	}
+	if (skip != facetDepartment && !matchesAny(p.Department, q.Departments)) ||
+		(skip != facetMainCategory && !matchesAny(p.MainCategory, q.MainCategories)) ||
+		(skip != facetSubCategory && !matchesAny(p.SubCategory, q.SubCategories)) {
+		return ProductHit{}, false
+	}
+
+	h := ProductHit{Product: p}
+	for _, v := range variances {
+		if match(v) {
+			h.VarianceCount++
+		}
+	}
+	if h.VarianceCount == 0 && q.filtersVariances(skip) {
+		return ProductHit{}, false
+	}
+
+	terms := searchTerms(q.Query)
+	if len(terms) > 0 && q.Fuzzy {
+		h.Similarity = wordSimilarity(q.Query, p.Title)
+		for _, v := range variances {
+			h.Similarity = max(h.Similarity, wordSimilarity(q.Query, v.Brand), wordSimilarity(q.Query, v.Supplier))
+		}
+		if h.Similarity < fuzzyThreshold {
+			return ProductHit{}, false
+		}
+	} else if len(terms) > 0 {
+		rank, ok := newSearchDocument(p, variances).rank(terms)
+		if !ok {
+			return ProductHit{}, false
+		}
+		h.Rank = rank
+		h.Snippet = highlight(p.Title+". "+p.Description, terms)
+	}
+	return h, true
+}
+
+// varianceFilter returns the variance filters of q, less the facet named
+// skip, as a predicate. Numeric brand and supplier values are ids and are
+// resolved to names here. Callers must hold m.mu.
+func (m *memoryStore) varianceFilter(q ProductSearch, skip string) func(Variance) bool {
+	// names resolves ids through byID, which maps an id to a name
+	names := func(values []string, byID func(id int) []string) []string {
+		resolved := make([]string, 0, len(values))
+		for _, v := range values {
+			if id, err := strconv.Atoi(v); err == nil {
+				resolved = append(resolved, byID(id)...)
+			} else {
+				resolved = append(resolved, v)
+			}
+		}
+		return resolved
+	}
+	brandName := func(id int) []string {
+		for _, b := range m.brands {
+			if numericID(b.ID) == id {
+				return []string{b.Name}
+			}
+		}
+		return nil
+	}
+	supplierName := func(id int) []string {
+		for _, s := range m.suppliers {
+			if numericID(s.ID) == id {
+				return []string{s.Name}
+			}
+		}
+		return nil
+	}
+	equalFold := func(name string) func(string) bool {
+		return func(s string) bool { return strings.EqualFold(s, name) }
+	}
+
+	var brands, suppliers []string
+	if len(q.Brands) > 0 && skip != facetBrand {
+		brands = names(q.Brands, brandName)
+	}
+	if len(q.Suppliers) > 0 {
+		suppliers = names(q.Suppliers, supplierName)
+	}
+	return func(v Variance) bool {
+		if brands != nil && !slices.ContainsFunc(brands, equalFold(v.Brand)) {
+			return false
+		}
+		if suppliers != nil && !slices.ContainsFunc(suppliers, equalFold(v.Supplier)) {
+			return false
+		}
+		if skip != facetPrice {
+			if (q.PriceMin != nil && v.RetailPrice.Amount.Cmp(*q.PriceMin) < 0) || (q.PriceMax != nil && v.RetailPrice.Amount.Cmp(*q.PriceMax) > 0) {
+				return false
+			}
+		}
+		if q.InStock && v.Quantity <= 0 {
+			return false
+		}
+		if q.Location != "" && !m.inStockAt(v, q.Location) {
+			return false
+		}
+		return q.Barcode == "" || v.Barcode == q.Barcode
+	}
+}
+
+// variancesByProduct groups the variances by product id. Callers must hold
+// m.mu.
+func (m *memoryStore) variancesByProduct() map[string][]Variance {
+	byProduct := map[string][]Variance{}
+	for _, v := range m.variances {
+		byProduct[v.ProductID] = append(byProduct[v.ProductID], v)
+	}
+	return byProduct
+}
+
+func (m *memoryStore) ProductFacets(ctx context.Context, q ProductSearch) (Facets, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	byProduct := m.variancesByProduct()
+	matching := func(facet string) []Product {
+		var products []Product
+		match := m.varianceFilter(q, facet)
+		for _, p := range m.products {
+			if _, ok := searchHit(p, byProduct[p.ID], q, match, facet); ok {
+				products = append(products, p)
+			}
+		}
+		return products
+	}
+	count := func(facet string, value func(Product) string) []FacetBucket {
+		counts := map[string]int{}
+		for _, p := range matching(facet) {
+			counts[value(p)]++
+		}
+		return facetBuckets(counts)
+	}
+
+	f := Facets{
+		Department:   count(facetDepartment, func(p Product) string { return p.Department }),
+		MainCategory: count(facetMainCategory, func(p Product) string { return p.MainCategory }),
+		SubCategory:  count(facetSubCategory, func(p Product) string { return p.SubCategory }),
+	}
+
+	// Brands and prices only count the variances passing the other variance
+	// filters.
+	brands := map[string]int{}
+	brandMatch := m.varianceFilter(q, facetBrand)
+	for _, p := range matching(facetBrand) {
+		seen := map[string]bool{}
+		for _, v := range byProduct[p.ID] {
+			if v.Brand != "" && !seen[v.Brand] && brandMatch(v) {
+				seen[v.Brand] = true
+				brands[v.Brand]++
+			}
+		}
+	}
+	f.Brand = facetBuckets(brands)
+
+	var prices []Decimal
+	priceMatch := m.varianceFilter(q, facetPrice)
+	for _, p := range matching(facetPrice) {
+		for _, v := range byProduct[p.ID] {
+			if priceMatch(v) {
+				prices = append(prices, v.RetailPrice.Amount)
+			}
+		}
+	}
+	f.Price = []PriceBucket{}
+	if len(prices) > 0 {
+		byAmount := func(a, b Decimal) int { return a.Cmp(b) }
+		width := priceBucketWidth(slices.MinFunc(prices, byAmount), slices.MaxFunc(prices, byAmount))
+		counts := map[int]int{}
+		for _, price := range prices {
+			counts[priceBucket(price, width)]++
+		}
+		f.Price = priceHistogram(counts, width)
+	}
+	return f, nil
+}
+
+func (m *memoryStore) Suggest(ctx context.Context, q string, limit int) ([]Suggestion, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var suggestions []Suggestion
+	consider := func(text, kind string) {
+		if score := wordSimilarity(q, text); score >= suggestThreshold {
+			suggestions = append(suggestions, Suggestion{Text: text, Kind: kind, Similarity: score})
+		}
+	}
+	for _, p := range m.products {
+		consider(p.Title, "product")
+	}
+	for name := range m.brands {
+		consider(name, "brand")
+	}
+	for name := range m.suppliers {
+		consider(name, "supplier")
+	}
+	return bestSuggestions(suggestions, limit), nil
+}
+
+// paginate sorts items and cuts out the page opts asks for, the in-memory
+// counterpart of orderBy, keyset and limitClause.
+func paginate[T any](items []T, opts ListOptions, fallback SortSpec, key func(T, string) any) (Page[T], error) {
+	total := len(items)
+	spec := opts.Sort.or(fallback).withTieBreak()
+	items, err := after(items, opts.After, spec, key)
+	if err != nil {
+		return Page[T]{}, err
+	}
+	return pageOf(items, total, opts.Limit, spec, key), nil
+}
+
+// after sorts items by spec and drops those up to and including cursor.
+func after[T any](items []T, cursor *Cursor, spec SortSpec, key func(T, string) any) ([]T, error) {
+	sortItems(items, spec, key)
+	if cursor == nil {
+		return items, nil
+	}
+	values, err := cursor.valuesFor(spec)
+	if err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(items, func(item T) bool {
+		return compareSortValues(sortValues(item, spec, key), values, spec) > 0
+	})
+	if i < 0 {
+		return nil, nil
+	}
+	return items[i:], nil
+}
+
+// matchesAny mirrors the SQL "column IN (...)" filters; an empty list matches.
+func matchesAny(value string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
+
+//? ----------------------------- variances --------------------------------- //
+
+func (m *memoryStore) UpsertVariance(ctx context.Context, v Variance, change PriceHistory, count *StockCount) (Variance, *StockMovement, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// The count can then only fail before anything changed
+	if count != nil {
+		if _, ok := m.location(count.Movement.LocationID); !ok {
+			return Variance{}, nil, errUnknownLocation(count.Movement.LocationID)
+		}
+	}
+	v = m.upsertVariance(v, change)
+	if count == nil {
+		return v, nil, nil
+	}
+	adjustment, err := m.countStock(v.ID, count.Quantity, count.Movement)
+	if err != nil {
+		return Variance{}, nil, err
+	}
+	return m.variances[v.ID], adjustment, nil
+}
+
+// upsertVariance is UpsertVariance without a count. Callers must hold m.mu.
+func (m *memoryStore) upsertVariance(v Variance, change PriceHistory) Variance {
+	v.priced(m.pricing.Currency)
+	for id, existing := range m.variances {
+		if existing.ProductName == v.ProductName && existing.VarianceTitle == v.VarianceTitle && existing.Brand == v.Brand {
+			v.ID = id
+			v.ProductID = existing.ProductID
+			v.CreatedAt = existing.CreatedAt
+			v.Quantity = existing.Quantity
+			m.variances[id] = v
+			m.recordPrices(change.changes(existing, v))
+			return v
+		}
+	}
+
+	// Stock only changes through the ledger
+	v.Quantity = 0
+	v.ID = m.nextVarianceID
+	m.nextVarianceID++
+	m.variances[v.ID] = v
+	return v
+}
+
+func (m *memoryStore) LastVariance(ctx context.Context) (Variance, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var last *Variance
+	for _, v := range m.variances {
+		if last == nil || newer(v.LastModifiedAt, last.LastModifiedAt) {
+			v := v
+			last = &v
+		}
+	}
+	if last == nil {
+		return Variance{}, errNotFound
+	}
+	return *last, nil
+}
+
+func (m *memoryStore) VariancesByProduct(ctx context.Context, productID string, opts ListOptions) (Page[Variance], error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var variances []Variance
+	for _, v := range m.variances {
+		if v.ProductID == productID {
+			variances = append(variances, v)
+		}
+	}
+	return paginate(variances, opts, variancesNewestFirst, varianceSortKey)
+}
+
+func (m *memoryStore) ListVariances(ctx context.Context) ([]Variance, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	variances := make([]Variance, 0, len(m.variances))
+	for _, v := range m.variances {
+		variances = append(variances, v)
+	}
+	sortItems(variances, SortSpec{{Field: "id"}}, varianceSortKey)
+	return variances, nil
+}
+
+func (m *memoryStore) VariancesByProducts(ctx context.Context, productIDs []string) (map[string][]Variance, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	byProduct := map[string][]Variance{}
+	for _, v := range m.variances {
+		if slices.Contains(productIDs, v.ProductID) {
+			byProduct[v.ProductID] = append(byProduct[v.ProductID], v)
+		}
+	}
+	for _, variances := range byProduct {
+		sortItems(variances, SortSpec{{Field: "id"}}, varianceSortKey)
+	}
+	return byProduct, nil
+}
+
+//? ----------------------------- suppliers --------------------------------- //
+
+func (m *memoryStore) UpsertSupplier(ctx context.Context, s Supplier) (Supplier, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.suppliers[s.Name]; ok {
+		s.ID = existing.ID
+		s.CreatedAt = existing.CreatedAt
+	} else {
+		s.ID = strconv.Itoa(m.nextSupplierID)
+		m.nextSupplierID++
+	}
+	m.suppliers[s.Name] = s
+	return s, nil
+}
+
+func (m *memoryStore) ListSuppliers(ctx context.Context, opts ListOptions) (Page[Supplier], error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	suppliers := make([]Supplier, 0, len(m.suppliers))
+	for _, s := range m.suppliers {
+		suppliers = append(suppliers, s)
+	}
+	return paginate(suppliers, opts, byName, supplierSortKey)
+}
+
+func (m *memoryStore) SuppliersByName(ctx context.Context, names []string) ([]Supplier, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var suppliers []Supplier
+	for _, name := range names {
+		if s, ok := m.suppliers[name]; ok {
+			suppliers = append(suppliers, s)
+		}
+	}
+	sortItems(suppliers, byName, supplierSortKey)
+	return suppliers, nil
+}
+
+//? ------------------------------- brands ---------------------------------- //
+
+func (m *memoryStore) UpsertBrand(ctx context.Context, b Brand) (Brand, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.brands[b.Name]; ok {
+		b.ID = existing.ID
+		b.CreatedAt = existing.CreatedAt
+	} else {
+		b.ID = strconv.Itoa(m.nextBrandID)
+		m.nextBrandID++
+	}
+	m.brands[b.Name] = b
+	return b, nil
+}
+
+func (m *memoryStore) ListBrands(ctx context.Context, opts ListOptions) (Page[Brand], error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	brands := make([]Brand, 0, len(m.brands))
+	for _, b := range m.brands {
+		brands = append(brands, b)
+	}
+	return paginate(brands, opts, byName, brandSortKey)
+}
+
+func (m *memoryStore) BrandsByName(ctx context.Context, names []string) ([]Brand, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var brands []Brand
+	for _, name := range names {
+		if b, ok := m.brands[name]; ok {
+			brands = append(brands, b)
+		}
+	}
+	sortItems(brands, byName, brandSortKey)
+	return brands, nil
+}
+
+//? ----------------------------- inventory --------------------------------- //
+
+// stockKey addresses the stock of a variance at a location.
+type stockKey struct {
+	varianceID, locationID int
+}
+
+func (m *memoryStore) RecordMovement(ctx context.Context, mv StockMovement) (StockMovement, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.appendMovement(mv)
+}
+
+func (m *memoryStore) Transfer(ctx context.Context, out, in StockMovement) (Transfer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Check both sides first so a failing one leaves nothing behind
+	for _, mv := range []StockMovement{out, in} {
+		if _, err := m.onHand(mv.VarianceID, mv.LocationID); err != nil {
+			return Transfer{}, err
+		}
+	}
+	var t Transfer
+	var err error
+	if t.Out, err = m.appendMovement(out); err != nil {
+		return t, err
+	}
+	t.In, err = m.appendMovement(in)
+	return t, err
+}
+
+func (m *memoryStore) CountStock(ctx context.Context, varianceID int, counted float64, mv StockMovement) (*StockMovement, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.countStock(varianceID, counted, mv)
+}
+
+// countStock is CountStock. Callers must hold m.mu.
+func (m *memoryStore) countStock(varianceID int, counted float64, mv StockMovement) (*StockMovement, error) {
+	mv.VarianceID = varianceID
+	onHand, err := m.onHand(varianceID, mv.LocationID)
+	if err != nil || onHand == counted {
+		return nil, err
+	}
+	mv.Kind, mv.Quantity = movementAdjustment, counted-onHand
+	mv, err = m.appendMovement(mv)
+	if err != nil {
+		return nil, err
+	}
+	return &mv, nil
+}
+
+// onHand returns a variance's stock at a location, resolving a zero
+// locationID to the main building. Callers must hold m.mu.
+func (m *memoryStore) onHand(varianceID, locationID int) (float64, error) {
+	if _, ok := m.variances[varianceID]; !ok {
+		return 0, errNotFound
+	}
+	l, ok := m.location(locationID)
+	if !ok {
+		return 0, errUnknownLocation(locationID)
+	}
+	return m.stock[stockKey{varianceID, l.ID}], nil
+}
+
+// location finds a location by id, 0 being the main building. Callers must
+// hold m.mu.
+func (m *memoryStore) location(id int) (Location, bool) {
+	if id == 0 {
+		l, ok := m.locations[defaultLocationCode]
+		return l, ok
+	}
+	for _, l := range m.locations {
+		if l.ID == id {
+			return l, true
+		}
+	}
+	return Location{}, false
+}
+
+// appendMovement adds mv to the ledger and updates the cached quantities.
+// Callers must hold m.mu for writing.
+func (m *memoryStore) appendMovement(mv StockMovement) (StockMovement, error) {
+	onHand, err := m.onHand(mv.VarianceID, mv.LocationID)
+	if err != nil {
+		return mv, err
+	}
+	l, _ := m.location(mv.LocationID)
+	available := onHand
+	if takesAvailable(mv) {
+		available -= m.reserved(mv.VarianceID, l.ID, time.Now())
+	}
+	if available+mv.Quantity < 0 {
+		return mv, errInsufficientStock(mv.VarianceID, available, mv.Quantity)
+	}
+	mv.LocationID, mv.BalanceAfter = l.ID, onHand+mv.Quantity
+	mv.ID = len(m.movements) + 1
+	if mv.CreatedAt == nil {
+		now := time.Now()
+		mv.CreatedAt = &now
+	}
+	m.movements = append(m.movements, mv)
+	m.stock[stockKey{mv.VarianceID, mv.LocationID}] = mv.BalanceAfter
+
+	v := m.variances[mv.VarianceID]
+	v.Quantity += mv.Quantity
+	m.variances[mv.VarianceID] = v
+	return mv, nil
+}
+
+func (m *memoryStore) ListMovements(ctx context.Context, f MovementFilter, opts ListOptions) (Page[StockMovement], error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var movements []StockMovement
+	for _, mv := range m.movements {
+		if (f.VarianceID == 0 || mv.VarianceID == f.VarianceID) &&
+			(f.LocationID == 0 || mv.LocationID == f.LocationID) &&
+			(f.Kind == "" || mv.Kind == f.Kind) &&
+			(f.Reference == "" || mv.Reference == f.Reference) {
+			movements = append(movements, mv)
+		}
+	}
+	return paginate(movements, opts, newestFirst, movementSortKey)
+}
+
+func (m *memoryStore) StockLevel(ctx context.Context, varianceID int) (StockLevel, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	v, ok := m.variances[varianceID]
+	if !ok {
+		return StockLevel{}, errNotFound
+	}
+	return m.stockLevel(v), nil
+}
+
+func (m *memoryStore) StockLevels(ctx context.Context, productID string) ([]StockLevel, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var levels []StockLevel
+	for _, v := range m.variances {
+		if v.ProductID == productID {
+			levels = append(levels, m.stockLevel(v))
+		}
+	}
+	slices.SortFunc(levels, func(a, b StockLevel) int { return a.VarianceID - b.VarianceID })
+	return levels, nil
+}
+
+// stockLevel sums the ledger and reservations for v, per location and in
+// total. Callers must hold m.mu.
+func (m *memoryStore) stockLevel(v Variance) StockLevel {
+	now := time.Now()
+	l := StockLevel{VarianceID: v.ID, ProductID: v.ProductID, Locations: []LocationStock{}}
+	byLocation := map[int]float64{}
+	for _, mv := range m.movements {
+		if mv.VarianceID == v.ID {
+			l.OnHand += mv.Quantity
+			l.LastMovementAt = mv.CreatedAt
+			byLocation[mv.LocationID] += mv.Quantity
+		}
+	}
+	for id, onHand := range byLocation {
+		loc, _ := m.location(id)
+		reserved := m.reserved(v.ID, id, now)
+		l.Reserved += reserved
+		l.Locations = append(l.Locations, LocationStock{LocationID: id, Code: loc.Code, Name: loc.Name,
+			OnHand: onHand, Reserved: reserved, Available: onHand - reserved})
+	}
+	l.Available = l.OnHand - l.Reserved
+	slices.SortFunc(l.Locations, func(a, b LocationStock) int { return a.LocationID - b.LocationID })
+	return l
+}
+
+// inStockAt reports whether variance v has stock at the location named by
+// ref, an id or a code. Callers must hold m.mu.
+func (m *memoryStore) inStockAt(v Variance, ref string) bool {
+	for _, l := range m.locations {
+		if matchesLocation(l, ref) && m.stock[stockKey{v.ID, l.ID}] > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+//? ---------------------------- reservations ------------------------------- //
+
+// reserved sums the reservations holding a variance's stock at a location.
+// Callers must hold m.mu.
+func (m *memoryStore) reserved(varianceID, locationID int, now time.Time) float64 {
+	var total float64
+	for _, r := range m.reservations {
+		if r.VarianceID == varianceID && r.LocationID == locationID && r.holds(now) {
+			total += r.Quantity
+		}
+	}
+	return total
+}
+
+// reservation finds a reservation by id. Callers must hold m.mu.
+func (m *memoryStore) reservation(id int) (*Reservation, error) {
+	if id < 1 || id > len(m.reservations) {
+		return nil, errNotFound
+	}
+	return &m.reservations[id-1], nil
+}
+
+func (m *memoryStore) Reserve(ctx context.Context, r Reservation) (Reservation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	onHand, err := m.onHand(r.VarianceID, r.LocationID)
+	if err != nil {
+		return r, err
+	}
+	l, _ := m.location(r.LocationID)
+	available := onHand - m.reserved(r.VarianceID, l.ID, time.Now())
+	if available < r.Quantity {
+		return r, errInsufficientStock(r.VarianceID, available, -r.Quantity)
+	}
+	r.ID, r.LocationID = len(m.reservations)+1, l.ID
+	m.reservations = append(m.reservations, r)
+	return r, nil
+}
+
+func (m *memoryStore) GetReservation(ctx context.Context, id int) (Reservation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	r, err := m.reservation(id)
+	if err != nil {
+		return Reservation{}, err
+	}
+	found := *r
+	found.Status = effectiveStatus(found, time.Now())
+	return found, nil
+}
+
+func (m *memoryStore) ListReservations(ctx context.Context, f ReservationFilter, opts ListOptions) (Page[Reservation], error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	var reservations []Reservation
+	for _, r := range m.reservations {
+		r.Status = effectiveStatus(r, now)
+		if (f.VarianceID == 0 || r.VarianceID == f.VarianceID) &&
+			(f.LocationID == 0 || r.LocationID == f.LocationID) &&
+			(f.Status == "" || r.Status == f.Status) &&
+			(f.Reference == "" || r.Reference == f.Reference) {
+			reservations = append(reservations, r)
+		}
+	}
+	return paginate(reservations, opts, newestFirst, reservationSortKey)
+}
+
+func (m *memoryStore) ConfirmReservation(ctx context.Context, id int, sale StockMovement) (ReservationSale, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, err := m.reservation(id)
+	if err != nil {
+		return ReservationSale{}, err
+	}
+	if r.Status == reservationConfirmed && r.MovementID != nil {
+		return ReservationSale{Reservation: *r, Movement: m.movements[*r.MovementID-1]}, nil
+	}
+	if !r.holds(time.Now()) {
+		closed := *r
+		closed.Status = effectiveStatus(closed, time.Now())
+		return ReservationSale{}, errReservationClosed(closed)
+	}
+
+	// Stop holding the stock first, or the sale could not take it
+	r.Status = reservationConfirmed
+	sale.VarianceID, sale.LocationID, sale.Quantity, sale.Reference = r.VarianceID, r.LocationID, -r.Quantity, saleReference(*r)
+	if sale, err = m.appendMovement(sale); err != nil {
+		r.Status = reservationActive
+		return ReservationSale{}, err
+	}
+	r.MovementID, r.UpdatedAt = &sale.ID, sale.CreatedAt
+	return ReservationSale{Reservation: *r, Movement: sale}, nil
+}
+
+func (m *memoryStore) ReleaseReservation(ctx context.Context, id int, now time.Time) (Reservation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, err := m.reservation(id)
+	if err != nil {
+		return Reservation{}, err
+	}
+	if r.Status == reservationReleased {
+		return *r, nil
+	}
+	if !r.holds(now) {
+		closed := *r
+		closed.Status = effectiveStatus(closed, now)
+		return Reservation{}, errReservationClosed(closed)
+	}
+	r.Status, r.UpdatedAt = reservationReleased, &now
+	return *r, nil
+}
+
+func (m *memoryStore) ExpireReservations(ctx context.Context, now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expired := 0
+	for i, r := range m.reservations {
+		if r.Status == reservationActive && !r.holds(now) {
+			m.reservations[i].Status, m.reservations[i].UpdatedAt = reservationExpired, &now
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+//? ---------------------------- reorder rules ------------------------------ //
+
+func (m *memoryStore) UpsertReorderRule(ctx context.Context, r ReorderRule) (ReorderRule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.variances[r.VarianceID]; !ok {
+		return r, errNotFound
+	}
+	if _, ok := m.location(r.LocationID); r.LocationID != 0 && !ok {
+		return r, errUnknownLocation(r.LocationID)
+	}
+	key := stockKey{r.VarianceID, r.LocationID}
+	if existing, ok := m.reorderRules[key]; ok {
+		r.ID, r.Low, r.AlertedAt = existing.ID, existing.Low, existing.AlertedAt
+	} else {
+		r.ID = len(m.reorderRules) + 1
+	}
+	m.reorderRules[key] = r
+	return r, nil
+}
+
+func (m *memoryStore) ListReorderRules(ctx context.Context, varianceID int) ([]ReorderRule, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var rules []ReorderRule
+	for _, r := range m.reorderRules {
+		if varianceID == 0 || r.VarianceID == varianceID {
+			rules = append(rules, r)
+		}
+	}
+	slices.SortFunc(rules, func(a, b ReorderRule) int {
+		if a.VarianceID != b.VarianceID {
+			return a.VarianceID - b.VarianceID
+		}
+		return a.LocationID - b.LocationID
+	})
+	return rules, nil
+}
+
+// watched pairs r with the stock it watches. Callers must hold m.mu.
+func (m *memoryStore) watched(r ReorderRule) LowStockItem {
+	v := m.variances[r.VarianceID]
+	if r.LocationID == 0 {
+		return lowStockItem(r, v.ProductID, "", v.Quantity)
+	}
+	l, _ := m.location(r.LocationID)
+	return lowStockItem(r, v.ProductID, l.Code, m.stock[stockKey{r.VarianceID, r.LocationID}])
+}
+
+func (m *memoryStore) LowStock(ctx context.Context, f LowStockFilter) ([]LowStockItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var items []LowStockItem
+	for _, r := range m.reorderRules {
+		item := m.watched(r)
+		if item.OnHand < item.ReorderPoint &&
+			(f.ProductID == "" || item.ProductID == f.ProductID) &&
+			(f.LocationID == 0 || item.LocationID == f.LocationID) {
+			items = append(items, item)
+		}
+	}
+	slices.SortFunc(items, func(a, b LowStockItem) int {
+		if c := cmp.Compare(b.Shortfall, a.Shortfall); c != 0 {
+			return c
+		}
+		if a.VarianceID != b.VarianceID {
+			return a.VarianceID - b.VarianceID
+		}
+		return a.LocationID - b.LocationID
+	})
+	return items, nil
+}
+
+func (m *memoryStore) CheckReorderRules(ctx context.Context, varianceID, locationID int, now time.Time, cooldown time.Duration) ([]StockAlert, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var alerts []StockAlert
+	for _, key := range []stockKey{{varianceID, 0}, {varianceID, locationID}} {
+		r, ok := m.reorderRules[key]
+		if !ok {
+			continue
+		}
+		item := m.watched(r)
+		changed, alert := r.observe(item.OnHand, now, cooldown)
+		if changed {
+			m.reorderRules[key] = r
+		}
+		if alert {
+			item.ReorderRule = r
+			alerts = append(alerts, item.alert(now))
+		}
+		if locationID == 0 {
+			break
+		}
+	}
+	return alerts, nil
+}
+
+//? --------------------------- purchase orders ----------------------------- //
+
+// supplierByID finds a supplier by its numeric id. Callers must hold m.mu.
+func (m *memoryStore) supplierByID(id int) (Supplier, bool) {
+	for _, supplier := range m.suppliers {
+		if supplier.ID == strconv.Itoa(id) {
+			return supplier, true
+		}
+	}
+	return Supplier{}, false
+}
+
+// resolvePurchaseOrder checks what po refers to and fills in its supplier
+// name, location, line ids, missing unit costs and total. Callers must hold
+// m.mu for writing.
+func (m *memoryStore) resolvePurchaseOrder(po *PurchaseOrder) error {
+	supplier, ok := m.supplierByID(po.SupplierID)
+	if !ok {
+		return errUnknownSupplier(po.SupplierID)
+	}
+	l, ok := m.location(po.LocationID)
+	if !ok {
+		return errUnknownLocation(po.LocationID)
+	}
+	po.SupplierName, po.LocationID, po.Currency = supplier.Name, l.ID, m.pricing.Currency
+
+	po.Lines = slices.Clone(po.Lines)
+	for i := range po.Lines {
+		line := &po.Lines[i]
+		v, ok := m.variances[line.VarianceID]
+		if !ok {
+			return errUnknownVariance(line.VarianceID)
+		}
+		cost := v.WholesalePrice
+		if line.UnitCost != nil {
+			cost = line.UnitCost.price(po.Currency)
+		}
+		line.UnitCost = &cost
+	}
+	for i := range po.Lines {
+		po.Lines[i].ID = m.nextPOLineID
+		m.nextPOLineID++
+	}
+	var err error
+	po.Total, err = po.totalCost()
+	return err
+}
+
+// purchaseOrder returns a copy of the order with id, safe to change. Callers
+// must hold m.mu.
+func (m *memoryStore) purchaseOrder(id int) (PurchaseOrder, error) {
+	if id < 1 || id > len(m.purchaseOrders) {
+		return PurchaseOrder{}, errNotFound
+	}
+	po := m.purchaseOrders[id-1]
+	po.Lines = slices.Clone(po.Lines)
+	return po, nil
+}
+
+func (m *memoryStore) CreatePurchaseOrder(ctx context.Context, po PurchaseOrder) (PurchaseOrder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.resolvePurchaseOrder(&po); err != nil {
+		return po, err
+	}
+	po.ID = len(m.purchaseOrders) + 1
+	m.purchaseOrders = append(m.purchaseOrders, po)
+	return m.purchaseOrder(po.ID)
+}
+
+func (m *memoryStore) UpdatePurchaseOrder(ctx context.Context, po PurchaseOrder) (PurchaseOrder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, err := m.purchaseOrder(po.ID)
+	if err != nil {
+		return po, err
+	}
+	if existing.Status != poDraft {
+		return po, errNotDraft(existing)
+	}
+	if err := m.resolvePurchaseOrder(&po); err != nil {
+		return po, err
+	}
+	po.CreatedBy, po.CreatedAt = existing.CreatedBy, existing.CreatedAt
+	m.purchaseOrders[po.ID-1] = po
+	return m.purchaseOrder(po.ID)
+}
+
+func (m *memoryStore) GetPurchaseOrder(ctx context.Context, id int) (PurchaseOrder, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.purchaseOrder(id)
+}
+
+func (m *memoryStore) ListPurchaseOrders(ctx context.Context, f PurchaseOrderFilter, opts ListOptions) (Page[PurchaseOrder], error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var orders []PurchaseOrder
+	for _, po := range m.purchaseOrders {
+		if (f.SupplierID == 0 || po.SupplierID == f.SupplierID) && (f.Status == "" || po.Status == f.Status) {
+			po.Lines = slices.Clone(po.Lines)
+			orders = append(orders, po)
+		}
+	}
+	return paginate(orders, opts, newestFirst, purchaseOrderSortKey)
+}
+
+func (m *memoryStore) SetPurchaseOrderStatus(ctx context.Context, id int, status string, now time.Time) (PurchaseOrder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	po, err := m.purchaseOrder(id)
+	if err != nil {
+		return po, err
+	}
+	if err := checkTransition(po, status); err != nil {
+		return po, err
+	}
+	po.Status, po.UpdatedAt = status, &now
+	m.purchaseOrders[id-1] = po
+	return m.purchaseOrder(id)
+}
+
+func (m *memoryStore) ReceivePurchaseOrder(ctx context.Context, id int, receipt POReceipt) (POReceiptResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := POReceiptResult{Movements: []StockMovement{}, PriceChanges: []PriceChange{}}
+	po, err := m.purchaseOrder(id)
+	if err != nil {
+		return result, err
+	}
+	if err := checkTransition(po, poReceived); err != nil {
+		return result, err
+	}
+	rate, ok := m.exchangeRate(po.Currency)
+	if !ok {
+		return result, errUnknownCurrency(po.Currency)
+	}
+	// Check every line first so a failing one leaves nothing behind
+	for _, line := range receipt.Lines {
+		if _, err := receiptLine(po, line); err != nil {
+			return result, err
+		}
+	}
+
+	for _, line := range receipt.Lines {
+		l, _ := receiptLine(po, line)
+		mv, err := m.appendMovement(receipt.receiptMovement(po, line))
+		if err != nil {
+			return result, err
+		}
+		result.Movements = append(result.Movements, mv)
+		l.Received += line.Quantity
+
+		cost := *l.UnitCost
+		if line.UnitCost != nil {
+			cost = line.UnitCost.price(po.Currency)
+		}
+		cost = rate.base(cost, m.pricing.Currency)
+		if v := m.variances[line.VarianceID]; v.OriginalPrice.Amount.Cmp(cost.Amount) != 0 {
+			change := PriceChange{VarianceID: v.ID, Field: "original_price", From: v.OriginalPrice, To: cost}
+			result.PriceChanges = append(result.PriceChanges, change)
+			m.recordPrices([]PriceHistory{receipt.priceHistory(po, change)})
+			v.OriginalPrice, v.LastModifiedAt = cost, receipt.CreatedAt
+			m.variances[v.ID] = v
+		}
+	}
+	po.Status, po.UpdatedAt = po.receivedStatus(), receipt.CreatedAt
+	m.purchaseOrders[id-1] = po
+	result.Order, err = m.purchaseOrder(id)
+	return result, err
+}
+
+//? ------------------------------- orders ---------------------------------- //
+
+// order returns a copy of the order with id, safe to change. Callers must
+// hold m.mu.
+func (m *memoryStore) order(id int) (Order, error) {
+	if id < 1 || id > len(m.orders) {
+		return Order{}, errNotFound
+	}
+	o := m.orders[id-1]
+	o.Lines = slices.Clone(o.Lines)
+	return o, nil
+}
+
+func (m *memoryStore) CreateOrder(ctx context.Context, o Order) (Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l, ok := m.location(o.LocationID)
+	if !ok {
+		return o, errUnknownLocation(o.LocationID)
+	}
+	o.LocationID = l.ID
+	if o.Currency == "" {
+		o.Currency = m.pricing.Currency
+	}
+	rate, ok := m.exchangeRate(o.Currency)
+	if !ok {
+		return o, errUnknownCurrency(o.Currency)
+	}
+	o.ExchangeRate = rate.Rate
+
+	o.Lines = slices.Clone(o.Lines)
+	for i := range o.Lines {
+		line := &o.Lines[i]
+		if _, ok := m.variances[line.VarianceID]; !ok {
+			return o, errUnknownVariance(line.VarianceID)
+		}
+		res, err := m.resolvePrice(PriceQuery{VarianceID: line.VarianceID, Customer: o.Customer,
+			Quantity: line.Quantity, At: timeValue(o.CreatedAt)})
+		if err != nil {
+			return o, err
+		}
+		o.PriceList = res.PriceList
+		line.price(rate.price(res.UnitPrice, m.pricing.Rounding))
+	}
+	for i := range o.Lines {
+		o.Lines[i].ID = m.nextOrderLineID
+		m.nextOrderLineID++
+	}
+	total, err := o.total()
+	if err != nil {
+		return o, err
+	}
+	o.Total = total
+	o.ID = len(m.orders) + 1
+	m.orders = append(m.orders, o)
+	return m.order(o.ID)
+}
+
+func (m *memoryStore) GetOrder(ctx context.Context, id int) (Order, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.order(id)
+}
+
+func (m *memoryStore) ListOrders(ctx context.Context, f OrderFilter, opts ListOptions) (Page[Order], error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var orders []Order
+	for _, o := range m.orders {
+		if (f.Status == "" || o.Status == f.Status) && (f.Customer == "" || o.Customer == f.Customer) {
+			o.Lines = slices.Clone(o.Lines)
+			orders = append(orders, o)
+		}
+	}
+	return paginate(orders, opts, newestFirst, orderSortKey)
+}
+
+func (m *memoryStore) SetOrderStatus(ctx context.Context, id int, status string, now time.Time) (Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o, err := m.order(id)
+	if err != nil {
+		return o, err
+	}
+	if err := checkOrderTransition(o, status); err != nil {
+		return o, err
+	}
+	o.Status, o.UpdatedAt = status, &now
+	m.orders[id-1] = o
+	return m.order(id)
+}
+
+func (m *memoryStore) FulfilOrder(ctx context.Context, id int, sale StockMovement) (OrderFulfilment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := OrderFulfilment{Movements: []StockMovement{}}
+	o, err := m.order(id)
+	if err != nil {
+		return result, err
+	}
+	if err := checkOrderTransition(o, orderFulfilled); err != nil {
+		return result, err
+	}
+	// Check every line first so a failing one leaves nothing behind. Lines
+	// are for distinct variances, so each is checked against its own stock.
+	now := time.Now()
+	for _, l := range o.Lines {
+		onHand, err := m.onHand(l.VarianceID, o.LocationID)
+		if err != nil {
+			return result, err
+		}
+		if available := onHand - m.reserved(l.VarianceID, o.LocationID, now); available < l.Quantity {
+			return result, errInsufficientStock(l.VarianceID, available, -l.Quantity)
+		}
+	}
+
+	for i, l := range o.Lines {
+		mv, err := m.appendMovement(o.saleMovement(l, sale))
+		if err != nil {
+			return result, err
+		}
+		result.Movements = append(result.Movements, mv)
+		o.Lines[i].MovementID = &mv.ID
+	}
+	o.Status, o.UpdatedAt = orderFulfilled, sale.CreatedAt
+	m.orders[id-1] = o
+	result.Order, err = m.order(id)
+	return result, err
+}
+
+//? ----------------------------- locations --------------------------------- //
+
+func (m *memoryStore) UpsertLocation(ctx context.Context, l Location) (Location, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.locations[l.Code]; ok {
+		l.ID = existing.ID
+		l.CreatedAt = existing.CreatedAt
+	} else {
+		l.ID = m.nextLocationID
+		m.nextLocationID++
+	}
+	m.locations[l.Code] = l
+	return l, nil
+}
+
+func (m *memoryStore) ListLocations(ctx context.Context, opts ListOptions) (Page[Location], error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	locations := make([]Location, 0, len(m.locations))
+	for _, l := range m.locations {
+		locations = append(locations, l)
+	}
+	return paginate(locations, opts, byName, locationSortKey)
+}
+
+//? --------------------------- exchange rates ------------------------------- //
+
+// exchangeRate is the rate into currency, 1 for the base currency. Callers
+// must hold m.mu.
+func (m *memoryStore) exchangeRate(currency string) (ExchangeRate, bool) {
+	if currency == m.pricing.Currency {
+		return baseRate(currency), true
+	}
+	r, ok := m.rates[currency]
+	return r, ok
+}
+
+func (m *memoryStore) UpsertExchangeRates(ctx context.Context, rates []ExchangeRate) ([]ExchangeRate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range rates {
+		m.rates[r.Currency] = r
+	}
+	return slices.Clone(rates), nil
+}
+
+func (m *memoryStore) ListExchangeRates(ctx context.Context) ([]ExchangeRate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rates := make([]ExchangeRate, 0, len(m.rates))
+	for _, r := range m.rates {
+		rates = append(rates, r)
+	}
+	slices.SortFunc(rates, func(a, b ExchangeRate) int { return strings.Compare(a.Currency, b.Currency) })
+	return rates, nil
+}
+
+func (m *memoryStore) ExchangeRate(ctx context.Context, currency string) (ExchangeRate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	r, ok := m.exchangeRate(currency)
+	if !ok {
+		return r, errNotFound
+	}
+	return r, nil
+}
+
+//? ----------------------------- price lists -------------------------------- //
+
+func (m *memoryStore) UpsertPriceList(ctx context.Context, l PriceList) (PriceList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.priceLists[l.Code]; ok {
+		l.ID = existing.ID
+		l.CreatedAt = existing.CreatedAt
+	} else {
+		l.ID = m.nextPriceListID
+		m.nextPriceListID++
+	}
+	m.priceLists[l.Code] = l
+	return l, nil
+}
+
+func (m *memoryStore) ListPriceLists(ctx context.Context) ([]PriceList, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	lists := make([]PriceList, 0, len(m.priceLists))
+	for _, l := range m.priceLists {
+		lists = append(lists, l)
+	}
+	slices.SortFunc(lists, func(a, b PriceList) int { return strings.Compare(a.Code, b.Code) })
+	return lists, nil
+}
+
+// tiers returns the tiers of a list for a variance, or for every variance
+// when varianceID is 0. Callers must hold m.mu.
+func (m *memoryStore) tiers(listID, varianceID int) []ListPrice {
+	tiers := []ListPrice{}
+	for _, p := range m.listPrices {
+		if p.PriceListID == listID && (varianceID == 0 || p.VarianceID == varianceID) {
+			tiers = append(tiers, p)
+		}
+	}
+	sortTiers(tiers)
+	return tiers
+}
+
+func (m *memoryStore) ListPrices(ctx context.Context, code string, varianceID int) ([]ListPrice, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	l, ok := m.priceLists[code]
+	if !ok {
+		return nil, errNotFound
+	}
+	return m.tiers(l.ID, varianceID), nil
+}
+
+func (m *memoryStore) SetListPrices(ctx context.Context, code string, varianceID int, tiers []ListPrice) ([]ListPrice, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l, ok := m.priceLists[code]
+	if !ok {
+		return nil, errNotFound
+	}
+	if _, ok := m.variances[varianceID]; !ok {
+		return nil, errUnknownVariance(varianceID)
+	}
+
+	m.listPrices = slices.DeleteFunc(m.listPrices, func(p ListPrice) bool {
+		return p.PriceListID == l.ID && p.VarianceID == varianceID
+	})
+	for _, p := range tiers {
+		p.ID, p.PriceListID, p.VarianceID = m.nextListPriceID, l.ID, varianceID
+		p.Price, p.Currency = p.Price.price(m.pricing.Currency), m.pricing.Currency
+		m.nextListPriceID++
+		m.listPrices = append(m.listPrices, p)
+	}
+	return m.tiers(l.ID, varianceID), nil
+}
+
+func (m *memoryStore) AssignPriceList(ctx context.Context, a CustomerPriceList) (CustomerPriceList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.priceLists[a.PriceList]; !ok {
+		return a, errUnknownPriceList(a.PriceList)
+	}
+	m.customerLists[a.Customer] = a
+	return a, nil
+}
+
+func (m *memoryStore) CustomerPriceList(ctx context.Context, customer string) (CustomerPriceList, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	a, ok := m.customerLists[customer]
+	if !ok {
+		return a, errNotFound
+	}
+	return a, nil
+}
+
+func (m *memoryStore) UnassignPriceList(ctx context.Context, customer string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.customerLists[customer]; !ok {
+		return errNotFound
+	}
+	delete(m.customerLists, customer)
+	return nil
+}
+
+// resolvePrice is ResolvePrice. Callers must hold m.mu.
+func (m *memoryStore) resolvePrice(q PriceQuery) (PriceResolution, error) {
+	v, ok := m.variances[q.VarianceID]
+	if !ok {
+		return PriceResolution{}, errNotFound
+	}
+	code := q.PriceList
+	if code == "" {
+		code = defaultPriceListCode
+		if a, ok := m.customerLists[q.Customer]; ok {
+			code = a.PriceList
+		}
+	}
+	l, ok := m.priceLists[code]
+	if !ok {
+		return PriceResolution{}, errUnknownPriceList(code)
+	}
+	return resolvePrice(q, v, l, m.tiers(l.ID, v.ID)), nil
+}
+
+func (m *memoryStore) ResolvePrice(ctx context.Context, q PriceQuery) (PriceResolution, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.resolvePrice(q)
+}
+
+//? ---------------------------- price history ------------------------------- //
+
+// recordPrices appends rows to the price history. Callers must hold m.mu.
+func (m *memoryStore) recordPrices(rows []PriceHistory) {
+	for _, h := range rows {
+		h.ID = len(m.priceHistory) + 1
+		h.Currency = m.pricing.Currency
+		if h.ChangedAt == nil {
+			now := time.Now()
+			h.ChangedAt = &now
+		}
+		m.priceHistory = append(m.priceHistory, h)
+	}
+}
+
+func (m *memoryStore) ListPriceHistory(ctx context.Context, f PriceHistoryFilter, opts ListOptions) (Page[PriceHistory], error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var rows []PriceHistory
+	for _, h := range m.priceHistory {
+		if (f.VarianceID == 0 || h.VarianceID == f.VarianceID) &&
+			(f.Field == "" || h.Field == f.Field) &&
+			(f.Source == "" || h.Source == f.Source) &&
+			(f.Since == nil || !h.ChangedAt.Before(*f.Since)) &&
+			(f.Until == nil || h.ChangedAt.Before(*f.Until)) {
+			rows = append(rows, h)
+		}
+	}
+	return paginate(rows, opts, newestFirst, priceHistorySortKey)
+}
+
+func (m *memoryStore) PricesAt(ctx context.Context, varianceID int, at time.Time) (VariancePrices, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	v, ok := m.variances[varianceID]
+	if !ok {
+		return VariancePrices{}, errNotFound
+	}
+	var later []PriceHistory
+	for _, h := range m.priceHistory {
+		if h.VarianceID == varianceID && h.ChangedAt.After(at) {
+			later = append(later, h)
+		}
+	}
+	return pricesAt(v, at, later), nil
+}
+
+func (m *memoryStore) SchedulePrice(ctx context.Context, sp ScheduledPrice) (ScheduledPrice, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.variances[sp.VarianceID]; !ok {
+		return sp, errUnknownVariance(sp.VarianceID)
+	}
+	sp.ID = len(m.scheduledPrices) + 1
+	m.scheduledPrices = append(m.scheduledPrices, sp)
+	return sp, nil
+}
+
+func (m *memoryStore) ListScheduledPrices(ctx context.Context, f ScheduledPriceFilter, opts ListOptions) (Page[ScheduledPrice], error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var changes []ScheduledPrice
+	for _, sp := range m.scheduledPrices {
+		if (f.VarianceID == 0 || sp.VarianceID == f.VarianceID) && (f.Status == "" || sp.Status == f.Status) {
+			changes = append(changes, sp)
+		}
+	}
+	return paginate(changes, opts, newestFirst, scheduledPriceSortKey)
+}
+
+func (m *memoryStore) CancelScheduledPrice(ctx context.Context, id int, now time.Time) (ScheduledPrice, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id < 1 || id > len(m.scheduledPrices) {
+		return ScheduledPrice{}, errNotFound
+	}
+	sp := &m.scheduledPrices[id-1]
+	if sp.Status != schedulePending {
+		return *sp, errScheduleTransition(*sp)
+	}
+	sp.Status, sp.UpdatedAt = scheduleCancelled, &now
+	return *sp, nil
+}
+
+func (m *memoryStore) ApplyScheduledPrices(ctx context.Context, now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var due []*ScheduledPrice
+	for i := range m.scheduledPrices {
+		if sp := &m.scheduledPrices[i]; sp.Status == schedulePending && !sp.EffectiveAt.After(now) {
+			due = append(due, sp)
+		}
+	}
+	slices.SortStableFunc(due, func(a, b *ScheduledPrice) int { return a.EffectiveAt.Compare(*b.EffectiveAt) })
+
+	applied := 0
+	for _, sp := range due {
+		v := m.variances[sp.VarianceID]
+		updated, err := sp.applyTo(v)
+		sp.UpdatedAt = &now
+		if err != nil {
+			sp.Status, sp.Failure = scheduleFailed, err.Error()
+			continue
+		}
+		m.recordPrices(sp.history(now).changes(v, updated))
+		updated.LastModifiedAt = &now
+		m.variances[v.ID] = updated
+		sp.Status = scheduleApplied
+		applied++
+	}
+	return applied, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUpsertVarianceWithCountIsAtomic(t *testing.T) {
+	ctx := context.Background()
+	m := newMemoryStore(defaultConfig().Pricing)
+	v := Variance{ProductName: "Portland Cement", ProductID: "p1", VarianceTitle: "50kg bag", RetailPrice: Money{Amount: newDecimal(1800, 0)}}
+
+	count := &StockCount{Quantity: 5, Movement: StockMovement{Reason: reasonCount, LocationID: 99}}
+	_, _, err := m.UpsertVariance(ctx, v, PriceHistory{}, count)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != CodeForeignKey {
+		t.Fatalf("count at an unknown location: err = %v, want %s", err, CodeForeignKey)
+	}
+	if variances, _ := m.ListVariances(ctx); len(variances) != 0 {
+		t.Fatalf("a failed count left %d variances behind", len(variances))
+	}
+
+	count.Movement.LocationID = 0
+	result, adjustment, err := m.UpsertVariance(ctx, v, PriceHistory{}, count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adjustment == nil || adjustment.Quantity != 5 || result.Quantity != 5 {
+		t.Fatalf("adjustment = %+v, quantity = %v, want 5 of each", adjustment, result.Quantity)
+	}
+	if _, adjustment, _ := m.UpsertVariance(ctx, v, PriceHistory{}, count); adjustment != nil {
+		t.Errorf("counting the same stock again recorded %+v", adjustment)
+	}
+}
+
+// A purchase order keeps the currency it was placed in, so one placed before
+// CURRENCY changed is received at the rate of its own currency.
+func TestReceivePurchaseOrderConvertsCost(t *testing.T) {
+	ctx := context.Background()
+	m := newMemoryStore(defaultConfig().Pricing)
+	if _, err := m.UpsertSupplier(ctx, Supplier{Name: "Acme Traders"}); err != nil {
+		t.Fatal(err)
+	}
+	v, _, err := m.UpsertVariance(ctx, Variance{ProductName: "Portland Cement", ProductID: "p1", VarianceTitle: "50kg bag",
+		WholesalePrice: Money{Amount: newDecimal(1500, 0)}, RetailPrice: Money{Amount: newDecimal(1800, 0)}}, PriceHistory{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	po, err := m.CreatePurchaseOrder(ctx, PurchaseOrder{SupplierID: 1, Status: poDraft, Lines: []PurchaseOrderLine{{VarianceID: v.ID, Quantity: 10}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.SetPurchaseOrderStatus(ctx, po.ID, poSent, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	m.pricing.Currency = "USD"
+	cost := Money{Amount: newDecimal(3000, 0)}
+	receipt := POReceipt{Lines: []POReceiptLine{{VarianceID: v.ID, Quantity: 4, UnitCost: &cost}}}
+	_, err = m.ReceivePurchaseOrder(ctx, po.ID, receipt)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != CodeForeignKey {
+		t.Fatalf("receiving in %s without a rate: err = %v, want %s", po.Currency, err, CodeForeignKey)
+	}
+	if level, _ := m.StockLevel(ctx, v.ID); level.OnHand != 0 {
+		t.Fatalf("a failed receipt left %v on hand", level.OnHand)
+	}
+
+	rate := ExchangeRate{Currency: po.Currency, Rate: newDecimal(300, 0)}
+	if _, err := m.UpsertExchangeRates(ctx, []ExchangeRate{rate}); err != nil {
+		t.Fatal(err)
+	}
+	result, err := m.ReceivePurchaseOrder(ctx, po.ID, receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.PriceChanges) != 1 || result.PriceChanges[0].To.String() != "10.00 USD" {
+		t.Errorf("price changes = %+v, want original_price 10.00 USD", result.PriceChanges)
+	}
+	if got, _ := m.LastVariance(ctx); got.OriginalPrice.Amount.String() != "10.00" {
+		t.Errorf("original_price = %s, want 10.00", got.OriginalPrice)
+	}
+}
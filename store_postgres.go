@@ -0,0 +1,2893 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+//! ============================================================================ //
+//? ======================== 🐘 POSTGRES STORE 🐘 ============================== //
+//! ============================================================================ //
+
+// postgresStore implements every store interface on top of one *sql.DB.
+type postgresStore struct {
+	db *sql.DB
+	// pricing holds the base currency and how conversions round.
+	pricing PricingConfig
+}
+
+func newPostgresStore(db *sql.DB, pricing PricingConfig) *postgresStore {
+	return &postgresStore{db: db, pricing: pricing}
+}
+
+func (s *postgresStore) stores() Stores {
+	return Stores{Products: s, Variances: s, Suppliers: s, Brands: s, Inventory: s, Locations: s, Reservations: s, Reorder: s, PurchaseOrders: s, Orders: s, ExchangeRates: s, PriceLists: s, PriceHistory: s}
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// Use COALESCE to replace NULL values with a default enum value for enum fields
+const productColumns = `
+			id,
+			COALESCE(title, '') AS title,
+			COALESCE(description, '') AS description,
+			COALESCE(tag_one, 'N/A') AS tag_one,
+			COALESCE(tag_two, 'N/A') AS tag_two,
+			COALESCE(imageurl, '') AS imageurl,
+			COALESCE(department, 'mainBuilding') AS department,
+			COALESCE(main_catogory, 'sand') AS main_catogory,
+			COALESCE(sub_catogory, 'N/A') AS sub_catogory,
+			created_at,
+			last_modified_at `
+
+func scanProduct(row rowScanner) (Product, error) {
+	var p Product
+	err := row.Scan(
+		&p.ID, &p.Title, &p.Description, &p.TagOne, &p.TagTwo,
+		&p.ImageURL, &p.Department, &p.MainCategory, &p.SubCategory, &p.CreatedAt, &p.LastModifiedAt,
+	)
+	return p, err
+}
+
+func scanProducts(rows *sql.Rows) ([]Product, error) {
+	defer rows.Close()
+
+	var products []Product
+	for rows.Next() {
+		p, err := scanProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, p)
+	}
+	return products, rows.Err()
+}
+
+// notFound maps sql.ErrNoRows onto the store-level errNotFound.
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return errNotFound
+	}
+	return err
+}
+
+//? ----------------------------- products ---------------------------------- //
+
+func (s *postgresStore) InsertProduct(ctx context.Context, p Product) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO products (id, title, description, tag_one, tag_two, imageurl, department, main_catogory, sub_catogory, created_at, last_modified_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`, p.ID, p.Title, p.Description, p.TagOne, p.TagTwo, p.ImageURL,
+		p.Department, p.MainCategory, p.SubCategory, p.CreatedAt, p.LastModifiedAt)
+	return err
+}
+
+func (s *postgresStore) UpdateProduct(ctx context.Context, p Product) error {
+	query := `
+		UPDATE products
+		SET
+			title = $1,
+			description = $2,
+			tag_one = $3,
+			tag_two = $4,
+			imageurl = $5,
+			department = $6,
+			main_catogory = $7,
+			sub_catogory = $8,
+			last_modified_at = $9
+		WHERE id = $10
+	`
+
+	result, err := s.db.ExecContext(ctx, query,
+		p.Title, p.Description, p.TagOne,
+		p.TagTwo, p.ImageURL, p.Department,
+		p.MainCategory, p.SubCategory, p.LastModifiedAt, p.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+func (s *postgresStore) GetProduct(ctx context.Context, id string) (Product, error) {
+	query := `SELECT ` + productColumns + `
+		FROM products
+		WHERE id = $1
+	`
+	p, err := scanProduct(s.db.QueryRowContext(ctx, query, id))
+	return p, notFound(err)
+}
+
+func (s *postgresStore) LastProduct(ctx context.Context) (Product, error) {
+	// Query to find the last product added
+	query := `SELECT ` + productColumns + `
+		FROM products
+		ORDER BY last_modified_at DESC
+		LIMIT 1
+	`
+	p, err := scanProduct(s.db.QueryRowContext(ctx, query))
+	return p, notFound(err)
+}
+
+func (s *postgresStore) ListProducts(ctx context.Context, opts ListOptions) (Page[Product], error) {
+	var page Page[Product]
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM products`).Scan(&page.Total); err != nil {
+		return page, err
+	}
+
+	spec := opts.Sort.or(productsNewestFirst).withTieBreak()
+	after, args, err := keyset(opts.After, spec, productSortFields, 1)
+	if err != nil {
+		return page, err
+	}
+	query := `SELECT ` + productColumns + `
+		FROM products`
+	if after != "" {
+		query += " WHERE " + after
+	}
+	rows, err := s.db.QueryContext(ctx, query+spec.orderBy(productSortFields)+limitClause(opts.Limit), args...)
+	if err != nil {
+		return page, err
+	}
+	products, err := scanProducts(rows)
+	if err != nil {
+		return page, err
+	}
+	return pageOf(products, page.Total, opts.Limit, spec, productSortKey), nil
+}
+
+// searchSQL is a ProductSearch rendered as SQL over the products table.
+type searchSQL struct {
+	where string
+	args  []any
+	// rank, similarity and snippet are select expressions; constants when q
+	// is empty.
+	rank, similarity, snippet string
+	// varianceMatch is the variance filters as a condition on varianceFrom,
+	// TRUE when there are none.
+	varianceMatch string
+}
+
+// varianceFrom joins each variance to its brand and supplier rows, so the
+// variance filters can name them either way.
+const varianceFrom = `products_variances v
+	LEFT JOIN brand b ON b.name = v.brand_name
+	LEFT JOIN supplier_tb s ON s.name = v.supplier`
+
+// arg adds a query argument and returns its placeholder.
+func (b *searchSQL) arg(v any) string {
+	b.args = append(b.args, v)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+// buildSearch renders q's filters, leaving out the one for the facet named
+// skip ("" keeps them all) so facet counts can ignore their own filter.
+func buildSearch(q ProductSearch, skip string) *searchSQL {
+	b := &searchSQL{where: " WHERE 1=1", rank: "0", similarity: "0", snippet: "''"}
+
+	// in appends "AND column IN ($n, ...)" for a CSV filter like department.
+	in := func(facet, column string, values []string) {
+		if len(values) == 0 || facet == skip {
+			return
+		}
+		placeholders := []string{}
+		for _, v := range values {
+			placeholders = append(placeholders, b.arg(v))
+		}
+		b.where += fmt.Sprintf(" AND %s IN (%s)", column, strings.Join(placeholders, ", "))
+	}
+
+	if q.Title != "" {
+		pattern := b.arg(fmt.Sprintf("%%%s%%", q.Title))
+		if q.LookInDescription {
+			b.where += fmt.Sprintf(" AND (LOWER(title) LIKE LOWER(%[1]s) OR LOWER(description) LIKE LOWER(%[1]s))", pattern)
+		} else {
+			b.where += fmt.Sprintf(" AND LOWER(title) LIKE LOWER(%s)", pattern)
+		}
+	}
+	in(facetDepartment, "department", q.Departments)
+	in(facetMainCategory, "main_catogory", q.MainCategories)
+	in(facetSubCategory, "sub_catogory", q.SubCategories)
+
+	// Brand and the other variance filters live on products_variances; a
+	// product needs one variance passing all of them
+	b.varianceMatch = b.varianceConditions(q, skip)
+	if q.filtersVariances(skip) {
+		b.where += " AND EXISTS (SELECT 1 FROM " + varianceFrom + `
+			WHERE v.product_id = products.id AND ` + b.varianceMatch + ")"
+	}
+
+	// Full-text search; the tsquery placeholder is reused by rank and snippet
+	if terms := searchTerms(q.Query); len(terms) > 0 && !q.Fuzzy {
+		query := fmt.Sprintf("to_tsquery('simple', %s)", b.arg(tsQuery(terms)))
+		b.where += " AND search_vector @@ " + query
+		b.rank = fmt.Sprintf("ts_rank(search_vector, %s)", query)
+		b.snippet = fmt.Sprintf("ts_headline('simple', hits.title || '. ' || hits.description, %s, '%s')", query, headlineOptions)
+	}
+
+	// Fuzzy search; <% is pg_trgm's word similarity operator, which can use
+	// the trigram indexes, and similarity reports the best score it found
+	if q.Fuzzy && strings.TrimSpace(q.Query) != "" {
+		param := b.arg(strings.TrimSpace(q.Query))
+		b.where += fmt.Sprintf(` AND (%[1]s <%% title OR EXISTS (
+			SELECT 1 FROM products_variances v
+			WHERE v.product_id = products.id AND (%[1]s <%% v.brand_name OR %[1]s <%% v.supplier)))`, param)
+		b.similarity = fmt.Sprintf(`GREATEST(word_similarity(%[1]s, title), COALESCE((
+			SELECT MAX(GREATEST(word_similarity(%[1]s, v.brand_name), word_similarity(%[1]s, COALESCE(v.supplier, ''))))
+			FROM products_variances v WHERE v.product_id = products.id), 0))`, param)
+	}
+	return b
+}
+
+// varianceConditions renders the variance filters of q over varianceFrom,
+// leaving out the facet named skip.
+func (b *searchSQL) varianceConditions(q ProductSearch, skip string) string {
+	var conds []string
+
+	// nameOrID matches names case-insensitively, and numeric values by id
+	nameOrID := func(nameColumn, idColumn string, values []string) {
+		var names, ids []string
+		for _, v := range values {
+			if id, err := strconv.Atoi(v); err == nil {
+				ids = append(ids, b.arg(id))
+			} else {
+				names = append(names, "LOWER("+b.arg(v)+")")
+			}
+		}
+		var alternatives []string
+		if len(names) > 0 {
+			alternatives = append(alternatives, fmt.Sprintf("LOWER(%s) IN (%s)", nameColumn, strings.Join(names, ", ")))
+		}
+		if len(ids) > 0 {
+			alternatives = append(alternatives, fmt.Sprintf("%s IN (%s)", idColumn, strings.Join(ids, ", ")))
+		}
+		conds = append(conds, "("+strings.Join(alternatives, " OR ")+")")
+	}
+
+	if len(q.Brands) > 0 && skip != facetBrand {
+		nameOrID("v.brand_name", "b.id", q.Brands)
+	}
+	if len(q.Suppliers) > 0 {
+		nameOrID("v.supplier", "s.id", q.Suppliers)
+	}
+	if skip != facetPrice {
+		if q.PriceMin != nil {
+			conds = append(conds, "COALESCE(v.retail_price, 0) >= "+b.arg(*q.PriceMin))
+		}
+		if q.PriceMax != nil {
+			conds = append(conds, "COALESCE(v.retail_price, 0) <= "+b.arg(*q.PriceMax))
+		}
+	}
+	if q.InStock {
+		conds = append(conds, "COALESCE(v.quantity, 0) > 0")
+	}
+	if q.Barcode != "" {
+		conds = append(conds, "v.barcode = "+b.arg(q.Barcode))
+	}
+	if q.Location != "" {
+		location := b.arg(q.Location)
+		conds = append(conds, `EXISTS (SELECT 1 FROM stock_levels sl JOIN locations l ON l.id = sl.location_id
+			WHERE sl.variance_id = v.id AND sl.quantity > 0 AND (l.code = `+location+` OR l.id::text = `+location+`))`)
+	}
+
+	if len(conds) == 0 {
+		return "TRUE"
+	}
+	return strings.Join(conds, " AND ")
+}
+
+func (s *postgresStore) SearchProducts(ctx context.Context, q ProductSearch) (Page[ProductHit], error) {
+	b := buildSearch(q, "")
+
+	var page Page[ProductHit]
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM products`+b.where, b.args...).Scan(&page.Total); err != nil {
+		return page, err
+	}
+
+	// The filtered rows become a subquery so rank can be sorted and keyed on
+	// like any other column.
+	query := `SELECT hits.*, ` + b.snippet + ` AS snippet
+		FROM (
+			SELECT ` + productColumns + `, ` + b.rank + `::float8 AS rank, ` + b.similarity + `::float8 AS similarity,
+				(SELECT COUNT(*) FROM ` + varianceFrom + `
+				 WHERE v.product_id = products.id AND ` + b.varianceMatch + `) AS variance_count
+			FROM products` + b.where + `
+		) hits`
+
+	// Keyset pagination continues after the cursor instead of skipping rows
+	spec := q.Sort.or(productsNewestFirst).withTieBreak()
+	after, afterArgs, err := keyset(q.After, spec, productSearchSortFields, len(b.args)+1)
+	if err != nil {
+		return page, err
+	}
+	if after != "" {
+		query += " WHERE " + after
+		b.args = append(b.args, afterArgs...)
+	}
+
+	// Sorting; only allow-listed columns end up in the query
+	query += spec.orderBy(productSearchSortFields)
+
+	// Pagination; one extra row tells pageOf whether there is a next page
+	query += fmt.Sprintf(" LIMIT %s OFFSET %s", b.arg(q.PageSize+1), b.arg(q.offset()))
+
+	query = fmt.Sprintf("-- dynamic | arg count: %d\n%s", len(b.args), query)
+
+	rows, err := s.db.QueryContext(ctx, query, b.args...)
+	if err != nil {
+		log.Printf("SQL: %s | ARGS: %#v", query, b.args)
+		return page, err
+	}
+	defer rows.Close()
+
+	var hits []ProductHit
+	for rows.Next() {
+		var h ProductHit
+		err := rows.Scan(
+			&h.ID, &h.Title, &h.Description, &h.TagOne, &h.TagTwo,
+			&h.ImageURL, &h.Department, &h.MainCategory, &h.SubCategory, &h.CreatedAt, &h.LastModifiedAt,
+			&h.Rank, &h.Similarity, &h.VarianceCount, &h.Snippet,
+		)
+		if err != nil {
+			return page, err
+		}
+		hits = append(hits, h)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+	return pageOf(hits, page.Total, q.PageSize, spec, hitSortKey), nil
+}
+
+func (s *postgresStore) ProductFacets(ctx context.Context, q ProductSearch) (Facets, error) {
+	var f Facets
+	var err error
+	if f.Department, err = s.facetCounts(ctx, q, facetDepartment, "COALESCE(department, 'mainBuilding')"); err != nil {
+		return f, err
+	}
+	if f.MainCategory, err = s.facetCounts(ctx, q, facetMainCategory, "COALESCE(main_catogory, 'sand')"); err != nil {
+		return f, err
+	}
+	if f.SubCategory, err = s.facetCounts(ctx, q, facetSubCategory, "COALESCE(sub_catogory, 'N/A')"); err != nil {
+		return f, err
+	}
+	if f.Brand, err = s.brandFacet(ctx, q); err != nil {
+		return f, err
+	}
+	if f.Price, err = s.priceFacet(ctx, q); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+// facetCounts counts matching products per value of a products column.
+func (s *postgresStore) facetCounts(ctx context.Context, q ProductSearch, facet, column string) ([]FacetBucket, error) {
+	b := buildSearch(q, facet)
+	return s.queryFacet(ctx, `SELECT `+column+`, COUNT(*) FROM products`+b.where+` GROUP BY 1`, b.args...)
+}
+
+// brandFacet counts matching products per brand of their variances.
+func (s *postgresStore) brandFacet(ctx context.Context, q ProductSearch) ([]FacetBucket, error) {
+	b := buildSearch(q, facetBrand)
+	return s.queryFacet(ctx, `
+		SELECT v.brand_name, COUNT(DISTINCT v.product_id)
+		FROM `+varianceFrom+`
+		WHERE v.brand_name <> '' AND `+b.varianceMatch+`
+			AND v.product_id IN (SELECT id FROM products`+b.where+`)
+		GROUP BY 1`, b.args...)
+}
+
+func (s *postgresStore) queryFacet(ctx context.Context, query string, args ...any) ([]FacetBucket, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var value string
+		var n int
+		if err := rows.Scan(&value, &n); err != nil {
+			return nil, err
+		}
+		counts[value] = n
+	}
+	return facetBuckets(counts), rows.Err()
+}
+
+// priceFacet buckets the retail prices of the matching products' variances.
+// The first query finds the range so the bucket width can be picked.
+func (s *postgresStore) priceFacet(ctx context.Context, q ProductSearch) ([]PriceBucket, error) {
+	b := buildSearch(q, facetPrice)
+	variances := `FROM ` + varianceFrom + `
+		WHERE v.retail_price IS NOT NULL AND ` + b.varianceMatch + `
+			AND v.product_id IN (SELECT id FROM products` + b.where + `)`
+
+	var n int
+	var lo, hi Decimal
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*), MIN(v.retail_price), MAX(v.retail_price) `+variances, b.args...).Scan(&n, &lo, &hi)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return []PriceBucket{}, nil
+	}
+
+	width := priceBucketWidth(lo, hi)
+	query := `SELECT FLOOR(v.retail_price / ` + b.arg(width) + `::numeric)::int, COUNT(*) ` + variances + ` GROUP BY 1`
+	rows, err := s.db.QueryContext(ctx, query, b.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[int]int{}
+	for rows.Next() {
+		var bucket, n int
+		if err := rows.Scan(&bucket, &n); err != nil {
+			return nil, err
+		}
+		counts[bucket] = n
+	}
+	return priceHistogram(counts, width), rows.Err()
+}
+
+func (s *postgresStore) Suggest(ctx context.Context, q string, limit int) ([]Suggestion, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT text, kind, score FROM (
+			SELECT title AS text, 'product' AS kind, word_similarity($1, title)::float8 AS score FROM products
+			UNION ALL
+			SELECT name, 'brand', word_similarity($1, name)::float8 FROM brand
+			UNION ALL
+			SELECT name, 'supplier', word_similarity($1, name)::float8 FROM supplier_tb
+		) candidates
+		WHERE score >= $2
+		ORDER BY score DESC, text
+		LIMIT $3
+	`, q, suggestThreshold, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var suggestions []Suggestion
+	for rows.Next() {
+		var sg Suggestion
+		if err := rows.Scan(&sg.Text, &sg.Kind, &sg.Similarity); err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, sg)
+	}
+	return suggestions, rows.Err()
+}
+
+//? ----------------------------- variances --------------------------------- //
+
+const varianceColumns = `
+			id,
+			COALESCE(product, '') AS product,
+			product_id,
+			COALESCE(variance_display_title, '') AS variance_display_title,
+			COALESCE(about_this_variance, '') AS about_this_variance,
+			COALESCE(images->>0, '') AS imageurl, -- get first image URL from JSON array
+			COALESCE(variance, '') AS variance,
+			COALESCE(brand_name, '') AS brand,
+			COALESCE(supplier, '') AS supplier,
+			COALESCE(original_price, 0) AS original_price,
+			COALESCE(retail_price, 0) AS retail_price,
+			COALESCE(wholesale_price, 0) AS wholesale_price,
+			COALESCE(quantity, 0) AS quantity,
+			COALESCE(unit_measure, '') AS unit_measure,
+			COALESCE(least_sub_unit_measure, 0) AS least_sub_unit_measure,
+			COALESCE(barcode, '') AS barcode,
+			created_at,
+			last_modified_at `
+
+func (s *postgresStore) scanVariance(row rowScanner) (Variance, error) {
+	var v Variance
+	err := row.Scan(
+		&v.ID, &v.ProductName, &v.ProductID, &v.DisplayTitle,
+		&v.VarianceDescription, &v.ImageUrl, &v.VarianceTitle,
+		&v.Brand, &v.Supplier, &v.OriginalPrice,
+		&v.RetailPrice, &v.WholesalePrice, &v.Quantity,
+		&v.UnitMeasure,
+		&v.LeastSubUnitMeasure, &v.Barcode, &v.CreatedAt, &v.LastModifiedAt,
+	)
+	v.priced(s.pricing.Currency)
+	return v, err
+}
+
+func (s *postgresStore) UpsertVariance(ctx context.Context, v Variance, change PriceHistory, count *StockCount) (Variance, *StockMovement, error) {
+	query := `
+		INSERT INTO products_variances (
+			images, original_price, retail_price, wholesale_price,
+			about_this_variance, variance_display_title, product, variance, brand_name,
+			product_id, supplier, quantity, unit_measure, least_sub_unit_measure, barcode, created_at, last_modified_at
+		) VALUES (
+			$1, $2, $3, $4,
+			$5, $6, $7, $8, $9,
+			$10, $11, 0, $12, $13, $14, $15, $16
+		)
+		ON CONFLICT (product, variance, brand_name)
+		DO UPDATE SET
+			original_price = EXCLUDED.original_price,
+			retail_price = EXCLUDED.retail_price,
+			wholesale_price = EXCLUDED.wholesale_price,
+			about_this_variance = EXCLUDED.about_this_variance,
+			variance_display_title = EXCLUDED.variance_display_title,
+			supplier = EXCLUDED.supplier,
+			unit_measure = EXCLUDED.unit_measure,
+			least_sub_unit_measure = EXCLUDED.least_sub_unit_measure,
+			images = EXCLUDED.images,
+			barcode = EXCLUDED.barcode,
+			last_modified_at = EXCLUDED.last_modified_at
+		RETURNING ` + varianceColumns
+
+	// JSON encode the image URL
+	imageJson, err := json.Marshal([]string{v.ImageUrl})
+	if err != nil {
+		return Variance{}, nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Variance{}, nil, err
+	}
+	defer tx.Rollback()
+
+	// Hold the row an update replaces, so its old prices go into the history
+	old, err := s.scanVariance(tx.QueryRowContext(ctx, `SELECT `+varianceColumns+`
+		FROM products_variances
+		WHERE product = $1 AND variance = $2 AND brand_name = $3
+		FOR UPDATE
+	`, v.ProductName, v.VarianceTitle, v.Brand))
+	exists := err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return Variance{}, nil, err
+	}
+
+	result, err := s.scanVariance(tx.QueryRowContext(ctx,
+		query,
+		string(imageJson), v.OriginalPrice, v.RetailPrice, v.WholesalePrice,
+		v.VarianceDescription, v.DisplayTitle, v.ProductName, v.VarianceTitle, v.Brand,
+		v.ProductID, v.Supplier, v.UnitMeasure, v.LeastSubUnitMeasure, v.Barcode, v.CreatedAt, v.LastModifiedAt,
+	))
+	if err != nil {
+		return Variance{}, nil, err
+	}
+	if exists {
+		if err := recordPrices(ctx, tx, change.changes(old, result)); err != nil {
+			return Variance{}, nil, err
+		}
+	}
+
+	var adjustment *StockMovement
+	if count != nil {
+		if adjustment, err = countStock(ctx, tx, result.ID, count.Quantity, count.Movement); err != nil {
+			return Variance{}, nil, err
+		}
+		if adjustment != nil {
+			result.Quantity += adjustment.Quantity
+		}
+	}
+	return result, adjustment, tx.Commit()
+}
+
+func (s *postgresStore) LastVariance(ctx context.Context) (Variance, error) {
+	query := `SELECT ` + varianceColumns + `
+		FROM products_variances
+		ORDER BY last_modified_at DESC
+		LIMIT 1
+	`
+	v, err := s.scanVariance(s.db.QueryRowContext(ctx, query))
+	return v, notFound(err)
+}
+
+func (s *postgresStore) VariancesByProduct(ctx context.Context, productID string, opts ListOptions) (Page[Variance], error) {
+	var page Page[Variance]
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM products_variances WHERE product_id = $1`, productID).Scan(&page.Total); err != nil {
+		return page, err
+	}
+
+	spec := opts.Sort.or(variancesNewestFirst).withTieBreak()
+	after, args, err := keyset(opts.After, spec, varianceSortFields, 2)
+	if err != nil {
+		return page, err
+	}
+	query := `SELECT ` + varianceColumns + `
+		FROM products_variances
+		WHERE product_id = $1`
+	if after != "" {
+		query += " AND " + after
+	}
+	query += spec.orderBy(varianceSortFields) + limitClause(opts.Limit)
+
+	rows, err := s.db.QueryContext(ctx, query, append([]any{productID}, args...)...)
+	if err != nil {
+		return page, err
+	}
+	variances, err := s.scanVariances(rows)
+	if err != nil {
+		return page, err
+	}
+	return pageOf(variances, page.Total, opts.Limit, spec, varianceSortKey), nil
+}
+
+func (s *postgresStore) ListVariances(ctx context.Context) ([]Variance, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+varianceColumns+`
+		FROM products_variances
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	return s.scanVariances(rows)
+}
+
+func (s *postgresStore) VariancesByProducts(ctx context.Context, productIDs []string) (map[string][]Variance, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+varianceColumns+`
+		FROM products_variances
+		WHERE product_id = ANY($1)
+		ORDER BY id
+	`, pq.Array(productIDs))
+	if err != nil {
+		return nil, err
+	}
+	variances, err := s.scanVariances(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	byProduct := map[string][]Variance{}
+	for _, v := range variances {
+		byProduct[v.ProductID] = append(byProduct[v.ProductID], v)
+	}
+	return byProduct, nil
+}
+
+func (s *postgresStore) scanVariances(rows *sql.Rows) ([]Variance, error) {
+	defer rows.Close()
+
+	var variances []Variance
+	for rows.Next() {
+		v, err := s.scanVariance(rows)
+		if err != nil {
+			log.Println("📢 Error scanning row into Variance model:", err)
+			continue
+		}
+		variances = append(variances, v)
+	}
+	return variances, rows.Err()
+}
+
+//? ----------------------------- suppliers --------------------------------- //
+
+const supplierColumns = `
+			COALESCE(id::text, '') AS id,
+			COALESCE(name, '') AS name,
+			COALESCE(description, '') AS description,
+			COALESCE(logourl, '') AS logourl,
+			COALESCE(website, '') AS website,
+			COALESCE(created_at, '2025-01-01 00:00:00'::timestamp) AS created_at,
+			COALESCE(coutry_of_origin, '') AS coutry_of_origin,
+			COALESCE(social_media_links, '') AS social_media_links,
+			COALESCE(contact_email, '') AS contact_email,
+			COALESCE(phone_number, '') AS phone_number,
+			COALESCE(banner_url, '') AS banner_url,
+			COALESCE(city, '') AS city,
+			COALESCE(country, '') AS country,
+			COALESCE(bank_details, '') AS bank_details,
+			COALESCE(status, '') AS status,
+			COALESCE(extra_data, '') AS extra_data `
+
+func scanSupplier(row rowScanner) (Supplier, error) {
+	var s Supplier
+	err := row.Scan(
+		&s.ID, &s.Name, &s.Description, &s.LogoURL, &s.Website,
+		&s.CreatedAt, &s.CountryOfOrigin, &s.SocialMediaLinks,
+		&s.ContactEmail, &s.PhoneNumber, &s.BannerURL,
+		&s.LocatedCity, &s.LocatedCountry,
+		&s.BankDetails, &s.Status, &s.ExtraData,
+	)
+	return s, err
+}
+
+func (s *postgresStore) UpsertSupplier(ctx context.Context, supplier Supplier) (Supplier, error) {
+	query := `
+		INSERT INTO supplier_tb (
+			name, description, logourl,  coutry_of_origin,
+			social_media_links, contact_email, phone_number, banner_url,
+			website, city, country, bank_details,
+			status, extra_data, created_at
+		) VALUES (
+			$1, $2, $3, $4,
+			$5, $6, $7, $8, $9,
+			$10, $11, $12, $13, $14, $15
+		)
+		ON CONFLICT (name)
+		DO UPDATE SET
+			name = EXCLUDED.name,
+			description = EXCLUDED.description,
+			logourl = EXCLUDED.logourl,
+			coutry_of_origin = EXCLUDED.coutry_of_origin,
+			social_media_links = EXCLUDED.social_media_links,
+			contact_email = EXCLUDED.contact_email,
+			phone_number = EXCLUDED.phone_number,
+			banner_url = EXCLUDED.banner_url,
+			website = EXCLUDED.website,
+			city = EXCLUDED.city,
+			country = EXCLUDED.country,
+			bank_details = EXCLUDED.bank_details,
+			status = EXCLUDED.status,
+			extra_data = EXCLUDED.extra_data
+		RETURNING ` + supplierColumns
+
+	return scanSupplier(s.db.QueryRowContext(ctx,
+		query,
+		supplier.Name, supplier.Description, supplier.LogoURL, supplier.CountryOfOrigin,
+		supplier.SocialMediaLinks, supplier.ContactEmail, supplier.PhoneNumber, supplier.BannerURL,
+		supplier.Website, supplier.LocatedCity, supplier.LocatedCountry, supplier.BankDetails,
+		supplier.Status, supplier.ExtraData, supplier.CreatedAt,
+	))
+}
+
+func (s *postgresStore) ListSuppliers(ctx context.Context, opts ListOptions) (Page[Supplier], error) {
+	var page Page[Supplier]
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM supplier_tb`).Scan(&page.Total); err != nil {
+		return page, err
+	}
+
+	spec := opts.Sort.or(byName).withTieBreak()
+	after, args, err := keyset(opts.After, spec, supplierSortFields, 1)
+	if err != nil {
+		return page, err
+	}
+	query := `SELECT ` + supplierColumns + `
+		FROM supplier_tb`
+	if after != "" {
+		query += " WHERE " + after
+	}
+	rows, err := s.db.QueryContext(ctx, query+spec.orderBy(supplierSortFields)+limitClause(opts.Limit), args...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	var suppliers []Supplier
+	for rows.Next() {
+		supplier, err := scanSupplier(rows)
+		if err != nil {
+			return page, err
+		}
+		suppliers = append(suppliers, supplier)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+	return pageOf(suppliers, page.Total, opts.Limit, spec, supplierSortKey), nil
+}
+
+func (s *postgresStore) SuppliersByName(ctx context.Context, names []string) ([]Supplier, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+supplierColumns+`
+		FROM supplier_tb
+		WHERE name = ANY($1)
+		ORDER BY name
+	`, pq.Array(names))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var suppliers []Supplier
+	for rows.Next() {
+		supplier, err := scanSupplier(rows)
+		if err != nil {
+			return nil, err
+		}
+		suppliers = append(suppliers, supplier)
+	}
+	return suppliers, rows.Err()
+}
+
+//? ------------------------------- brands ---------------------------------- //
+
+const brandColumns = `
+			COALESCE(id::text, '') AS id,
+			COALESCE(name, '') AS name,
+			COALESCE(description, '') AS description,
+			COALESCE(logourl, '') AS logourl,
+			COALESCE(created_at, '2025-01-01 00:00:00'::timestamp) AS created_at,
+			COALESCE(coutry_of_origin, '') AS coutry_of_origin,
+			COALESCE(social_media_links, '') AS social_media_links,
+			COALESCE(contact_email, '') AS contact_email,
+			COALESCE(phone_number, '') AS phone_number,
+			COALESCE(banner_url, '') AS banner_url,
+			COALESCE(website, '') AS website `
+
+func scanBrand(row rowScanner) (Brand, error) {
+	var b Brand
+	err := row.Scan(
+		&b.ID, &b.Name, &b.Description, &b.Logourl, &b.CreatedAt,
+		&b.CountryOfOrigin, &b.SocialMediaLinks, &b.ContactEmail,
+		&b.PhoneNumber, &b.BannerUrl, &b.Website,
+	)
+	return b, err
+}
+
+func (s *postgresStore) UpsertBrand(ctx context.Context, brand Brand) (Brand, error) {
+	query := `
+		INSERT INTO brand (
+			name, description, logourl, coutry_of_origin,
+			social_media_links, contact_email, phone_number,
+			banner_url, website, created_at
+		) VALUES (
+			$1, $2, $3, $4,
+			$5, $6, $7, $8, $9,
+			$10
+		)
+		ON CONFLICT (name)
+		DO UPDATE SET
+			name = EXCLUDED.name,
+			description = EXCLUDED.description,
+			logourl = EXCLUDED.logourl,
+			coutry_of_origin = EXCLUDED.coutry_of_origin,
+			social_media_links = EXCLUDED.social_media_links,
+			contact_email = EXCLUDED.contact_email,
+			phone_number = EXCLUDED.phone_number,
+			banner_url = EXCLUDED.banner_url,
+			website = EXCLUDED.website
+		RETURNING ` + brandColumns
+
+	return scanBrand(s.db.QueryRowContext(ctx,
+		query,
+		brand.Name, brand.Description,
+		brand.Logourl, brand.CountryOfOrigin, brand.SocialMediaLinks, brand.ContactEmail, brand.PhoneNumber,
+		brand.BannerUrl, brand.Website, brand.CreatedAt,
+	))
+}
+
+func (s *postgresStore) ListBrands(ctx context.Context, opts ListOptions) (Page[Brand], error) {
+	var page Page[Brand]
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM brand`).Scan(&page.Total); err != nil {
+		return page, err
+	}
+
+	spec := opts.Sort.or(byName).withTieBreak()
+	after, args, err := keyset(opts.After, spec, brandSortFields, 1)
+	if err != nil {
+		return page, err
+	}
+	query := `SELECT ` + brandColumns + `
+		FROM brand`
+	if after != "" {
+		query += " WHERE " + after
+	}
+	rows, err := s.db.QueryContext(ctx, query+spec.orderBy(brandSortFields)+limitClause(opts.Limit), args...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	var brands []Brand
+	for rows.Next() {
+		b, err := scanBrand(rows)
+		if err != nil {
+			return page, err
+		}
+		brands = append(brands, b)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+	return pageOf(brands, page.Total, opts.Limit, spec, brandSortKey), nil
+}
+
+func (s *postgresStore) BrandsByName(ctx context.Context, names []string) ([]Brand, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+brandColumns+`
+		FROM brand
+		WHERE name = ANY($1)
+		ORDER BY name
+	`, pq.Array(names))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var brands []Brand
+	for rows.Next() {
+		b, err := scanBrand(rows)
+		if err != nil {
+			return nil, err
+		}
+		brands = append(brands, b)
+	}
+	return brands, rows.Err()
+}
+
+//? ----------------------------- inventory --------------------------------- //
+
+const movementColumns = `
+			id, variance_id, location_id, kind, quantity, balance_after,
+			reason, reference, created_by, created_at `
+
+func scanMovement(row rowScanner) (StockMovement, error) {
+	var m StockMovement
+	err := row.Scan(
+		&m.ID, &m.VarianceID, &m.LocationID, &m.Kind, &m.Quantity, &m.BalanceAfter,
+		&m.Reason, &m.Reference, &m.CreatedBy, &m.CreatedAt,
+	)
+	return m, err
+}
+
+func (s *postgresStore) RecordMovement(ctx context.Context, m StockMovement) (StockMovement, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return m, err
+	}
+	defer tx.Rollback()
+
+	if m, err = appendMovement(ctx, tx, m); err != nil {
+		return m, err
+	}
+	return m, tx.Commit()
+}
+
+func (s *postgresStore) Transfer(ctx context.Context, out, in StockMovement) (Transfer, error) {
+	var t Transfer
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return t, err
+	}
+	defer tx.Rollback()
+
+	if t.Out, err = appendMovement(ctx, tx, out); err != nil {
+		return t, err
+	}
+	if t.In, err = appendMovement(ctx, tx, in); err != nil {
+		return t, err
+	}
+	return t, tx.Commit()
+}
+
+func (s *postgresStore) CountStock(ctx context.Context, varianceID int, counted float64, m StockMovement) (*StockMovement, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	adjustment, err := countStock(ctx, tx, varianceID, counted, m)
+	if err != nil {
+		return nil, err
+	}
+	return adjustment, tx.Commit()
+}
+
+// countStock is CountStock as part of tx.
+func countStock(ctx context.Context, tx *sql.Tx, varianceID int, counted float64, m StockMovement) (*StockMovement, error) {
+	locationID, onHand, err := lockStock(ctx, tx, varianceID, m.LocationID)
+	if err != nil || onHand == counted {
+		return nil, err
+	}
+	m.VarianceID, m.LocationID, m.Kind, m.Quantity = varianceID, locationID, movementAdjustment, counted-onHand
+	if m, err = appendMovement(ctx, tx, m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// lockStock locks a variance row for the rest of tx, so movements on one
+// variance apply one at a time, and returns its on-hand quantity at a
+// location. A zero locationID is resolved to the main building.
+func lockStock(ctx context.Context, tx *sql.Tx, varianceID, locationID int) (int, float64, error) {
+	err := tx.QueryRowContext(ctx, `SELECT id FROM products_variances WHERE id = $1 FOR UPDATE`, varianceID).Scan(&varianceID)
+	if err != nil {
+		return 0, 0, notFound(err)
+	}
+
+	var onHand float64
+	err = tx.QueryRowContext(ctx, `
+		SELECT l.id, COALESCE(sl.quantity, 0)
+		FROM locations l
+		LEFT JOIN stock_levels sl ON sl.location_id = l.id AND sl.variance_id = $1
+		WHERE CASE WHEN $2 = 0 THEN l.code = $3 ELSE l.id = $2 END
+	`, varianceID, locationID, defaultLocationCode).Scan(&locationID, &onHand)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, errUnknownLocation(locationID)
+	}
+	return locationID, onHand, err
+}
+
+// appendMovement locks the stock m changes, inserts m and updates both
+// cached quantities.
+func appendMovement(ctx context.Context, tx *sql.Tx, m StockMovement) (StockMovement, error) {
+	locationID, onHand, err := lockStock(ctx, tx, m.VarianceID, m.LocationID)
+	if err != nil {
+		return m, err
+	}
+	available := onHand
+	if takesAvailable(m) {
+		reserved, err := reservedStock(ctx, tx, m.VarianceID, locationID)
+		if err != nil {
+			return m, err
+		}
+		available -= reserved
+	}
+	if available+m.Quantity < 0 {
+		return m, errInsufficientStock(m.VarianceID, available, m.Quantity)
+	}
+	m.LocationID, m.BalanceAfter = locationID, onHand+m.Quantity
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO stock_movements (variance_id, location_id, kind, quantity, balance_after, reason, reference, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, COALESCE($9, now()))
+		RETURNING id, created_at
+	`, m.VarianceID, m.LocationID, m.Kind, m.Quantity, m.BalanceAfter, m.Reason, m.Reference, m.CreatedBy, m.CreatedAt).Scan(&m.ID, &m.CreatedAt)
+	if err != nil {
+		return m, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO stock_levels (variance_id, location_id, quantity) VALUES ($1, $2, $3)
+		ON CONFLICT (variance_id, location_id) DO UPDATE SET quantity = EXCLUDED.quantity
+	`, m.VarianceID, m.LocationID, m.BalanceAfter)
+	if err != nil {
+		return m, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE products_variances SET quantity = COALESCE(quantity, 0) + $2 WHERE id = $1
+	`, m.VarianceID, m.Quantity)
+	return m, err
+}
+
+func (s *postgresStore) ListMovements(ctx context.Context, f MovementFilter, opts ListOptions) (Page[StockMovement], error) {
+	var page Page[StockMovement]
+	var conds []string
+	var args []any
+	filter := func(column string, value any) {
+		args = append(args, value)
+		conds = append(conds, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+	if f.VarianceID != 0 {
+		filter("variance_id", f.VarianceID)
+	}
+	if f.LocationID != 0 {
+		filter("location_id", f.LocationID)
+	}
+	if f.Kind != "" {
+		filter("kind", f.Kind)
+	}
+	if f.Reference != "" {
+		filter("reference", f.Reference)
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM stock_movements`+where, args...).Scan(&page.Total); err != nil {
+		return page, err
+	}
+
+	spec := opts.Sort.or(newestFirst).withTieBreak()
+	after, afterArgs, err := keyset(opts.After, spec, movementSortFields, len(args)+1)
+	if err != nil {
+		return page, err
+	}
+	if after != "" {
+		conds = append(conds, after)
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+	query := `SELECT ` + movementColumns + `FROM stock_movements` + where + spec.orderBy(movementSortFields) + limitClause(opts.Limit)
+	rows, err := s.db.QueryContext(ctx, query, append(args, afterArgs...)...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	var movements []StockMovement
+	for rows.Next() {
+		m, err := scanMovement(rows)
+		if err != nil {
+			return page, err
+		}
+		movements = append(movements, m)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+	return pageOf(movements, page.Total, opts.Limit, spec, movementSortKey), nil
+}
+
+// stockLevelQuery sums the ledger and the reservations holding stock per
+// variance and location; callers add the WHERE. A variance without movements
+// comes back once with a NULL location.
+const stockLevelQuery = `
+	SELECT v.id, v.product_id, l.id, l.code, l.name, COALESCE(SUM(m.quantity), 0)::float8,
+		COALESCE((
+			SELECT SUM(r.quantity) FROM stock_reservations r
+			WHERE r.variance_id = v.id AND r.location_id = l.id AND r.status = 'active' AND r.expires_at > now()
+		), 0)::float8,
+		MAX(m.created_at)
+	FROM products_variances v
+	LEFT JOIN stock_movements m ON m.variance_id = v.id
+	LEFT JOIN locations l ON l.id = m.location_id`
+
+const stockLevelGrouping = `
+	GROUP BY v.id, l.id
+	ORDER BY v.id, l.id`
+
+// scanStockLevels folds stockLevelQuery rows into one StockLevel per
+// variance.
+func scanStockLevels(rows *sql.Rows) ([]StockLevel, error) {
+	defer rows.Close()
+
+	var levels []StockLevel
+	for rows.Next() {
+		var varianceID int
+		var productID string
+		var locationID sql.NullInt64
+		var code, name sql.NullString
+		var onHand, reserved float64
+		var last sql.NullTime
+		if err := rows.Scan(&varianceID, &productID, &locationID, &code, &name, &onHand, &reserved, &last); err != nil {
+			return nil, err
+		}
+
+		if len(levels) == 0 || levels[len(levels)-1].VarianceID != varianceID {
+			levels = append(levels, StockLevel{VarianceID: varianceID, ProductID: productID, Locations: []LocationStock{}})
+		}
+		l := &levels[len(levels)-1]
+		if !locationID.Valid {
+			continue
+		}
+		l.OnHand += onHand
+		l.Reserved += reserved
+		l.Available = l.OnHand - l.Reserved
+		l.Locations = append(l.Locations, LocationStock{LocationID: int(locationID.Int64), Code: code.String, Name: name.String,
+			OnHand: onHand, Reserved: reserved, Available: onHand - reserved})
+		if last.Valid && (l.LastMovementAt == nil || last.Time.After(*l.LastMovementAt)) {
+			l.LastMovementAt = &last.Time
+		}
+	}
+	return levels, rows.Err()
+}
+
+func (s *postgresStore) StockLevel(ctx context.Context, varianceID int) (StockLevel, error) {
+	rows, err := s.db.QueryContext(ctx, stockLevelQuery+`
+		WHERE v.id = $1`+stockLevelGrouping, varianceID)
+	if err != nil {
+		return StockLevel{}, err
+	}
+	levels, err := scanStockLevels(rows)
+	if err != nil {
+		return StockLevel{}, err
+	}
+	if len(levels) == 0 {
+		return StockLevel{}, errNotFound
+	}
+	return levels[0], nil
+}
+
+func (s *postgresStore) StockLevels(ctx context.Context, productID string) ([]StockLevel, error) {
+	rows, err := s.db.QueryContext(ctx, stockLevelQuery+`
+		WHERE v.product_id = $1`+stockLevelGrouping, productID)
+	if err != nil {
+		return nil, err
+	}
+	return scanStockLevels(rows)
+}
+
+//? ---------------------------- reservations ------------------------------- //
+
+// reservationStatus reports an active reservation past its expiry as expired
+// before the sweeper marks it.
+const reservationStatus = `CASE WHEN status = 'active' AND expires_at <= now() THEN 'expired' ELSE status END`
+
+const reservationColumns = `
+			id, variance_id, location_id, quantity, ` + reservationStatus + `,
+			reference, expires_at, movement_id, created_by, created_at, updated_at `
+
+func scanReservation(row rowScanner) (Reservation, error) {
+	var r Reservation
+	var movementID sql.NullInt64
+	err := row.Scan(
+		&r.ID, &r.VarianceID, &r.LocationID, &r.Quantity, &r.Status,
+		&r.Reference, &r.ExpiresAt, &movementID, &r.CreatedBy, &r.CreatedAt, &r.UpdatedAt,
+	)
+	if movementID.Valid {
+		id := int(movementID.Int64)
+		r.MovementID = &id
+	}
+	return r, err
+}
+
+// reservedStock sums the reservations holding a variance's stock at a
+// location. Callers hold the variance lock from lockStock, so no reservation
+// can be added until tx ends.
+func reservedStock(ctx context.Context, tx *sql.Tx, varianceID, locationID int) (float64, error) {
+	var reserved float64
+	err := tx.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(quantity), 0)::float8 FROM stock_reservations
+		WHERE variance_id = $1 AND location_id = $2 AND status = 'active' AND expires_at > now()
+	`, varianceID, locationID).Scan(&reserved)
+	return reserved, err
+}
+
+func (s *postgresStore) Reserve(ctx context.Context, r Reservation) (Reservation, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return r, err
+	}
+	defer tx.Rollback()
+
+	locationID, onHand, err := lockStock(ctx, tx, r.VarianceID, r.LocationID)
+	if err != nil {
+		return r, err
+	}
+	reserved, err := reservedStock(ctx, tx, r.VarianceID, locationID)
+	if err != nil {
+		return r, err
+	}
+	if available := onHand - reserved; available < r.Quantity {
+		return r, errInsufficientStock(r.VarianceID, available, -r.Quantity)
+	}
+
+	query := `
+		INSERT INTO stock_reservations (variance_id, location_id, quantity, status, reference, expires_at, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)
+		RETURNING ` + reservationColumns
+	r, err = scanReservation(tx.QueryRowContext(ctx, query,
+		r.VarianceID, locationID, r.Quantity, r.Status, r.Reference, r.ExpiresAt, r.CreatedBy, r.CreatedAt))
+	if err != nil {
+		return r, err
+	}
+	return r, tx.Commit()
+}
+
+func (s *postgresStore) GetReservation(ctx context.Context, id int) (Reservation, error) {
+	r, err := scanReservation(s.db.QueryRowContext(ctx, `SELECT `+reservationColumns+`FROM stock_reservations WHERE id = $1`, id))
+	return r, notFound(err)
+}
+
+func (s *postgresStore) ListReservations(ctx context.Context, f ReservationFilter, opts ListOptions) (Page[Reservation], error) {
+	var page Page[Reservation]
+	var conds []string
+	var args []any
+	filter := func(column string, value any) {
+		args = append(args, value)
+		conds = append(conds, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+	if f.VarianceID != 0 {
+		filter("variance_id", f.VarianceID)
+	}
+	if f.LocationID != 0 {
+		filter("location_id", f.LocationID)
+	}
+	if f.Status != "" {
+		filter(reservationStatus, f.Status)
+	}
+	if f.Reference != "" {
+		filter("reference", f.Reference)
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM stock_reservations`+where, args...).Scan(&page.Total); err != nil {
+		return page, err
+	}
+
+	spec := opts.Sort.or(newestFirst).withTieBreak()
+	after, afterArgs, err := keyset(opts.After, spec, reservationSortFields, len(args)+1)
+	if err != nil {
+		return page, err
+	}
+	if after != "" {
+		conds = append(conds, after)
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+	query := `SELECT ` + reservationColumns + `FROM stock_reservations` + where + spec.orderBy(reservationSortFields) + limitClause(opts.Limit)
+	rows, err := s.db.QueryContext(ctx, query, append(args, afterArgs...)...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	var reservations []Reservation
+	for rows.Next() {
+		r, err := scanReservation(rows)
+		if err != nil {
+			return page, err
+		}
+		reservations = append(reservations, r)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+	return pageOf(reservations, page.Total, opts.Limit, spec, reservationSortKey), nil
+}
+
+// lockReservation locks a reservation row for the rest of tx and fails with
+// RESERVATION_CLOSED unless it still holds stock.
+func lockReservation(ctx context.Context, tx *sql.Tx, id int) (Reservation, error) {
+	r, err := scanReservation(tx.QueryRowContext(ctx, `SELECT `+reservationColumns+`FROM stock_reservations WHERE id = $1 FOR UPDATE`, id))
+	if err != nil {
+		return r, notFound(err)
+	}
+	if now := time.Now(); !r.holds(now) {
+		r.Status = effectiveStatus(r, now)
+		return r, errReservationClosed(r)
+	}
+	return r, nil
+}
+
+func (s *postgresStore) ConfirmReservation(ctx context.Context, id int, sale StockMovement) (ReservationSale, error) {
+	var result ReservationSale
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	r, err := lockReservation(ctx, tx, id)
+	if r.Status == reservationConfirmed && r.MovementID != nil {
+		result.Reservation = r
+		result.Movement, err = scanMovement(tx.QueryRowContext(ctx, `SELECT `+movementColumns+`FROM stock_movements WHERE id = $1`, *r.MovementID))
+		return result, err
+	}
+	if err != nil {
+		return result, err
+	}
+	// Stop holding the stock first, or the sale could not take it
+	if _, err = tx.ExecContext(ctx, `UPDATE stock_reservations SET status = $2 WHERE id = $1`, id, reservationConfirmed); err != nil {
+		return result, err
+	}
+	sale.VarianceID, sale.LocationID, sale.Quantity, sale.Reference = r.VarianceID, r.LocationID, -r.Quantity, saleReference(r)
+	if result.Movement, err = appendMovement(ctx, tx, sale); err != nil {
+		return result, err
+	}
+	query := `
+		UPDATE stock_reservations SET movement_id = $2, updated_at = $3 WHERE id = $1
+		RETURNING ` + reservationColumns
+	if result.Reservation, err = scanReservation(tx.QueryRowContext(ctx, query, id, result.Movement.ID, result.Movement.CreatedAt)); err != nil {
+		return result, err
+	}
+	return result, tx.Commit()
+}
+
+func (s *postgresStore) ReleaseReservation(ctx context.Context, id int, now time.Time) (Reservation, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Reservation{}, err
+	}
+	defer tx.Rollback()
+
+	r, err := lockReservation(ctx, tx, id)
+	if r.Status == reservationReleased {
+		return r, nil
+	}
+	if err != nil {
+		return r, err
+	}
+	query := `
+		UPDATE stock_reservations SET status = $2, updated_at = $3 WHERE id = $1
+		RETURNING ` + reservationColumns
+	r, err = scanReservation(tx.QueryRowContext(ctx, query, id, reservationReleased, now))
+	if err != nil {
+		return r, err
+	}
+	return r, tx.Commit()
+}
+
+func (s *postgresStore) ExpireReservations(ctx context.Context, now time.Time) (int, error) {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE stock_reservations SET status = $1, updated_at = $2
+		WHERE status = 'active' AND expires_at <= $2
+	`, reservationExpired, now)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+//? ---------------------------- reorder rules ------------------------------ //
+
+const reorderRuleColumns = `
+			id, variance_id, COALESCE(location_id, 0), reorder_point, reorder_quantity, low, alerted_at, updated_at `
+
+func scanReorderRule(row rowScanner) (ReorderRule, error) {
+	var r ReorderRule
+	err := row.Scan(&r.ID, &r.VarianceID, &r.LocationID, &r.ReorderPoint, &r.ReorderQuantity, &r.Low, &r.AlertedAt, &r.UpdatedAt)
+	return r, err
+}
+
+// lowStockQuery joins each rule to the stock it watches; callers add the
+// WHERE on the columns of s.
+const lowStockQuery = `
+	SELECT ` + reorderRuleColumns + `, product_id, location_code, on_hand
+	FROM (
+		SELECT r.*, v.product_id, COALESCE(l.code, '') AS location_code,
+			CASE WHEN r.location_id IS NULL THEN COALESCE(v.quantity, 0) ELSE COALESCE(sl.quantity, 0) END::float8 AS on_hand
+		FROM reorder_rules r
+		JOIN products_variances v ON v.id = r.variance_id
+		LEFT JOIN locations l ON l.id = r.location_id
+		LEFT JOIN stock_levels sl ON sl.variance_id = r.variance_id AND sl.location_id = r.location_id
+	) s`
+
+func scanLowStockItem(row rowScanner) (LowStockItem, error) {
+	var r ReorderRule
+	var productID, locationCode string
+	var onHand float64
+	err := row.Scan(&r.ID, &r.VarianceID, &r.LocationID, &r.ReorderPoint, &r.ReorderQuantity, &r.Low, &r.AlertedAt, &r.UpdatedAt,
+		&productID, &locationCode, &onHand)
+	return lowStockItem(r, productID, locationCode, onHand), err
+}
+
+func (s *postgresStore) UpsertReorderRule(ctx context.Context, r ReorderRule) (ReorderRule, error) {
+	err := s.db.QueryRowContext(ctx, `SELECT id FROM products_variances WHERE id = $1`, r.VarianceID).Scan(&r.VarianceID)
+	if err != nil {
+		return r, notFound(err)
+	}
+	if r.LocationID != 0 {
+		err := s.db.QueryRowContext(ctx, `SELECT id FROM locations WHERE id = $1`, r.LocationID).Scan(&r.LocationID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return r, errUnknownLocation(r.LocationID)
+		}
+		if err != nil {
+			return r, err
+		}
+	}
+
+	query := `
+		INSERT INTO reorder_rules (variance_id, location_id, reorder_point, reorder_quantity, updated_at)
+		VALUES ($1, NULLIF($2, 0), $3, $4, $5)
+		ON CONFLICT (variance_id, (COALESCE(location_id, 0)))
+		DO UPDATE SET
+			reorder_point = EXCLUDED.reorder_point,
+			reorder_quantity = EXCLUDED.reorder_quantity,
+			updated_at = EXCLUDED.updated_at
+		RETURNING ` + reorderRuleColumns
+
+	return scanReorderRule(s.db.QueryRowContext(ctx, query, r.VarianceID, r.LocationID, r.ReorderPoint, r.ReorderQuantity, r.UpdatedAt))
+}
+
+func (s *postgresStore) ListReorderRules(ctx context.Context, varianceID int) ([]ReorderRule, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+reorderRuleColumns+`FROM reorder_rules
+		WHERE $1 = 0 OR variance_id = $1
+		ORDER BY variance_id, COALESCE(location_id, 0)`, varianceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []ReorderRule
+	for rows.Next() {
+		r, err := scanReorderRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+func (s *postgresStore) LowStock(ctx context.Context, f LowStockFilter) ([]LowStockItem, error) {
+	rows, err := s.db.QueryContext(ctx, lowStockQuery+`
+		WHERE on_hand < reorder_point
+			AND ($1 = '' OR product_id = $1)
+			AND ($2 = 0 OR location_id = $2)
+		ORDER BY reorder_point - on_hand DESC, variance_id, COALESCE(location_id, 0)`, f.ProductID, f.LocationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []LowStockItem
+	for rows.Next() {
+		item, err := scanLowStockItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (s *postgresStore) CheckReorderRules(ctx context.Context, varianceID, locationID int, now time.Time, cooldown time.Duration) ([]StockAlert, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the rules before reading stock, so a concurrent check waits and
+	// then sees what this one saved
+	_, err = tx.ExecContext(ctx, `
+		SELECT id FROM reorder_rules
+		WHERE variance_id = $1 AND (location_id IS NULL OR location_id = $2)
+		FOR UPDATE
+	`, varianceID, locationID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tx.QueryContext(ctx, lowStockQuery+`
+		WHERE variance_id = $1 AND (location_id IS NULL OR location_id = $2)`, varianceID, locationID)
+	if err != nil {
+		return nil, err
+	}
+	var items []LowStockItem
+	for rows.Next() {
+		item, err := scanLowStockItem(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var alerts []StockAlert
+	for _, item := range items {
+		changed, alert := item.observe(item.OnHand, now, cooldown)
+		if !changed {
+			continue
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE reorder_rules SET low = $2, alerted_at = $3 WHERE id = $1`,
+			item.ID, item.Low, item.AlertedAt)
+		if err != nil {
+			return nil, err
+		}
+		if alert {
+			alerts = append(alerts, item.alert(now))
+		}
+	}
+	return alerts, tx.Commit()
+}
+
+//? --------------------------- purchase orders ----------------------------- //
+
+const purchaseOrderColumns = `
+			po.id, po.supplier_id, s.name, po.status, po.location_id, po.reference, po.notes,
+			po.currency, po.created_by, po.created_at, po.updated_at `
+
+const purchaseOrderFrom = `
+		FROM purchase_orders po
+		JOIN supplier_tb s ON s.id = po.supplier_id`
+
+func scanPurchaseOrder(row rowScanner) (PurchaseOrder, error) {
+	var po PurchaseOrder
+	err := row.Scan(
+		&po.ID, &po.SupplierID, &po.SupplierName, &po.Status, &po.LocationID, &po.Reference, &po.Notes,
+		&po.Currency, &po.CreatedBy, &po.CreatedAt, &po.UpdatedAt,
+	)
+	return po, err
+}
+
+// queryer is the part of *sql.DB and *sql.Tx shared by the helpers that run
+// both in and out of a transaction.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// loadPurchaseOrderLines fills in the lines and totals of orders with one
+// query.
+func loadPurchaseOrderLines(ctx context.Context, q queryer, orders []PurchaseOrder) error {
+	ids := make([]int64, len(orders))
+	for i, po := range orders {
+		ids[i] = int64(po.ID)
+	}
+	rows, err := q.QueryContext(ctx, `
+		SELECT purchase_order_id, id, variance_id, quantity, unit_cost, quantity_received
+		FROM purchase_order_lines
+		WHERE purchase_order_id = ANY($1)
+		ORDER BY id
+	`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	byOrder := map[int][]PurchaseOrderLine{}
+	for rows.Next() {
+		var orderID int
+		var l PurchaseOrderLine
+		l.UnitCost = new(Money)
+		if err := rows.Scan(&orderID, &l.ID, &l.VarianceID, &l.Quantity, l.UnitCost, &l.Received); err != nil {
+			return err
+		}
+		byOrder[orderID] = append(byOrder[orderID], l)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for i := range orders {
+		orders[i].Lines = append([]PurchaseOrderLine{}, byOrder[orders[i].ID]...)
+		for _, l := range orders[i].Lines {
+			l.UnitCost.Currency = orders[i].Currency
+		}
+		total, err := orders[i].totalCost()
+		if err != nil {
+			return err
+		}
+		orders[i].Total = total
+	}
+	return nil
+}
+
+// resolvePurchaseOrder checks what po refers to and fills in its location and
+// unit costs, in po's currency.
+func resolvePurchaseOrder(ctx context.Context, tx *sql.Tx, po *PurchaseOrder) error {
+	err := tx.QueryRowContext(ctx, `SELECT name FROM supplier_tb WHERE id = $1`, po.SupplierID).Scan(&po.SupplierName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errUnknownSupplier(po.SupplierID)
+	}
+	if err != nil {
+		return err
+	}
+	err = tx.QueryRowContext(ctx, `
+		SELECT id FROM locations WHERE CASE WHEN $1 = 0 THEN code = $2 ELSE id = $1 END
+	`, po.LocationID, defaultLocationCode).Scan(&po.LocationID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errUnknownLocation(po.LocationID)
+	}
+	if err != nil {
+		return err
+	}
+
+	for i := range po.Lines {
+		line := &po.Lines[i]
+		var wholesale Money
+		err := tx.QueryRowContext(ctx, `
+			SELECT COALESCE(wholesale_price, 0) FROM products_variances WHERE id = $1
+		`, line.VarianceID).Scan(&wholesale)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errUnknownVariance(line.VarianceID)
+		}
+		if err != nil {
+			return err
+		}
+		if line.UnitCost != nil {
+			wholesale = *line.UnitCost
+		}
+		cost := wholesale.price(po.Currency)
+		line.UnitCost = &cost
+	}
+	return nil
+}
+
+// insertPurchaseOrderLines writes po's lines, replacing any it had.
+func insertPurchaseOrderLines(ctx context.Context, tx *sql.Tx, po PurchaseOrder) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM purchase_order_lines WHERE purchase_order_id = $1`, po.ID); err != nil {
+		return err
+	}
+	for _, l := range po.Lines {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO purchase_order_lines (purchase_order_id, variance_id, quantity, unit_cost)
+			VALUES ($1, $2, $3, $4)
+		`, po.ID, l.VarianceID, l.Quantity, *l.UnitCost)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockPurchaseOrder reads an order and its lines, locking the order for the
+// rest of tx.
+func lockPurchaseOrder(ctx context.Context, tx *sql.Tx, id int) (PurchaseOrder, error) {
+	po, err := scanPurchaseOrder(tx.QueryRowContext(ctx, `SELECT `+purchaseOrderColumns+purchaseOrderFrom+`
+		WHERE po.id = $1
+		FOR UPDATE OF po`, id))
+	if err != nil {
+		return po, notFound(err)
+	}
+	orders := []PurchaseOrder{po}
+	err = loadPurchaseOrderLines(ctx, tx, orders)
+	return orders[0], err
+}
+
+func (s *postgresStore) CreatePurchaseOrder(ctx context.Context, po PurchaseOrder) (PurchaseOrder, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return po, err
+	}
+	defer tx.Rollback()
+
+	po.Currency = s.pricing.Currency
+	if err := resolvePurchaseOrder(ctx, tx, &po); err != nil {
+		return po, err
+	}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO purchase_orders (supplier_id, location_id, status, reference, notes, currency, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
+	`, po.SupplierID, po.LocationID, po.Status, po.Reference, po.Notes, po.Currency, po.CreatedBy, po.CreatedAt, po.UpdatedAt).Scan(&po.ID)
+	if err != nil {
+		return po, err
+	}
+	if err := insertPurchaseOrderLines(ctx, tx, po); err != nil {
+		return po, err
+	}
+	if err := tx.Commit(); err != nil {
+		return po, err
+	}
+	return s.GetPurchaseOrder(ctx, po.ID)
+}
+
+func (s *postgresStore) UpdatePurchaseOrder(ctx context.Context, po PurchaseOrder) (PurchaseOrder, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return po, err
+	}
+	defer tx.Rollback()
+
+	existing, err := lockPurchaseOrder(ctx, tx, po.ID)
+	if err != nil {
+		return po, err
+	}
+	if existing.Status != poDraft {
+		return po, errNotDraft(existing)
+	}
+	po.Currency = existing.Currency
+	if err := resolvePurchaseOrder(ctx, tx, &po); err != nil {
+		return po, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE purchase_orders SET supplier_id = $2, location_id = $3, reference = $4, notes = $5, updated_at = $6
+		WHERE id = $1
+	`, po.ID, po.SupplierID, po.LocationID, po.Reference, po.Notes, po.UpdatedAt)
+	if err != nil {
+		return po, err
+	}
+	if err := insertPurchaseOrderLines(ctx, tx, po); err != nil {
+		return po, err
+	}
+	if err := tx.Commit(); err != nil {
+		return po, err
+	}
+	return s.GetPurchaseOrder(ctx, po.ID)
+}
+
+func (s *postgresStore) GetPurchaseOrder(ctx context.Context, id int) (PurchaseOrder, error) {
+	po, err := scanPurchaseOrder(s.db.QueryRowContext(ctx, `SELECT `+purchaseOrderColumns+purchaseOrderFrom+`
+		WHERE po.id = $1`, id))
+	if err != nil {
+		return po, notFound(err)
+	}
+	orders := []PurchaseOrder{po}
+	err = loadPurchaseOrderLines(ctx, s.db, orders)
+	return orders[0], err
+}
+
+func (s *postgresStore) ListPurchaseOrders(ctx context.Context, f PurchaseOrderFilter, opts ListOptions) (Page[PurchaseOrder], error) {
+	var page Page[PurchaseOrder]
+	var conds []string
+	var args []any
+	filter := func(column string, value any) {
+		args = append(args, value)
+		conds = append(conds, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+	if f.SupplierID != 0 {
+		filter("po.supplier_id", f.SupplierID)
+	}
+	if f.Status != "" {
+		filter("po.status", f.Status)
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM purchase_orders po`+where, args...).Scan(&page.Total); err != nil {
+		return page, err
+	}
+
+	spec := opts.Sort.or(newestFirst).withTieBreak()
+	after, afterArgs, err := keyset(opts.After, spec, purchaseOrderSortFields, len(args)+1)
+	if err != nil {
+		return page, err
+	}
+	if after != "" {
+		conds = append(conds, after)
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+	query := `SELECT ` + purchaseOrderColumns + purchaseOrderFrom + where + spec.orderBy(purchaseOrderSortFields) + limitClause(opts.Limit)
+	rows, err := s.db.QueryContext(ctx, query, append(args, afterArgs...)...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	var orders []PurchaseOrder
+	for rows.Next() {
+		po, err := scanPurchaseOrder(rows)
+		if err != nil {
+			return page, err
+		}
+		orders = append(orders, po)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+	if err := loadPurchaseOrderLines(ctx, s.db, orders); err != nil {
+		return page, err
+	}
+	return pageOf(orders, page.Total, opts.Limit, spec, purchaseOrderSortKey), nil
+}
+
+func (s *postgresStore) SetPurchaseOrderStatus(ctx context.Context, id int, status string, now time.Time) (PurchaseOrder, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return PurchaseOrder{}, err
+	}
+	defer tx.Rollback()
+
+	po, err := lockPurchaseOrder(ctx, tx, id)
+	if err != nil {
+		return po, err
+	}
+	if err := checkTransition(po, status); err != nil {
+		return po, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE purchase_orders SET status = $2, updated_at = $3 WHERE id = $1`, id, status, now); err != nil {
+		return po, err
+	}
+	if err := tx.Commit(); err != nil {
+		return po, err
+	}
+	return s.GetPurchaseOrder(ctx, id)
+}
+
+func (s *postgresStore) ReceivePurchaseOrder(ctx context.Context, id int, receipt POReceipt) (POReceiptResult, error) {
+	result := POReceiptResult{Movements: []StockMovement{}, PriceChanges: []PriceChange{}}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	po, err := lockPurchaseOrder(ctx, tx, id)
+	if err != nil {
+		return result, err
+	}
+	if err := checkTransition(po, poReceived); err != nil {
+		return result, err
+	}
+	rate, err := s.shareExchangeRate(ctx, tx, po.Currency)
+	if errors.Is(err, errNotFound) {
+		return result, errUnknownCurrency(po.Currency)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	for _, line := range receipt.Lines {
+		l, err := receiptLine(po, line)
+		if err != nil {
+			return result, err
+		}
+		mv, err := appendMovement(ctx, tx, receipt.receiptMovement(po, line))
+		if err != nil {
+			return result, err
+		}
+		result.Movements = append(result.Movements, mv)
+		l.Received += line.Quantity
+		_, err = tx.ExecContext(ctx, `UPDATE purchase_order_lines SET quantity_received = $2 WHERE id = $1`, l.ID, l.Received)
+		if err != nil {
+			return result, err
+		}
+
+		// appendMovement holds the variance row, so the price cannot change
+		// under us
+		cost := *l.UnitCost
+		if line.UnitCost != nil {
+			cost = line.UnitCost.price(po.Currency)
+		}
+		cost = rate.base(cost, s.pricing.Currency)
+		var original Money
+		err = tx.QueryRowContext(ctx, `
+			SELECT COALESCE(original_price, 0) FROM products_variances WHERE id = $1
+		`, line.VarianceID).Scan(&original)
+		if err != nil {
+			return result, err
+		}
+		if original = original.price(s.pricing.Currency); original.Amount.Cmp(cost.Amount) != 0 {
+			_, err := tx.ExecContext(ctx, `
+				UPDATE products_variances SET original_price = $2, last_modified_at = $3 WHERE id = $1
+			`, line.VarianceID, cost, receipt.CreatedAt)
+			if err != nil {
+				return result, err
+			}
+			change := PriceChange{VarianceID: line.VarianceID, Field: "original_price", From: original, To: cost}
+			if err := recordPrices(ctx, tx, []PriceHistory{receipt.priceHistory(po, change)}); err != nil {
+				return result, err
+			}
+			result.PriceChanges = append(result.PriceChanges, change)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE purchase_orders SET status = $2, updated_at = $3 WHERE id = $1`,
+		id, po.receivedStatus(), receipt.CreatedAt)
+	if err != nil {
+		return result, err
+	}
+	if err := tx.Commit(); err != nil {
+		return result, err
+	}
+	result.Order, err = s.GetPurchaseOrder(ctx, id)
+	return result, err
+}
+
+//? ------------------------------- orders ---------------------------------- //
+
+const orderColumns = `
+			id, status, location_id, customer, reference, notes, total, currency, exchange_rate, price_list,
+			created_by, created_at, updated_at `
+
+func scanOrder(row rowScanner) (Order, error) {
+	var o Order
+	err := row.Scan(&o.ID, &o.Status, &o.LocationID, &o.Customer, &o.Reference, &o.Notes, &o.Total,
+		&o.Currency, &o.ExchangeRate, &o.PriceList, &o.CreatedBy, &o.CreatedAt, &o.UpdatedAt)
+	o.Total.Currency = o.Currency
+	return o, err
+}
+
+// loadOrderLines fills in the lines of orders with one query.
+func loadOrderLines(ctx context.Context, q queryer, orders []Order) error {
+	ids := make([]int64, len(orders))
+	for i, o := range orders {
+		ids[i] = int64(o.ID)
+	}
+	rows, err := q.QueryContext(ctx, `
+		SELECT order_id, id, variance_id, quantity, unit_price, line_total, movement_id
+		FROM order_lines
+		WHERE order_id = ANY($1)
+		ORDER BY id
+	`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	byOrder := map[int][]OrderLine{}
+	for rows.Next() {
+		var orderID int
+		var l OrderLine
+		if err := rows.Scan(&orderID, &l.ID, &l.VarianceID, &l.Quantity, &l.UnitPrice, &l.LineTotal, &l.MovementID); err != nil {
+			return err
+		}
+		byOrder[orderID] = append(byOrder[orderID], l)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for i := range orders {
+		orders[i].Lines = append([]OrderLine{}, byOrder[orders[i].ID]...)
+		for j := range orders[i].Lines {
+			orders[i].Lines[j].UnitPrice.Currency = orders[i].Currency
+			orders[i].Lines[j].LineTotal.Currency = orders[i].Currency
+		}
+	}
+	return nil
+}
+
+func (s *postgresStore) CreateOrder(ctx context.Context, o Order) (Order, error) {
+	if o.Currency == "" {
+		o.Currency = s.pricing.Currency
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return o, err
+	}
+	defer tx.Rollback()
+
+	// The rate and the prices are read in tx, so the order is priced as of
+	// one moment and the rate can't change before it is written
+	rate, err := s.shareExchangeRate(ctx, tx, o.Currency)
+	if errors.Is(err, errNotFound) {
+		return o, errUnknownCurrency(o.Currency)
+	}
+	if err != nil {
+		return o, err
+	}
+	o.ExchangeRate = rate.Rate
+
+	err = tx.QueryRowContext(ctx, `
+		SELECT id FROM locations WHERE CASE WHEN $1 = 0 THEN code = $2 ELSE id = $1 END
+	`, o.LocationID, defaultLocationCode).Scan(&o.LocationID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return o, errUnknownLocation(o.LocationID)
+	}
+	if err != nil {
+		return o, err
+	}
+	for i := range o.Lines {
+		line := &o.Lines[i]
+		res, err := s.resolvePrice(ctx, tx, PriceQuery{VarianceID: line.VarianceID, Customer: o.Customer,
+			Quantity: line.Quantity, At: timeValue(o.CreatedAt)})
+		if errors.Is(err, errNotFound) {
+			return o, errUnknownVariance(line.VarianceID)
+		}
+		if err != nil {
+			return o, err
+		}
+		o.PriceList = res.PriceList
+		line.price(rate.price(res.UnitPrice, s.pricing.Rounding))
+	}
+	if o.Total, err = o.total(); err != nil {
+		return o, err
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO orders (status, location_id, customer, reference, notes, total, currency, exchange_rate, price_list,
+			created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id
+	`, o.Status, o.LocationID, o.Customer, o.Reference, o.Notes, o.Total, o.Currency, o.ExchangeRate, o.PriceList,
+		o.CreatedBy, o.CreatedAt, o.UpdatedAt).Scan(&o.ID)
+	if err != nil {
+		return o, err
+	}
+	for _, l := range o.Lines {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO order_lines (order_id, variance_id, quantity, unit_price, line_total)
+			VALUES ($1, $2, $3, $4, $5)
+		`, o.ID, l.VarianceID, l.Quantity, l.UnitPrice, l.LineTotal)
+		if err != nil {
+			return o, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return o, err
+	}
+	return s.GetOrder(ctx, o.ID)
+}
+
+// lockOrder reads an order and its lines, locking the order for the rest of
+// tx.
+func lockOrder(ctx context.Context, tx *sql.Tx, id int) (Order, error) {
+	o, err := scanOrder(tx.QueryRowContext(ctx, `SELECT `+orderColumns+`FROM orders WHERE id = $1 FOR UPDATE`, id))
+	if err != nil {
+		return o, notFound(err)
+	}
+	orders := []Order{o}
+	err = loadOrderLines(ctx, tx, orders)
+	return orders[0], err
+}
+
+func (s *postgresStore) GetOrder(ctx context.Context, id int) (Order, error) {
+	o, err := scanOrder(s.db.QueryRowContext(ctx, `SELECT `+orderColumns+`FROM orders WHERE id = $1`, id))
+	if err != nil {
+		return o, notFound(err)
+	}
+	orders := []Order{o}
+	err = loadOrderLines(ctx, s.db, orders)
+	return orders[0], err
+}
+
+func (s *postgresStore) ListOrders(ctx context.Context, f OrderFilter, opts ListOptions) (Page[Order], error) {
+	var page Page[Order]
+	var conds []string
+	var args []any
+	filter := func(column string, value any) {
+		args = append(args, value)
+		conds = append(conds, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+	if f.Status != "" {
+		filter("status", f.Status)
+	}
+	if f.Customer != "" {
+		filter("customer", f.Customer)
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM orders`+where, args...).Scan(&page.Total); err != nil {
+		return page, err
+	}
+
+	spec := opts.Sort.or(newestFirst).withTieBreak()
+	after, afterArgs, err := keyset(opts.After, spec, orderSortFields, len(args)+1)
+	if err != nil {
+		return page, err
+	}
+	if after != "" {
+		conds = append(conds, after)
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+	query := `SELECT ` + orderColumns + `FROM orders` + where + spec.orderBy(orderSortFields) + limitClause(opts.Limit)
+	rows, err := s.db.QueryContext(ctx, query, append(args, afterArgs...)...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	var orders []Order
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			return page, err
+		}
+		orders = append(orders, o)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+	if err := loadOrderLines(ctx, s.db, orders); err != nil {
+		return page, err
+	}
+	return pageOf(orders, page.Total, opts.Limit, spec, orderSortKey), nil
+}
+
+func (s *postgresStore) SetOrderStatus(ctx context.Context, id int, status string, now time.Time) (Order, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Order{}, err
+	}
+	defer tx.Rollback()
+
+	o, err := lockOrder(ctx, tx, id)
+	if err != nil {
+		return o, err
+	}
+	if err := checkOrderTransition(o, status); err != nil {
+		return o, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE orders SET status = $2, updated_at = $3 WHERE id = $1`, id, status, now); err != nil {
+		return o, err
+	}
+	if err := tx.Commit(); err != nil {
+		return o, err
+	}
+	return s.GetOrder(ctx, id)
+}
+
+func (s *postgresStore) FulfilOrder(ctx context.Context, id int, sale StockMovement) (OrderFulfilment, error) {
+	result := OrderFulfilment{Movements: []StockMovement{}}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	o, err := lockOrder(ctx, tx, id)
+	if err != nil {
+		return result, err
+	}
+	if err := checkOrderTransition(o, orderFulfilled); err != nil {
+		return result, err
+	}
+	for _, l := range o.Lines {
+		mv, err := appendMovement(ctx, tx, o.saleMovement(l, sale))
+		if err != nil {
+			return result, err
+		}
+		result.Movements = append(result.Movements, mv)
+		if _, err := tx.ExecContext(ctx, `UPDATE order_lines SET movement_id = $2 WHERE id = $1`, l.ID, mv.ID); err != nil {
+			return result, err
+		}
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE orders SET status = $2, updated_at = $3 WHERE id = $1`, id, orderFulfilled, sale.CreatedAt)
+	if err != nil {
+		return result, err
+	}
+	if err := tx.Commit(); err != nil {
+		return result, err
+	}
+	result.Order, err = s.GetOrder(ctx, id)
+	return result, err
+}
+
+//? ----------------------------- locations --------------------------------- //
+
+const locationColumns = ` id, code, name, kind, address, created_at `
+
+func scanLocation(row rowScanner) (Location, error) {
+	var l Location
+	err := row.Scan(&l.ID, &l.Code, &l.Name, &l.Kind, &l.Address, &l.CreatedAt)
+	return l, err
+}
+
+func (s *postgresStore) UpsertLocation(ctx context.Context, l Location) (Location, error) {
+	query := `
+		INSERT INTO locations (code, name, kind, address, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (code)
+		DO UPDATE SET
+			name = EXCLUDED.name,
+			kind = EXCLUDED.kind,
+			address = EXCLUDED.address
+		RETURNING ` + locationColumns
+
+	return scanLocation(s.db.QueryRowContext(ctx, query, l.Code, l.Name, l.Kind, l.Address, l.CreatedAt))
+}
+
+func (s *postgresStore) ListLocations(ctx context.Context, opts ListOptions) (Page[Location], error) {
+	var page Page[Location]
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM locations`).Scan(&page.Total); err != nil {
+		return page, err
+	}
+
+	spec := opts.Sort.or(byName).withTieBreak()
+	after, args, err := keyset(opts.After, spec, locationSortFields, 1)
+	if err != nil {
+		return page, err
+	}
+	query := `SELECT ` + locationColumns + `
+		FROM locations`
+	if after != "" {
+		query += " WHERE " + after
+	}
+	rows, err := s.db.QueryContext(ctx, query+spec.orderBy(locationSortFields)+limitClause(opts.Limit), args...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	var locations []Location
+	for rows.Next() {
+		l, err := scanLocation(rows)
+		if err != nil {
+			return page, err
+		}
+		locations = append(locations, l)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+	return pageOf(locations, page.Total, opts.Limit, spec, locationSortKey), nil
+}
+
+//? --------------------------- exchange rates ------------------------------- //
+
+const exchangeRateColumns = `currency, rate, updated_by, updated_at `
+
+func scanExchangeRate(row rowScanner) (ExchangeRate, error) {
+	var r ExchangeRate
+	err := row.Scan(&r.Currency, &r.Rate, &r.UpdatedBy, &r.UpdatedAt)
+	return r, err
+}
+
+func (s *postgresStore) UpsertExchangeRates(ctx context.Context, rates []ExchangeRate) ([]ExchangeRate, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	saved := make([]ExchangeRate, 0, len(rates))
+	for _, r := range rates {
+		r, err := scanExchangeRate(tx.QueryRowContext(ctx, `
+			INSERT INTO exchange_rates (currency, rate, updated_by, updated_at)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (currency)
+			DO UPDATE SET
+				rate = EXCLUDED.rate,
+				updated_by = EXCLUDED.updated_by,
+				updated_at = EXCLUDED.updated_at
+			RETURNING `+exchangeRateColumns, r.Currency, r.Rate, r.UpdatedBy, r.UpdatedAt))
+		if err != nil {
+			return nil, err
+		}
+		saved = append(saved, r)
+	}
+	return saved, tx.Commit()
+}
+
+func (s *postgresStore) ListExchangeRates(ctx context.Context) ([]ExchangeRate, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+exchangeRateColumns+`FROM exchange_rates ORDER BY currency`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []ExchangeRate{}
+	for rows.Next() {
+		r, err := scanExchangeRate(rows)
+		if err != nil {
+			return nil, err
+		}
+		rates = append(rates, r)
+	}
+	return rates, rows.Err()
+}
+
+func (s *postgresStore) ExchangeRate(ctx context.Context, currency string) (ExchangeRate, error) {
+	if currency == s.pricing.Currency {
+		return baseRate(currency), nil
+	}
+	r, err := scanExchangeRate(s.db.QueryRowContext(ctx, `SELECT `+exchangeRateColumns+`FROM exchange_rates WHERE currency = $1`, currency))
+	return r, notFound(err)
+}
+
+// shareExchangeRate reads the rate of currency as part of tx, keeping it from
+// changing until tx ends.
+func (s *postgresStore) shareExchangeRate(ctx context.Context, tx *sql.Tx, currency string) (ExchangeRate, error) {
+	if currency == s.pricing.Currency {
+		return baseRate(currency), nil
+	}
+	r, err := scanExchangeRate(tx.QueryRowContext(ctx, `
+		SELECT `+exchangeRateColumns+`FROM exchange_rates WHERE currency = $1 FOR SHARE
+	`, currency))
+	return r, notFound(err)
+}
+
+//? ----------------------------- price lists -------------------------------- //
+
+const priceListColumns = ` id, code, name, description, base_price, created_at `
+
+func scanPriceList(row rowScanner) (PriceList, error) {
+	var l PriceList
+	err := row.Scan(&l.ID, &l.Code, &l.Name, &l.Description, &l.BasePrice, &l.CreatedAt)
+	return l, err
+}
+
+const listPriceColumns = ` id, price_list_id, variance_id, min_quantity, price, valid_from, valid_to, updated_by, updated_at `
+
+func (s *postgresStore) scanListPrice(row rowScanner) (ListPrice, error) {
+	var p ListPrice
+	err := row.Scan(&p.ID, &p.PriceListID, &p.VarianceID, &p.MinQuantity, &p.Price,
+		&p.ValidFrom, &p.ValidTo, &p.UpdatedBy, &p.UpdatedAt)
+	p.Price.Currency, p.Currency = s.pricing.Currency, s.pricing.Currency
+	return p, err
+}
+
+func (s *postgresStore) UpsertPriceList(ctx context.Context, l PriceList) (PriceList, error) {
+	query := `
+		INSERT INTO price_lists (code, name, description, base_price, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (code)
+		DO UPDATE SET
+			name = EXCLUDED.name,
+			description = EXCLUDED.description,
+			base_price = EXCLUDED.base_price
+		RETURNING ` + priceListColumns
+
+	return scanPriceList(s.db.QueryRowContext(ctx, query, l.Code, l.Name, l.Description, l.BasePrice, l.CreatedAt))
+}
+
+func (s *postgresStore) ListPriceLists(ctx context.Context) ([]PriceList, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+priceListColumns+`FROM price_lists ORDER BY code`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []PriceList{}
+	for rows.Next() {
+		l, err := scanPriceList(rows)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, l)
+	}
+	return lists, rows.Err()
+}
+
+// priceListID returns the id of the list with code, or errNotFound.
+func priceListID(ctx context.Context, q queryer, code string) (int, error) {
+	var id int
+	err := q.QueryRowContext(ctx, `SELECT id FROM price_lists WHERE code = $1`, code).Scan(&id)
+	return id, notFound(err)
+}
+
+// listPrices returns the tiers of a list for a variance, or for every
+// variance when varianceID is 0, in sortTiers order.
+func (s *postgresStore) listPrices(ctx context.Context, q queryer, listID, varianceID int) ([]ListPrice, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT `+listPriceColumns+`
+		FROM list_prices
+		WHERE price_list_id = $1 AND ($2 = 0 OR variance_id = $2)
+		ORDER BY variance_id, min_quantity, valid_from NULLS FIRST, id
+	`, listID, varianceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tiers := []ListPrice{}
+	for rows.Next() {
+		p, err := s.scanListPrice(rows)
+		if err != nil {
+			return nil, err
+		}
+		tiers = append(tiers, p)
+	}
+	return tiers, rows.Err()
+}
+
+func (s *postgresStore) ListPrices(ctx context.Context, code string, varianceID int) ([]ListPrice, error) {
+	id, err := priceListID(ctx, s.db, code)
+	if err != nil {
+		return nil, err
+	}
+	return s.listPrices(ctx, s.db, id, varianceID)
+}
+
+func (s *postgresStore) SetListPrices(ctx context.Context, code string, varianceID int, tiers []ListPrice) ([]ListPrice, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	id, err := priceListID(ctx, tx, code)
+	if err != nil {
+		return nil, err
+	}
+	var exists bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM products_variances WHERE id = $1)`, varianceID).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errUnknownVariance(varianceID)
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM list_prices WHERE price_list_id = $1 AND variance_id = $2`, id, varianceID)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range tiers {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO list_prices (price_list_id, variance_id, min_quantity, price, valid_from, valid_to, updated_by, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`, id, varianceID, p.MinQuantity, p.Price.price(s.pricing.Currency), p.ValidFrom, p.ValidTo, p.UpdatedBy, p.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	saved, err := s.listPrices(ctx, tx, id, varianceID)
+	if err != nil {
+		return nil, err
+	}
+	return saved, tx.Commit()
+}
+
+func (s *postgresStore) AssignPriceList(ctx context.Context, a CustomerPriceList) (CustomerPriceList, error) {
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO customer_price_lists (customer, price_list_id, updated_by, updated_at)
+		SELECT $1, id, $3, $4 FROM price_lists WHERE code = $2
+		ON CONFLICT (customer)
+		DO UPDATE SET
+			price_list_id = EXCLUDED.price_list_id,
+			updated_by = EXCLUDED.updated_by,
+			updated_at = EXCLUDED.updated_at
+		RETURNING customer
+	`, a.Customer, a.PriceList, a.UpdatedBy, a.UpdatedAt).Scan(&a.Customer)
+	if errors.Is(err, sql.ErrNoRows) {
+		return a, errUnknownPriceList(a.PriceList)
+	}
+	return a, err
+}
+
+func (s *postgresStore) CustomerPriceList(ctx context.Context, customer string) (CustomerPriceList, error) {
+	var a CustomerPriceList
+	err := s.db.QueryRowContext(ctx, `
+		SELECT c.customer, pl.code, c.updated_by, c.updated_at
+		FROM customer_price_lists c
+		JOIN price_lists pl ON pl.id = c.price_list_id
+		WHERE c.customer = $1
+	`, customer).Scan(&a.Customer, &a.PriceList, &a.UpdatedBy, &a.UpdatedAt)
+	return a, notFound(err)
+}
+
+func (s *postgresStore) UnassignPriceList(ctx context.Context, customer string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM customer_price_lists WHERE customer = $1`, customer)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+// resolvePrice is ResolvePrice, run on q so orders can price their lines
+// in their own transaction.
+func (s *postgresStore) resolvePrice(ctx context.Context, q queryer, query PriceQuery) (PriceResolution, error) {
+	v, err := s.scanVariance(q.QueryRowContext(ctx, `SELECT `+varianceColumns+`FROM products_variances WHERE id = $1`, query.VarianceID))
+	if err != nil {
+		return PriceResolution{}, notFound(err)
+	}
+
+	// The list named by the query, else the customer's, else retail
+	code := query.PriceList
+	if code == "" {
+		code = defaultPriceListCode
+	}
+	l, err := scanPriceList(q.QueryRowContext(ctx, `
+		SELECT `+priceListColumns+`
+		FROM price_lists
+		WHERE id = COALESCE(
+			(SELECT price_list_id FROM customer_price_lists WHERE customer = $1 AND $2 = ''),
+			(SELECT id FROM price_lists WHERE code = $3))
+	`, query.Customer, query.PriceList, code))
+	if errors.Is(err, sql.ErrNoRows) {
+		return PriceResolution{}, errUnknownPriceList(code)
+	}
+	if err != nil {
+		return PriceResolution{}, err
+	}
+
+	tiers, err := s.listPrices(ctx, q, l.ID, v.ID)
+	if err != nil {
+		return PriceResolution{}, err
+	}
+	return resolvePrice(query, v, l, tiers), nil
+}
+
+func (s *postgresStore) ResolvePrice(ctx context.Context, q PriceQuery) (PriceResolution, error) {
+	return s.resolvePrice(ctx, s.db, q)
+}
+
+//? ---------------------------- price history ------------------------------- //
+
+const priceHistoryColumns = `
+			id, variance_id, field, old_price, new_price, source, reference, changed_by, changed_at `
+
+func (s *postgresStore) scanPriceHistory(row rowScanner) (PriceHistory, error) {
+	var h PriceHistory
+	err := row.Scan(&h.ID, &h.VarianceID, &h.Field, &h.From, &h.To, &h.Source, &h.Reference, &h.ChangedBy, &h.ChangedAt)
+	h.From, h.To = h.From.price(s.pricing.Currency), h.To.price(s.pricing.Currency)
+	h.Currency = s.pricing.Currency
+	return h, err
+}
+
+// recordPrices inserts rows into the price history as part of tx.
+func recordPrices(ctx context.Context, tx *sql.Tx, rows []PriceHistory) error {
+	for _, h := range rows {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO price_history (variance_id, field, old_price, new_price, source, reference, changed_by, changed_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, COALESCE($8, now()))
+		`, h.VarianceID, h.Field, h.From, h.To, h.Source, h.Reference, h.ChangedBy, h.ChangedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *postgresStore) ListPriceHistory(ctx context.Context, f PriceHistoryFilter, opts ListOptions) (Page[PriceHistory], error) {
+	var page Page[PriceHistory]
+	var conds []string
+	var args []any
+	filter := func(cond string, value any) {
+		args = append(args, value)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if f.VarianceID != 0 {
+		filter("variance_id = $%d", f.VarianceID)
+	}
+	if f.Field != "" {
+		filter("field = $%d", f.Field)
+	}
+	if f.Source != "" {
+		filter("source = $%d", f.Source)
+	}
+	if f.Since != nil {
+		filter("changed_at >= $%d", *f.Since)
+	}
+	if f.Until != nil {
+		filter("changed_at < $%d", *f.Until)
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM price_history`+where, args...).Scan(&page.Total); err != nil {
+		return page, err
+	}
+
+	spec := opts.Sort.or(newestFirst).withTieBreak()
+	after, afterArgs, err := keyset(opts.After, spec, priceHistorySortFields, len(args)+1)
+	if err != nil {
+		return page, err
+	}
+	if after != "" {
+		conds = append(conds, after)
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+	query := `SELECT ` + priceHistoryColumns + `FROM price_history` + where + spec.orderBy(priceHistorySortFields) + limitClause(opts.Limit)
+	rows, err := s.db.QueryContext(ctx, query, append(args, afterArgs...)...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	var history []PriceHistory
+	for rows.Next() {
+		h, err := s.scanPriceHistory(rows)
+		if err != nil {
+			return page, err
+		}
+		history = append(history, h)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+	return pageOf(history, page.Total, opts.Limit, spec, priceHistorySortKey), nil
+}
+
+func (s *postgresStore) PricesAt(ctx context.Context, varianceID int, at time.Time) (VariancePrices, error) {
+	v, err := s.scanVariance(s.db.QueryRowContext(ctx, `SELECT `+varianceColumns+`FROM products_variances WHERE id = $1`, varianceID))
+	if err != nil {
+		return VariancePrices{}, notFound(err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+priceHistoryColumns+`
+		FROM price_history
+		WHERE variance_id = $1 AND changed_at > $2
+		ORDER BY id
+	`, varianceID, at)
+	if err != nil {
+		return VariancePrices{}, err
+	}
+	defer rows.Close()
+
+	var later []PriceHistory
+	for rows.Next() {
+		h, err := s.scanPriceHistory(rows)
+		if err != nil {
+			return VariancePrices{}, err
+		}
+		later = append(later, h)
+	}
+	if err := rows.Err(); err != nil {
+		return VariancePrices{}, err
+	}
+	return pricesAt(v, at, later), nil
+}
+
+const scheduledPriceColumns = `
+			id, variance_id, original_price, retail_price, wholesale_price, effective_at, reference, status,
+			failure, created_by, created_at, updated_at `
+
+func (s *postgresStore) scanScheduledPrice(row rowScanner) (ScheduledPrice, error) {
+	var sp ScheduledPrice
+	err := row.Scan(&sp.ID, &sp.VarianceID, &sp.OriginalPrice, &sp.RetailPrice, &sp.WholesalePrice, &sp.EffectiveAt,
+		&sp.Reference, &sp.Status, &sp.Failure, &sp.CreatedBy, &sp.CreatedAt, &sp.UpdatedAt)
+	sp.priced(s.pricing.Currency)
+	return sp, err
+}
+
+func (s *postgresStore) SchedulePrice(ctx context.Context, sp ScheduledPrice) (ScheduledPrice, error) {
+	result, err := s.scanScheduledPrice(s.db.QueryRowContext(ctx, `
+		INSERT INTO scheduled_prices (
+			variance_id, original_price, retail_price, wholesale_price, effective_at, reference, status,
+			created_by, created_at, updated_at
+		)
+		SELECT id, $2, $3, $4, $5, $6, $7, $8, $9, $10 FROM products_variances WHERE id = $1
+		RETURNING `+scheduledPriceColumns,
+		sp.VarianceID, sp.OriginalPrice, sp.RetailPrice, sp.WholesalePrice, sp.EffectiveAt, sp.Reference, sp.Status,
+		sp.CreatedBy, sp.CreatedAt, sp.UpdatedAt))
+	if errors.Is(err, sql.ErrNoRows) {
+		return sp, errUnknownVariance(sp.VarianceID)
+	}
+	return result, err
+}
+
+func (s *postgresStore) ListScheduledPrices(ctx context.Context, f ScheduledPriceFilter, opts ListOptions) (Page[ScheduledPrice], error) {
+	var page Page[ScheduledPrice]
+	var conds []string
+	var args []any
+	filter := func(column string, value any) {
+		args = append(args, value)
+		conds = append(conds, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+	if f.VarianceID != 0 {
+		filter("variance_id", f.VarianceID)
+	}
+	if f.Status != "" {
+		filter("status", f.Status)
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM scheduled_prices`+where, args...).Scan(&page.Total); err != nil {
+		return page, err
+	}
+
+	spec := opts.Sort.or(newestFirst).withTieBreak()
+	after, afterArgs, err := keyset(opts.After, spec, scheduledPriceSortFields, len(args)+1)
+	if err != nil {
+		return page, err
+	}
+	if after != "" {
+		conds = append(conds, after)
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+	query := `SELECT ` + scheduledPriceColumns + `FROM scheduled_prices` + where + spec.orderBy(scheduledPriceSortFields) + limitClause(opts.Limit)
+	rows, err := s.db.QueryContext(ctx, query, append(args, afterArgs...)...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	var changes []ScheduledPrice
+	for rows.Next() {
+		sp, err := s.scanScheduledPrice(rows)
+		if err != nil {
+			return page, err
+		}
+		changes = append(changes, sp)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+	return pageOf(changes, page.Total, opts.Limit, spec, scheduledPriceSortKey), nil
+}
+
+func (s *postgresStore) CancelScheduledPrice(ctx context.Context, id int, now time.Time) (ScheduledPrice, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return ScheduledPrice{}, err
+	}
+	defer tx.Rollback()
+
+	sp, err := s.scanScheduledPrice(tx.QueryRowContext(ctx, `
+		SELECT `+scheduledPriceColumns+`FROM scheduled_prices WHERE id = $1 FOR UPDATE
+	`, id))
+	if err != nil {
+		return sp, notFound(err)
+	}
+	if sp.Status != schedulePending {
+		return sp, errScheduleTransition(sp)
+	}
+	sp, err = s.scanScheduledPrice(tx.QueryRowContext(ctx, `
+		UPDATE scheduled_prices SET status = $2, updated_at = $3 WHERE id = $1
+		RETURNING `+scheduledPriceColumns, id, scheduleCancelled, now))
+	if err != nil {
+		return sp, err
+	}
+	return sp, tx.Commit()
+}
+
+func (s *postgresStore) ApplyScheduledPrices(ctx context.Context, now time.Time) (int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id FROM scheduled_prices WHERE status = $1 AND effective_at <= $2 ORDER BY effective_at, id
+	`, schedulePending, now)
+	if err != nil {
+		return 0, err
+	}
+	var due []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	// Each change commits on its own, so one that errors is logged and left
+	// pending for the next run without holding up the rest
+	applied, failed := 0, 0
+	for _, id := range due {
+		ok, err := s.applyScheduledPrice(ctx, id, now)
+		if ctx.Err() != nil {
+			return applied, ctx.Err()
+		}
+		if err != nil {
+			log.Printf("🔴 scheduled price %d could not be applied: %v", id, err)
+			failed++
+			continue
+		}
+		if ok {
+			applied++
+		}
+	}
+	if failed > 0 {
+		return applied, fmt.Errorf("%d of %d due scheduled price change(s) could not be applied", failed, len(due))
+	}
+	return applied, nil
+}
+
+// applyScheduledPrice applies the change with id in a transaction of its own
+// and reports whether it did. A change that is no longer pending, or that
+// another instance is applying (SKIP LOCKED), is left alone.
+func (s *postgresStore) applyScheduledPrice(ctx context.Context, id int, now time.Time) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	sp, err := s.scanScheduledPrice(tx.QueryRowContext(ctx, `
+		SELECT `+scheduledPriceColumns+`FROM scheduled_prices WHERE id = $1 AND status = $2 FOR UPDATE SKIP LOCKED
+	`, id, schedulePending))
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	v, err := s.scanVariance(tx.QueryRowContext(ctx, `
+		SELECT `+varianceColumns+`FROM products_variances WHERE id = $1 FOR UPDATE
+	`, sp.VarianceID))
+	if err != nil {
+		return false, err
+	}
+	updated, failure := sp.applyTo(v)
+	if failure != nil {
+		_, err := tx.ExecContext(ctx, `UPDATE scheduled_prices SET status = $2, failure = $3, updated_at = $4 WHERE id = $1`,
+			sp.ID, scheduleFailed, failure.Error(), now)
+		if err != nil {
+			return false, err
+		}
+		return false, tx.Commit()
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE products_variances
+		SET original_price = $2, retail_price = $3, wholesale_price = $4, last_modified_at = $5
+		WHERE id = $1
+	`, v.ID, updated.OriginalPrice, updated.RetailPrice, updated.WholesalePrice, now)
+	if err != nil {
+		return false, err
+	}
+	if err := recordPrices(ctx, tx, sp.history(now).changes(v, updated)); err != nil {
+		return false, err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE scheduled_prices SET status = $2, updated_at = $3 WHERE id = $1`,
+		sp.ID, scheduleApplied, now)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
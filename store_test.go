@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testStores returns the stores a store test runs against: the in-memory
+// store, and Postgres, migrated up, when DATABASE_URL is set.
+func testStores(t *testing.T) map[string]Stores {
+	t.Helper()
+	pricing := defaultConfig().Pricing
+	stores := map[string]Stores{"memory": newMemoryStore(pricing).stores()}
+
+	url := os.Getenv("DATABASE_URL")
+	if url == "" {
+		return stores
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("opening %s: %v", url, err)
+	}
+	t.Cleanup(func() { db.Close() })
+	m, err := newMigrator(db, pricing.Currency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.up(context.Background(), 0); err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+	stores["postgres"] = newPostgresStore(db, pricing).stores()
+	return stores
+}
+
+var testProductSeq atomic.Int64
+
+// testVarianceWithStock adds a product of its own with one variance holding
+// onHand at the main building. Names are unique, so Postgres tests can share
+// a database.
+func testVarianceWithStock(t *testing.T, stores Stores, onHand float64) Variance {
+	t.Helper()
+	ctx := context.Background()
+	id := fmt.Sprintf("test-%d-%d", time.Now().UnixNano(), testProductSeq.Add(1))
+	now := time.Now()
+	p := Product{ID: id, Title: "Test product " + id, Department: "mainBuilding", MainCategory: "sand", CreatedAt: &now, LastModifiedAt: &now}
+	if err := stores.Products.InsertProduct(ctx, p); err != nil {
+		t.Fatalf("inserting product: %v", err)
+	}
+
+	v := Variance{ProductName: p.Title, ProductID: id, VarianceTitle: "1 cube", Brand: "Test",
+		RetailPrice: Money{Amount: newDecimal(700, 0)}, CreatedAt: &now, LastModifiedAt: &now}
+	count := &StockCount{Quantity: onHand, Movement: StockMovement{Reason: reasonCount, Reference: "test", CreatedAt: &now}}
+	v, _, err := stores.Variances.UpsertVariance(ctx, v, PriceHistory{}, count)
+	if err != nil {
+		t.Fatalf("upserting variance: %v", err)
+	}
+	return v
+}
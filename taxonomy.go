@@ -0,0 +1,105 @@
+package main
+
+//! ============================================================================ //
+//? ========================= 🗂️ CATALOG TAXONOMY 🗂️ =========================== //
+//! ============================================================================ //
+
+// catalogCategory is one main_catogory together with the department that
+// stocks it, its sub categories and what a typical variance looks like.
+type catalogCategory struct {
+	Name       string
+	Department string
+	Subs       []string
+	Units      []string
+	Variants   []string
+	// MinPrice/MaxPrice bound the wholesale price of the cheapest variant.
+	MinPrice float64
+	MaxPrice float64
+}
+
+// catalogDepartments are the valid department values; mainBuilding is the
+// default the queries fall back to.
+var catalogDepartments = []string{"mainBuilding", "yard", "hardwareStore", "paintStore"}
+
+var catalogCategories = []catalogCategory{
+	{
+		Name: "sand", Department: "yard",
+		Subs:     []string{"river sand", "sea sand", "filling sand", "plaster sand"},
+		Units:    []string{"cube", "bag"},
+		Variants: []string{"25kg bag", "50kg bag", "half cube", "1 cube"},
+		MinPrice: 450, MaxPrice: 900,
+	},
+	{
+		Name: "cement", Department: "mainBuilding",
+		Subs:     []string{"ordinary portland", "rapid hardening", "white cement", "tile adhesive"},
+		Units:    []string{"bag"},
+		Variants: []string{"25kg bag", "50kg bag"},
+		MinPrice: 1400, MaxPrice: 2600,
+	},
+	{
+		Name: "bricks", Department: "yard",
+		Subs:     []string{"clay brick", "cement block", "interlock", "hollow block"},
+		Units:    []string{"piece", "pallet"},
+		Variants: []string{"single", "100 pack", "pallet"},
+		MinPrice: 18, MaxPrice: 95,
+	},
+	{
+		Name: "steel", Department: "yard",
+		Subs:     []string{"tor steel", "mild steel", "binding wire", "mesh"},
+		Units:    []string{"length", "kg", "roll"},
+		Variants: []string{"6mm", "10mm", "12mm", "16mm"},
+		MinPrice: 650, MaxPrice: 3800,
+	},
+	{
+		Name: "timber", Department: "yard",
+		Subs:     []string{"rafters", "planks", "plywood", "door frames"},
+		Units:    []string{"ft", "sheet", "piece"},
+		Variants: []string{"2x2", "2x4", "4x8 sheet", "6ft"},
+		MinPrice: 300, MaxPrice: 6500,
+	},
+	{
+		Name: "roofing", Department: "mainBuilding",
+		Subs:     []string{"asbestos free sheets", "zinc alum", "roof tiles", "gutters"},
+		Units:    []string{"sheet", "piece", "ft"},
+		Variants: []string{"6ft", "8ft", "10ft", "12ft"},
+		MinPrice: 900, MaxPrice: 5200,
+	},
+	{
+		Name: "tools", Department: "hardwareStore",
+		Subs:     []string{"hand tools", "power tools", "measuring", "safety gear"},
+		Units:    []string{"piece", "set"},
+		Variants: []string{"standard", "pro", "set of 3", "set of 6"},
+		MinPrice: 250, MaxPrice: 28000,
+	},
+	{
+		Name: "plumbing", Department: "hardwareStore",
+		Subs:     []string{"pvc pipes", "fittings", "taps", "water tanks"},
+		Units:    []string{"length", "piece"},
+		Variants: []string{"1/2 inch", "3/4 inch", "1 inch", "2 inch"},
+		MinPrice: 120, MaxPrice: 9500,
+	},
+	{
+		Name: "electrical", Department: "hardwareStore",
+		Subs:     []string{"cables", "switches", "bulbs", "breakers"},
+		Units:    []string{"roll", "piece", "m"},
+		Variants: []string{"1mm", "1.5mm", "2.5mm", "single", "double"},
+		MinPrice: 90, MaxPrice: 14500,
+	},
+	{
+		Name: "paint", Department: "paintStore",
+		Subs:     []string{"emulsion", "enamel", "primer", "wood finish"},
+		Units:    []string{"l"},
+		Variants: []string{"1L", "4L", "10L", "18L"},
+		MinPrice: 950, MaxPrice: 4200,
+	},
+}
+
+// categoryByName looks up a main category; ok is false for unknown names.
+func categoryByName(name string) (catalogCategory, bool) {
+	for _, c := range catalogCategories {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return catalogCategory{}, false
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+//! ============================================================================ //
+//? ========================= ✅ INPUT VALIDATION ✅ =========================== //
+//! ============================================================================ //
+
+// Validation rules live in the `binding` tags on the models. On top of the
+// validator/v10 built-ins this registers:
+//
+//	department    one of catalogDepartments
+//	main_category a main_catogory from catalogCategories
+//	sub_category  a sub_catogory of any category, or "N/A"
+//	gtin          EAN-8, UPC-A, EAN-13 or GTIN-14 with a valid check digit
+//	phone         7-15 digits, optionally with +, spaces, dashes, parentheses
+//	url_list      comma separated http(s) URLs
+//
+// plus struct-level rules relating fields to each other (see
+// validateVariance, validateProduct, validateMovement and validateTransfer).
+
+var registerValidatorsOnce sync.Once
+
+var phonePattern = regexp.MustCompile(`^\+?[0-9 ()\-]+$`)
+
+func registerValidators() {
+	registerValidatorsOnce.Do(func() {
+		v, ok := binding.Validator.Engine().(*validator.Validate)
+		if !ok {
+			panic("gin binding validator is not validator/v10")
+		}
+
+		// Report fields by their JSON names so clients can map errors back.
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" || name == "" {
+				return f.Name
+			}
+			return name
+		})
+
+		must := func(err error) {
+			if err != nil {
+				panic(err)
+			}
+		}
+		must(v.RegisterValidation("department", func(fl validator.FieldLevel) bool {
+			return contains(catalogDepartments, fl.Field().String())
+		}))
+		must(v.RegisterValidation("main_category", func(fl validator.FieldLevel) bool {
+			_, ok := categoryByName(fl.Field().String())
+			return ok
+		}))
+		must(v.RegisterValidation("sub_category", func(fl validator.FieldLevel) bool {
+			sub := fl.Field().String()
+			if sub == "N/A" {
+				return true
+			}
+			for _, c := range catalogCategories {
+				if contains(c.Subs, sub) {
+					return true
+				}
+			}
+			return false
+		}))
+		must(v.RegisterValidation("gtin", func(fl validator.FieldLevel) bool {
+			return validGTIN(fl.Field().String())
+		}))
+		must(v.RegisterValidation("phone", func(fl validator.FieldLevel) bool {
+			return validPhone(fl.Field().String())
+		}))
+		must(v.RegisterValidation("url_list", func(fl validator.FieldLevel) bool {
+			for _, link := range strings.Split(fl.Field().String(), ",") {
+				if !validHTTPURL(strings.TrimSpace(link)) {
+					return false
+				}
+			}
+			return true
+		}))
+
+		must(v.RegisterValidation("currency", func(fl validator.FieldLevel) bool {
+			return validCurrency(fl.Field().String())
+		}))
+
+		// Money and Decimal validate as the float nearest their amount, so
+		// gte=0 and the like work on prices and rates.
+		v.RegisterCustomTypeFunc(func(field reflect.Value) any {
+			switch d := field.Interface().(type) {
+			case Money:
+				return d.Amount.Float64()
+			case Decimal:
+				return d.Float64()
+			}
+			return nil
+		}, Money{}, Decimal{})
+
+		v.RegisterStructValidation(validateProduct, Product{})
+		v.RegisterStructValidation(validateVariance, Variance{})
+		v.RegisterStructValidation(validateMovement, StockMovement{})
+		v.RegisterStructValidation(validateTransfer, StockTransfer{})
+	})
+}
+
+func contains(values []string, v string) bool {
+	for _, candidate := range values {
+		if candidate == v {
+			return true
+		}
+	}
+	return false
+}
+
+// validGTIN accepts the GS1 lengths and checks the final check digit.
+func validGTIN(code string) bool {
+	switch len(code) {
+	case 8, 12, 13, 14:
+	default:
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	body, check := code[:len(code)-1], int(code[len(code)-1]-'0')
+	return gtinCheckDigit(body) == check
+}
+
+func validPhone(phone string) bool {
+	if !phonePattern.MatchString(phone) {
+		return false
+	}
+	digits := 0
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+	return digits >= 7 && digits <= 15
+}
+
+func validHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// validateProduct checks that a sub category belongs to the main category.
+func validateProduct(sl validator.StructLevel) {
+	p := sl.Current().Interface().(Product)
+	if p.SubCategory == "" || p.SubCategory == "N/A" {
+		return
+	}
+	if category, ok := categoryByName(p.MainCategory); ok && !contains(category.Subs, p.SubCategory) {
+		sl.ReportError(p.SubCategory, "sub_catogory", "SubCategory", "sub_category_of", p.MainCategory)
+	}
+}
+
+// validateVariance checks the price relationships: retail is never below
+// wholesale, and nothing is sold at retail below what it cost.
+func validateVariance(sl validator.StructLevel) {
+	v := sl.Current().Interface().(Variance)
+	for _, field := range v.priceConflicts() {
+		sl.ReportError(v.RetailPrice, "retail_price", "RetailPrice", "gtefield", field)
+	}
+}
+
+// priceConflicts names the prices retail_price is below, breaking the rules
+// validateVariance checks. A variance's prices are all in the base currency.
+func (v Variance) priceConflicts() []string {
+	var fields []string
+	if v.WholesalePrice.Sign() > 0 && v.RetailPrice.Amount.Cmp(v.WholesalePrice.Amount) < 0 {
+		fields = append(fields, "wholesale_price")
+	}
+	if v.OriginalPrice.Sign() > 0 && v.RetailPrice.Sign() > 0 && v.RetailPrice.Amount.Cmp(v.OriginalPrice.Amount) < 0 {
+		fields = append(fields, "original_price")
+	}
+	return fields
+}
+
+// FieldError is one entry of a VALIDATION_FAILED response's details.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// fieldErrors converts validator errors into FieldErrors; ok is false when
+// err did not come from the validator.
+func fieldErrors(err error) ([]FieldError, bool) {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return nil, false
+	}
+
+	out := make([]FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		field := fe.Field()
+		out = append(out, FieldError{
+			Field:   field,
+			Rule:    fe.Tag(),
+			Param:   fe.Param(),
+			Message: fieldMessage(field, fe.Tag(), fe.Param()),
+		})
+	}
+	return out, true
+}
+
+func fieldMessage(field, rule, param string) string {
+	switch rule {
+	case "required":
+		return fmt.Sprintf("%s is required", field)
+	case "max":
+		return fmt.Sprintf("%s must be at most %s characters", field, param)
+	case "min":
+		return fmt.Sprintf("%s must have at least %s entries", field, param)
+	case "unique":
+		return fmt.Sprintf("%s must not repeat a %s", field, param)
+	case "gte":
+		return fmt.Sprintf("%s must be %s or more", field, param)
+	case "lte":
+		return fmt.Sprintf("%s must be %s or less", field, param)
+	case "gt":
+		return fmt.Sprintf("%s must be greater than %s", field, param)
+	case "lt":
+		return fmt.Sprintf("%s must be less than %s", field, param)
+	case "ne":
+		return fmt.Sprintf("%s must not be %s", field, param)
+	case "nefield":
+		return fmt.Sprintf("%s must differ from %s", field, param)
+	case "gtefield":
+		return fmt.Sprintf("%s must not be lower than %s", field, param)
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", field, strings.ReplaceAll(param, " ", ", "))
+	case "email":
+		return fmt.Sprintf("%s must be a valid email address", field)
+	case "url", "http_url":
+		return fmt.Sprintf("%s must be a valid http(s) URL", field)
+	case "url_list":
+		return fmt.Sprintf("%s must be a comma separated list of http(s) URLs", field)
+	case "phone":
+		return fmt.Sprintf("%s must be a phone number with 7 to 15 digits", field)
+	case "currency":
+		return fmt.Sprintf("%s must be a three letter ISO 4217 code such as USD", field)
+	case "gtin":
+		return fmt.Sprintf("%s must be an EAN-8, UPC-A, EAN-13 or GTIN-14 with a valid check digit", field)
+	case "department":
+		return fmt.Sprintf("%s must be one of: %s", field, strings.Join(catalogDepartments, ", "))
+	case "main_category":
+		names := make([]string, 0, len(catalogCategories))
+		for _, c := range catalogCategories {
+			names = append(names, c.Name)
+		}
+		return fmt.Sprintf("%s must be one of: %s", field, strings.Join(names, ", "))
+	case "sub_category":
+		return fmt.Sprintf("%s is not a known sub category", field)
+	case "sub_category_of":
+		return fmt.Sprintf("%s is not a sub category of %s", field, param)
+	}
+	return fmt.Sprintf("%s failed the %s rule", field, rule)
+}
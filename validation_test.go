@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestValidGTIN(t *testing.T) {
+	tests := map[string]bool{
+		"4006381333931":  true,
+		"036000291452":   true,
+		"96385074":       true,
+		"10012345678902": true,
+		"4006381333932":  false, // wrong check digit
+		"400638133393":   false, // EAN-13 missing a digit, so it reads as a bad UPC
+		"40063813339":    false,
+		"40063813339a1":  false,
+		"":               false,
+	}
+	for code, want := range tests {
+		if got := validGTIN(code); got != want {
+			t.Errorf("validGTIN(%q) = %v, want %v", code, got, want)
+		}
+	}
+}
+
+func TestValidPhone(t *testing.T) {
+	tests := map[string]bool{
+		"+94 77 123 4567":        true,
+		"(011) 2-345678":         true,
+		"123456":                 false,
+		"+94 77 123 4567 890 12": false,
+		"call me":                false,
+	}
+	for phone, want := range tests {
+		if got := validPhone(phone); got != want {
+			t.Errorf("validPhone(%q) = %v, want %v", phone, got, want)
+		}
+	}
+}
+
+// Each payload breaks one rule and gets a 422 naming the field by its JSON
+// name, with the rule it broke.
+func TestValidationFailures(t *testing.T) {
+	r := newTestAPI(t)
+	product := func(old, new string) string { return strings.Replace(testProduct, old, new, 1) }
+	variance := func(old, new string) string { return strings.Replace(testVariance, old, new, 1) }
+	tests := []struct {
+		name, path, body string
+		field, rule      string
+	}{
+		{"product without title", "/products/insert", product(`"title":"Portland Cement",`, ""), "title", "required"},
+		{"unknown department", "/products/insert", product(`"mainBuilding"`, `"basement"`), "department", "department"},
+		{"unknown main category", "/products/insert", product(`"main_catogory":"cement"`, `"main_catogory":"cheese"`), "main_catogory", "main_category"},
+		{"sub category of another", "/products/insert", product(`"ordinary portland"`, `"river sand"`), "sub_catogory", "sub_category_of"},
+		{"retail below wholesale", "/variance/upsert", variance(`"retail_price":1800`, `"retail_price":1550`), "retail_price", "gtefield"},
+		{"negative price", "/variance/upsert", variance(`"original_price":1500`, `"original_price":-1`), "original_price", "gte"},
+		{"bad barcode", "/variance/upsert", variance(`"quantity":10`, `"barcode":"4006381333932"`), "barcode", "gtin"},
+		{"brand with a bad email", "/brand/upsert", `{"name":"Holcim","contact_email":"holcim"}`, "contact_email", "email"},
+		{"brand with a bad link", "/brand/upsert", `{"name":"Holcim","social_media_links":"https://fb.com/holcim,ftp://x"}`, "social_media_links", "url_list"},
+		{"supplier with a bad phone", "/supplier/upsert", `{"name":"Acme","phone_number":"call me"}`, "phone_number", "phone"},
+		{"supplier with a bad status", "/supplier/upsert", `{"name":"Acme","status":"asleep"}`, "status", "oneof"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, env := serveJSON(t, r, http.MethodPost, tt.path, tt.body)
+			if w.Code != http.StatusUnprocessableEntity || env.Error == nil || env.Error.Code != CodeValidation {
+				t.Fatalf("POST %s = %d %s, want 422 %s", tt.path, w.Code, w.Body.String(), CodeValidation)
+			}
+			var details []FieldError
+			if err := json.Unmarshal(env.Error.Details, &details); err != nil {
+				t.Fatal(err)
+			}
+			for _, d := range details {
+				if d.Field == tt.field && d.Rule == tt.rule && d.Message != "" {
+					return
+				}
+			}
+			t.Errorf("details = %+v, want %s failing %s", details, tt.field, tt.rule)
+		})
+	}
+}